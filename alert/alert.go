@@ -0,0 +1,228 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package alert contains the alerting engine, which evaluates rules on the
+// events of the bus and emits an ALERT event when a rule matches.
+package alert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:alert")
+
+// Category is the category of alert events, to route alerts with a filter.
+const Category = "alert"
+
+// EventType is the type of alert events.
+var EventType = event.Type("ALERT")
+
+// Alert describes a match of a rule.
+type Alert struct {
+	Rule Rule
+
+	// Values are the values of the group by fields of the rule.
+	Values []string
+
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+
+	// EventIDs are the ids of the contributing events, of distinct rules
+	// the id of the last event of each value.
+	EventIDs []string
+
+	// DistinctValues are the values of distinct rules.
+	DistinctValues []string
+}
+
+// Event returns the alert event.
+func (a *Alert) Event() event.Event {
+	options := []event.Option{
+		event.Sensor("alert"),
+		event.Category(Category),
+		EventType,
+		event.Custom("alert.rule", a.Rule.Name),
+		event.Custom("alert.rule-type", a.Rule.Type),
+		event.Custom("alert.severity", a.Rule.Severity),
+		event.Custom("alert.count", a.Count),
+		event.Custom("alert.first-seen", a.FirstSeen),
+		event.Custom("alert.last-seen", a.LastSeen),
+		event.Custom("alert.event-ids", a.EventIDs),
+	}
+
+	if a.Rule.Description != "" {
+		options = append(options, event.Custom("alert.description", a.Rule.Description))
+	}
+
+	if a.Rule.Type == Distinct {
+		options = append(options, event.Custom(fmt.Sprintf("alert.%s", a.Rule.Field), a.DistinctValues))
+	}
+
+	// the group by fields, eg. source-ip
+	for i, field := range a.Rule.GroupBy {
+		options = append(options, event.Custom(field, a.Values[i]))
+	}
+
+	return event.New(options...)
+}
+
+// Engine is a channel evaluating the rules on the events it receives,
+// sending the alert events to the configured channel.
+type Engine struct {
+	Rules []Rule
+
+	channel pushers.Channel
+
+	m     sync.Mutex
+	rules []*rule
+
+	alerts chan event.Event
+}
+
+// New returns an alerting engine.
+func New(options ...func(*Engine) error) (*Engine, error) {
+	en := &Engine{
+		channel: pushers.MustDummy(),
+		alerts:  make(chan event.Event, 100),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(en); err != nil {
+			return nil, err
+		}
+	}
+
+	names := map[string]bool{}
+
+	for _, r := range en.Rules {
+		ru, err := newRule(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if names[r.Name] {
+			return nil, fmt.Errorf("rule %s: duplicate name", r.Name)
+		}
+
+		names[r.Name] = true
+
+		en.rules = append(en.rules, ru)
+	}
+
+	go en.run()
+
+	return en, nil
+}
+
+// WithConfig decodes the rules of the alert sections.
+func WithConfig(rules ...toml.Primitive) func(*Engine) error {
+	return func(en *Engine) error {
+		for _, p := range rules {
+			r := Rule{}
+			if err := toml.PrimitiveDecode(p, &r); err != nil {
+				return err
+			}
+
+			en.Rules = append(en.Rules, r)
+		}
+
+		return nil
+	}
+}
+
+// WithRules adds the rules.
+func WithRules(rules ...Rule) func(*Engine) error {
+	return func(en *Engine) error {
+		en.Rules = append(en.Rules, rules...)
+		return nil
+	}
+}
+
+// WithChannel sets the channel the alert events are sent to.
+func WithChannel(channel pushers.Channel) func(*Engine) error {
+	return func(en *Engine) error {
+		en.channel = channel
+		return nil
+	}
+}
+
+// Len returns the number of rules.
+func (en *Engine) Len() int {
+	return len(en.rules)
+}
+
+// Send evaluates the rules on the event. Alert events are not evaluated.
+func (en *Engine) Send(e event.Event) {
+	if e.Get("category") == Category {
+		return
+	}
+
+	now := time.Now()
+	if date, ok := e.Load("date"); !ok {
+	} else if t, ok := date.(time.Time); ok {
+		now = t
+	}
+
+	en.m.Lock()
+	defer en.m.Unlock()
+
+	for _, r := range en.rules {
+		a := r.eval(e, now)
+		if a == nil {
+			continue
+		}
+
+		log.Infof("Alert %s (%s) matched %d events", r.Name, r.Severity, a.Count)
+
+		// the alerts are sent by run, Send is called by the bus which
+		// the alerts are sent on
+		select {
+		case en.alerts <- a.Event():
+		default:
+			log.Errorf("Dropping alert %s: queue full", r.Name)
+		}
+	}
+}
+
+func (en *Engine) run() {
+	for e := range en.alerts {
+		en.channel.Send(e)
+	}
+}
@@ -0,0 +1,311 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package alert
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+type collector struct {
+	pushers.Recorder
+}
+
+func (c *collector) wait(t *testing.T, n int) []event.Event {
+	events, ok := c.Wait(n, time.Second)
+	if !ok {
+		t.Fatalf("expected %d alerts", n)
+	}
+
+	return events
+}
+
+func (c *collector) count() int {
+	time.Sleep(50 * time.Millisecond)
+
+	return len(c.Events())
+}
+
+func newEngine(t *testing.T, rules ...Rule) (*Engine, *collector) {
+	c := &collector{}
+
+	en, err := New(WithRules(rules...), WithChannel(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return en, c
+}
+
+var start = time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func at(d time.Duration, options ...event.Option) event.Event {
+	return event.New(append(options, event.Custom("date", start.Add(d)))...)
+}
+
+func TestThreshold(t *testing.T) {
+	en, c := newEngine(t, Rule{
+		Name:     "bruteforce",
+		Type:     Threshold,
+		Match:    `type =~ "-authentication$"`,
+		GroupBy:  []string{"source-ip"},
+		Count:    3,
+		Window:   config.Delay(5 * time.Minute),
+		Cooldown: config.Delay(time.Hour),
+	})
+
+	auth := event.Type("password-authentication")
+
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		e := at(time.Duration(i)*time.Minute, auth, event.Custom("source-ip", "10.0.0.1"))
+		ids = append(ids, e.Get("event-id"))
+
+		// other sources and events are not counted
+		if i > 0 {
+			en.Send(at(time.Duration(i)*time.Minute, auth, event.Custom("source-ip", "10.0.0.2")))
+		}
+
+		en.Send(at(time.Duration(i)*time.Minute, event.Type("request"), event.Custom("source-ip", "10.0.0.1")))
+
+		en.Send(e)
+	}
+
+	alerts := c.wait(t, 1)
+
+	a := alerts[0]
+	if a.Get("category") != Category || a.Get("type") != "ALERT" {
+		t.Errorf("unexpected alert %s %s", a.Get("category"), a.Get("type"))
+	}
+
+	if a.Get("alert.rule") != "bruteforce" || a.Get("source-ip") != "10.0.0.1" {
+		t.Errorf("unexpected alert %s %s", a.Get("alert.rule"), a.Get("source-ip"))
+	}
+
+	v, _ := a.Load("alert.event-ids")
+	if eventIDs, ok := v.([]string); !ok || len(eventIDs) != 3 || eventIDs[0] != ids[0] || eventIDs[2] != ids[2] {
+		t.Errorf("unexpected event ids %v, expected %v", v, ids)
+	}
+
+	// within the cooldown
+	for i := 0; i < 3; i++ {
+		en.Send(at(10*time.Minute, auth, event.Custom("source-ip", "10.0.0.1")))
+	}
+
+	if n := c.count(); n != 1 {
+		t.Errorf("expected alerts to be suppressed, got %d", n)
+	}
+
+	// after the cooldown
+	for i := 0; i < 3; i++ {
+		en.Send(at(2*time.Hour, auth, event.Custom("source-ip", "10.0.0.1")))
+	}
+
+	c.wait(t, 2)
+}
+
+func TestThresholdWindow(t *testing.T) {
+	en, c := newEngine(t, Rule{
+		Name:    "bruteforce",
+		Type:    Threshold,
+		GroupBy: []string{"source-ip"},
+		Count:   3,
+		Window:  config.Delay(5 * time.Minute),
+	})
+
+	for i := 0; i < 3; i++ {
+		en.Send(at(time.Duration(i)*4*time.Minute, event.Custom("source-ip", "10.0.0.1")))
+	}
+
+	if n := c.count(); n != 0 {
+		t.Errorf("expected no alerts outside of the window, got %d", n)
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	en, c := newEngine(t, Rule{
+		Name:    "scanner",
+		Type:    Distinct,
+		GroupBy: []string{"source-ip"},
+		Field:   "service",
+		Count:   3,
+		Window:  config.Delay(10 * time.Minute),
+	})
+
+	for i, service := range []string{"ssh", "ssh", "telnet", "ssh", "http"} {
+		en.Send(at(time.Duration(i)*time.Minute, event.Service(service), event.Custom("source-ip", "10.0.0.1")))
+	}
+
+	alerts := c.wait(t, 1)
+
+	v, _ := alerts[0].Load("alert.service")
+	if services, ok := v.([]string); !ok || len(services) != 3 {
+		t.Errorf("unexpected services %v", v)
+	}
+
+	if v, _ := alerts[0].Load("alert.count"); v != 5 {
+		t.Errorf("unexpected count %v", v)
+	}
+}
+
+func TestDistinctBounded(t *testing.T) {
+	r, err := newRule(Rule{
+		Name:    "scanner",
+		Type:    Distinct,
+		GroupBy: []string{"source-ip"},
+		Field:   "service",
+		Count:   3,
+		Window:  config.Delay(10 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2017, 11, 28, 14, 0, 0, 0, time.UTC)
+
+	// repeated values keep a single last seen entry
+	for i := 0; i < 1000; i++ {
+		service := []string{"ssh", "telnet"}[i%2]
+		if a := r.eval(event.New(event.Service(service), event.Custom("source-ip", "10.0.0.1")), now.Add(time.Duration(i)*time.Second)); a != nil {
+			t.Fatalf("unexpected alert %v", a)
+		}
+	}
+
+	for _, g := range r.groups {
+		if len(g.entries) != 0 || len(g.distinct) != 2 {
+			t.Errorf("expected 2 distinct values, got %d entries and %d values", len(g.entries), len(g.distinct))
+		}
+	}
+
+	// values expire after the window since they were last seen
+	a := r.eval(event.New(event.Service("http"), event.Custom("source-ip", "10.0.0.1")), now.Add(1000*time.Second+11*time.Minute))
+	if a != nil {
+		t.Fatalf("unexpected alert %v", a)
+	}
+
+	a = r.eval(event.New(event.Service("ssh"), event.Custom("source-ip", "10.0.0.1")), now.Add(1001*time.Second+11*time.Minute))
+	if a != nil {
+		t.Fatalf("unexpected alert %v", a)
+	}
+
+	a = r.eval(event.New(event.Service("ftp"), event.Custom("source-ip", "10.0.0.1")), now.Add(1002*time.Second+11*time.Minute))
+	if a == nil {
+		t.Fatal("expected alert")
+	}
+
+	if fmt.Sprint(a.DistinctValues) != "[http ssh ftp]" || a.Count != 3 {
+		t.Errorf("unexpected alert values %v, count %d", a.DistinctValues, a.Count)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	en, c := newEngine(t, Rule{
+		Name: "dropper",
+		Type: Sequence,
+		Steps: []string{
+			`category == "ssh" and type == "login"`,
+			`ssh.command =~ "wget|curl"`,
+		},
+		GroupBy: []string{"session-id"},
+		Window:  config.Delay(10 * time.Minute),
+	})
+
+	login := []event.Option{event.Category("ssh"), event.Type("login")}
+
+	// command before login
+	en.Send(at(0, event.Custom("session-id", "a"), event.Custom("ssh.command", "wget http://example.com/x")))
+	en.Send(at(time.Minute, append(login, event.Custom("session-id", "a"))...))
+
+	// command after the window
+	en.Send(at(20*time.Minute, event.Custom("session-id", "a"), event.Custom("ssh.command", "curl http://example.com/x")))
+
+	if n := c.count(); n != 0 {
+		t.Fatalf("expected no alerts, got %d", n)
+	}
+
+	en.Send(at(30*time.Minute, append(login, event.Custom("session-id", "b"))...))
+	en.Send(at(31*time.Minute, event.Custom("session-id", "b"), event.Custom("ssh.command", "ls")))
+	en.Send(at(32*time.Minute, event.Custom("session-id", "b"), event.Custom("ssh.command", "wget http://example.com/x")))
+
+	alerts := c.wait(t, 1)
+
+	if alerts[0].Get("session-id") != "b" {
+		t.Errorf("unexpected session %s", alerts[0].Get("session-id"))
+	}
+
+	v, _ := alerts[0].Load("alert.event-ids")
+	if eventIDs, ok := v.([]string); !ok || len(eventIDs) != 2 {
+		t.Errorf("unexpected event ids %v", v)
+	}
+}
+
+func TestIgnoreAlerts(t *testing.T) {
+	en, c := newEngine(t, Rule{
+		Name:   "everything",
+		Type:   Threshold,
+		Count:  1,
+		Window: config.Delay(time.Minute),
+	})
+
+	en.Send(event.New(event.Category(Category)))
+
+	if n := c.count(); n != 0 {
+		t.Errorf("expected alerts to be ignored, got %d", n)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	rules := []Rule{
+		{Type: Threshold, Count: 1, Window: config.Delay(time.Minute)},
+		{Name: "a", Type: "unknown", Count: 1, Window: config.Delay(time.Minute)},
+		{Name: "a", Type: Threshold, Window: config.Delay(time.Minute)},
+		{Name: "a", Type: Threshold, Count: 1},
+		{Name: "a", Type: Distinct, Count: 1, Window: config.Delay(time.Minute)},
+		{Name: "a", Type: Sequence, Steps: []string{"a == 1"}, Window: config.Delay(time.Minute)},
+		{Name: "a", Type: Threshold, Match: "a ==", Count: 1, Window: config.Delay(time.Minute)},
+	}
+
+	for i, r := range rules {
+		if _, err := New(WithRules(r)); err == nil {
+			t.Errorf("%d: expected error", i)
+		}
+	}
+
+	r := Rule{Name: "a", Type: Threshold, Count: 1, Window: config.Delay(time.Minute)}
+	if _, err := New(WithRules(r, r)); err == nil {
+		t.Error("expected error for duplicate names")
+	}
+}
@@ -0,0 +1,422 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers/expr"
+)
+
+// The rule types.
+const (
+	// Threshold rules match when at least count events match within the
+	// window.
+	Threshold = "threshold"
+	// Distinct rules match when the matching events have at least count
+	// distinct values of field within the window.
+	Distinct = "distinct"
+	// Sequence rules match when events match each of the steps, in order,
+	// within the window.
+	Sequence = "sequence"
+)
+
+// maxEventIDs limits the number of event ids of an alert.
+const maxEventIDs = 100
+
+// Rule defines the configuration of an alerting rule.
+type Rule struct {
+	Name        string `toml:"name"`
+	Type        string `toml:"type"`
+	Description string `toml:"description"`
+	Severity    string `toml:"severity"`
+
+	// Match is an expression selecting the events of threshold and
+	// distinct rules, Steps are the expressions of sequence rules.
+	Match string   `toml:"match"`
+	Steps []string `toml:"steps"`
+
+	// GroupBy are the fields events are grouped by, rules are evaluated
+	// per group.
+	GroupBy []string `toml:"group_by"`
+
+	Field  string       `toml:"field"`
+	Count  int          `toml:"count"`
+	Window config.Delay `toml:"window"`
+
+	// Cooldown is the minimum duration between alerts of a group,
+	// defaulting to the window.
+	Cooldown config.Delay `toml:"cooldown"`
+}
+
+// entry is an event contributing to a group.
+type entry struct {
+	date time.Time
+	id   string
+}
+
+// seen is a distinct value of a group, with the events it was seen in.
+type seen struct {
+	value string
+	first time.Time
+	last  time.Time
+	id    string
+	count int
+}
+
+// group is the state of a rule for a single group.
+type group struct {
+	values  []string
+	entries []entry
+
+	// distinct are the values of distinct rules seen within the window,
+	// at most count
+	distinct map[string]*seen
+
+	// step is the next step of sequence rules
+	step int
+
+	lastAlert time.Time
+}
+
+// prune removes the entries and distinct values older than the window.
+func (g *group) prune(now time.Time, window time.Duration) {
+	i := 0
+	for ; i < len(g.entries); i++ {
+		if now.Sub(g.entries[i].date) <= window {
+			break
+		}
+	}
+
+	g.entries = g.entries[i:]
+
+	for value, s := range g.distinct {
+		if now.Sub(s.last) > window {
+			delete(g.distinct, value)
+		}
+	}
+}
+
+type rule struct {
+	Rule
+
+	match *expr.Expression
+	steps []*expr.Expression
+
+	groups    map[string]*group
+	lastSweep time.Time
+}
+
+func newRule(r Rule) (*rule, error) {
+	if r.Name == "" {
+		return nil, errors.New("name not set")
+	}
+
+	if r.Window <= 0 {
+		return nil, fmt.Errorf("rule %s: window not set", r.Name)
+	}
+
+	if r.Cooldown <= 0 {
+		r.Cooldown = r.Window
+	}
+
+	if r.Severity == "" {
+		r.Severity = "medium"
+	}
+
+	ru := &rule{
+		Rule:   r,
+		groups: map[string]*group{},
+	}
+
+	switch r.Type {
+	case Threshold, Distinct:
+		if r.Count <= 0 {
+			return nil, fmt.Errorf("rule %s: count not set", r.Name)
+		}
+
+		if r.Type == Distinct && r.Field == "" {
+			return nil, fmt.Errorf("rule %s: field not set", r.Name)
+		}
+
+		if r.Match != "" {
+			x, err := expr.Parse(r.Match)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %s", r.Name, err.Error())
+			}
+
+			ru.match = x
+		}
+	case Sequence:
+		if len(r.Steps) < 2 {
+			return nil, fmt.Errorf("rule %s: at least two steps required", r.Name)
+		}
+
+		for _, s := range r.Steps {
+			x, err := expr.Parse(s)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %s", r.Name, err.Error())
+			}
+
+			ru.steps = append(ru.steps, x)
+		}
+	default:
+		return nil, fmt.Errorf("rule %s: unsupported type %q", r.Name, r.Type)
+	}
+
+	return ru, nil
+}
+
+// group returns the group of the event, or nil if the event doesn't have
+// all group by fields.
+func (r *rule) group(e event.Event) *group {
+	values := make([]string, len(r.GroupBy))
+
+	for i, field := range r.GroupBy {
+		v, ok := e.Load(field)
+		if !ok {
+			return nil
+		}
+
+		values[i] = fmt.Sprintf("%v", v)
+	}
+
+	key := strings.Join(values, "\x00")
+
+	g, ok := r.groups[key]
+	if !ok {
+		g = &group{values: values}
+		r.groups[key] = g
+	}
+
+	return g
+}
+
+// sweep removes the groups without entries and outside of the cooldown.
+func (r *rule) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.Window.Duration() {
+		return
+	}
+
+	r.lastSweep = now
+
+	for key, g := range r.groups {
+		if r.Type != Sequence {
+			g.prune(now, r.Window.Duration())
+		} else if g.step > 0 && now.Sub(g.entries[0].date) > r.Window.Duration() {
+			g.step = 0
+			g.entries = nil
+		}
+
+		if len(g.entries) == 0 && len(g.distinct) == 0 && now.Sub(g.lastAlert) > r.Cooldown.Duration() {
+			delete(r.groups, key)
+		}
+	}
+}
+
+// eval adds the event to its group, returning the alert if the rule matches.
+func (r *rule) eval(e event.Event, now time.Time) *Alert {
+	r.sweep(now)
+
+	switch r.Type {
+	case Sequence:
+		return r.evalSequence(e, now)
+	}
+
+	if r.match != nil && !r.match.Eval(e) {
+		return nil
+	}
+
+	g := r.group(e)
+	if g == nil {
+		return nil
+	}
+
+	g.prune(now, r.Window.Duration())
+
+	if r.Type == Distinct {
+		return r.evalDistinct(g, e, now)
+	}
+
+	g.entries = append(g.entries, entry{date: now, id: e.Get("event-id")})
+
+	if len(g.entries) < r.Count {
+		return nil
+	}
+
+	return r.alert(g, now)
+}
+
+// evalDistinct records the last time the value of the event was seen, the
+// group is reset when count distinct values are seen.
+func (r *rule) evalDistinct(g *group, e event.Event, now time.Time) *Alert {
+	v, ok := e.Load(r.Field)
+	if !ok {
+		return nil
+	}
+
+	value := fmt.Sprintf("%v", v)
+
+	if g.distinct == nil {
+		g.distinct = map[string]*seen{}
+	}
+
+	s, ok := g.distinct[value]
+	if !ok {
+		s = &seen{value: value, first: now}
+		g.distinct[value] = s
+	}
+
+	s.last = now
+	s.id = e.Get("event-id")
+	s.count++
+
+	if len(g.distinct) < r.Count {
+		return nil
+	}
+
+	return r.alert(g, now)
+}
+
+func (r *rule) evalSequence(e event.Event, now time.Time) *Alert {
+	matches := false
+	for _, s := range r.steps {
+		if matches = s.Eval(e); matches {
+			break
+		}
+	}
+
+	if !matches {
+		return nil
+	}
+
+	g := r.group(e)
+	if g == nil {
+		return nil
+	}
+
+	// restart the sequence when the window elapsed
+	if g.step > 0 && now.Sub(g.entries[0].date) > r.Window.Duration() {
+		g.step = 0
+		g.entries = nil
+	}
+
+	if !r.steps[g.step].Eval(e) {
+		return nil
+	}
+
+	g.entries = append(g.entries, entry{date: now, id: e.Get("event-id")})
+	g.step++
+
+	if g.step < len(r.steps) {
+		return nil
+	}
+
+	g.step = 0
+
+	return r.alert(g, now)
+}
+
+// alert returns the alert of the group and resets it, or nil within the
+// cooldown of the group.
+func (r *rule) alert(g *group, now time.Time) *Alert {
+	entries := g.entries
+	g.entries = nil
+
+	distinct := g.distinct
+	g.distinct = nil
+
+	if !g.lastAlert.IsZero() && now.Sub(g.lastAlert) < r.Cooldown.Duration() {
+		return nil
+	}
+
+	g.lastAlert = now
+
+	a := &Alert{
+		Rule:   r.Rule,
+		Values: g.values,
+	}
+
+	if r.Type == Distinct {
+		r.alertDistinct(a, distinct)
+		return a
+	}
+
+	a.Count = len(entries)
+	a.FirstSeen = entries[0].date
+	a.LastSeen = entries[len(entries)-1].date
+
+	for _, en := range entries {
+		if len(a.EventIDs) >= maxEventIDs {
+			break
+		}
+
+		if en.id != "" {
+			a.EventIDs = append(a.EventIDs, en.id)
+		}
+	}
+
+	return a
+}
+
+// alertDistinct fills the alert with the distinct values, in the order they
+// were first seen, and the last event of each value.
+func (r *rule) alertDistinct(a *Alert, distinct map[string]*seen) {
+	values := make([]*seen, 0, len(distinct))
+	for _, s := range distinct {
+		values = append(values, s)
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].first.Before(values[j].first)
+	})
+
+	a.FirstSeen = values[0].first
+
+	for _, s := range values {
+		a.Count += s.count
+		a.DistinctValues = append(a.DistinctValues, s.value)
+
+		if s.last.After(a.LastSeen) {
+			a.LastSeen = s.last
+		}
+
+		if s.id != "" && len(a.EventIDs) < maxEventIDs {
+			a.EventIDs = append(a.EventIDs, s.id)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package artifact stores the files captured by the services, like uploads,
+// attachments, print jobs and downloads, by their SHA-256 checksum.
+package artifact
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Category is the category of artifact events.
+const Category = "artifact"
+
+// maxSources is the number of sources kept per artifact.
+const maxSources = 100
+
+// Source describes where an artifact was captured.
+type Source struct {
+	Service   string    `json:"service"`
+	SessionID string    `json:"session-id,omitempty"`
+	SourceIP  string    `json:"source-ip,omitempty"`
+	Filename  string    `json:"filename,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Date      time.Time `json:"date"`
+}
+
+// NewSource returns the source of an artifact captured now by service, within
+// the session carried by ctx, from addr.
+func NewSource(ctx context.Context, service string, addr net.Addr, filename string) Source {
+	src := Source{
+		Service:  service,
+		Filename: filename,
+		Date:     time.Now(),
+	}
+
+	if id, ok := event.SessionFromContext(ctx); ok {
+		src.SessionID = id
+	}
+
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		src.SourceIP = a.IP.String()
+	case *net.UDPAddr:
+		src.SourceIP = a.IP.String()
+	}
+
+	return src
+}
+
+// Artifact contains the metadata of a stored file.
+type Artifact struct {
+	SHA256   string `json:"sha256"`
+	SHA1     string `json:"sha1"`
+	MD5      string `json:"md5"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime-type"`
+
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first-seen"`
+	LastSeen  time.Time `json:"last-seen"`
+
+	// Sources contains the most recent sources of the artifact.
+	Sources []Source `json:"sources"`
+}
+
+func (a *Artifact) add(src Source) {
+	a.Count++
+
+	if a.FirstSeen.IsZero() || src.Date.Before(a.FirstSeen) {
+		a.FirstSeen = src.Date
+	}
+
+	if src.Date.After(a.LastSeen) {
+		a.LastSeen = src.Date
+	}
+
+	a.Sources = append(a.Sources, src)
+	if len(a.Sources) > maxSources {
+		a.Sources = a.Sources[len(a.Sources)-maxSources:]
+	}
+}
+
+func (a *Artifact) copy() *Artifact {
+	c := *a
+	c.Sources = append([]Source{}, a.Sources...)
+	return &c
+}
+
+// Event returns the event of storing the artifact from src, duplicate is true
+// when the artifact was already stored.
+func (a *Artifact) Event(src Source, duplicate bool) event.Event {
+	options := []event.Option{
+		event.Sensor(Category),
+		event.Category(Category),
+		event.ArtifactStored,
+		event.Service(src.Service),
+		event.Custom("artifact.sha256", a.SHA256),
+		event.Custom("artifact.sha1", a.SHA1),
+		event.Custom("artifact.md5", a.MD5),
+		event.Custom("artifact.size", a.Size),
+		event.Custom("artifact.mime-type", a.MimeType),
+		event.Custom("artifact.count", a.Count),
+		event.Custom("artifact.duplicate", duplicate),
+	}
+
+	if src.SessionID != "" {
+		options = append(options, event.Custom("session-id", src.SessionID))
+	}
+
+	if src.SourceIP != "" {
+		options = append(options, event.Custom("source-ip", src.SourceIP))
+	}
+
+	if src.Filename != "" {
+		options = append(options, event.Custom("artifact.filename", src.Filename))
+	}
+
+	if src.URL != "" {
+		options = append(options, event.Custom("artifact.url", src.URL))
+	}
+
+	return event.New(options...)
+}
@@ -0,0 +1,297 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func newStore(t *testing.T, options ...func(*Store) error) (*Store, *pushers.Recorder, func()) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &pushers.Recorder{}
+
+	st, err := New(append([]func(*Store) error{WithPath(dir), WithChannel(c)}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	return st, c, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func source(service string, date time.Time) Source {
+	return Source{
+		Service:   service,
+		SessionID: "session",
+		SourceIP:  "192.0.2.1",
+		Filename:  "file",
+		Date:      date,
+	}
+}
+
+func TestPut(t *testing.T) {
+	st, c, cleanup := newStore(t)
+	defer cleanup()
+
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	a, err := st.Put(strings.NewReader("hello world"), source("ftp", start))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.SHA256 != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("unexpected sha256 %s", a.SHA256)
+	}
+
+	if a.SHA1 != "2aae6c35c94fcfb415dbe95f408b9ce91ee846ed" || a.MD5 != "5eb63bbbe01eeed093cb22bb8f5acdc3" {
+		t.Errorf("unexpected checksums %s %s", a.SHA1, a.MD5)
+	}
+
+	if a.Size != 11 || a.MimeType != "text/plain; charset=utf-8" || a.Count != 1 {
+		t.Errorf("unexpected artifact %+v", a)
+	}
+
+	a, err = st.Put(strings.NewReader("hello world"), source("tftp", start.Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Count != 2 || len(a.Sources) != 2 || !a.FirstSeen.Equal(start) || !a.LastSeen.Equal(start.Add(time.Hour)) {
+		t.Errorf("unexpected artifact %+v", a)
+	}
+
+	if st.Used() != 11 {
+		t.Errorf("expected 11 bytes used, got %d", st.Used())
+	}
+
+	f, err := st.Open(a.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadAll(f)
+	f.Close()
+
+	if string(data) != "hello world" {
+		t.Errorf("unexpected contents %q", data)
+	}
+
+	events := c.Events()
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	e := events[1]
+	if e.Get("type") != "ARTIFACT:STORED" || e.Get("artifact.sha256") != a.SHA256 || e.Get("service") != "tftp" {
+		t.Errorf("unexpected event %s %s %s", e.Get("type"), e.Get("artifact.sha256"), e.Get("service"))
+	}
+
+	if e.Get("session-id") != "session" || e.Get("source-ip") != "192.0.2.1" || e.Get("artifact.filename") != "file" {
+		t.Errorf("unexpected event %s %s %s", e.Get("session-id"), e.Get("source-ip"), e.Get("artifact.filename"))
+	}
+
+	if v, _ := events[0].Load("artifact.duplicate"); v != false {
+		t.Errorf("expected first artifact not to be a duplicate")
+	}
+
+	if v, _ := e.Load("artifact.duplicate"); v != true {
+		t.Errorf("expected second artifact to be a duplicate")
+	}
+
+	// reloaded from the directory
+	st, err = New(WithPath(st.Dir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := st.Get(a.SHA256); err != nil {
+		t.Fatal(err)
+	} else if a.Count != 2 || st.Used() != 11 {
+		t.Errorf("unexpected artifact after reload %+v", a)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	st, c, cleanup := newStore(t, func(s *Store) error {
+		s.MaxSize = 8
+		s.Quota = 12
+		return nil
+	})
+	defer cleanup()
+
+	if _, err := st.Put(strings.NewReader("0123456789"), source("ftp", time.Now())); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+
+	if _, err := st.Put(strings.NewReader(""), source("ftp", time.Now())); err != ErrEmpty {
+		t.Errorf("expected ErrEmpty, got %v", err)
+	}
+
+	if _, err := st.Put(strings.NewReader("01234567"), source("ftp", time.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.Put(strings.NewReader("abcdefgh"), source("ftp", time.Now())); err != ErrQuotaExceeded {
+		t.Errorf("expected ErrQuotaExceeded, got %v", err)
+	}
+
+	// duplicates don't count towards the quota
+	if _, err := st.Put(strings.NewReader("01234567"), source("ftp", time.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	if events := c.Events(); len(events) != 2 {
+		t.Errorf("expected 2 events, got %d", len(events))
+	}
+
+	files, _ := ioutil.ReadDir(st.Dir())
+	for _, f := range files {
+		if !f.IsDir() {
+			t.Errorf("unexpected file %s", f.Name())
+		}
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	ctx := event.NewSessionContext(context.Background(), "abc")
+
+	src := NewSource(ctx, "tftp", &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 69}, "file")
+	if src.SessionID != "abc" || src.SourceIP != "192.0.2.1" || src.Service != "tftp" || src.Filename != "file" {
+		t.Errorf("unexpected source %+v", src)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	st, _, cleanup := newStore(t, func(s *Store) error {
+		s.Token = "secret"
+		return nil
+	})
+	defer cleanup()
+
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	a, err := st.Put(strings.NewReader("<html></html>"), source("ftp", start))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.Put(bytes.NewReader([]byte{0x7f, 'E', 'L', 'F', 2, 1}), source("tftp", start.Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	h := Handler(st)
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if w := get("/", token); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected unauthorized for token %q, got %d", token, w.Code)
+		}
+	}
+
+	w := get("/?service=ftp", "secret")
+
+	artifacts := []Artifact{}
+	if err := json.NewDecoder(w.Body).Decode(&artifacts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(artifacts) != 1 || artifacts[0].SHA256 != a.SHA256 {
+		t.Errorf("unexpected artifacts %+v", artifacts)
+	}
+
+	w = get("/?limit=1", "secret")
+
+	artifacts = []Artifact{}
+	if err := json.NewDecoder(w.Body).Decode(&artifacts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(artifacts) != 1 || artifacts[0].MimeType != "application/octet-stream" {
+		t.Errorf("expected most recent artifact, got %+v", artifacts)
+	}
+
+	w = get("/"+a.SHA256, "secret")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"mime-type":"text/html; charset=utf-8"`) {
+		t.Errorf("unexpected metadata %d %s", w.Code, w.Body.String())
+	}
+
+	w = get("/"+a.SHA256+"/raw", "secret")
+	if w.Body.String() != "<html></html>" || w.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("unexpected contents %q %s", w.Body.String(), w.Header().Get("Content-Type"))
+	}
+
+	for _, path := range []string{"/0000", "/../../etc/passwd/raw", "/" + a.SHA256 + "/other"} {
+		if w := get(path, "secret"); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected not found, got %d", path, w.Code)
+		}
+	}
+
+	if w := get("/?since=yesterday", "secret"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %d", w.Code)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package artifact
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/honeytrap/honeytrap/web"
+)
+
+// Handler returns the http handler serving the store, relative to the path it
+// is mounted on:
+//
+//	/              lists the artifacts, selected by the query parameters
+//	               service, mime-type, since (RFC 3339) and limit
+//	/<sha256>      returns the metadata of the artifact
+//	/<sha256>/raw  returns the contents of the artifact
+//
+// Every request requires the token of the store as bearer token, without
+// token all requests are refused.
+func Handler(st *Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !web.Authorized(st.Token, r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="artifacts"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+		switch {
+		case len(parts) == 1 && parts[0] == "":
+			list(st, w, r)
+		case len(parts) == 1:
+			metadata(st, w, parts[0])
+		case len(parts) == 2 && parts[1] == "raw":
+			raw(st, w, parts[0])
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func list(st *Store, w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	q := Query{
+		Service:  values.Get("service"),
+		MimeType: values.Get("mime-type"),
+	}
+
+	if s := values.Get("since"); s == "" {
+	} else if t, err := time.Parse(time.RFC3339, s); err != nil {
+		http.Error(w, "Invalid since: "+err.Error(), http.StatusBadRequest)
+		return
+	} else {
+		q.Since = t
+	}
+
+	if s := values.Get("limit"); s == "" {
+	} else if limit, err := strconv.Atoi(s); err != nil {
+		http.Error(w, "Invalid limit: "+err.Error(), http.StatusBadRequest)
+		return
+	} else {
+		q.Limit = limit
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(st.Query(q)); err != nil {
+		log.Errorf("Error encoding artifacts: %s", err.Error())
+	}
+}
+
+func metadata(st *Store, w http.ResponseWriter, sum string) {
+	a, err := st.Get(sum)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(a); err != nil {
+		log.Errorf("Error encoding artifact: %s", err.Error())
+	}
+}
+
+func raw(st *Store, w http.ResponseWriter, sum string) {
+	f, err := st.Open(sum)
+	if err != nil {
+		http.Error(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	defer f.Close()
+
+	// artifacts are never rendered by the browser
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+sum+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if _, err := io.Copy(w, f); err != nil {
+		log.Errorf("Error sending artifact %s: %s", sum, err.Error())
+	}
+}
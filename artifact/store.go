@@ -0,0 +1,466 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package artifact
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/pushers"
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:artifact")
+
+// DefaultMaxSize is the default maximum size of an artifact.
+const DefaultMaxSize = 10 * 1024 * 1024
+
+// DefaultQuota is the default maximum size of all artifacts together.
+const DefaultQuota = 1024 * 1024 * 1024
+
+const ext = ".json"
+
+var validHash = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+var (
+	// ErrTooLarge is returned for artifacts exceeding max_size.
+	ErrTooLarge = errors.New("artifact exceeds maximum size")
+
+	// ErrQuotaExceeded is returned when storing the artifact would exceed
+	// the quota.
+	ErrQuotaExceeded = errors.New("artifact quota exceeded")
+
+	// ErrEmpty is returned for empty artifacts.
+	ErrEmpty = errors.New("artifact is empty")
+
+	// ErrNotFound is returned for unknown artifacts.
+	ErrNotFound = errors.New("artifact not found")
+)
+
+// Store stores artifacts within a directory, the contents of an artifact are
+// stored as <xx>/<sha256> and its metadata as <xx>/<sha256>.json, where xx
+// are the first two characters of the checksum. Artifacts with the same
+// contents are stored once.
+type Store struct {
+	Enabled bool   `toml:"enabled"`
+	Path    string `toml:"path"`
+	MaxSize int64  `toml:"max_size"`
+	Quota   int64  `toml:"quota"`
+
+	// Token is the bearer token required by the api, the api is disabled
+	// without token.
+	Token string `toml:"token"`
+
+	dataDir string
+
+	ch pushers.Channel
+
+	m         sync.RWMutex
+	artifacts map[string]*Artifact
+	used      int64
+}
+
+// New returns a Store, configured by options. The artifacts are read by Load.
+func New(options ...func(*Store) error) (*Store, error) {
+	s := &Store{
+		Path:      "artifacts",
+		MaxSize:   DefaultMaxSize,
+		Quota:     DefaultQuota,
+		artifacts: map[string]*Artifact{},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.MaxSize <= 0 {
+		return nil, fmt.Errorf("invalid max_size %d", s.MaxSize)
+	}
+
+	if s.Quota < 0 {
+		return nil, fmt.Errorf("invalid quota %d", s.Quota)
+	}
+
+	return s, nil
+}
+
+// WithConfig decodes the artifact configuration.
+func WithConfig(c toml.Primitive) func(*Store) error {
+	return func(s *Store) error {
+		return toml.PrimitiveDecode(c, s)
+	}
+}
+
+// WithDataDir sets the directory relative paths are resolved against.
+func WithDataDir(dataDir string) func(*Store) error {
+	return func(s *Store) error {
+		s.dataDir = dataDir
+		return nil
+	}
+}
+
+// WithPath sets the directory artifacts are stored in.
+func WithPath(path string) func(*Store) error {
+	return func(s *Store) error {
+		s.Path = path
+		return nil
+	}
+}
+
+// WithChannel sets the channel the artifact events are sent to.
+func WithChannel(ch pushers.Channel) func(*Store) error {
+	return func(s *Store) error {
+		s.ch = ch
+		return nil
+	}
+}
+
+// Dir returns the directory artifacts are stored in.
+func (s *Store) Dir() string {
+	if filepath.IsAbs(s.Path) {
+		return s.Path
+	}
+
+	return filepath.Join(s.dataDir, s.Path)
+}
+
+func (s *Store) blob(sum string) string {
+	return filepath.Join(s.Dir(), sum[:2], sum)
+}
+
+// Load creates the directory of the store and reads the metadata of all
+// stored artifacts.
+func (s *Store) Load() error {
+	if err := os.MkdirAll(s.Dir(), 0700); err != nil {
+		return err
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.Dir(), "*", "*"+ext))
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.artifacts = map[string]*Artifact{}
+	s.used = 0
+
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		a := &Artifact{}
+		if err := json.Unmarshal(data, a); err != nil {
+			log.Errorf("Error decoding artifact %s: %s", name, err.Error())
+			continue
+		}
+
+		if !validHash.MatchString(a.SHA256) {
+			log.Errorf("Invalid artifact %s", name)
+			continue
+		}
+
+		s.artifacts[a.SHA256] = a
+		s.used += a.Size
+	}
+
+	return nil
+}
+
+// Used returns the total size of the stored artifacts.
+func (s *Store) Used() int64 {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return s.used
+}
+
+// Get returns the metadata of the artifact with the SHA-256 checksum sum.
+func (s *Store) Get(sum string) (*Artifact, error) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	a, ok := s.artifacts[sum]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return a.copy(), nil
+}
+
+// Open returns the contents of the artifact with the SHA-256 checksum sum.
+func (s *Store) Open(sum string) (*os.File, error) {
+	if _, err := s.Get(sum); err != nil {
+		return nil, err
+	}
+
+	return os.Open(s.blob(sum))
+}
+
+// Query selects artifacts, empty fields match all artifacts.
+type Query struct {
+	Service  string
+	MimeType string
+	Since    time.Time
+	Limit    int
+}
+
+func (q Query) match(a *Artifact) bool {
+	if q.MimeType != "" && q.MimeType != a.MimeType {
+		return false
+	}
+
+	if !q.Since.IsZero() && a.LastSeen.Before(q.Since) {
+		return false
+	}
+
+	if q.Service == "" {
+		return true
+	}
+
+	for _, src := range a.Sources {
+		if src.Service == q.Service {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Query returns the artifacts matching q, most recently seen first.
+func (s *Store) Query(q Query) []*Artifact {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	artifacts := []*Artifact{}
+	for _, a := range s.artifacts {
+		if !q.match(a) {
+			continue
+		}
+
+		artifacts = append(artifacts, a.copy())
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		if !artifacts[i].LastSeen.Equal(artifacts[j].LastSeen) {
+			return artifacts[i].LastSeen.After(artifacts[j].LastSeen)
+		}
+
+		return artifacts[i].SHA256 < artifacts[j].SHA256
+	})
+
+	if q.Limit > 0 && len(artifacts) > q.Limit {
+		artifacts = artifacts[:q.Limit]
+	}
+
+	return artifacts
+}
+
+// Put stores the contents of r as artifact captured from src.
+func (s *Store) Put(r io.Reader, src Source) (*Artifact, error) {
+	w, err := s.NewWriter(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		w.Discard()
+		return nil, err
+	}
+
+	return w.Commit()
+}
+
+// NewWriter returns a Writer storing an artifact captured from src.
+func (s *Store) NewWriter(src Source) (*Writer, error) {
+	f, err := ioutil.TempFile(s.Dir(), ".artifact-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		s:      s,
+		src:    src,
+		f:      f,
+		md5:    md5.New(),
+		sha1:   sha1.New(),
+		sha256: sha256.New(),
+	}, nil
+}
+
+// Writer writes an artifact to a temporary file, calculating its checksums.
+// Writes never fail, so the writer can be used with io.TeeReader without
+// affecting the original transfer, errors are returned by Commit instead.
+type Writer struct {
+	s   *Store
+	src Source
+
+	f *os.File
+
+	md5, sha1, sha256 hash.Hash
+
+	head []byte
+	n    int64
+	err  error
+}
+
+// Write writes p to the artifact.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return len(p), nil
+	}
+
+	if w.n+int64(len(p)) > w.s.MaxSize {
+		w.err = ErrTooLarge
+		return len(p), nil
+	}
+
+	if _, err := w.f.Write(p); err != nil {
+		w.err = err
+		return len(p), nil
+	}
+
+	w.md5.Write(p)
+	w.sha1.Write(p)
+	w.sha256.Write(p)
+
+	if len(w.head) < 512 {
+		n := 512 - len(w.head)
+		if n > len(p) {
+			n = len(p)
+		}
+
+		w.head = append(w.head, p[:n]...)
+	}
+
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// Discard removes the artifact.
+func (w *Writer) Discard() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// Commit stores the artifact, or counts another source when the contents were
+// stored before, and sends the artifact event.
+func (w *Writer) Commit() (*Artifact, error) {
+	defer w.Discard()
+
+	if err := w.f.Close(); err != nil && w.err == nil {
+		w.err = err
+	}
+
+	if w.err != nil {
+		return nil, w.err
+	} else if w.n == 0 {
+		return nil, ErrEmpty
+	}
+
+	a, duplicate, err := w.s.commit(w)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.s.ch != nil {
+		w.s.ch.Send(a.Event(w.src, duplicate))
+	}
+
+	return a, nil
+}
+
+func (s *Store) commit(w *Writer) (*Artifact, bool, error) {
+	sum := hex.EncodeToString(w.sha256.Sum(nil))
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	a, duplicate := s.artifacts[sum]
+	if !duplicate {
+		if s.Quota > 0 && s.used+w.n > s.Quota {
+			return nil, false, ErrQuotaExceeded
+		}
+
+		if err := os.MkdirAll(filepath.Dir(s.blob(sum)), 0700); err != nil {
+			return nil, false, err
+		}
+
+		if err := os.Rename(w.f.Name(), s.blob(sum)); err != nil {
+			return nil, false, err
+		}
+
+		a = &Artifact{
+			SHA256:   sum,
+			SHA1:     hex.EncodeToString(w.sha1.Sum(nil)),
+			MD5:      hex.EncodeToString(w.md5.Sum(nil)),
+			Size:     w.n,
+			MimeType: http.DetectContentType(w.head),
+		}
+
+		s.artifacts[sum] = a
+		s.used += w.n
+	}
+
+	a.add(w.src)
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := ioutil.WriteFile(s.blob(sum)+ext, data, 0600); err != nil {
+		return nil, false, err
+	}
+
+	return a.copy(), duplicate, nil
+}
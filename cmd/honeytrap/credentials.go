@@ -0,0 +1,241 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package honeytrap
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/credentials"
+	"github.com/honeytrap/honeytrap/storage"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var credentialsCommand = cli.Command{
+	Name:  "credentials",
+	Usage: "Query and export the harvested credentials",
+	Description: `Print the credentials used in authentication attempts, the most used first,
+   or export them as wordlist. Reads the storage within the data directory, or
+   queries the web api of a running honeytrap with --web.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "service, s",
+			Usage: "Only credentials of `SERVICE`",
+		},
+		cli.StringFlag{
+			Name:  "method, m",
+			Usage: "Only credentials of `METHOD` (password, publickey, basic, vnc-challenge)",
+		},
+		cli.StringFlag{
+			Name:  "username, u",
+			Usage: "Only credentials of `USERNAME`",
+		},
+		cli.BoolFlag{
+			Name:  "successful",
+			Usage: "Only credentials of successful attempts",
+		},
+		cli.DurationFlag{
+			Name:  "since",
+			Usage: "Only credentials used within `DURATION`",
+		},
+		cli.IntFlag{
+			Name:  "limit, n",
+			Usage: "Print at most `N` credentials",
+		},
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: credentials.FormatCSV,
+			Usage: "Output format (" + strings.Join(credentials.Formats, ", ") + ")",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: "-",
+			Usage: "Write output to `FILE`",
+		},
+		cli.StringFlag{
+			Name:  "web",
+			Usage: "Query the web api at `URL`, eg. http://127.0.0.1:8089",
+		},
+		cli.StringFlag{
+			Name:  "token",
+			Usage: "Bearer `TOKEN` of the web api, defaults to the token of the configuration",
+		},
+	},
+	Action: credentialsQuery,
+}
+
+func credentialsQuery(c *cli.Context) error {
+	q := credentials.Query{
+		Service:    c.String("service"),
+		Method:     c.String("method"),
+		Username:   c.String("username"),
+		Successful: c.Bool("successful"),
+		Limit:      c.Int("limit"),
+	}
+
+	if d := c.Duration("since"); d > 0 {
+		q.Since = time.Now().Add(-d)
+	}
+
+	var w io.Writer = os.Stdout
+
+	if o := c.String("output"); o != "-" {
+		f, err := os.OpenFile(o, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		defer f.Close()
+
+		w = f
+	}
+
+	cfg, err := loadConfig(c.GlobalString("config"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	options := []func(*credentials.Store) error{}
+	if cfg != nil {
+		options = append(options, credentials.WithConfig(cfg.Credentials))
+	}
+
+	if u := c.String("web"); u != "" {
+		token := c.String("token")
+		if token == "" && cfg != nil {
+			x := struct {
+				Token string `toml:"token"`
+			}{}
+
+			if err := toml.PrimitiveDecode(cfg.Credentials, &x); err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+
+			token = x.Token
+		}
+
+		if err := credentialsWeb(w, u, token, q, c.String("format")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		return nil
+	}
+
+	return withStorage(func(c *cli.Context) error {
+		s, err := storage.Namespace(credentials.Namespace)
+		if err != nil {
+			return err
+		}
+
+		store, err := credentials.NewStore(s, options...)
+		if err != nil {
+			return err
+		}
+
+		return credentials.Export(w, c.String("format"), store.Query(q))
+	})(c)
+}
+
+// credentialsWeb writes the response of the web api to w.
+func credentialsWeb(w io.Writer, u, token string, q credentials.Query, format string) error {
+	values := url.Values{}
+	values.Set("format", format)
+
+	for k, v := range map[string]string{"service": q.Service, "method": q.Method, "username": q.Username} {
+		if v != "" {
+			values.Set(k, v)
+		}
+	}
+
+	if q.Successful {
+		values.Set("successful", "true")
+	}
+
+	if !q.Since.IsZero() {
+		values.Set("since", q.Since.UTC().Format(time.RFC3339))
+	}
+
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(u, "/")+"/api/credentials?"+values.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected response: %s", resp.Status)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// loadConfig decodes the first existing local configuration file of the
+// candidates serve uses, without applying it. Returns nil when there is none.
+func loadConfig(path string) (*config.Config, error) {
+	for _, candidate := range []string{
+		path,
+		"/etc/honeytrap/config.toml",
+		"/etc/honeytrap.toml",
+	} {
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			continue
+		}
+
+		cfg := config.Config{}
+		if _, err := toml.DecodeFile(candidate, &cfg); err != nil {
+			return nil, fmt.Errorf("error reading configuration %s: %s", candidate, err.Error())
+		}
+
+		return &cfg, nil
+	}
+
+	return nil, nil
+}
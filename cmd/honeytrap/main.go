@@ -239,7 +239,11 @@ Commit-ID: %s
 	app.Flags = globalFlags
 	app.Description = `honeytrap: The honeypot server.`
 	app.CustomAppHelpTemplate = helpTemplate
-	app.Commands = []cli.Command{}
+	app.Commands = []cli.Command{
+		storageCommand,
+		replayCommand,
+		credentialsCommand,
+	}
 	app.Before = func(c *cli.Context) error {
 		return nil
 	}
@@ -0,0 +1,229 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package honeytrap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/server"
+	"github.com/honeytrap/honeytrap/transcript"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var replayCommand = cli.Command{
+	Name:      "replay",
+	Usage:     "Print or replay the transcript of a session",
+	ArgsUsage: "[session]",
+	Description: `Print the recorded transcript of a session as hexdump or text, or replay the
+   client side of the session against --target. Lists the recorded sessions if
+   no session is given.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "path",
+			Usage: "Read transcripts from `DIR`, relative to the data directory (default: path of the configuration)",
+		},
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "hex",
+			Usage: "Output format (hex, text)",
+		},
+		cli.StringFlag{
+			Name:  "target, t",
+			Usage: "Replay the client side against `ADDR` (host:port)",
+		},
+		cli.StringFlag{
+			Name:  "network",
+			Value: "tcp",
+			Usage: "Network of the target (tcp, udp)",
+		},
+		cli.BoolFlag{
+			Name:  "realtime",
+			Usage: "Keep the recorded delays between client data while replaying",
+		},
+		cli.DurationFlag{
+			Name:  "wait",
+			Value: 2 * time.Second,
+			Usage: "Wait for responses of the target after replaying",
+		},
+	},
+	Action: replay,
+}
+
+func replay(c *cli.Context) error {
+	p, err := server.DataDir(c.GlobalString("data"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	options := []func(*transcript.Store) error{
+		transcript.WithDataDir(p),
+	}
+
+	if cfg, err := loadConfig(c.GlobalString("config")); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	} else if cfg != nil {
+		options = append(options, transcript.WithConfig(cfg.Transcript))
+	}
+
+	if path := c.String("path"); path != "" {
+		options = append(options, transcript.WithPath(path))
+	}
+
+	ts, err := transcript.New(options...)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	var print func(transcript.Record)
+
+	switch format := c.String("format"); format {
+	case "hex":
+		print = func(r transcript.Record) {
+			fmt.Printf("%s %s %d bytes\n%s", r.Time.Format(time.RFC3339Nano), r.Direction, len(r.Data), hex.Dump(r.Data))
+		}
+	case "text":
+		print = func(r transcript.Record) {
+			fmt.Printf("%s %s %d bytes\n%s\n", r.Time.Format(time.RFC3339Nano), r.Direction, len(r.Data), r.Data)
+		}
+	default:
+		return cli.NewExitError(fmt.Sprintf("Unknown format %s", format), 1)
+	}
+
+	if !c.Args().Present() {
+		sessions, err := ts.Sessions()
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		for _, session := range sessions {
+			fmt.Println(session)
+		}
+
+		return nil
+	}
+
+	session := c.Args().First()
+
+	if target := c.String("target"); target != "" {
+		err = replayTarget(ts, session, c.String("network"), target, c.Bool("realtime"), c.Duration("wait"), print)
+	} else {
+		err = ts.Records(session, func(r transcript.Record) error {
+			print(r)
+			return nil
+		})
+	}
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// replayTarget sends the client data of session to target, printing both the
+// data sent and the responses.
+func replayTarget(ts *transcript.Store, session, network, target string, realtime bool, wait time.Duration, print func(transcript.Record)) error {
+	conn, err := net.DialTimeout(network, target, 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	m := sync.Mutex{}
+	output := func(r transcript.Record) {
+		m.Lock()
+		defer m.Unlock()
+
+		print(r)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				output(transcript.Record{
+					Time:      time.Now(),
+					Direction: transcript.Out,
+					Data:      append([]byte{}, buf[:n]...),
+				})
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var last time.Time
+
+	err = ts.Records(session, func(r transcript.Record) error {
+		if r.Direction != transcript.In {
+			return nil
+		}
+
+		if realtime && !last.IsZero() {
+			time.Sleep(r.Time.Sub(last))
+		}
+
+		last = r.Time
+
+		if _, err := conn.Write(r.Data); err != nil {
+			return err
+		}
+
+		output(transcript.Record{
+			Time:      time.Now(),
+			Direction: transcript.In,
+			Data:      r.Data,
+		})
+		return nil
+	})
+
+	select {
+	case <-done:
+	case <-time.After(wait):
+	}
+
+	conn.Close()
+	<-done
+
+	return err
+}
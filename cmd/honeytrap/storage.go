@@ -0,0 +1,211 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package honeytrap
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/honeytrap/honeytrap/server"
+	"github.com/honeytrap/honeytrap/storage"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var storageCommand = cli.Command{
+	Name:  "storage",
+	Usage: "Manage the honeytrap storage (host keys, ab tests)",
+	Description: `Inspect, backup and restore the persistent storage within the data directory.
+   The storage can't be accessed while honeytrap is running.`,
+	Subcommands: []cli.Command{
+		{
+			Name:      "ls",
+			Usage:     "List namespaces, or the keys of a namespace",
+			ArgsUsage: "[namespace]",
+			Action:    withStorage(storageList),
+		},
+		{
+			Name:      "get",
+			Usage:     "Write the value of a key to stdout",
+			ArgsUsage: "namespace key",
+			Action:    withStorage(storageGet),
+		},
+		{
+			Name:      "export",
+			Usage:     "Export namespaces, all by default",
+			ArgsUsage: "[namespace...]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format, f",
+					Value: storage.FormatJSON,
+					Usage: "Export format (json, tar)",
+				},
+				cli.StringFlag{
+					Name:  "output, o",
+					Value: "-",
+					Usage: "Write export to `FILE`",
+				},
+			},
+			Action: withStorage(storageExport),
+		},
+		{
+			Name:      "import",
+			Usage:     "Import an export",
+			ArgsUsage: "file",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format, f",
+					Value: storage.FormatJSON,
+					Usage: "Import format (json, tar)",
+				},
+				cli.BoolFlag{
+					Name:  "skip-existing",
+					Usage: "Don't overwrite existing keys",
+				},
+			},
+			Action: withStorage(storageImport),
+		},
+	},
+}
+
+// withStorage opens the storage within the data directory before running fn.
+func withStorage(fn func(*cli.Context) error) func(*cli.Context) error {
+	return func(c *cli.Context) error {
+		p, err := server.DataDir(c.GlobalString("data"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		if err := storage.Open(p); err != nil {
+			return cli.NewExitError(fmt.Sprintf("Could not open storage in %s: %s", p, err.Error()), 1)
+		}
+
+		defer storage.Close()
+
+		if err := fn(c); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		return nil
+	}
+}
+
+func storageList(c *cli.Context) error {
+	if !c.Args().Present() {
+		namespaces, err := storage.Namespaces()
+		if err != nil {
+			return err
+		}
+
+		for _, namespace := range namespaces {
+			if namespace == "" {
+				namespace = `""`
+			}
+
+			fmt.Println(namespace)
+		}
+
+		return nil
+	}
+
+	s, err := storage.Namespace(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	return s.Range(func(key string, value []byte) error {
+		fmt.Printf("%s\t%d\n", key, len(value))
+		return nil
+	})
+}
+
+func storageGet(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("expected namespace and key")
+	}
+
+	s, err := storage.Namespace(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	value, err := s.Get(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(value)
+	return err
+}
+
+func storageExport(c *cli.Context) error {
+	var w io.Writer = os.Stdout
+
+	if o := c.String("output"); o != "-" {
+		f, err := os.OpenFile(o, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		w = f
+	}
+
+	return storage.Export(w, c.String("format"), c.Args()...)
+}
+
+func storageImport(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("expected file to import")
+	}
+
+	var r io.Reader = os.Stdin
+
+	if name := c.Args().First(); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+
+		r = f
+	}
+
+	n, err := storage.Import(r, c.String("format"), !c.Bool("skip-existing"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d keys\n", n)
+	return nil
+}
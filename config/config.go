@@ -55,13 +55,21 @@ type Config struct {
 	Web toml.Primitive `toml:"web"`
 	AbTester toml.Primitive `toml:"abtester"`
 
+	Transcript  toml.Primitive `toml:"transcript"`
+	Artifacts   toml.Primitive `toml:"artifacts"`
+	Fetcher     toml.Primitive `toml:"fetcher"`
+	Credentials toml.Primitive `toml:"credentials"`
+	Enrichment  toml.Primitive `toml:"enrichment"`
+
 	Services  map[string]toml.Primitive `toml:"service"`
 	Ports     []toml.Primitive          `toml:"port"`
 	Directors map[string]toml.Primitive `toml:"director"`
 	Scripters map[string]toml.Primitive `toml:"scripter"`
 	Channels  map[string]toml.Primitive `toml:"channel"`
+	Enrichers map[string]toml.Primitive `toml:"enricher"`
 
 	Filters []toml.Primitive `toml:"filter"`
+	Alerts  []toml.Primitive `toml:"alert"`
 
 	Logging []struct {
 		Output string `toml:"output"`
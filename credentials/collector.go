@@ -0,0 +1,104 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package credentials
+
+import (
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:credentials")
+
+// Collector is a channel extracting the credentials of the events it
+// receives, counting them in the store and sending the credential events to
+// the configured channel.
+type Collector struct {
+	store   *Store
+	x       *Extractor
+	channel pushers.Channel
+
+	events chan event.Event
+}
+
+// NewCollector returns a Collector adding the credentials to store and
+// sending the credential events to channel.
+func NewCollector(store *Store, channel pushers.Channel) *Collector {
+	c := &Collector{
+		store:   store,
+		x:       NewExtractor(),
+		channel: channel,
+		events:  make(chan event.Event, 100),
+	}
+
+	go c.run()
+
+	return c
+}
+
+// Send extracts the credential of the event. Credential events are ignored.
+func (c *Collector) Send(e event.Event) {
+	if e.Get("category") == Category {
+		return
+	}
+
+	cred, ok := c.x.Extract(e)
+	if !ok {
+		return
+	}
+
+	seen := time.Now()
+	if date, ok := e.Load("date"); !ok {
+	} else if t, ok := date.(time.Time); ok {
+		seen = t
+	}
+
+	if err := c.store.Add(cred, seen); err != nil {
+		log.Errorf("Error storing credential: %s", err.Error())
+	}
+
+	// the events are sent by run, Send is called by the bus which the
+	// events are sent on
+	select {
+	case c.events <- cred.Event(e):
+	default:
+		log.Errorf("Dropping credential event of %s: queue full", cred.Service)
+	}
+}
+
+func (c *Collector) run() {
+	for e := range c.events {
+		c.channel.Send(e)
+	}
+}
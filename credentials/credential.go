@@ -0,0 +1,98 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package credentials normalizes the credentials used in authentication
+// attempts on the services into credential events, and stores them with
+// counts and first and last seen per credential.
+package credentials
+
+import (
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Category is the category of credential events.
+const Category = "auth"
+
+// EventType is the type of credential events.
+var EventType = event.Type("credential")
+
+// The authentication methods.
+const (
+	MethodPassword  = "password"
+	MethodPublicKey = "publickey"
+	MethodBasic     = "basic"
+	MethodVNC       = "vnc-challenge"
+)
+
+// Credential is a single authentication attempt.
+type Credential struct {
+	Service  string `json:"service"`
+	Username string `json:"username"`
+	Secret   string `json:"secret"`
+	Method   string `json:"method"`
+	Success  bool   `json:"success"`
+}
+
+// copied are the fields copied from the event of the attempt.
+var copied = []string{
+	"date",
+	"sensor",
+	"session-id",
+	"source-ip",
+	"source-port",
+	"destination-ip",
+	"destination-port",
+}
+
+// Event returns the credential event of the attempt in e.
+func (c Credential) Event(e event.Event) event.Event {
+	options := []event.Option{
+		event.Category(Category),
+		EventType,
+		event.Custom("auth.service", c.Service),
+		event.Custom("auth.username", c.Username),
+		event.Custom("auth.secret", c.Secret),
+		event.Custom("auth.method", c.Method),
+		event.Custom("auth.success", c.Success),
+	}
+
+	if id := e.Get("event-id"); id != "" {
+		options = append(options, event.Custom("auth.event-id", id))
+	}
+
+	for _, field := range copied {
+		if v, ok := e.Load(field); ok {
+			options = append(options, event.Custom(field, v))
+		}
+	}
+
+	return event.New(options...)
+}
@@ -0,0 +1,477 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package credentials
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		events   []event.Event
+		expected Credential
+	}{
+		{
+			name: "ssh",
+			events: []event.Event{event.New(
+				event.Category("ssh"),
+				event.Type("password-authentication"),
+				event.Custom("ssh.username", "root"),
+				event.Custom("ssh.password", "toor"),
+				event.Custom("ssh.authenticated", true),
+			)},
+			expected: Credential{"ssh", "root", "toor", MethodPassword, true},
+		},
+		{
+			name: "ssh-publickey",
+			events: []event.Event{event.New(
+				event.Category("ssh"),
+				event.Type("publickey-authentication"),
+				event.Custom("ssh.username", "root"),
+				event.Custom("ssh.publickey", "0001"),
+			)},
+			expected: Credential{"ssh", "root", "SHA256:tBP0fRPuL+bIRbLuFBr4HehY307FSaWLeXC7lmRbyNI", MethodPublicKey, false},
+		},
+		{
+			name: "ftp",
+			events: []event.Event{
+				event.New(event.Category("ftp"), event.Custom("ftp.sessionid", "1"), event.Custom("ftp.command", "USER anonymous")),
+				event.New(event.Category("ftp"), event.Custom("ftp.sessionid", "2"), event.Custom("ftp.command", "USER other")),
+				event.New(event.Category("ftp"), event.Custom("ftp.sessionid", "1"), event.Custom("ftp.command", "pass guest@")),
+			},
+			expected: Credential{"ftp", "anonymous", "guest@", MethodPassword, false},
+		},
+		{
+			name: "smtp-plain",
+			events: []event.Event{
+				event.New(event.Category("smtp"), event.Custom("session-id", "1"), event.Custom("smtp.line", "AUTH PLAIN "+b64("\x00user\x00secret"))),
+			},
+			expected: Credential{"smtp", "user", "secret", MethodPassword, false},
+		},
+		{
+			name: "smtp-login",
+			events: []event.Event{
+				event.New(event.Category("smtp"), event.Custom("session-id", "1"), event.Custom("smtp.line", "AUTH LOGIN")),
+				event.New(event.Category("smtp"), event.Custom("session-id", "1"), event.Custom("smtp.line", b64("user"))),
+				event.New(event.Category("smtp"), event.Custom("session-id", "1"), event.Custom("smtp.line", b64("secret"))),
+			},
+			expected: Credential{"smtp", "user", "secret", MethodPassword, false},
+		},
+		{
+			name: "redis",
+			events: []event.Event{event.New(
+				event.Category("redis"),
+				event.Custom("redis.command", "auth"),
+				event.Custom("redis.args", []string{"foobared"}),
+			)},
+			expected: Credential{"redis", "", "foobared", MethodPassword, false},
+		},
+		{
+			name: "http",
+			events: []event.Event{event.New(
+				event.Category("http"),
+				event.Custom("http.header.authorization", []string{"Basic " + b64("admin:admin")}),
+			)},
+			expected: Credential{"http", "admin", "admin", MethodBasic, false},
+		},
+		{
+			name: "vnc",
+			events: []event.Event{event.New(
+				event.Service("vnc"),
+				event.Category("vnc"),
+				event.Type("password-authentication"),
+				event.Custom("vnc.challenge", "00ff"),
+				event.Custom("vnc.response", "ff00"),
+			)},
+			expected: Credential{"vnc", "", "$vnc$*00FF*FF00", MethodVNC, false},
+		},
+	}
+
+	for _, test := range tests {
+		x := NewExtractor()
+
+		var c Credential
+		var ok bool
+
+		for i, e := range test.events {
+			c, ok = x.Extract(e)
+
+			if i < len(test.events)-1 && ok {
+				t.Errorf("%s: unexpected credential %v", test.name, c)
+			}
+		}
+
+		if !ok {
+			t.Errorf("%s: expected credential", test.name)
+		} else if c != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, c)
+		}
+	}
+}
+
+func TestExtractNone(t *testing.T) {
+	x := NewExtractor()
+
+	events := []event.Event{
+		event.New(event.Category("ftp"), event.Custom("ftp.command", "LIST")),
+		event.New(event.Category("smtp"), event.Custom("smtp.line", "HELO example.com")),
+		event.New(event.Category("redis"), event.Custom("redis.command", "GET"), event.Custom("redis.args", []string{"a"})),
+		event.New(event.Category("http"), event.Custom("http.header.authorization", []string{"Bearer abc"})),
+		event.New(event.Category("telnet")),
+	}
+
+	for _, e := range events {
+		if c, ok := x.Extract(e); ok {
+			t.Errorf("unexpected credential %v", c)
+		}
+	}
+}
+
+func TestExtractorSweep(t *testing.T) {
+	x := NewExtractor()
+
+	x.pending["expired"] = &pending{seen: time.Now().Add(-2 * pendingTimeout)}
+
+	x.setState("a", &pending{})
+
+	if _, ok := x.pending["expired"]; ok {
+		t.Error("expected the expired state to be swept")
+	}
+
+	// states are swept once per timeout
+	x.pending["expired"] = &pending{seen: time.Now().Add(-2 * pendingTimeout)}
+
+	x.setState("b", &pending{})
+
+	if _, ok := x.pending["expired"]; !ok {
+		t.Error("expected no sweep within the timeout")
+	}
+
+	x.lastSweep = x.lastSweep.Add(-pendingTimeout)
+
+	x.setState("c", &pending{})
+
+	if _, ok := x.pending["expired"]; ok || len(x.pending) != 3 {
+		t.Errorf("expected the expired state to be swept, got %d states", len(x.pending))
+	}
+}
+
+// memoryStorage is an in memory Storage.
+type memoryStorage struct {
+	m      sync.Mutex
+	values map[string][]byte
+}
+
+func (s *memoryStorage) Set(key string, data []byte) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.values[key] = data
+	return nil
+}
+
+func (s *memoryStorage) Delete(key string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	delete(s.values, key)
+	return nil
+}
+
+func (s *memoryStorage) Range(fn func(key string, value []byte) error) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	keys := []string{}
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := fn(key, s.values[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newStore(t *testing.T) (*Store, *memoryStorage) {
+	s := &memoryStorage{values: map[string][]byte{}}
+
+	store, err := NewStore(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Token = "secret"
+
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, c := range []Credential{
+		{"ssh", "root", "root", MethodPassword, false},
+		{"ssh", "root", "admin", MethodPassword, false},
+		{"ssh", "root", "root", MethodPassword, true},
+		{"ftp", "admin", "admin", MethodPassword, false},
+		{"ssh", "root", "root", MethodPassword, false},
+		{"ssh", "admin", "admin", MethodPassword, false},
+	} {
+		if err := store.Add(c, start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return store, s
+}
+
+func TestStore(t *testing.T) {
+	store, s := newStore(t)
+
+	records := store.Query(Query{})
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+
+	r := records[0]
+	if r.Service != "ssh" || r.Username != "root" || r.Secret != "root" || r.Count != 3 || r.Successes != 1 {
+		t.Errorf("unexpected record %+v", r)
+	}
+
+	if r.FirstSeen.Hour() != 0 || r.LastSeen.Hour() != 4 {
+		t.Errorf("unexpected first and last seen %s %s", r.FirstSeen, r.LastSeen)
+	}
+
+	if records := store.Query(Query{Service: "ftp"}); len(records) != 1 {
+		t.Errorf("expected 1 ftp record, got %d", len(records))
+	}
+
+	if records := store.Query(Query{Successful: true}); len(records) != 1 {
+		t.Errorf("expected 1 successful record, got %d", len(records))
+	}
+
+	if records := store.Query(Query{Since: time.Date(2018, 1, 1, 3, 0, 0, 0, time.UTC)}); len(records) != 3 {
+		t.Errorf("expected 3 recent records, got %d", len(records))
+	}
+
+	if records := store.Query(Query{Limit: 2}); len(records) != 2 {
+		t.Errorf("expected 2 records, got %d", len(records))
+	}
+
+	// reloaded from the storage
+	store, err := NewStore(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if records := store.Query(Query{}); len(records) != 4 || records[0].Count != 3 {
+		t.Errorf("unexpected records after reload %v", records)
+	}
+}
+
+func TestStoreMaxRecords(t *testing.T) {
+	_, s := newStore(t)
+
+	// the least recently seen records are removed when loading
+	store, err := NewStore(s, func(st *Store) error {
+		st.MaxRecords = 2
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := store.Query(Query{})
+	if len(records) != 2 || records[0].Username != "root" || records[1].Username != "admin" {
+		t.Fatalf("unexpected records %v", records)
+	}
+
+	if len(s.values) != 2 {
+		t.Errorf("expected 2 stored records, got %d", len(s.values))
+	}
+
+	seen := time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	// seeing a record again keeps it
+	if err := store.Add(Credential{"ssh", "admin", "admin", MethodPassword, false}, seen); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Add(Credential{"telnet", "guest", "guest", MethodPassword, false}, seen); err != nil {
+		t.Fatal(err)
+	}
+
+	records = store.Query(Query{})
+	if len(records) != 2 || records[0].Username != "admin" || records[1].Username != "guest" {
+		t.Errorf("unexpected records %v", records)
+	}
+
+	if len(s.values) != 2 {
+		t.Errorf("expected 2 stored records, got %d", len(s.values))
+	}
+}
+
+func TestExport(t *testing.T) {
+	store, _ := newStore(t)
+
+	records := store.Query(Query{})
+
+	tests := map[string]string{
+		FormatUsernames: "root\nadmin\n",
+		FormatSecrets:   "admin\nroot\n",
+		FormatPairs:     "root:root\nadmin:admin\nroot:admin\n",
+	}
+
+	for format, expected := range tests {
+		buf := &bytes.Buffer{}
+		if err := Export(buf, format, records); err != nil {
+			t.Fatal(err)
+		}
+
+		if buf.String() != expected {
+			t.Errorf("%s: expected %q, got %q", format, expected, buf.String())
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Export(buf, FormatCSV, records); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 || lines[1] != "ssh,password,root,root,3,1,2018-01-01T00:00:00Z,2018-01-01T04:00:00Z" {
+		t.Errorf("unexpected csv %q", buf.String())
+	}
+
+	if err := Export(buf, "xml", records); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	store, _ := newStore(t)
+
+	h := Handler(store)
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if w := get("/api/credentials", token); w.Code != http.StatusUnauthorized {
+			t.Errorf("expected unauthorized for token %q, got %d", token, w.Code)
+		}
+	}
+
+	w := get("/api/credentials?service=ssh&limit=2", "secret")
+
+	records := []Record{}
+	if err := json.NewDecoder(w.Body).Decode(&records); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records[0].Count != 3 {
+		t.Errorf("unexpected records %v", records)
+	}
+
+	w = get("/api/credentials?format=usernames&service=ftp", "secret")
+
+	if w.Body.String() != "admin\n" || w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("unexpected wordlist %q", w.Body.String())
+	}
+
+	for _, query := range []string{"format=xml", "limit=a", "since=yesterday"} {
+		w = get("/api/credentials?"+query, "secret")
+
+		if w.Code != 400 {
+			t.Errorf("%s: expected bad request, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	store, _ := newStore(t)
+
+	out := &pushers.Recorder{}
+	c := NewCollector(store, out)
+
+	e := event.New(
+		event.Category("ftp"),
+		event.Custom("source-ip", "10.0.0.1"),
+		event.Custom("ftp.command", "PASS secret"),
+	)
+
+	c.Send(e)
+	c.Send(event.New(event.Category(Category)))
+
+	events, _ := out.Wait(1, time.Second)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 credential event, got %d", len(events))
+	}
+
+	ce := events[0]
+	if ce.Get("category") != Category || ce.Get("type") != "credential" || ce.Get("auth.secret") != "secret" {
+		t.Errorf("unexpected event %s %s %s", ce.Get("category"), ce.Get("type"), ce.Get("auth.secret"))
+	}
+
+	if ce.Get("auth.event-id") != e.Get("event-id") || ce.Get("source-ip") != "10.0.0.1" {
+		t.Errorf("unexpected event %s %s", ce.Get("auth.event-id"), ce.Get("source-ip"))
+	}
+
+	if records := store.Query(Query{Secret: "secret"}); len(records) != 1 {
+		t.Errorf("expected credential to be stored, got %v", records)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package credentials
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The export formats.
+const (
+	FormatJSON      = "json"
+	FormatCSV       = "csv"
+	FormatUsernames = "usernames"
+	FormatSecrets   = "secrets"
+	FormatPairs     = "pairs"
+)
+
+// Formats are the supported export formats.
+var Formats = []string{FormatJSON, FormatCSV, FormatUsernames, FormatSecrets, FormatPairs}
+
+// ContentType returns the content type of the format.
+func ContentType(format string) string {
+	switch format {
+	case FormatJSON:
+		return "application/json"
+	case FormatCSV:
+		return "text/csv"
+	}
+
+	return "text/plain; charset=utf-8"
+}
+
+// Export writes the records in the format. The usernames, secrets and pairs
+// (username:secret) formats are wordlists, containing every word once, the
+// most used first.
+func Export(w io.Writer, format string, records []Record) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case FormatCSV:
+		return exportCSV(w, records)
+	case FormatUsernames:
+		return exportWords(w, records, func(r Record) string { return r.Username })
+	case FormatSecrets:
+		return exportWords(w, records, func(r Record) string { return r.Secret })
+	case FormatPairs:
+		return exportWords(w, records, func(r Record) string { return r.Username + ":" + r.Secret })
+	}
+
+	return fmt.Errorf("Unknown format %s", format)
+}
+
+func exportCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+
+	cw.Write([]string{"service", "method", "username", "secret", "count", "successes", "first-seen", "last-seen"})
+
+	for _, r := range records {
+		cw.Write([]string{
+			r.Service,
+			r.Method,
+			r.Username,
+			r.Secret,
+			strconv.Itoa(r.Count),
+			strconv.Itoa(r.Successes),
+			r.FirstSeen.UTC().Format(time.RFC3339),
+			r.LastSeen.UTC().Format(time.RFC3339),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportWords(w io.Writer, records []Record, word func(Record) string) error {
+	counts := map[string]int{}
+	for _, r := range records {
+		counts[word(r)] += r.Count
+	}
+
+	words := []string{}
+	for word := range counts {
+		if word != "" && word != ":" {
+			words = append(words, word)
+		}
+	}
+
+	sort.Slice(words, func(i, j int) bool {
+		if counts[words[i]] != counts[words[j]] {
+			return counts[words[i]] > counts[words[j]]
+		}
+
+		return words[i] < words[j]
+	})
+
+	for _, word := range words {
+		if _, err := fmt.Fprintln(w, word); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
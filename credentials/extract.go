@@ -0,0 +1,389 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package credentials
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// pendingTimeout is the duration the state of a multi step authentication
+// is kept.
+const pendingTimeout = 10 * time.Minute
+
+// pending is the state of a multi step authentication, like ftp USER and
+// PASS commands.
+type pending struct {
+	// state is the next expected step
+	state    string
+	username string
+	seen     time.Time
+}
+
+// Extractor extracts the credentials of the events of the services.
+type Extractor struct {
+	m         sync.Mutex
+	pending   map[string]*pending
+	lastSweep time.Time
+}
+
+// NewExtractor returns an Extractor.
+func NewExtractor() *Extractor {
+	return &Extractor{
+		pending: map[string]*pending{},
+	}
+}
+
+// Extract returns the credential of the attempt in e, if any.
+func (x *Extractor) Extract(e event.Event) (Credential, bool) {
+	var c Credential
+	var ok bool
+
+	switch e.Get("category") {
+	case "ssh":
+		c, ok = extractSSH(e)
+	case "ftp":
+		c, ok = x.extractFTP(e)
+	case "smtp":
+		c, ok = x.extractSMTP(e)
+	case "redis":
+		c, ok = extractRedis(e)
+	case "http":
+		c, ok = extractHTTP(e)
+	case "vnc":
+		c, ok = extractVNC(e)
+	}
+
+	if !ok {
+		return c, false
+	}
+
+	c.Service = e.Get("service")
+	if c.Service == "" {
+		c.Service = e.Get("category")
+	}
+
+	return c, true
+}
+
+func success(e event.Event, field string) bool {
+	v, _ := e.Load(field)
+	b, _ := v.(bool)
+	return b
+}
+
+func extractSSH(e event.Event) (Credential, bool) {
+	switch e.Get("type") {
+	case "password-authentication":
+		return Credential{
+			Username: e.Get("ssh.username"),
+			Secret:   e.Get("ssh.password"),
+			Method:   MethodPassword,
+			Success:  success(e, "ssh.authenticated"),
+		}, true
+	case "publickey-authentication":
+		key, err := hex.DecodeString(e.Get("ssh.publickey"))
+		if err != nil || len(key) == 0 {
+			return Credential{}, false
+		}
+
+		// the fingerprint as printed by ssh-keygen
+		sum := sha256.Sum256(key)
+
+		return Credential{
+			Username: e.Get("ssh.username"),
+			Secret:   "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]),
+			Method:   MethodPublicKey,
+			Success:  success(e, "ssh.authenticated"),
+		}, true
+	}
+
+	return Credential{}, false
+}
+
+// session returns the key of the state of the session of e.
+func session(e event.Event, field string) string {
+	if id := e.Get(field); id != "" {
+		return e.Get("category") + "/" + id
+	}
+
+	if id := e.Get("session-id"); id != "" {
+		return e.Get("category") + "/" + id
+	}
+
+	return fmt.Sprintf("%s/%v:%v", e.Get("category"), e.Get("source-ip"), loadString(e, "source-port"))
+}
+
+func loadString(e event.Event, field string) string {
+	v, ok := e.Load(field)
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// state returns the pending state of the session, and removes it.
+func (x *Extractor) state(key string) *pending {
+	x.m.Lock()
+	defer x.m.Unlock()
+
+	p, ok := x.pending[key]
+	if !ok {
+		return &pending{}
+	}
+
+	delete(x.pending, key)
+
+	if time.Since(p.seen) > pendingTimeout {
+		return &pending{}
+	}
+
+	return p
+}
+
+// setState stores the pending state of the session, expiring old states.
+func (x *Extractor) setState(key string, p *pending) {
+	x.m.Lock()
+	defer x.m.Unlock()
+
+	now := time.Now()
+
+	x.sweep(now)
+
+	p.seen = now
+	x.pending[key] = p
+}
+
+// sweep removes the expired states, at most once per pendingTimeout.
+func (x *Extractor) sweep(now time.Time) {
+	if now.Sub(x.lastSweep) < pendingTimeout {
+		return
+	}
+
+	x.lastSweep = now
+
+	for k, p := range x.pending {
+		if now.Sub(p.seen) > pendingTimeout {
+			delete(x.pending, k)
+		}
+	}
+}
+
+// command splits the line into the upper cased command and its argument.
+func command(line string) (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(line), " ", 2)
+
+	cmd := strings.ToUpper(parts[0])
+	if len(parts) == 1 {
+		return cmd, ""
+	}
+
+	return cmd, strings.TrimSpace(parts[1])
+}
+
+func (x *Extractor) extractFTP(e event.Event) (Credential, bool) {
+	line := e.Get("ftp.command")
+	if line == "" {
+		return Credential{}, false
+	}
+
+	key := session(e, "ftp.sessionid")
+
+	switch cmd, arg := command(line); cmd {
+	case "USER":
+		x.setState(key, &pending{state: "PASS", username: arg})
+	case "PASS":
+		p := x.state(key)
+
+		return Credential{
+			Username: p.username,
+			Secret:   arg,
+			Method:   MethodPassword,
+		}, true
+	}
+
+	return Credential{}, false
+}
+
+func decodeBase64(s string) (string, bool) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return "", false
+	}
+
+	return string(data), true
+}
+
+// plain returns the credential of a SASL PLAIN response, authzid NUL
+// authcid NUL passwd.
+func plain(s string) (Credential, bool) {
+	data, ok := decodeBase64(s)
+	if !ok {
+		return Credential{}, false
+	}
+
+	parts := bytes.Split([]byte(data), []byte{0})
+	if len(parts) != 3 {
+		return Credential{}, false
+	}
+
+	return Credential{
+		Username: string(parts[1]),
+		Secret:   string(parts[2]),
+		Method:   MethodPassword,
+	}, true
+}
+
+func (x *Extractor) extractSMTP(e event.Event) (Credential, bool) {
+	line := e.Get("smtp.line")
+	if line == "" {
+		return Credential{}, false
+	}
+
+	key := session(e, "smtp.sessionid")
+
+	if cmd, arg := command(line); cmd == "AUTH" {
+		mechanism, response := command(arg)
+
+		switch {
+		case mechanism == "PLAIN" && response != "":
+			return plain(response)
+		case mechanism == "PLAIN":
+			x.setState(key, &pending{state: "PLAIN"})
+		case mechanism == "LOGIN" && response != "":
+			if username, ok := decodeBase64(response); ok {
+				x.setState(key, &pending{state: "LOGIN-PASSWORD", username: username})
+			}
+		case mechanism == "LOGIN":
+			x.setState(key, &pending{state: "LOGIN-USERNAME"})
+		}
+
+		return Credential{}, false
+	}
+
+	// the responses to the challenges of the server
+	switch p := x.state(key); p.state {
+	case "PLAIN":
+		return plain(line)
+	case "LOGIN-USERNAME":
+		if username, ok := decodeBase64(line); ok {
+			x.setState(key, &pending{state: "LOGIN-PASSWORD", username: username})
+		}
+	case "LOGIN-PASSWORD":
+		if password, ok := decodeBase64(line); ok {
+			return Credential{
+				Username: p.username,
+				Secret:   password,
+				Method:   MethodPassword,
+			}, true
+		}
+	}
+
+	return Credential{}, false
+}
+
+func extractRedis(e event.Event) (Credential, bool) {
+	if !strings.EqualFold(e.Get("redis.command"), "AUTH") {
+		return Credential{}, false
+	}
+
+	v, _ := e.Load("redis.args")
+	args, _ := v.([]string)
+
+	switch len(args) {
+	case 1:
+		return Credential{Secret: args[0], Method: MethodPassword}, true
+	case 2:
+		return Credential{Username: args[0], Secret: args[1], Method: MethodPassword}, true
+	}
+
+	return Credential{}, false
+}
+
+func extractHTTP(e event.Event) (Credential, bool) {
+	v, _ := e.Load("http.header.authorization")
+
+	headers, _ := v.([]string)
+	if s, ok := v.(string); ok {
+		headers = []string{s}
+	}
+
+	for _, h := range headers {
+		scheme, value := command(h)
+		if scheme != "BASIC" {
+			continue
+		}
+
+		data, ok := decodeBase64(value)
+		if !ok {
+			continue
+		}
+
+		parts := strings.SplitN(data, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		return Credential{
+			Username: parts[0],
+			Secret:   parts[1],
+			Method:   MethodBasic,
+		}, true
+	}
+
+	return Credential{}, false
+}
+
+func extractVNC(e event.Event) (Credential, bool) {
+	if e.Get("type") != "password-authentication" {
+		return Credential{}, false
+	}
+
+	challenge, response := e.Get("vnc.challenge"), e.Get("vnc.response")
+	if challenge == "" || response == "" {
+		return Credential{}, false
+	}
+
+	// the format of john the ripper and hashcat
+	return Credential{
+		Secret: fmt.Sprintf("$vnc$*%s*%s", strings.ToUpper(challenge), strings.ToUpper(response)),
+		Method: MethodVNC,
+	}, true
+}
@@ -0,0 +1,107 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package credentials
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/honeytrap/honeytrap/web"
+)
+
+// Handler returns the http handler querying the store. The query parameters
+// service, method, username, secret, since (RFC 3339), successful and limit
+// select the records, format is one of the export formats.
+//
+// Every request requires the token of the store as bearer token, without
+// token all requests are refused.
+func Handler(st *Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !web.Authorized(st.Token, r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="credentials"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		values := r.URL.Query()
+
+		q := Query{
+			Service:    values.Get("service"),
+			Method:     values.Get("method"),
+			Username:   values.Get("username"),
+			Secret:     values.Get("secret"),
+			Successful: values.Get("successful") == "true",
+		}
+
+		if s := values.Get("since"); s == "" {
+		} else if t, err := time.Parse(time.RFC3339, s); err != nil {
+			http.Error(w, "Invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		} else {
+			q.Since = t
+		}
+
+		if s := values.Get("limit"); s == "" {
+		} else if limit, err := strconv.Atoi(s); err != nil {
+			http.Error(w, "Invalid limit: "+err.Error(), http.StatusBadRequest)
+			return
+		} else {
+			q.Limit = limit
+		}
+
+		format := values.Get("format")
+		if format == "" {
+			format = FormatJSON
+		}
+
+		valid := false
+		for _, f := range Formats {
+			valid = valid || f == format
+		}
+
+		if !valid {
+			http.Error(w, "Unknown format "+format, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentType(format))
+
+		if err := Export(w, format, st.Query(q)); err != nil {
+			log.Errorf("Error exporting credentials: %s", err.Error())
+		}
+	})
+}
@@ -0,0 +1,274 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package credentials
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Namespace is the storage namespace of the credentials.
+const Namespace = "credentials"
+
+// DefaultMaxRecords is the default maximum number of records.
+const DefaultMaxRecords = 100000
+
+// Record contains the counts of a credential, per service, method, username
+// and secret.
+type Record struct {
+	Service  string `json:"service"`
+	Username string `json:"username"`
+	Secret   string `json:"secret"`
+	Method   string `json:"method"`
+
+	Count     int       `json:"count"`
+	Successes int       `json:"successes"`
+	FirstSeen time.Time `json:"first-seen"`
+	LastSeen  time.Time `json:"last-seen"`
+}
+
+func (r *Record) key() string {
+	h := sha1.New()
+	h.Write([]byte(strings.Join([]string{r.Service, r.Method, r.Username, r.Secret}, "\x00")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Storage is the persistent storage of the records, eg. a namespace of the
+// storage package.
+type Storage interface {
+	Set(key string, data []byte) error
+	Delete(key string) error
+	Range(fn func(key string, value []byte) error) error
+}
+
+// Store contains the records of the credentials, up to MaxRecords. The least
+// recently seen records are removed first.
+type Store struct {
+	// Token is the bearer token required by the api, the api is disabled
+	// without token.
+	Token string `toml:"token"`
+
+	MaxRecords int `toml:"max_records"`
+
+	s Storage
+
+	m       sync.RWMutex
+	records map[string]*list.Element
+	// recent contains the records, the most recently seen first
+	recent *list.List
+}
+
+// NewStore returns a Store configured by options, loading the records of s.
+func NewStore(s Storage, options ...func(*Store) error) (*Store, error) {
+	st := &Store{
+		MaxRecords: DefaultMaxRecords,
+		s:          s,
+		records:    map[string]*list.Element{},
+		recent:     list.New(),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(st); err != nil {
+			return nil, err
+		}
+	}
+
+	if st.MaxRecords <= 0 {
+		return nil, fmt.Errorf("invalid max_records %d", st.MaxRecords)
+	}
+
+	records := []*Record{}
+
+	err := s.Range(func(key string, value []byte) error {
+		r := &Record{}
+		if err := json.Unmarshal(value, r); err != nil {
+			log.Errorf("Error decoding credential %s: %s", key, err.Error())
+			return nil
+		}
+
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].LastSeen.Before(records[j].LastSeen)
+	})
+
+	for _, r := range records {
+		st.records[r.key()] = st.recent.PushFront(r)
+	}
+
+	st.evict()
+
+	return st, nil
+}
+
+// WithConfig decodes the credentials configuration.
+func WithConfig(c toml.Primitive) func(*Store) error {
+	return func(st *Store) error {
+		return toml.PrimitiveDecode(c, st)
+	}
+}
+
+// evict removes the least recently seen records exceeding MaxRecords.
+func (st *Store) evict() {
+	for st.recent.Len() > st.MaxRecords {
+		r := st.recent.Remove(st.recent.Back()).(*Record)
+
+		key := r.key()
+		delete(st.records, key)
+
+		if err := st.s.Delete(key); err != nil {
+			log.Errorf("Error deleting credential %s: %s", key, err.Error())
+		}
+	}
+}
+
+// Add counts the credential, seen at the time.
+func (st *Store) Add(c Credential, seen time.Time) error {
+	r := &Record{
+		Service:  c.Service,
+		Username: c.Username,
+		Secret:   c.Secret,
+		Method:   c.Method,
+	}
+
+	key := r.key()
+
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	if e, ok := st.records[key]; ok {
+		st.recent.MoveToFront(e)
+		r = e.Value.(*Record)
+	} else {
+		r.FirstSeen = seen
+		st.records[key] = st.recent.PushFront(r)
+
+		st.evict()
+	}
+
+	r.Count++
+	if c.Success {
+		r.Successes++
+	}
+
+	if seen.After(r.LastSeen) {
+		r.LastSeen = seen
+	}
+
+	if seen.Before(r.FirstSeen) {
+		r.FirstSeen = seen
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return st.s.Set(key, data)
+}
+
+// Query selects records, empty fields match all records.
+type Query struct {
+	Service  string
+	Method   string
+	Username string
+	Secret   string
+
+	// Since selects the records last seen after it.
+	Since time.Time
+	// Successful only selects records with successful attempts.
+	Successful bool
+
+	// Limit limits the number of records, all records are returned if not
+	// set.
+	Limit int
+}
+
+func (q Query) match(r *Record) bool {
+	switch {
+	case q.Service != "" && q.Service != r.Service:
+		return false
+	case q.Method != "" && q.Method != r.Method:
+		return false
+	case q.Username != "" && q.Username != r.Username:
+		return false
+	case q.Secret != "" && q.Secret != r.Secret:
+		return false
+	case !q.Since.IsZero() && r.LastSeen.Before(q.Since):
+		return false
+	case q.Successful && r.Successes == 0:
+		return false
+	}
+
+	return true
+}
+
+// Query returns the records matching q, the most used first.
+func (st *Store) Query(q Query) []Record {
+	st.m.RLock()
+
+	records := []Record{}
+	for _, e := range st.records {
+		if r := e.Value.(*Record); q.match(r) {
+			records = append(records, *r)
+		}
+	}
+
+	st.m.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Count != records[j].Count {
+			return records[i].Count > records[j].Count
+		}
+
+		return records[i].LastSeen.After(records[j].LastSeen)
+	})
+
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[:q.Limit]
+	}
+
+	return records
+}
@@ -31,6 +31,7 @@
 package director
 
 import (
+	"context"
 	"net"
 
 	"github.com/BurntSushi/toml"
@@ -65,7 +66,7 @@ func GetAvailableDirectorNames() []string {
 // Director defines an interface which exposes an interface to allow structures that
 // implement this interface allow us to control containers which they provide.
 type Director interface {
-	Dial(net.Conn) (net.Conn, error)
+	Dial(context.Context, net.Conn) (net.Conn, error)
 	//Dial(network) (net.Conn, error)
 	//DialUDP() (net.Conn, error)
 	// Run(ctx context.Context)
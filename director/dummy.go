@@ -30,7 +30,10 @@
  */
 package director
 
-import "net"
+import (
+	"context"
+	"net"
+)
 
 func MustDummy(options ...func(Director) error) Director {
 	l, _ := Dummy()
@@ -44,6 +47,6 @@ func Dummy(options ...func(Director) error) (Director, error) {
 type dummyDirector struct {
 }
 
-func (*dummyDirector) Dial(net.Conn) (net.Conn, error) {
+func (*dummyDirector) Dial(context.Context, net.Conn) (net.Conn, error) {
 	return nil, nil
 }
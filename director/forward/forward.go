@@ -31,6 +31,7 @@
 package forward
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -65,7 +66,7 @@ func (d *forwardDirector) SetChannel(eb pushers.Channel) {
 	d.eb = eb
 }
 
-func (d *forwardDirector) Dial(conn net.Conn) (net.Conn, error) {
+func (d *forwardDirector) Dial(ctx context.Context, conn net.Conn) (net.Conn, error) {
 	host := d.Host
 	protocol := ""
 	port := ""
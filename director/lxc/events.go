@@ -37,40 +37,40 @@ import (
 )
 
 // ContainerClonedEvent returns a connection open event object giving the associated data values.
-func ContainerClonedEvent(name, template string) event.Event {
-	return event.New(
+func ContainerClonedEvent(name, template string, options ...event.Option) event.Event {
+	return event.New(append([]event.Option{
 		event.ContainerCloned,
 		event.ContainersSensor,
 		event.Custom("container-name", name),
 		event.Custom("container-template", template),
-	)
+	}, options...)...)
 }
 
 // ContainerUnfrozenEvent returns a connection open event object giving the associated data values.
-func ContainerUnfrozenEvent(name string, ip net.IP) event.Event {
-	return event.New(
+func ContainerUnfrozenEvent(name string, ip net.IP, options ...event.Option) event.Event {
+	return event.New(append([]event.Option{
 		event.ContainerUnfrozen,
 		event.ContainersSensor,
 		event.Custom("container-name", name),
 		event.Custom("container-ip", ip.String()),
-	)
+	}, options...)...)
 }
 
 // ContainerStartedEvent returns a connection open event object giving the associated data values.
-func ContainerStartedEvent(name string) event.Event {
-	return event.New(
+func ContainerStartedEvent(name string, options ...event.Option) event.Event {
+	return event.New(append([]event.Option{
 		event.ContainerStarted,
 		event.ContainersSensor,
 		event.Custom("container-name", name),
-	)
+	}, options...)...)
 }
 
 // ContainerErrorEvent returns a connection open event object giving the associated data values.
-func ContainerErrorEvent(name string, e error) event.Event {
-	return event.New(
+func ContainerErrorEvent(name string, e error, options ...event.Option) event.Event {
+	return event.New(append([]event.Option{
 		event.ContainerError,
 		event.ContainersSensor,
 		event.Custom("container-name", name),
 		event.Error(e),
-	)
+	}, options...)...)
 }
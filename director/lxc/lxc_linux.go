@@ -33,6 +33,7 @@
 package lxc
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -42,6 +43,7 @@ import (
 	"time"
 
 	"github.com/honeytrap/honeytrap/director"
+	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/lxc/go-lxc"
 )
@@ -74,7 +76,7 @@ func (d *lxcDirector) SetChannel(eb pushers.Channel) {
 	d.eb = eb
 }
 
-func (d *lxcDirector) Dial(conn net.Conn) (net.Conn, error) {
+func (d *lxcDirector) Dial(ctx context.Context, conn net.Conn) (net.Conn, error) {
 	h := fnv.New32()
 
 	remoteAddr, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
@@ -88,7 +90,7 @@ func (d *lxcDirector) Dial(conn net.Conn) (net.Conn, error) {
 	if !ok {
 		var err error
 
-		c, err = d.newContainer(name, d.template)
+		c, err = d.newContainer(ctx, name, d.template)
 		if err != nil {
 			log.Errorf("Error creating container: %s", err.Error())
 			return nil, err
@@ -98,9 +100,10 @@ func (d *lxcDirector) Dial(conn net.Conn) (net.Conn, error) {
 		// d.cache[name] = c
 		//m.Unlock()
 		d.cache.Store(name, c)
+		director.Containers.Add(1, "lxc")
 	}
 
-	if err := c.(*lxcContainer).ensureStarted(); err != nil {
+	if err := c.(*lxcContainer).ensureStarted(ctx); err != nil {
 		log.Errorf("Error creating container: %s", err.Error())
 		return nil, err
 	}
@@ -110,10 +113,10 @@ func (d *lxcDirector) Dial(conn net.Conn) (net.Conn, error) {
 
 	if ta, ok := conn.LocalAddr().(*net.TCPAddr); ok {
 		connection, err := c.(*lxcContainer).Dial("tcp", ta.Port)
-		return lxcContainerConn{Conn: connection, container: c.(*lxcContainer)}, err
+		return lxcContainerConn{Conn: connection, container: c.(*lxcContainer), ctx: ctx}, err
 	} else if ta, ok := conn.LocalAddr().(*net.UDPAddr); ok {
 		connection, err := c.(*lxcContainer).Dial("udp", ta.Port)
-		return lxcContainerConn{Conn: connection, container: c.(*lxcContainer)}, err
+		return lxcContainerConn{Conn: connection, container: c.(*lxcContainer), ctx: ctx}, err
 	} else {
 		return nil, errors.New("Unsupported protocol")
 	}
@@ -134,7 +137,7 @@ type lxcContainer struct {
 }
 
 // NewContainer returns a new LxcContainer from the provider.
-func (d *lxcDirector) newContainer(name string, template string) (*lxcContainer, error) {
+func (d *lxcDirector) newContainer(ctx context.Context, name string, template string) (*lxcContainer, error) {
 	c := lxcContainer{
 		name:     name,
 		template: template,
@@ -153,7 +156,7 @@ func (d *lxcDirector) newContainer(name string, template string) (*lxcContainer,
 		return &c, nil
 	}
 
-	if err := c.clone(); err != nil {
+	if err := c.clone(ctx); err != nil {
 		return nil, err
 	}
 	return &c, nil
@@ -176,16 +179,18 @@ func (c *lxcContainer) housekeeper() {
 		if time.Since(c.idle) > time.Duration(c.Delays.StopDelay) && c.isFrozen() {
 			log.Debugf("LxcContainer %s: idle for %s, stopping container", c.name, time.Now().Sub(c.idle).String())
 			c.c.Stop()
+			director.ContainerChanges.Inc("lxc", "stopped")
 			return
 		} else if time.Since(c.idle) > time.Duration(c.Delays.FreezeDelay) && c.isRunning() {
 			log.Debugf("LxcContainer %s: idle for %s, freezing container", c.name, time.Now().Sub(c.idle).String())
 			c.c.Freeze()
+			director.ContainerChanges.Inc("lxc", "frozen")
 		}
 	}
 }
 
 // clone attempts to clone the underline lxc.Container.
-func (c *lxcContainer) clone() error {
+func (c *lxcContainer) clone(ctx context.Context) error {
 	log.Debugf("Creating new container %s from template %s", c.name, c.d.template)
 
 	c1, err := lxc.NewContainer(c.template)
@@ -221,25 +226,27 @@ func (c *lxcContainer) clone() error {
 		return err
 	}
 
-	c.d.eb.Send(ContainerClonedEvent(c.name, c.template))
+	c.d.eb.Send(ContainerClonedEvent(c.name, c.template, event.Session(ctx)))
+	director.ContainerChanges.Inc("lxc", "cloned")
 
 	return nil
 }
 
 // start begins the call to the lxc.Container.
-func (c *lxcContainer) start() error {
+func (c *lxcContainer) start(ctx context.Context) error {
 	log.Infof("Starting container")
 
 	c.idle = time.Now()
 
 	if !c.c.Defined() {
-		if err := c.clone(); err != nil {
+		if err := c.clone(ctx); err != nil {
 			log.Error(err.Error())
 			return err
 		}
 	}
 
-	c.d.eb.Send(ContainerStartedEvent(c.name))
+	c.d.eb.Send(ContainerStartedEvent(c.name, event.Session(ctx)))
+	director.ContainerChanges.Inc("lxc", "started")
 
 	// run independent of our process
 	c.c.WantDaemonize(true)
@@ -262,7 +269,7 @@ func (c *lxcContainer) start() error {
 }
 
 // unfreeze sets the internal container into an unfrozen state.
-func (c *lxcContainer) unfreeze() error {
+func (c *lxcContainer) unfreeze(ctx context.Context) error {
 	log.Infof("Unfreezing container: %s", c.name)
 
 	if err := c.c.Unfreeze(); err != nil {
@@ -273,7 +280,8 @@ func (c *lxcContainer) unfreeze() error {
 		return err
 	}
 
-	c.d.eb.Send(ContainerUnfrozenEvent(c.name, c.ip))
+	c.d.eb.Send(ContainerUnfrozenEvent(c.name, c.ip, event.Session(ctx)))
+	director.ContainerChanges.Inc("lxc", "unfrozen")
 
 	/*
 		if err := c.sf.Start(c.idevice); err != nil {
@@ -342,13 +350,13 @@ func (c *lxcContainer) settle() error {
 	return nil
 }
 
-func (c *lxcContainer) ensureStarted() error {
+func (c *lxcContainer) ensureStarted(ctx context.Context) error {
 	if c.isFrozen() {
-		return c.unfreeze()
+		return c.unfreeze(ctx)
 	}
 
 	if c.isStopped() {
-		return c.start()
+		return c.start(ctx)
 	}
 
 	// settle will fill the container with ip address and interface
@@ -3,6 +3,7 @@
 package lxc
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"time"
@@ -13,28 +14,29 @@ import (
 type lxcContainerConn struct {
 	net.Conn
 	container *lxcContainer
+	ctx       context.Context
 }
 
 // Read reads the giving set of data from the container connection to the
 // byte slice.
 func (c lxcContainerConn) Read(b []byte) (n int, err error) {
-	c.container.stillActive()
+	c.container.stillActive(c.ctx)
 	return c.Conn.Read(b)
 }
 
 // Write writes the data into byte slice from the container.
 func (c lxcContainerConn) Write(b []byte) (n int, err error) {
-	c.container.stillActive()
+	c.container.stillActive(c.ctx)
 	return c.Conn.Write(b)
 }
 
 // stillActive returns an error if the containerr is not still active
-func (c *lxcContainer) stillActive() error {
+func (c *lxcContainer) stillActive(ctx context.Context) error {
 	if c.isStopped() {
 		return fmt.Errorf("lxccontainer not running %s", c.name)
 	}
 	if c.isFrozen() {
-		return c.unfreeze()
+		return c.unfreeze(ctx)
 	}
 	if !c.isRunning() {
 		return fmt.Errorf("lxccontainer in unknown state %s:%s", c.name, c.c.State())
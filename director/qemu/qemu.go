@@ -34,6 +34,7 @@
 package qemu
 
 import (
+	"context"
 	"errors"
 	"net"
 
@@ -65,6 +66,6 @@ func (d *qemuDirector) SetChannel(eb pushers.Channel) {
 	d.eb = eb
 }
 
-func (d *qemuDirector) Dial(conn net.Conn) (net.Conn, error) {
+func (d *qemuDirector) Dial(ctx context.Context, conn net.Conn) (net.Conn, error) {
 	return nil, errors.New("Qemu director not implemented yet")
 }
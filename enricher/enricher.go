@@ -0,0 +1,218 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package enricher
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/metrics"
+	"github.com/honeytrap/honeytrap/pushers"
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:enricher")
+
+// Enricher defines an interface for adding information to events before
+// they are delivered to the channels.
+type Enricher interface {
+	Enrich(event.Event)
+}
+
+type EnricherFunc func(...func(Enricher) error) (Enricher, error)
+
+var (
+	enrichers = map[string]EnricherFunc{}
+)
+
+func Register(key string, fn EnricherFunc) EnricherFunc {
+	enrichers[key] = fn
+	return fn
+}
+
+func Get(key string) (EnricherFunc, bool) {
+	if fn, ok := enrichers[key]; ok {
+		return fn, true
+	}
+
+	return nil, false
+}
+
+func GetAvailableEnricherNames() []string {
+	var out []string
+	for key := range enrichers {
+		out = append(out, key)
+	}
+	return out
+}
+
+func WithConfig(c toml.Primitive) func(Enricher) error {
+	return func(e Enricher) error {
+		err := toml.PrimitiveDecode(c, e)
+		return err
+	}
+}
+
+// DefaultQueueSize defines the number of events queued for enrichment.
+const DefaultQueueSize = 1024
+
+var skippedTotal = metrics.NewCounterVec(
+	"honeytrap_enricher_skipped_total",
+	"Number of events delivered unenriched because the enrichment queue was full.",
+)
+
+type enrichChannel struct {
+	channel   pushers.Channel
+	enrichers []Enricher
+
+	m      sync.RWMutex
+	closed bool
+
+	ch   chan event.Event
+	done chan struct{}
+
+	skipped uint64
+}
+
+// Channel returns a Channel which enriches events using enrichers, in order,
+// before delivering them to channel. Enrichment runs on its own goroutine
+// with a queue of size events (DefaultQueueSize when size <= 0), so slow
+// enrichers don't hold up the sender. When the queue is full, events are
+// delivered to channel unenriched, leaving overflow to the policy of
+// channel. The returned Channel implements io.Closer, Close delivers the
+// queued events.
+func Channel(channel pushers.Channel, size int, enrichers ...Enricher) pushers.Channel {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+
+	ec := &enrichChannel{
+		channel:   channel,
+		enrichers: enrichers,
+		ch:        make(chan event.Event, size),
+		done:      make(chan struct{}),
+	}
+
+	go ec.run()
+
+	return ec
+}
+
+func (ec *enrichChannel) run() {
+	defer close(ec.done)
+
+	for e := range ec.ch {
+		for _, enricher := range ec.enrichers {
+			enrich(enricher, e)
+		}
+
+		ec.channel.Send(e)
+	}
+}
+
+// enrich runs enricher on e, recovering from panics so a failing enricher
+// doesn't stop the others.
+func enrich(enricher Enricher, e event.Event) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Errorf("Error enriching event with %T: %v", enricher, err)
+		}
+	}()
+
+	enricher.Enrich(e)
+}
+
+// Send queues the event for enrichment, without blocking. When the queue is
+// full the event is delivered unenriched.
+func (ec *enrichChannel) Send(e event.Event) {
+	if ec.queue(e) {
+		return
+	}
+
+	skippedTotal.Inc()
+
+	if n := atomic.AddUint64(&ec.skipped, 1); n == 1 || n%1000 == 0 {
+		log.Errorf("Enrichment queue full, delivered %d events unenriched", n)
+	}
+
+	ec.channel.Send(e)
+}
+
+// queue queues the event, it returns false if the queue is full.
+func (ec *enrichChannel) queue(e event.Event) bool {
+	ec.m.RLock()
+	defer ec.m.RUnlock()
+
+	if ec.closed {
+		return true
+	}
+
+	select {
+	case ec.ch <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting events and waits until the queued events are
+// enriched and delivered.
+func (ec *enrichChannel) Close() error {
+	ec.m.Lock()
+	if !ec.closed {
+		ec.closed = true
+		close(ec.ch)
+	}
+	ec.m.Unlock()
+
+	<-ec.done
+	return nil
+}
+
+// IP returns the ip address stored in field of the event, or nil.
+func IP(e event.Event, field string) net.IP {
+	v, ok := e.Load(field)
+	if !ok {
+		return nil
+	}
+
+	switch x := v.(type) {
+	case net.IP:
+		return x
+	case string:
+		return net.ParseIP(x)
+	default:
+		return nil
+	}
+}
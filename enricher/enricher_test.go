@@ -0,0 +1,168 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package enricher
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+type enricherFunc func(event.Event)
+
+func (fn enricherFunc) Enrich(e event.Event) {
+	fn(e)
+}
+
+type recordingChannel chan event.Event
+
+func (c recordingChannel) Send(e event.Event) {
+	c <- e
+}
+
+func TestChannel(t *testing.T) {
+	rc := make(recordingChannel, 1)
+
+	c := Channel(rc, 0,
+		enricherFunc(func(e event.Event) {
+			e.Store("order", "first")
+		}),
+		enricherFunc(func(e event.Event) {
+			e.Store("order", e.Get("order")+",second")
+		}),
+	)
+
+	c.Send(event.New())
+
+	select {
+	case e := <-rc:
+		if order := e.Get("order"); order != "first,second" {
+			t.Errorf("expected enrichers to run in order, got %s", order)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event not delivered")
+	}
+}
+
+func TestChannelDeliversUnenrichedWhenFull(t *testing.T) {
+	rc := make(recordingChannel, 10)
+
+	release := make(chan struct{})
+
+	c := Channel(rc, 1, enricherFunc(func(e event.Event) {
+		<-release
+		e.Store("enriched", "yes")
+	}))
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 5; i++ {
+			c.Send(event.New())
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("send blocked on a full queue")
+	}
+
+	if n := atomic.LoadUint64(&c.(*enrichChannel).skipped); n == 0 {
+		t.Error("expected events to skip enrichment")
+	}
+
+	close(release)
+
+	c.(io.Closer).Close()
+
+	if len(rc) != 5 {
+		t.Errorf("expected all events to be delivered, got %d", len(rc))
+	}
+
+	// sending after close is a no-op
+	c.Send(event.New())
+
+	if len(rc) != 5 {
+		t.Errorf("expected no events after close, got %d", len(rc))
+	}
+}
+
+func TestChannelRecoversEnricher(t *testing.T) {
+	rc := make(recordingChannel, 1)
+
+	c := Channel(rc, 0,
+		enricherFunc(func(e event.Event) {
+			panic("enricher failed")
+		}),
+		enricherFunc(func(e event.Event) {
+			e.Store("enriched", "yes")
+		}),
+	)
+
+	c.Send(event.New())
+
+	select {
+	case e := <-rc:
+		if v := e.Get("enriched"); v != "yes" {
+			t.Errorf("expected the next enricher to run, got %q", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event not delivered")
+	}
+
+	c.(io.Closer).Close()
+}
+
+func TestChannelCloseDelivers(t *testing.T) {
+	rc := make(recordingChannel, 10)
+
+	c := Channel(rc, 0, enricherFunc(func(e event.Event) {
+		time.Sleep(time.Millisecond)
+	}))
+
+	for i := 0; i < 5; i++ {
+		c.Send(event.New())
+	}
+
+	if err := c.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rc) != 5 {
+		t.Errorf("expected queued events to be delivered on close, got %d", len(rc))
+	}
+}
@@ -0,0 +1,178 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package geoip
+
+import (
+	"fmt"
+
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+	logging "github.com/op/go-logging"
+	maxminddb "github.com/oschwald/maxminddb-golang"
+)
+
+var (
+	_ = enricher.Register("geoip", New)
+)
+
+var log = logging.MustGetLogger("honeytrap:enricher:geoip")
+
+// Config defines the paths of the MaxMind databases to use, databases which
+// are not configured are skipped. The databases are not downloaded.
+type Config struct {
+	City    string `toml:"city"`
+	Country string `toml:"country"`
+	ASN     string `toml:"asn"`
+}
+
+// GeoIP adds the location and autonomous system of the source-ip to events:
+//
+//	source.country.isocode, source.country.name  (city or country database)
+//	source.city.name, source.location            (city database)
+//	source.asn.number, source.asn.organization   (asn database)
+type GeoIP struct {
+	Config
+
+	city    *maxminddb.Reader
+	country *maxminddb.Reader
+	asn     *maxminddb.Reader
+}
+
+// New returns a new instance of the GeoIP enricher.
+func New(options ...func(enricher.Enricher) error) (enricher.Enricher, error) {
+	g := &GeoIP{}
+
+	for _, optionFn := range options {
+		if err := optionFn(g); err != nil {
+			return nil, err
+		}
+	}
+
+	if g.City == "" && g.Country == "" && g.ASN == "" {
+		return nil, fmt.Errorf("GeoIP enricher: no databases configured")
+	}
+
+	for _, db := range []struct {
+		path   string
+		reader **maxminddb.Reader
+	}{
+		{g.City, &g.city},
+		{g.Country, &g.country},
+		{g.ASN, &g.asn},
+	} {
+		if db.path == "" {
+			continue
+		}
+
+		r, err := maxminddb.Open(db.path)
+		if err != nil {
+			return nil, fmt.Errorf("GeoIP enricher: could not open %s: %s", db.path, err.Error())
+		}
+
+		*db.reader = r
+	}
+
+	return g, nil
+}
+
+type names struct {
+	EN string `maxminddb:"en"`
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+		Names   names  `maxminddb:"names"`
+	} `maxminddb:"country"`
+}
+
+type cityRecord struct {
+	countryRecord
+
+	City struct {
+		Names names `maxminddb:"names"`
+	} `maxminddb:"city"`
+
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// Enrich adds the location and autonomous system of the source-ip.
+func (g *GeoIP) Enrich(e event.Event) {
+	ip := enricher.IP(e, "source-ip")
+	if ip == nil {
+		return
+	}
+
+	if g.city != nil {
+		var record cityRecord
+		if err := g.city.Lookup(ip, &record); err != nil {
+			log.Errorf("Error looking up city for %s: %s", ip, err.Error())
+		} else if record.Country.ISOCode != "" {
+			e.Store("source.country.isocode", record.Country.ISOCode)
+			e.Store("source.country.name", record.Country.Names.EN)
+
+			if record.City.Names.EN != "" {
+				e.Store("source.city.name", record.City.Names.EN)
+			}
+
+			e.Store("source.location", map[string]float64{
+				"lat": record.Location.Latitude,
+				"lon": record.Location.Longitude,
+			})
+		}
+	} else if g.country != nil {
+		var record countryRecord
+		if err := g.country.Lookup(ip, &record); err != nil {
+			log.Errorf("Error looking up country for %s: %s", ip, err.Error())
+		} else if record.Country.ISOCode != "" {
+			e.Store("source.country.isocode", record.Country.ISOCode)
+			e.Store("source.country.name", record.Country.Names.EN)
+		}
+	}
+
+	if g.asn != nil {
+		var record asnRecord
+		if err := g.asn.Lookup(ip, &record); err != nil {
+			log.Errorf("Error looking up asn for %s: %s", ip, err.Error())
+		} else if record.Number != 0 {
+			e.Store("source.asn.number", record.Number)
+			e.Store("source.asn.organization", record.Organization)
+		}
+	}
+}
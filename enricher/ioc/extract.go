@@ -0,0 +1,367 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package ioc
+
+import (
+	"encoding/base64"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	urlPattern = regexp.MustCompile("(?i)\\b(?:https?|ftp|tftp|ldaps?|rmi|dns|iiop|corba|nis|nds)://[^\\s'\"<>|;&`(){}\\[\\]\\\\]+")
+
+	domainPattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,24}\b`)
+
+	emailPattern = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@(?:[a-z0-9-]+\.)+[a-z]{2,24}\b`)
+
+	ipv4Pattern = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9][0-9]|[1-9]?[0-9])\b`)
+
+	ipv6Pattern = regexp.MustCompile(`(?i)[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}(?::(?:[0-9]{1,3}\.){3}[0-9]{1,3})?`)
+
+	hostPattern = regexp.MustCompile(`^(?:[a-zA-Z0-9-]+(?:\.[a-zA-Z0-9-]+)*|\[[0-9a-fA-F:.]+\]|[0-9a-fA-F:]+)$`)
+
+	base64Pattern = regexp.MustCompile(`[A-Za-z0-9+/]{16,}={0,2}`)
+
+	// lookupPattern matches the nested lookups obfuscating a jndi lookup,
+	// like ${lower:j}, ${::-n} and ${env:X:-d}.
+	lookupPattern = regexp.MustCompile(`\$\{[^${}]*[:-]([^${}:-])\}`)
+)
+
+// fileExtensions are top level domains which are more likely to be the
+// extension of a file name, these are only recognized as domain in urls.
+var fileExtensions = map[string]bool{
+	"sh": true, "pl": true, "py": true, "so": true, "bin": true,
+	"exe": true, "cgi": true, "php": true, "asp": true, "aspx": true,
+	"jsp": true, "html": true, "htm": true, "txt": true, "log": true,
+	"conf": true, "cfg": true, "ini": true, "tar": true, "gz": true,
+	"tgz": true, "zip": true, "js": true, "css": true, "png": true,
+	"jpg": true, "gif": true, "xml": true, "json": true, "elf": true,
+	"arm": true, "mips": true, "mpsl": true, "ppc": true, "spc": true,
+	"lua": true, "rb": true, "jar": true, "war": true, "action": true,
+	"do": true, "pid": true, "tmp": true, "bak": true, "old": true,
+}
+
+// Indicators are the indicators of compromise found in text.
+type Indicators struct {
+	URLs    []string
+	Domains []string
+	IPv4    []string
+	IPv6    []string
+	Emails  []string
+	Base64  []string
+	JNDI    []string
+	Markers []string
+
+	seen map[string]bool
+
+	// scanned is the length of the text scanned
+	scanned int
+}
+
+func (i *Indicators) add(list *[]string, kind, value string) {
+	key := kind + "\x00" + value
+	if i.seen[key] {
+		return
+	}
+
+	i.seen[key] = true
+	*list = append(*list, value)
+}
+
+// Len returns the number of indicators.
+func (i *Indicators) Len() int {
+	return len(i.URLs) + len(i.Domains) + len(i.IPv4) + len(i.IPv6) + len(i.Emails) + len(i.Base64) + len(i.JNDI) + len(i.Markers)
+}
+
+// Extractor extracts indicators of compromise from text.
+type Extractor struct {
+	// MaxDepth is the maximum depth of decoding base64 blobs within
+	// decoded base64 blobs.
+	MaxDepth int
+
+	// MaxLength is the maximum length of text scanned, unlimited if 0.
+	MaxLength int
+
+	// MaxTotal is the maximum length of all text scanned by Extract,
+	// including decoded base64 blobs, unlimited if 0.
+	MaxTotal int
+
+	// MaxBase64Length is the maximum length of the decoded base64 blobs
+	// returned, longer blobs are truncated. Unlimited if 0.
+	MaxBase64Length int
+
+	Markers []Marker
+}
+
+// Extract returns the indicators within the texts, in order of appearance.
+func (x *Extractor) Extract(texts ...string) *Indicators {
+	i := &Indicators{
+		seen: map[string]bool{},
+	}
+
+	for _, text := range texts {
+		x.scan(i, text, 0)
+	}
+
+	return i
+}
+
+func (x *Extractor) scan(i *Indicators, text string, depth int) {
+	if x.MaxLength > 0 && len(text) > x.MaxLength {
+		text = text[:x.MaxLength]
+	}
+
+	if x.MaxTotal > 0 {
+		remaining := x.MaxTotal - i.scanned
+		if remaining <= 0 {
+			return
+		} else if len(text) > remaining {
+			text = text[:remaining]
+		}
+	}
+
+	i.scanned += len(text)
+
+	texts := []string{text}
+	if unescaped, err := url.QueryUnescape(text); err == nil && unescaped != text {
+		texts = append(texts, unescaped)
+	}
+
+	for _, text := range texts {
+		if d := deobfuscate(text); d != text {
+			texts = append(texts, d)
+		}
+	}
+
+	for _, text := range texts {
+		for _, lookup := range jndiLookups(text) {
+			i.add(&i.JNDI, "jndi", lookup)
+
+			// the url of the lookup, without obfuscation
+			x.urls(i, lookup)
+		}
+
+		for _, m := range x.Markers {
+			if m.pattern.MatchString(text) {
+				i.add(&i.Markers, "marker", m.Name)
+			}
+		}
+
+		x.urls(i, text)
+
+		for _, email := range emailPattern.FindAllString(text, -1) {
+			i.add(&i.Emails, "email", strings.ToLower(email))
+		}
+
+		for _, loc := range domainPattern.FindAllStringIndex(text, -1) {
+			domain := strings.ToLower(text[loc[0]:loc[1]])
+
+			// the domain of an email address
+			if loc[0] > 0 && strings.ContainsAny(text[loc[0]-1:loc[0]], "@-") {
+				continue
+			}
+
+			if fileExtensions[domain[strings.LastIndex(domain, ".")+1:]] {
+				continue
+			}
+
+			i.add(&i.Domains, "domain", domain)
+		}
+
+		for _, s := range ipv4Pattern.FindAllString(text, -1) {
+			i.add(&i.IPv4, "ip", s)
+		}
+
+		for _, s := range ipv6Pattern.FindAllString(text, -1) {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() == nil && !ip.IsUnspecified() {
+				i.add(&i.IPv6, "ip", ip.String())
+			}
+		}
+
+		for _, s := range base64Pattern.FindAllString(text, -1) {
+			decoded, ok := decodeBase64(s)
+			if !ok {
+				continue
+			}
+
+			// blobs repeated within the text are scanned once
+			key := "base64\x00" + decoded
+			if i.seen[key] {
+				continue
+			}
+
+			i.seen[key] = true
+			i.Base64 = append(i.Base64, truncate(decoded, x.MaxBase64Length))
+
+			if depth < x.MaxDepth {
+				x.scan(i, decoded, depth+1)
+			}
+		}
+	}
+}
+
+func (x *Extractor) urls(i *Indicators, text string) {
+	for _, s := range urlPattern.FindAllString(text, -1) {
+		s = strings.TrimRight(s, ".,:'\"")
+
+		u, err := url.Parse(s)
+		if err != nil || !hostPattern.MatchString(u.Hostname()) {
+			continue
+		}
+
+		i.add(&i.URLs, "url", s)
+
+		host := strings.ToLower(u.Hostname())
+		if ip := net.ParseIP(host); ip == nil && domainPattern.MatchString(host) {
+			i.add(&i.Domains, "domain", host)
+		}
+	}
+}
+
+// deobfuscate replaces the nested lookups obfuscating a jndi lookup by their
+// default values.
+func deobfuscate(s string) string {
+	for i := 0; i < 16; i++ {
+		r := lookupPattern.ReplaceAllString(s, "$1")
+		if r == s {
+			break
+		}
+
+		s = r
+	}
+
+	return s
+}
+
+// jndiLookups returns the jndi lookups within s, like
+// ${jndi:ldap://192.0.2.1/a}, including nested lookups like
+// ${jndi:ldap://${hostName}.example.com/a}.
+func jndiLookups(s string) []string {
+	lookups := []string{}
+
+	// lowered byte by byte, keeping the offsets of s
+	lower := lowerASCII(s)
+	for offset := 0; ; {
+		start := strings.Index(lower[offset:], "${jndi:")
+		if start < 0 {
+			return lookups
+		}
+
+		start += offset
+
+		// the closing brace, skipping nested lookups
+		end, level := -1, 0
+		for j := start; j < len(s) && end < 0; j++ {
+			switch s[j] {
+			case '{':
+				level++
+			case '}':
+				level--
+				if level == 0 {
+					end = j
+				}
+			}
+		}
+
+		if end < 0 {
+			end = len(s) - 1
+		}
+
+		lookups = append(lookups, s[start:end+1])
+		offset = end + 1
+	}
+}
+
+// lowerASCII returns s with the ASCII letters lowered. Unlike
+// strings.ToLower, the result has the length of s, also for invalid utf-8.
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+
+	return string(b)
+}
+
+// truncate returns s cut to at most n bytes, at a rune boundary. s is
+// returned as is if n is 0.
+func truncate(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// decodeBase64 returns the decoded blob, when it decodes to printable text.
+func decodeBase64(s string) (string, bool) {
+	var data []byte
+	var err error
+
+	if strings.HasSuffix(s, "=") || len(s)%4 == 0 {
+		data, err = base64.StdEncoding.DecodeString(s)
+	} else {
+		data, err = base64.RawStdEncoding.DecodeString(s)
+	}
+
+	if err != nil || !printable(data) {
+		return "", false
+	}
+
+	return string(data), true
+}
+
+// printable returns true when data is valid utf-8 consisting of printable
+// characters and white space.
+func printable(data []byte) bool {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return false
+	}
+
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,193 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package ioc contains the ioc enricher, which extracts indicators of
+// compromise from the payloads and commands of events into ioc fields: urls,
+// domains, ip addresses, email addresses, decoded base64 blobs, jndi lookups
+// and markers of known exploits.
+package ioc
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+var (
+	_ = enricher.Register("ioc", New)
+)
+
+// DefaultFields are the fields indicators are extracted from.
+var DefaultFields = []string{
+	"payload",
+	"ssh.command",
+	"ssh.exec",
+	"telnet.command",
+	"http.url",
+	"http.body",
+	"memcached.command",
+	"redis.args",
+}
+
+// Config defines the configuration of the ioc enricher.
+type Config struct {
+	// Fields are the fields indicators are extracted from.
+	Fields []string `toml:"fields"`
+
+	// MaxDepth is the maximum depth of decoding base64 blobs within
+	// decoded base64 blobs, blobs within blobs aren't decoded if 0.
+	MaxDepth int `toml:"max_depth"`
+
+	// MaxLength is the maximum length of a field scanned, MaxTotal of all
+	// fields of an event, including decoded base64 blobs, and
+	// MaxBase64Length of the decoded base64 blobs stored in ioc.base64.
+	// Each is unlimited if 0.
+	MaxLength       int `toml:"max_length"`
+	MaxTotal        int `toml:"max_total"`
+	MaxBase64Length int `toml:"max_base64_length"`
+
+	// Markers maps the names of additional exploit markers to regular
+	// expressions.
+	Markers map[string]string `toml:"markers"`
+}
+
+// IOC extracts indicators of compromise.
+type IOC struct {
+	Config
+
+	x *Extractor
+}
+
+// New returns a new instance of the ioc enricher.
+func New(options ...func(enricher.Enricher) error) (enricher.Enricher, error) {
+	c := &IOC{
+		Config: Config{
+			Fields:          DefaultFields,
+			MaxDepth:        3,
+			MaxLength:       64 * 1024,
+			MaxTotal:        256 * 1024,
+			MaxBase64Length: 1024,
+		},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(c); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, limit := range []struct {
+		name  string
+		value int
+	}{
+		{"max_depth", c.MaxDepth},
+		{"max_length", c.MaxLength},
+		{"max_total", c.MaxTotal},
+		{"max_base64_length", c.MaxBase64Length},
+	} {
+		if limit.value < 0 {
+			return nil, fmt.Errorf("IOC enricher: invalid %s %d", limit.name, limit.value)
+		}
+	}
+
+	c.x = &Extractor{
+		MaxDepth:        c.MaxDepth,
+		MaxLength:       c.MaxLength,
+		MaxTotal:        c.MaxTotal,
+		MaxBase64Length: c.MaxBase64Length,
+		Markers:         defaultMarkers(),
+	}
+
+	names := []string{}
+	for name := range c.Markers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		m, err := NewMarker(name, c.Markers[name])
+		if err != nil {
+			return nil, err
+		}
+
+		c.x.Markers = append(c.x.Markers, m)
+	}
+
+	return c, nil
+}
+
+// Enrich adds the indicators within the fields to the event.
+func (c *IOC) Enrich(e event.Event) {
+	texts := []string{}
+
+	for _, field := range c.Fields {
+		v, ok := e.Load(field)
+		if !ok {
+			continue
+		}
+
+		switch v := v.(type) {
+		case string:
+			texts = append(texts, v)
+		case []byte:
+			texts = append(texts, string(v))
+		case []string:
+			texts = append(texts, v...)
+		}
+	}
+
+	if len(texts) == 0 {
+		return
+	}
+
+	i := c.x.Extract(texts...)
+	if i.Len() == 0 {
+		return
+	}
+
+	for field, values := range map[string][]string{
+		"ioc.urls":    i.URLs,
+		"ioc.domains": i.Domains,
+		"ioc.ipv4":    i.IPv4,
+		"ioc.ipv6":    i.IPv6,
+		"ioc.emails":  i.Emails,
+		"ioc.base64":  i.Base64,
+		"ioc.jndi":    i.JNDI,
+		"ioc.markers": i.Markers,
+	} {
+		if len(values) > 0 {
+			e.Store(field, values)
+		}
+	}
+}
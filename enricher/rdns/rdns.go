@@ -0,0 +1,184 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package rdns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+var (
+	_ = enricher.Register("reverse-dns", New)
+)
+
+// Config defines the configuration of the reverse dns enricher.
+type Config struct {
+	// TTL is the time lookups, including failed lookups, are cached.
+	TTL config.Delay `toml:"ttl"`
+
+	// Timeout is the maximum duration of a lookup.
+	Timeout config.Delay `toml:"timeout"`
+
+	// MaxEntries limits the number of cached lookups.
+	MaxEntries int `toml:"max_entries"`
+
+	// MaxPending limits the number of concurrent lookups.
+	MaxPending int `toml:"max_pending"`
+}
+
+var (
+	defaultTTL        = config.Delay(time.Hour)
+	defaultTimeout    = config.Delay(500 * time.Millisecond)
+	defaultMaxEntries = 10000
+	defaultMaxPending = 64
+)
+
+type entry struct {
+	hostname string
+	expires  time.Time
+}
+
+// ReverseDNS adds the hostname of the source-ip to events as source.hostname,
+// caching the results. Lookups run in the background, so events are only
+// enriched once the hostname of their source-ip is cached.
+type ReverseDNS struct {
+	Config
+
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+
+	m       sync.Mutex
+	cache   map[string]entry
+	pending map[string]bool
+
+	// wg tracks the running lookups
+	wg sync.WaitGroup
+}
+
+// New returns a new instance of the reverse dns enricher.
+func New(options ...func(enricher.Enricher) error) (enricher.Enricher, error) {
+	r := &ReverseDNS{
+		Config: Config{
+			TTL:        defaultTTL,
+			Timeout:    defaultTimeout,
+			MaxEntries: defaultMaxEntries,
+			MaxPending: defaultMaxPending,
+		},
+		lookupAddr: net.DefaultResolver.LookupAddr,
+		cache:      map[string]entry{},
+		pending:    map[string]bool{},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// lookup returns the cached hostname of ip, starting a lookup when it is not
+// cached yet.
+func (r *ReverseDNS) lookup(ip string) string {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if cached, ok := r.cache[ip]; ok && time.Now().Before(cached.expires) {
+		return cached.hostname
+	}
+
+	if r.pending[ip] || len(r.pending) >= r.MaxPending {
+		return ""
+	}
+
+	r.pending[ip] = true
+
+	r.wg.Add(1)
+	go r.resolve(ip)
+
+	return ""
+}
+
+func (r *ReverseDNS) resolve(ip string) {
+	defer r.wg.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout.Duration())
+	defer cancel()
+
+	now := time.Now()
+
+	result := entry{
+		expires: now.Add(r.TTL.Duration()),
+	}
+
+	if names, err := r.lookupAddr(ctx, ip); err == nil && len(names) > 0 {
+		result.hostname = strings.TrimSuffix(names[0], ".")
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	delete(r.pending, ip)
+
+	if len(r.cache) >= r.MaxEntries {
+		for k, v := range r.cache {
+			if now.After(v.expires) {
+				delete(r.cache, k)
+			}
+		}
+	}
+
+	if len(r.cache) >= r.MaxEntries {
+		// still full, start over
+		r.cache = map[string]entry{}
+	}
+
+	r.cache[ip] = result
+}
+
+// Enrich adds the hostname of the source-ip.
+func (r *ReverseDNS) Enrich(e event.Event) {
+	ip := enricher.IP(e, "source-ip")
+	if ip == nil {
+		return
+	}
+
+	if hostname := r.lookup(ip.String()); hostname != "" {
+		e.Store("source.hostname", hostname)
+	}
+}
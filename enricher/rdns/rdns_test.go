@@ -0,0 +1,93 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package rdns
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestEnrich(t *testing.T) {
+	lookups := 0
+
+	e, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := e.(*ReverseDNS)
+	r.lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		r.m.Lock()
+		lookups++
+		r.m.Unlock()
+
+		if addr == "192.0.2.1" {
+			return []string{"scanner.example.com."}, nil
+		}
+
+		return nil, errors.New("no such host")
+	}
+
+	// the first events start the lookups in the background
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		ev := event.New(event.Custom("source-ip", ip))
+		r.Enrich(ev)
+
+		if ev.Has("source.hostname") {
+			t.Errorf("expected no hostname before the lookup completed, got %q", ev.Get("source.hostname"))
+		}
+	}
+
+	r.wg.Wait()
+
+	for i := 0; i < 2; i++ {
+		ev := event.New(event.Custom("source-ip", "192.0.2.1"))
+		r.Enrich(ev)
+
+		if hostname := ev.Get("source.hostname"); hostname != "scanner.example.com" {
+			t.Errorf("expected scanner.example.com, got %q", hostname)
+		}
+
+		ev = event.New(event.Custom("source-ip", "192.0.2.2"))
+		r.Enrich(ev)
+
+		if ev.Has("source.hostname") {
+			t.Errorf("expected no hostname, got %q", ev.Get("source.hostname"))
+		}
+	}
+
+	if lookups != 2 {
+		t.Errorf("expected lookups to be cached, got %d lookups", lookups)
+	}
+}
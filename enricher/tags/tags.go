@@ -0,0 +1,131 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package tags
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+var (
+	_ = enricher.Register("tags", New)
+)
+
+// Config defines the configuration of the tags enricher.
+type Config struct {
+	// Field is the field containing the ip address, source-ip by default.
+	Field string `toml:"field"`
+
+	// CIDR maps networks to the tags of addresses within the network.
+	CIDR map[string][]string `toml:"cidr"`
+}
+
+type network struct {
+	ipnet *net.IPNet
+	tags  []string
+}
+
+// Tags adds the tags of all networks containing the ip address to the tags
+// field of events.
+type Tags struct {
+	Config
+
+	networks []network
+}
+
+// New returns a new instance of the tags enricher.
+func New(options ...func(enricher.Enricher) error) (enricher.Enricher, error) {
+	t := &Tags{
+		Config: Config{
+			Field: "source-ip",
+		},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(t); err != nil {
+			return nil, err
+		}
+	}
+
+	for cidr, tags := range t.CIDR {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Tags enricher: %s", err.Error())
+		}
+
+		t.networks = append(t.networks, network{ipnet, tags})
+	}
+
+	return t, nil
+}
+
+// Enrich adds the tags.
+func (t *Tags) Enrich(e event.Event) {
+	ip := enricher.IP(e, t.Field)
+	if ip == nil {
+		return
+	}
+
+	seen := map[string]bool{}
+
+	if v, ok := e.Load("tags"); !ok {
+	} else if tags, ok := v.([]string); ok {
+		for _, tag := range tags {
+			seen[tag] = true
+		}
+	}
+
+	for _, n := range t.networks {
+		if !n.ipnet.Contains(ip) {
+			continue
+		}
+
+		for _, tag := range n.tags {
+			seen[tag] = true
+		}
+	}
+
+	if len(seen) == 0 {
+		return
+	}
+
+	tags := []string{}
+	for tag := range seen {
+		tags = append(tags, tag)
+	}
+
+	sort.Strings(tags)
+	e.Store("tags", tags)
+}
@@ -0,0 +1,92 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package tags
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/enricher"
+	"github.com/honeytrap/honeytrap/event"
+)
+
+const config = `
+[tags]
+[tags.cidr]
+"10.0.0.0/8" = ["internal"]
+"10.1.0.0/16" = ["lab", "internal"]
+"192.0.2.0/24" = ["scanner"]
+`
+
+func TestEnrich(t *testing.T) {
+	s := struct {
+		Tags toml.Primitive
+	}{}
+
+	if _, err := toml.Decode(config, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	tg, err := New(enricher.WithConfig(s.Tags))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip   string
+		tags []string
+	}{
+		{"10.1.2.3", []string{"internal", "lab"}},
+		{"10.2.2.3", []string{"internal"}},
+		{"192.0.2.10", []string{"known", "scanner"}},
+		{"198.51.100.1", nil},
+	}
+
+	for _, test := range tests {
+		e := event.New(
+			event.Custom("source-ip", test.ip),
+		)
+
+		if test.ip == "192.0.2.10" {
+			e.Store("tags", []string{"known"})
+		}
+
+		tg.Enrich(e)
+
+		v, _ := e.Load("tags")
+		if test.tags == nil && v != nil {
+			t.Errorf("%s: expected no tags, got %v", test.ip, v)
+		} else if test.tags != nil && !reflect.DeepEqual(v, test.tags) {
+			t.Errorf("%s: expected %v, got %v", test.ip, test.tags, v)
+		}
+	}
+}
@@ -31,6 +31,7 @@
 package event
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"net"
@@ -72,6 +73,7 @@ var (
 	ContainerTarred      = Type("CONTAINER:TARRED")
 	ContainerCheckpoint  = Type("CONTAINER:CHECKPOINT")
 	ContainerPcaped      = Type("CONTAINER:PCAPED")
+	ArtifactStored       = Type("ARTIFACT:STORED")
 )
 
 //====================================================================================
@@ -132,6 +134,64 @@ func Token(token string) Option {
 	}
 }
 
+type contextKey int
+
+const (
+	sessionKey contextKey = iota
+	serviceKey
+)
+
+// NewSessionContext returns a copy of ctx carrying the session id.
+func NewSessionContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey, id)
+}
+
+// SessionFromContext returns the session id carried by ctx, if any.
+func SessionFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	id, ok := ctx.Value(sessionKey).(string)
+	return id, ok
+}
+
+// Session returns an option for setting the session-id value to the session
+// id carried by ctx.
+func Session(ctx context.Context) Option {
+	return func(m Event) {
+		if id, ok := SessionFromContext(ctx); ok {
+			m.Store("session-id", id)
+		}
+	}
+}
+
+// NewServiceContext returns a copy of ctx carrying the name of the service
+// handling the session.
+func NewServiceContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, serviceKey, name)
+}
+
+// ServiceFromContext returns the service name carried by ctx, if any.
+func ServiceFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	name, ok := ctx.Value(serviceKey).(string)
+	return name, ok
+}
+
+// ContextService returns an option for setting the service value to the
+// service name carried by ctx.
+func ContextService(ctx context.Context) Option {
+	return func(m Event) {
+		if name, ok := ServiceFromContext(ctx); ok {
+			m.Store("service", name)
+		}
+	}
+}
+
 // Category returns an option for setting the category value.
 func Category(s string) Option {
 	return func(m Event) {
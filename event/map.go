@@ -34,6 +34,8 @@ import (
 	"encoding/json"
 	"sync"
 	"time"
+
+	uuid "github.com/satori/go.uuid"
 )
 
 // Event defines a object which adds key-value pairs into a map type for event data.
@@ -54,12 +56,14 @@ func (e Event) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
-// New returns a new Event with the options applied.
+// New returns a new Event with the options applied. Every event has a
+// unique event-id and the date it was created.
 func New(opts ...Option) Event {
 	e := Event{
 		sm: new(sync.Map),
 	}
 
+	e.sm.Store("event-id", uuid.NewV4().String())
 	e.sm.Store("date", time.Now())
 
 	for _, opt := range opts {
@@ -86,6 +90,11 @@ func (e Event) Has(s string) bool {
 	return ok
 }
 
+// Load retrieves the value stored for the key, and whether it exists.
+func (e Event) Load(s string) (interface{}, bool) {
+	return e.sm.Load(s)
+}
+
 // Get retrieves a giving value for a key has string.
 func (e Event) Get(s string) string {
 	if v, ok := e.sm.Load(s); !ok {
@@ -0,0 +1,177 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// blockedNetworks are the networks never fetched from, unless allowed
+// explicitly: private, loopback, link local, shared, documentation,
+// multicast and reserved ranges, and NAT64 which reaches ipv4 addresses
+// through ipv6.
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks, err := parseCIDRs(cidrs...)
+	if err != nil {
+		panic(err)
+	}
+
+	return networks
+}
+
+func parseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		networks = append(networks, n)
+	}
+
+	return networks, nil
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// egress dials the hosts urls are fetched from, directly or through a socks
+// proxy. Hosts are resolved before dialing, connections to blocked addresses
+// are refused, also when reached by a redirect.
+type egress struct {
+	allowed []*net.IPNet
+
+	direct *net.Dialer
+	proxy  proxy.Dialer
+}
+
+func newEgress(proxyURL string, allowed []*net.IPNet, timeout time.Duration) (*egress, error) {
+	e := &egress{
+		allowed: allowed,
+		direct: &net.Dialer{
+			Timeout: timeout,
+		},
+	}
+
+	if proxyURL == "" {
+		return e, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := proxy.FromURL(u, e.direct)
+	if err != nil {
+		return nil, err
+	}
+
+	e.proxy = d
+	return e, nil
+}
+
+func (e *egress) blocked(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	return contains(blockedNetworks, ip) && !contains(e.allowed, ip)
+}
+
+// DialContext resolves the host of addr and dials the first address, when
+// none of its addresses are blocked.
+func (e *egress) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	} else if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+
+	for _, a := range addrs {
+		if e.blocked(a.IP) {
+			return nil, fmt.Errorf("address %s of %s is blocked", a.IP, host)
+		}
+	}
+
+	target := net.JoinHostPort(addrs[0].IP.String(), port)
+
+	if e.proxy != nil {
+		return e.proxy.Dial(network, target)
+	}
+
+	return e.direct.DialContext(ctx, network, target)
+}
@@ -0,0 +1,95 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package fetcher
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// urlPattern matches http and https urls, up to the first character
+// terminating a shell word.
+var urlPattern = regexp.MustCompile("(?i)\\bhttps?://[^\\s'\"<>|;&`(){}\\[\\]\\\\]+")
+
+// downloadPattern matches wget and curl commands, up to the end of the
+// command.
+var downloadPattern = regexp.MustCompile("(?i)\\b(?:wget|curl)\\s[^;|&\\n`]*")
+
+// hostPattern matches the arguments of wget and curl without scheme, like
+// 192.0.2.1/bins.sh and example.com:8080/x.
+var hostPattern = regexp.MustCompile(`(?i)^[a-z0-9-]+(?:\.[a-z0-9-]+)+(?::[0-9]+)?/\S*$`)
+
+// Extract returns the http and https urls within s, in order of appearance.
+// Arguments of wget and curl without scheme are returned as http urls, url
+// encoded text is decoded first.
+func Extract(s string) []string {
+	texts := []string{s}
+	if unescaped, err := url.QueryUnescape(s); err == nil && unescaped != s {
+		texts = append(texts, unescaped)
+	}
+
+	seen := map[string]bool{}
+	urls := []string{}
+
+	add := func(u string) {
+		u = strings.TrimRight(u, ".,:'\"")
+		if seen[u] {
+			return
+		}
+
+		if parsed, err := url.Parse(u); err != nil || parsed.Host == "" {
+			return
+		}
+
+		seen[u] = true
+		urls = append(urls, u)
+	}
+
+	for _, text := range texts {
+		for _, u := range urlPattern.FindAllString(text, -1) {
+			add(u)
+		}
+
+		for _, cmd := range downloadPattern.FindAllString(text, -1) {
+			for _, arg := range strings.Fields(cmd)[1:] {
+				arg = strings.Trim(arg, `'"`)
+				if strings.HasPrefix(arg, "-") || !hostPattern.MatchString(arg) {
+					continue
+				}
+
+				add("http://" + arg)
+			}
+		}
+	}
+
+	return urls
+}
@@ -0,0 +1,448 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package fetcher fetches the urls observed in attacker commands and
+// payloads, like the wget and curl commands of droppers, into a quarantine
+// directory. Files are fetched through a configurable egress, with size and
+// time limits, and never from private addresses.
+package fetcher
+
+import (
+	"container/list"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/artifact"
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:fetcher")
+
+// Category is the category of fetcher events.
+const Category = "fetcher"
+
+var (
+	// FetchCompleted is the type of the event of a fetched url.
+	FetchCompleted = event.Type("FETCH:COMPLETED")
+
+	// FetchFailed is the type of the event of an url that could not be
+	// fetched.
+	FetchFailed = event.Type("FETCH:FAILED")
+)
+
+// DefaultFields are the event fields urls are extracted from.
+var DefaultFields = []string{
+	"payload",
+	"ssh.command",
+	"ssh.exec",
+	"telnet.command",
+	"http.url",
+	"http.body",
+	"redis.args",
+	"ioc.urls",
+}
+
+// maxSeen is the number of fetched urls remembered, the least recently
+// seen urls are forgotten first.
+const maxSeen = 10000
+
+// request is an url to fetch, observed in event.
+type request struct {
+	url   string
+	event event.Event
+}
+
+// Fetcher is a channel fetching the urls within the events it receives.
+type Fetcher struct {
+	Enabled bool   `toml:"enabled"`
+	Path    string `toml:"path"`
+
+	// Proxy is the url of the socks5 proxy urls are fetched through, eg.
+	// socks5://127.0.0.1:9050.
+	Proxy string `toml:"proxy"`
+
+	// AllowNetworks are the private networks urls may be fetched from.
+	AllowNetworks []string `toml:"allow_networks"`
+
+	Fields []string `toml:"fields"`
+
+	Timeout         config.Delay `toml:"timeout"`
+	MaxSize         int64        `toml:"max_size"`
+	Quota           int64        `toml:"quota"`
+	MaxRedirects    int          `toml:"max_redirects"`
+	RefetchInterval config.Delay `toml:"refetch_interval"`
+	UserAgent       string       `toml:"user_agent"`
+	Workers         int          `toml:"workers"`
+
+	dataDir string
+
+	channel pushers.Channel
+
+	client *http.Client
+	store  *artifact.Store
+
+	m    sync.Mutex
+	seen map[string]*list.Element
+	// recent contains the seen urls, the most recently seen first
+	recent *list.List
+
+	queue chan request
+}
+
+// New returns a Fetcher, configured by options. The fetcher starts fetching
+// after Start.
+func New(options ...func(*Fetcher) error) (*Fetcher, error) {
+	f := &Fetcher{
+		Path:            "quarantine",
+		Fields:          DefaultFields,
+		Timeout:         config.Delay(time.Minute),
+		MaxSize:         artifact.DefaultMaxSize,
+		Quota:           artifact.DefaultQuota,
+		MaxRedirects:    5,
+		RefetchInterval: config.Delay(time.Hour),
+		UserAgent:       "Wget/1.19.4 (linux-gnu)",
+		Workers:         2,
+		channel:         pushers.MustDummy(),
+		seen:            map[string]*list.Element{},
+		recent:          list.New(),
+		queue:           make(chan request, 100),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(f); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid timeout %s", f.Timeout.Duration())
+	}
+
+	if f.Workers <= 0 {
+		return nil, fmt.Errorf("invalid workers %d", f.Workers)
+	}
+
+	allowed, err := parseCIDRs(f.AllowNetworks...)
+	if err != nil {
+		return nil, err
+	}
+
+	eg, err := newEgress(f.Proxy, allowed, f.Timeout.Duration())
+	if err != nil {
+		return nil, err
+	}
+
+	f.client = &http.Client{
+		Timeout: f.Timeout.Duration(),
+		Transport: &http.Transport{
+			// the egress is configured explicitly, never by the
+			// environment
+			Proxy:       nil,
+			DialContext: eg.DialContext,
+			// droppers are often hosted with invalid certificates
+			TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+			TLSHandshakeTimeout:   f.Timeout.Duration(),
+			ResponseHeaderTimeout: f.Timeout.Duration(),
+			DisableKeepAlives:     true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= f.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", len(via))
+			}
+
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("unsupported redirect to %s", req.URL)
+			}
+
+			return nil
+		},
+	}
+
+	f.store, err = artifact.New(
+		artifact.WithPath(f.Dir()),
+		func(s *artifact.Store) error {
+			s.MaxSize = f.MaxSize
+			s.Quota = f.Quota
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// WithConfig decodes the fetcher configuration.
+func WithConfig(c toml.Primitive) func(*Fetcher) error {
+	return func(f *Fetcher) error {
+		return toml.PrimitiveDecode(c, f)
+	}
+}
+
+// WithDataDir sets the directory relative paths are resolved against.
+func WithDataDir(dataDir string) func(*Fetcher) error {
+	return func(f *Fetcher) error {
+		f.dataDir = dataDir
+		return nil
+	}
+}
+
+// WithPath sets the quarantine directory.
+func WithPath(path string) func(*Fetcher) error {
+	return func(f *Fetcher) error {
+		f.Path = path
+		return nil
+	}
+}
+
+// WithChannel sets the channel the fetcher events are sent to.
+func WithChannel(channel pushers.Channel) func(*Fetcher) error {
+	return func(f *Fetcher) error {
+		f.channel = channel
+		return nil
+	}
+}
+
+// Dir returns the quarantine directory.
+func (f *Fetcher) Dir() string {
+	if filepath.IsAbs(f.Path) {
+		return f.Path
+	}
+
+	return filepath.Join(f.dataDir, f.Path)
+}
+
+// Client returns the client urls are fetched with, dialing through the
+// egress. It can be used when the fetcher is disabled.
+func (f *Fetcher) Client() *http.Client {
+	return f.client
+}
+
+// Store returns the store of the quarantined files.
+func (f *Fetcher) Store() *artifact.Store {
+	return f.store
+}
+
+// Start loads the quarantine directory and starts the workers fetching the
+// urls.
+func (f *Fetcher) Start() error {
+	if err := f.store.Load(); err != nil {
+		return err
+	}
+
+	for i := 0; i < f.Workers; i++ {
+		go f.run()
+	}
+
+	return nil
+}
+
+// Send queues the urls within the fields of the event, which haven't been
+// fetched within the refetch interval. Fetcher and artifact events are
+// ignored.
+func (f *Fetcher) Send(e event.Event) {
+	if category := e.Get("category"); category == Category || category == artifact.Category {
+		return
+	}
+
+	urls := []string{}
+
+	for _, field := range f.Fields {
+		v, ok := e.Load(field)
+		if !ok {
+			continue
+		}
+
+		switch v := v.(type) {
+		case string:
+			urls = append(urls, Extract(v)...)
+		case []byte:
+			urls = append(urls, Extract(string(v))...)
+		case []string:
+			for _, s := range v {
+				urls = append(urls, Extract(s)...)
+			}
+		}
+	}
+
+	for _, u := range urls {
+		if !f.first(u) {
+			continue
+		}
+
+		// fetching takes time, Send is called by the bus
+		select {
+		case f.queue <- request{url: u, event: e}:
+		default:
+			log.Errorf("Dropping url %s: queue full", u)
+		}
+	}
+}
+
+// seenURL is an url and the time it was last fetched.
+type seenURL struct {
+	url     string
+	fetched time.Time
+}
+
+// first returns true when the url hasn't been fetched within the refetch
+// interval.
+func (f *Fetcher) first(u string) bool {
+	now := time.Now()
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if e, ok := f.seen[u]; ok {
+		f.recent.MoveToFront(e)
+
+		s := e.Value.(*seenURL)
+		if now.Sub(s.fetched) < f.RefetchInterval.Duration() {
+			return false
+		}
+
+		s.fetched = now
+		return true
+	}
+
+	f.seen[u] = f.recent.PushFront(&seenURL{url: u, fetched: now})
+
+	for f.recent.Len() > maxSeen {
+		s := f.recent.Remove(f.recent.Back()).(*seenURL)
+		delete(f.seen, s.url)
+	}
+
+	return true
+}
+
+func (f *Fetcher) run() {
+	for r := range f.queue {
+		f.channel.Send(f.fetch(r))
+	}
+}
+
+// fetch fetches the url into the quarantine, returning the event linking the
+// url to the stored file.
+func (f *Fetcher) fetch(r request) event.Event {
+	options := []event.Option{
+		event.Sensor(Category),
+		event.Category(Category),
+		event.Custom("fetcher.url", r.url),
+		event.Custom("fetcher.event-id", r.event.Get("event-id")),
+	}
+
+	for _, key := range []string{"session-id", "source-ip"} {
+		if v, ok := r.event.Load(key); ok {
+			options = append(options, event.Custom(key, v))
+		}
+	}
+
+	a, resp, err := f.get(r)
+	if resp != nil {
+		options = append(options,
+			event.Custom("fetcher.status", resp.StatusCode),
+			event.Custom("fetcher.final-url", resp.Request.URL.String()),
+		)
+	}
+
+	if err != nil {
+		log.Errorf("Error fetching %s: %s", r.url, err.Error())
+
+		return event.New(append(options,
+			FetchFailed,
+			event.Custom("fetcher.error", err.Error()),
+		)...)
+	}
+
+	log.Infof("Fetched %s: %s", r.url, a.SHA256)
+
+	return event.New(append(options,
+		FetchCompleted,
+		event.Custom("fetcher.sha256", a.SHA256),
+		event.Custom("fetcher.sha1", a.SHA1),
+		event.Custom("fetcher.md5", a.MD5),
+		event.Custom("fetcher.size", a.Size),
+		event.Custom("fetcher.mime-type", a.MimeType),
+		event.Custom("fetcher.count", a.Count),
+	)...)
+}
+
+// get fetches the url into the quarantine, the response is returned when the
+// request was sent.
+func (f *Fetcher) get(r request) (*artifact.Artifact, *http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req.Header.Set("User-Agent", f.UserAgent)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp, errors.New(resp.Status)
+	}
+
+	service := r.event.Get("service")
+	if service == "" {
+		service = r.event.Get("category")
+	}
+
+	src := artifact.Source{
+		Service:   service,
+		SessionID: r.event.Get("session-id"),
+		SourceIP:  r.event.Get("source-ip"),
+		Filename:  path.Base(resp.Request.URL.Path),
+		URL:       r.url,
+		Date:      time.Now(),
+	}
+
+	a, err := f.store.Put(io.LimitReader(resp.Body, f.MaxSize+1), src)
+	return a, resp, err
+}
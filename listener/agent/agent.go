@@ -250,7 +250,7 @@ func (al *agentListener) Start(ctx context.Context) error {
 		listen = al.Listen
 	}
 
-	listener, err := libdisco.Listen("tcp", listen, &serverConfig)
+	ln, err := libdisco.Listen("tcp", listen, &serverConfig)
 	if err != nil {
 		fmt.Println(color.RedString("Error starting listener: %s", err.Error()))
 		return err
@@ -260,9 +260,10 @@ func (al *agentListener) Start(ctx context.Context) error {
 
 	go func() {
 		for {
-			c, err := listener.Accept()
+			c, err := ln.Accept()
 			if err != nil {
 				log.Errorf("Error accepting connection: %s", err.Error())
+				listener.AcceptErrors.Inc("agent")
 				continue
 			}
 
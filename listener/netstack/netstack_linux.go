@@ -174,7 +174,7 @@ func (l *netstackListener) Start(ctx context.Context) error {
 	for _, address := range l.Addresses {
 		go func(address net.Addr) {
 			if ta, ok := address.(*net.TCPAddr); ok {
-				listener, err := gonet.NewListener(s, tcpip.FullAddress{
+				ln, err := gonet.NewListener(s, tcpip.FullAddress{
 					NIC:  0,
 					Addr: tcpip.Address(ta.IP),
 					Port: uint16(ta.Port),
@@ -183,12 +183,13 @@ func (l *netstackListener) Start(ctx context.Context) error {
 					log.Fatal(err)
 				}
 
-				defer listener.Close()
+				defer ln.Close()
 
 				for {
-					conn, err := listener.Accept()
+					conn, err := ln.Accept()
 					if err != nil {
 						log.Error(err.Error())
+						listener.AcceptErrors.Inc("netstack")
 						continue
 					}
 
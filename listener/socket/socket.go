@@ -93,6 +93,7 @@ func (sl *socketListener) Start(ctx context.Context) error {
 					c, err := l.Accept()
 					if err != nil {
 						log.Errorf("Error accepting connection: %s", err.Error())
+						listener.AcceptErrors.Inc("socket")
 						continue
 					}
 
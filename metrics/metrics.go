@@ -0,0 +1,237 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package metrics contains counters and gauges, exported in the Prometheus
+// text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	m       sync.Mutex
+	metrics = map[string]metric{}
+)
+
+func register(name string, mt metric) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := metrics[name]; ok {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+
+	metrics[name] = mt
+}
+
+// vec contains the values of a metric, per combination of label values.
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	m      sync.Mutex
+	values map[string]float64
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	v := &vec{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		values: map[string]float64{},
+	}
+
+	register(name, v)
+	return v
+}
+
+// labelEscaper escapes label values as defined by the text exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// key returns the formatted labels of the values.
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+
+	if len(values) == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = fmt.Sprintf("%s=\"%s\"", v.labels[i], labelEscaper.Replace(value))
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (v *vec) add(delta float64, values []string) {
+	key := v.key(values)
+
+	v.m.Lock()
+	v.values[key] += delta
+	v.m.Unlock()
+}
+
+func (v *vec) set(value float64, values []string) {
+	key := v.key(values)
+
+	v.m.Lock()
+	v.values[key] = value
+	v.m.Unlock()
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, key, format(v.values[key]))
+	}
+}
+
+func format(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+// CounterVec defines a counter, per combination of label values.
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec returns a registered counter with the labels.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, "counter", labels)}
+}
+
+// Inc increments the counter of the label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.add(1, values)
+}
+
+// Add adds delta, which should be positive, to the counter of the label
+// values.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %s can't decrease", c.name))
+	}
+
+	c.add(delta, values)
+}
+
+// GaugeVec defines a gauge, per combination of label values.
+type GaugeVec struct {
+	*vec
+}
+
+// NewGaugeVec returns a registered gauge with the labels.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, "gauge", labels)}
+}
+
+// Set sets the gauge of the label values.
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.set(value, values)
+}
+
+// Add adds delta to the gauge of the label values.
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.add(delta, values)
+}
+
+// Write writes all metrics in the Prometheus text format.
+func Write(w *bufio.Writer) {
+	m.Lock()
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+
+	m.Unlock()
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		m.Lock()
+		mt := metrics[name]
+		m.Unlock()
+
+		mt.write(w)
+	}
+}
+
+// Handler returns the http handler serving all metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		w := bufio.NewWriter(rw)
+		defer w.Flush()
+
+		Write(w)
+	})
+}
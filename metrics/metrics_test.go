@@ -0,0 +1,119 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := NewCounterVec("test_counter_total", "Test counter.", "a", "b")
+	c.Inc("x", "y")
+	c.Add(2, "x", "y")
+	c.Inc("x", "quote\"")
+
+	buf := &bytes.Buffer{}
+	w := bufio.NewWriter(buf)
+	c.write(w)
+	w.Flush()
+
+	expected := "# HELP test_counter_total Test counter.\n" +
+		"# TYPE test_counter_total counter\n" +
+		"test_counter_total{a=\"x\",b=\"quote\\\"\"} 1\n" +
+		"test_counter_total{a=\"x\",b=\"y\"} 3\n"
+
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	c := NewCounterVec("test_escaping_total", "Test escaping.", "a")
+	c.Inc("back\\slash\nnew line é \x00")
+
+	buf := &bytes.Buffer{}
+	w := bufio.NewWriter(buf)
+	c.write(w)
+	w.Flush()
+
+	expected := "test_escaping_total{a=\"back\\\\slash\\nnew line é \x00\"} 1\n"
+
+	if !strings.HasSuffix(buf.String(), expected) {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, buf.String())
+	}
+}
+
+func TestGaugeVec(t *testing.T) {
+	g := NewGaugeVec("test_gauge", "Test gauge.")
+	g.Set(5)
+	g.Add(-2)
+
+	buf := &bytes.Buffer{}
+	w := bufio.NewWriter(buf)
+	g.write(w)
+	w.Flush()
+
+	if !strings.HasSuffix(buf.String(), "test_gauge 3\n") {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	c := NewCounterVec("test_labels_total", "Test labels.", "a")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on label count mismatch")
+		}
+	}()
+
+	c.Inc("x", "y")
+}
+
+func TestHandler(t *testing.T) {
+	NewCounterVec("test_handler_total", "Test handler.").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.Contains(rec.Body.String(), "test_handler_total 1\n") {
+		t.Errorf("unexpected output:\n%s", rec.Body.String())
+	}
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("unexpected content type %s", ct)
+	}
+}
@@ -0,0 +1,270 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// AggregateConfig defines the configuration of an aggregating channel.
+type AggregateConfig struct {
+	// Keys are the fields events are grouped by.
+	Keys []string `toml:"keys"`
+
+	// Window is the duration events are grouped for, starting at the first
+	// event of a group.
+	Window string `toml:"window"`
+
+	// Fields are the fields of which the distinct values are collected.
+	Fields []string `toml:"fields"`
+
+	// MaxValues limits the number of distinct values collected per field.
+	MaxValues int `toml:"max_values"`
+
+	// Match is an expression selecting the events to aggregate, all events
+	// are aggregated when empty.
+	Match string `toml:"match"`
+}
+
+const defaultAggregateMaxValues = 100
+
+// aggregate collects the events of a single group.
+type aggregate struct {
+	first event.Event
+
+	timer *time.Timer
+
+	count     int
+	firstSeen time.Time
+	lastSeen  time.Time
+
+	values map[string]map[string]bool
+}
+
+type aggregateChannel struct {
+	Channel
+
+	keys      []string
+	window    time.Duration
+	fields    []string
+	maxValues int
+	match     FilterFunc
+
+	m          sync.Mutex
+	aggregates map[string]*aggregate
+	closed     bool
+
+	// serializes sends to the underlying channel
+	sendM sync.Mutex
+}
+
+// AggregateChannel returns a Channel which groups the events matching fn by
+// the values of keys within window, delivering a single summary event per group
+// instead of the raw events. Events not matching fn are delivered as is.
+//
+// The summary event contains the sensor, category, type and service of the
+// first event, the keys and the aggregate.count, aggregate.first-seen,
+// aggregate.last-seen fields and for every field in fields the distinct values
+// as aggregate.<field>.
+func AggregateChannel(channel Channel, keys []string, window time.Duration, fields []string, maxValues int, fn FilterFunc) Channel {
+	if maxValues <= 0 {
+		maxValues = defaultAggregateMaxValues
+	}
+
+	return &aggregateChannel{
+		Channel:    channel,
+		keys:       keys,
+		window:     window,
+		fields:     fields,
+		maxValues:  maxValues,
+		match:      fn,
+		aggregates: map[string]*aggregate{},
+	}
+}
+
+// Send adds the event to its group, or delivers it when it doesn't match.
+func (ac *aggregateChannel) Send(e event.Event) {
+	if ac.match != nil && !ac.match(e) {
+		ac.send(e)
+		return
+	}
+
+	values := make([]string, len(ac.keys))
+	for i, key := range ac.keys {
+		v, ok := e.Load(key)
+		if !ok {
+			// events without the keys can't be grouped
+			ac.send(e)
+			return
+		}
+
+		values[i] = toString(v)
+	}
+
+	key := strings.Join(values, "\x00")
+
+	seen := time.Now()
+	if date, ok := e.Load("date"); !ok {
+	} else if t, ok := date.(time.Time); ok {
+		seen = t
+	}
+
+	ac.m.Lock()
+	defer ac.m.Unlock()
+
+	if ac.closed {
+		// the summary would never be delivered
+		ac.send(e)
+		return
+	}
+
+	a, ok := ac.aggregates[key]
+	if !ok {
+		a = &aggregate{
+			first:     e,
+			firstSeen: seen,
+			values:    map[string]map[string]bool{},
+		}
+
+		for _, field := range ac.fields {
+			a.values[field] = map[string]bool{}
+		}
+
+		ac.aggregates[key] = a
+
+		a.timer = time.AfterFunc(ac.window, func() {
+			ac.flush(key)
+		})
+	}
+
+	a.count++
+	a.lastSeen = seen
+
+	for _, field := range ac.fields {
+		v, ok := e.Load(field)
+		if !ok {
+			continue
+		}
+
+		if len(a.values[field]) >= ac.maxValues {
+			continue
+		}
+
+		a.values[field][toString(v)] = true
+	}
+}
+
+// Close stops the windows and delivers the summaries of all pending groups,
+// events sent afterwards are delivered as is.
+func (ac *aggregateChannel) Close() error {
+	ac.m.Lock()
+	ac.closed = true
+
+	keys := []string{}
+	for key, a := range ac.aggregates {
+		a.timer.Stop()
+		keys = append(keys, key)
+	}
+
+	ac.m.Unlock()
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		ac.flush(key)
+	}
+
+	return nil
+}
+
+func (ac *aggregateChannel) flush(key string) {
+	ac.m.Lock()
+	a, ok := ac.aggregates[key]
+	delete(ac.aggregates, key)
+	ac.m.Unlock()
+
+	if !ok {
+		return
+	}
+
+	ac.send(ac.summary(a))
+}
+
+// summary returns the summary event of the group.
+func (ac *aggregateChannel) summary(a *aggregate) event.Event {
+	options := []event.Option{}
+
+	for _, name := range append([]string{"sensor", "category", "type", "service"}, ac.keys...) {
+		if v, ok := a.first.Load(name); ok {
+			options = append(options, event.Custom(name, v))
+		}
+	}
+
+	options = append(options,
+		event.Custom("aggregate.count", a.count),
+		event.Custom("aggregate.first-seen", a.firstSeen),
+		event.Custom("aggregate.last-seen", a.lastSeen),
+	)
+
+	for _, field := range ac.fields {
+		values := []string{}
+		for v := range a.values[field] {
+			values = append(values, v)
+		}
+
+		sort.Strings(values)
+
+		options = append(options, event.Custom("aggregate."+field, values))
+	}
+
+	return event.New(options...)
+}
+
+func (ac *aggregateChannel) send(e event.Event) {
+	ac.sendM.Lock()
+	defer ac.sendM.Unlock()
+
+	ac.Channel.Send(e)
+}
+
+func toString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,167 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+type recordingChannel struct {
+	ch chan event.Event
+}
+
+func (c *recordingChannel) Send(e event.Event) {
+	c.ch <- e
+}
+
+func TestAggregateChannel(t *testing.T) {
+	rc := &recordingChannel{ch: make(chan event.Event, 10)}
+
+	match := func(e event.Event) bool {
+		return e.Get("type") == "password-authentication"
+	}
+
+	c := AggregateChannel(rc, []string{"source-ip", "category"}, 50*time.Millisecond, []string{"ssh.username"}, 0, match)
+
+	for _, username := range []string{"root", "admin", "root"} {
+		c.Send(event.New(
+			event.Category("ssh"),
+			event.Type("password-authentication"),
+			event.Custom("source-ip", "1.2.3.4"),
+			event.Custom("ssh.username", username),
+		))
+	}
+
+	c.Send(event.New(
+		event.Category("ssh"),
+		event.Type("password-authentication"),
+		event.Custom("source-ip", "5.6.7.8"),
+		event.Custom("ssh.username", "pi"),
+	))
+
+	// not matching, delivered immediately
+	c.Send(event.New(
+		event.Category("ssh"),
+		event.Type("session-started"),
+		event.Custom("source-ip", "1.2.3.4"),
+	))
+
+	select {
+	case e := <-rc.ch:
+		if e.Get("type") != "session-started" {
+			t.Fatalf("expected non matching event, got %s", e.Get("type"))
+		}
+	case <-time.After(10 * time.Millisecond):
+		t.Fatal("non matching event not delivered")
+	}
+
+	summaries := map[string]map[string]interface{}{}
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-rc.ch:
+			summaries[e.Get("source-ip")] = event.ToMap(e)
+		case <-time.After(time.Second):
+			t.Fatal("summary not delivered")
+		}
+	}
+
+	s := summaries["1.2.3.4"]
+	if s["aggregate.count"] != 3 {
+		t.Errorf("expected count 3, got %v", s["aggregate.count"])
+	}
+
+	if v := s["aggregate.ssh.username"]; !reflect.DeepEqual(v, []string{"admin", "root"}) {
+		t.Errorf("expected distinct usernames, got %v", v)
+	}
+
+	if s["category"] != "ssh" || s["type"] != "password-authentication" {
+		t.Errorf("expected category and type of first event, got %v %v", s["category"], s["type"])
+	}
+
+	if first, last := s["aggregate.first-seen"].(time.Time), s["aggregate.last-seen"].(time.Time); last.Before(first) {
+		t.Errorf("last seen %s before first seen %s", last, first)
+	}
+
+	if s := summaries["5.6.7.8"]; s["aggregate.count"] != 1 {
+		t.Errorf("expected count 1, got %v", s["aggregate.count"])
+	}
+
+	select {
+	case e := <-rc.ch:
+		t.Errorf("unexpected event: %v", event.ToMap(e))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestAggregateChannelClose(t *testing.T) {
+	rc := &recordingChannel{ch: make(chan event.Event, 10)}
+
+	c := AggregateChannel(rc, []string{"source-ip"}, time.Hour, nil, 0, nil)
+
+	for _, ip := range []string{"1.2.3.4", "1.2.3.4", "5.6.7.8"} {
+		c.Send(event.New(
+			event.Custom("source-ip", ip),
+		))
+	}
+
+	if err := c.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []int{2, 1} {
+		select {
+		case e := <-rc.ch:
+			if v := event.ToMap(e)["aggregate.count"]; v != expected {
+				t.Errorf("expected count %d, got %v", expected, v)
+			}
+		default:
+			t.Fatal("pending summary not delivered on close")
+		}
+	}
+
+	c.Send(event.New(
+		event.Custom("source-ip", "1.2.3.4"),
+	))
+
+	select {
+	case e := <-rc.ch:
+		if _, ok := e.Load("aggregate.count"); ok {
+			t.Error("expected event sent after close to be delivered as is")
+		}
+	default:
+		t.Fatal("event sent after close not delivered")
+	}
+}
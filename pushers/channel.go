@@ -41,6 +41,21 @@ type Channel interface {
 	Send(event.Event)
 }
 
+// HealthChecker is implemented by channels that know whether their backend
+// is reachable, so events can be held back while it isn't.
+type HealthChecker interface {
+	Healthy() bool
+}
+
+// Healthy returns false if the channel reports its backend is unreachable.
+func Healthy(c Channel) bool {
+	if hc, ok := c.(HealthChecker); ok {
+		return hc.Healthy()
+	}
+
+	return true
+}
+
 type ChannelFunc func(...func(Channel) error) (Channel, error)
 
 var (
@@ -31,14 +31,16 @@
 package elasticsearch
 
 import (
-	"crypto/tls"
 	"errors"
-	"strings"
-
+	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/pushers"
+
 	elastic "gopkg.in/olivere/elastic.v5"
 )
 
@@ -49,58 +51,155 @@ var (
 
 // Config defines a struct which holds configuration values for a SearchBackend.
 type Config struct {
-	options []elastic.ClientOptionFunc
+	// URL is the url of Elasticsearch, its path is used as index if Index
+	// is not set.
+	URL   string `toml:"url"`
+	Index string `toml:"index"`
 
-	Index string
-}
+	// IndexDateFormat suffixes the index with the date of the event, in
+	// the layout of the time package, eg. "2006.01.02" for daily indices.
+	IndexDateFormat string `toml:"index_date_format"`
 
-// UnmarshalTOML deserializes the giving data into the config.
-func (c *Config) UnmarshalTOML(p interface{}) error {
-	c.options = []elastic.ClientOptionFunc{
-		elastic.SetHttpClient(&http.Client{
-			Transport: &http.Transport{
-				MaxIdleConnsPerHost: 5,
-				TLSClientConfig:     &tls.Config{},
-			},
-			Timeout: time.Duration(20) * time.Second,
-		}),
-		elastic.SetSniff(false),
-		elastic.SetRetrier(&Retrier{}),
-	}
+	// DataStream writes to the index as data stream, which requires
+	// Elasticsearch 7.9 or newer.
+	DataStream bool `toml:"data_stream"`
+
+	// Template installs the index template on start, TemplateFile replaces
+	// the default template.
+	Template     bool   `toml:"template"`
+	TemplateFile string `toml:"template_file"`
+	ILMPolicy    string `toml:"ilm_policy"`
+
+	// Fields renames fields of the events, an empty name removes the
+	// field.
+	Fields map[string]string `toml:"fields"`
 
-	data, _ := p.(map[string]interface{})
+	// The bulk request is sent when it contains BulkActions events, is
+	// larger than BulkSize bytes or after the FlushInterval.
+	BulkActions   int          `toml:"bulk_actions"`
+	BulkSize      int64        `toml:"bulk_size"`
+	FlushInterval config.Delay `toml:"flush_interval"`
+	Timeout       config.Delay `toml:"timeout"`
+
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	APIKey   string `toml:"api_key"`
+
+	TLS pushers.TLSConfig `toml:"tls"`
+}
 
-	v, ok := data["url"]
-	if !ok {
+// validate sets the index from the url if not set.
+func (c *Config) validate() error {
+	if c.URL == "" {
 		return ErrElasticsearchNoURL
 	}
-	s, _ := v.(string)
-	u, err := url.Parse(s)
+
+	u, err := url.Parse(c.URL)
 	if err != nil {
 		return err
 	}
-	parts := strings.Split(u.Path, "/")
-	if len(parts) != 2 {
-		return ErrElasticsearchNoIndex
+
+	if c.Index == "" {
+		c.Index = strings.Trim(u.Path, "/")
 	}
 
-	c.Index = parts[1]
+	if c.Index == "" || strings.Contains(c.Index, "/") {
+		return ErrElasticsearchNoIndex
+	}
 
 	// remove path
 	u.Path = ""
-	c.options = append(c.options, elastic.SetURL(u.String()))
+	c.URL = u.String()
 
-	log.Debugf("Using URL: %s with index: %s", u.String(), c.Index)
+	if c.DataStream && c.IndexDateFormat != "" {
+		return errors.New("Elasticsearch data streams can not be date suffixed")
+	}
 
-	if username, ok := data["username"]; !ok {
-	} else if password := data["password"]; !ok {
-	} else {
-		username := username.(string)
-		password := password.(string)
-		c.options = append(c.options, elastic.SetBasicAuth(username, password))
+	if c.BulkActions <= 0 {
+		return fmt.Errorf("Invalid bulk_actions: %d", c.BulkActions)
+	}
 
-		log.Debugf("Using authentication with username: %s and password.", username)
+	if c.FlushInterval.Duration() <= 0 {
+		return fmt.Errorf("Invalid flush_interval: %s", c.FlushInterval.Duration())
 	}
 
 	return nil
 }
+
+// options returns the client options of the config.
+func (c *Config) options() ([]elastic.ClientOptionFunc, error) {
+	tlsConfig, err := c.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	var transport http.RoundTripper = &http.Transport{
+		MaxIdleConnsPerHost: 5,
+		TLSClientConfig:     tlsConfig,
+	}
+
+	if c.APIKey != "" {
+		transport = &apiKeyTransport{
+			apiKey:    c.APIKey,
+			transport: transport,
+		}
+	}
+
+	options := []elastic.ClientOptionFunc{
+		elastic.SetHttpClient(&http.Client{
+			Transport: transport,
+			Timeout:   c.Timeout.Duration(),
+		}),
+		elastic.SetSniff(false),
+		elastic.SetRetrier(&Retrier{}),
+		elastic.SetURL(c.URL),
+	}
+
+	log.Debugf("Using URL: %s with index: %s", c.URL, c.Index)
+
+	if c.Username != "" {
+		options = append(options, elastic.SetBasicAuth(c.Username, c.Password))
+
+		log.Debugf("Using authentication with username: %s and password.", c.Username)
+	}
+
+	return options, nil
+}
+
+// apiKeyTransport authenticates requests with an api key.
+type apiKeyTransport struct {
+	apiKey    string
+	transport http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+
+	r.Header.Set("Authorization", "ApiKey "+t.apiKey)
+
+	return t.transport.RoundTrip(r)
+}
+
+// index returns the index of an event with the date.
+func (c *Config) index(date time.Time) string {
+	if c.IndexDateFormat == "" {
+		return c.Index
+	}
+
+	return c.Index + "-" + date.UTC().Format(c.IndexDateFormat)
+}
+
+// pattern returns the index pattern of the template.
+func (c *Config) pattern() string {
+	if c.IndexDateFormat == "" {
+		return c.Index
+	}
+
+	return c.Index + "-*"
+}
@@ -32,13 +32,18 @@ package elasticsearch
 
 import (
 	"context"
-
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
 
 	elastic "gopkg.in/olivere/elastic.v5"
 
+	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 
@@ -56,23 +61,57 @@ var log = logging.MustGetLogger("channels/elasticsearch")
 type Backend struct {
 	Config
 
-	es *elastic.Client
-	ch chan map[string]interface{}
+	es      *elastic.Client
+	version version
+
+	// bulk contains the requests not yet sent, requests holds the same
+	// requests, oldest first
+	bulk     *elastic.BulkService
+	requests []elastic.BulkableRequest
+	// count is the number of indexed events
+	count int
+
+	ch   chan map[string]interface{}
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+
+	// failing is set while the last request failed
+	failing int32
 }
 
 func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	ch := make(chan map[string]interface{}, 100)
 
 	c := Backend{
-		ch: ch,
+		Config: Config{
+			Template:      true,
+			BulkActions:   100,
+			BulkSize:      5 * 1024 * 1024,
+			FlushInterval: config.Delay(10 * time.Second),
+			Timeout:       config.Delay(20 * time.Second),
+		},
+		ch:   ch,
+		done: make(chan struct{}),
 	}
 
 	for _, optionFn := range options {
-		optionFn(&c)
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	clientOptions, err := c.options()
+	if err != nil {
+		return nil, err
 	}
 
 	es, err := elastic.NewClient(
-		c.options...,
+		clientOptions...,
 	)
 	if err != nil {
 		return nil, err
@@ -80,62 +119,253 @@ func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 
 	c.es = es
 
+	s, err := es.ElasticsearchVersion(c.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.version, err = parseVersion(s); err != nil {
+		return nil, err
+	}
+
+	if c.DataStream && !c.version.atLeast(7, 9) {
+		return nil, fmt.Errorf("Elasticsearch %s does not support data streams", s)
+	}
+
+	if c.Template {
+		if err := c.installTemplate(context.Background(), c.version); err != nil {
+			return nil, fmt.Errorf("Error installing index template: %s", err.Error())
+		}
+
+		log.Debugf("Installed index template %s", c.Index)
+	}
+
+	c.wg.Add(1)
 	go c.run()
 
 	return &c, nil
 }
 
-func (hc Backend) run() {
+func (hc *Backend) run() {
+	defer hc.wg.Done()
+
 	log.Debug("Indexer started...")
 	defer log.Debug("Indexer stopped...")
 
-	bulk := hc.es.Bulk()
+	hc.bulk = hc.es.Bulk()
+
+	ticker := time.NewTicker(hc.FlushInterval.Duration())
+	defer ticker.Stop()
 
-	count := 0
 	for {
 		select {
 		case doc := <-hc.ch:
-			messageID := uuid.NewV4()
+			hc.add(doc)
 
-			bulk = bulk.Add(elastic.NewBulkIndexRequest().
-				Index(hc.Index).
-				Type("event").
-				Id(messageID.String()).
-				Doc(doc),
-			)
-
-			if bulk.NumberOfActions() < 10 {
+			if hc.bulk.NumberOfActions() < hc.BulkActions && hc.bulk.EstimatedSizeInBytes() < hc.BulkSize {
 				continue
 			}
-		case <-time.After(time.Second * 10):
+		case <-ticker.C:
+		case <-hc.done:
+			hc.drain()
+			hc.flush()
+			return
+		}
+
+		hc.flush()
+	}
+}
+
+// drain adds the queued events to the bulk request.
+func (hc *Backend) drain() {
+	for {
+		select {
+		case doc := <-hc.ch:
+			hc.add(doc)
+		default:
+			return
+		}
+	}
+}
+
+// add adds the document to the bulk request.
+func (hc *Backend) add(doc map[string]interface{}) {
+	request := hc.request(doc)
+
+	hc.bulk.Add(request)
+	hc.requests = append(hc.requests, request)
+}
+
+// flush sends the bulk request, which keeps its requests on failure to be
+// retried with the next flush, dropping the oldest requests if it grows too
+// large.
+func (hc *Backend) flush() {
+	if hc.bulk.NumberOfActions() == 0 {
+		return
+	}
+
+	response, err := hc.bulk.Do(context.Background())
+	if err != nil {
+		log.Errorf("Error indexing: %s", err.Error())
+		pushers.Errors.Inc("elasticsearch")
+		atomic.StoreInt32(&hc.failing, 1)
+
+		if max := hc.BulkActions * 10; len(hc.requests) > max {
+			log.Errorf("Dropping %d events", len(hc.requests)-max)
+
+			hc.requests = hc.requests[len(hc.requests)-max:]
+			hc.bulk = hc.es.Bulk().Add(hc.requests...)
 		}
 
-		if bulk.NumberOfActions() == 0 {
-		} else if response, err := bulk.Do(context.Background()); err != nil {
-			log.Errorf("Error indexing: %s", err.Error())
+		return
+	}
+
+	atomic.StoreInt32(&hc.failing, 0)
+
+	hc.requests = nil
+
+	indexed := response.Indexed()
+	if hc.DataStream {
+		indexed = response.Created()
+	}
+
+	hc.count += len(indexed)
+
+	for _, item := range response.Failed() {
+		log.Errorf("Error indexing item: %s with error: %+v", item.Id, *item.Error)
+		pushers.Errors.Inc("elasticsearch")
+	}
+
+	log.Debugf("Bulk indexing: %d total %d", len(indexed), hc.count)
+}
+
+// request returns the bulk request of the document.
+func (hc *Backend) request(doc map[string]interface{}) *elastic.BulkIndexRequest {
+	date, ok := doc["date"].(time.Time)
+	if !ok {
+		date = time.Now()
+	}
+
+	doc = hc.document(doc)
+
+	request := elastic.NewBulkIndexRequest().
+		Index(hc.index(date)).
+		Type(hc.version.documentType()).
+		Id(uuid.NewV4().String()).
+		Doc(doc)
+
+	if hc.DataStream {
+		doc["@timestamp"] = date.UTC()
+		request = request.OpType("create")
+	}
+
+	return request
+}
+
+// document renames the fields of the event and encodes the values of
+// varying types, like arrays of objects, as json, to prevent mapping
+// conflicts.
+func (hc *Backend) document(m map[string]interface{}) map[string]interface{} {
+	doc := make(map[string]interface{}, len(m))
+
+	for k, v := range m {
+		if name, ok := hc.Fields[k]; !ok {
+		} else if name == "" {
+			continue
 		} else {
-			indexed := response.Indexed()
-			count += len(indexed)
+			k = name
+		}
 
-			for _, item := range response.Failed() {
-				log.Errorf("Error indexing item: %s with error: %+v", item.Id, *item.Error)
-			}
+		doc[k] = normalize(v)
+	}
+
+	return doc
+}
+
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, string, bool, time.Time, json.Number:
+		return v
+	case []byte:
+		return string(v)
+	case []string:
+		return v
+	case map[string]float64:
+		// geo point
+		return v
+	}
 
-			log.Debugf("Bulk indexing: %d total %d", len(indexed), count)
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return v
+	case reflect.Slice, reflect.Array:
+		if scalars(rv) {
+			return v
 		}
 	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	return string(data)
 }
 
-// Send delivers the giving push messages into the internal elastic search endpoint.
-func (hc Backend) Send(message event.Event) {
-	mp := make(map[string]interface{})
+// scalars returns true if the slice only contains strings or only numbers.
+func scalars(rv reflect.Value) bool {
+	kind := reflect.Invalid
+
+	for i := 0; i < rv.Len(); i++ {
+		ev := rv.Index(i)
+		for ev.Kind() == reflect.Interface && !ev.IsNil() {
+			ev = ev.Elem()
+		}
+
+		k := ev.Kind()
+		switch k {
+		case reflect.String:
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			k = reflect.Float64
+		default:
+			return false
+		}
 
-	message.Range(func(key, value interface{}) bool {
-		if keyName, ok := key.(string); ok {
-			mp[keyName] = value
+		if kind != reflect.Invalid && kind != k {
+			return false
 		}
-		return true
+
+		kind = k
+	}
+
+	return true
+}
+
+// Healthy returns false if the last request failed.
+func (hc *Backend) Healthy() bool {
+	return atomic.LoadInt32(&hc.failing) == 0
+}
+
+// Send delivers the giving push messages into the internal elastic search endpoint.
+func (hc *Backend) Send(message event.Event) {
+	select {
+	case hc.ch <- event.ToMap(message):
+	case <-hc.done:
+	}
+}
+
+// Close sends the queued events.
+func (hc *Backend) Close() error {
+	hc.once.Do(func() {
+		close(hc.done)
 	})
 
-	hc.ch <- mp
+	hc.wg.Wait()
+	return nil
 }
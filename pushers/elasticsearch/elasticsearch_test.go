@@ -28,4 +28,442 @@
 * logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
 * must display the words "Powered by Honeytrap" and retain the original copyright notice.
  */
-package elasticsearch_test
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+type bulkAction struct {
+	action string
+	meta   map[string]interface{}
+	doc    map[string]interface{}
+}
+
+// testServer is an Elasticsearch stand-in, recording the templates and bulk
+// requests.
+type testServer struct {
+	*httptest.Server
+
+	version string
+
+	m         sync.Mutex
+	templates map[string]map[string]interface{}
+	actions   []bulkAction
+	bulks     int
+	headers   []http.Header
+
+	// failing fails the bulk requests
+	failing bool
+}
+
+func newTestServer(version string) *testServer {
+	s := &testServer{
+		version:   version,
+		templates: map[string]map[string]interface{}{},
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *testServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.headers = append(s.headers, r.Header)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case r.URL.Path == "/":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"version": map[string]interface{}{"number": s.version},
+		})
+	case r.Method == "PUT" && (strings.HasPrefix(r.URL.Path, "/_template/") || strings.HasPrefix(r.URL.Path, "/_index_template/")):
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		s.templates[r.URL.Path] = body
+		w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == "POST" && r.URL.Path == "/_bulk" && s.failing:
+		s.bulks++
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"unavailable","status":503}`))
+	case r.Method == "POST" && r.URL.Path == "/_bulk":
+		s.bulks++
+
+		items := []interface{}{}
+
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			command := map[string]map[string]interface{}{}
+			json.Unmarshal(scanner.Bytes(), &command)
+
+			if !scanner.Scan() {
+				break
+			}
+
+			doc := map[string]interface{}{}
+			json.Unmarshal(scanner.Bytes(), &doc)
+
+			for action, meta := range command {
+				s.actions = append(s.actions, bulkAction{action, meta, doc})
+
+				items = append(items, map[string]interface{}{
+					action: map[string]interface{}{"_index": meta["_index"], "_id": meta["_id"], "status": 201},
+				})
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"took":   1,
+			"errors": false,
+			"items":  items,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *testServer) template(path string) map[string]interface{} {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.templates[path]
+}
+
+func (s *testServer) bulkActions() []bulkAction {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return append([]bulkAction{}, s.actions...)
+}
+
+func newBackend(t *testing.T, s *testServer, options ...func(*Backend)) *Backend {
+	c, err := New(func(c pushers.Channel) error {
+		b := c.(*Backend)
+		b.URL = s.URL + "/honeytrap"
+
+		for _, fn := range options {
+			fn(b)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*Backend)
+}
+
+func lookup(m map[string]interface{}, path ...string) interface{} {
+	var v interface{} = m
+	for _, p := range path {
+		mv, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		v = mv[p]
+	}
+
+	return v
+}
+
+func TestLegacyTemplate(t *testing.T) {
+	s := newTestServer("5.6.3")
+	defer s.Close()
+
+	b := newBackend(t, s, func(b *Backend) {
+		b.IndexDateFormat = "2006.01.02"
+	})
+	b.Close()
+
+	template := s.template("/_template/honeytrap")
+	if template == nil {
+		t.Fatal("expected template to be installed")
+	}
+
+	if template["template"] != "honeytrap-*" {
+		t.Errorf("unexpected template pattern %v", template["template"])
+	}
+
+	if v := lookup(template, "mappings", "event", "properties", "source-ip", "type"); v != "ip" {
+		t.Errorf("expected source-ip mapped as ip, got %v", v)
+	}
+
+	if v := lookup(template, "mappings", "event", "properties", "source", "properties", "location", "type"); v != "geo_point" {
+		t.Errorf("expected source.location mapped as geo_point, got %v", v)
+	}
+}
+
+func TestComposableTemplate(t *testing.T) {
+	s := newTestServer("7.10.2")
+	defer s.Close()
+
+	b := newBackend(t, s, func(b *Backend) {
+		b.ILMPolicy = "honeytrap"
+	})
+	b.Close()
+
+	template := s.template("/_index_template/honeytrap")
+	if template == nil {
+		t.Fatal("expected index template to be installed")
+	}
+
+	if v := lookup(template, "template", "mappings", "properties", "date", "type"); v != "date" {
+		t.Errorf("expected date mapped as date, got %v", v)
+	}
+
+	if v := lookup(template, "template", "settings", "index.lifecycle.name"); v != "honeytrap" {
+		t.Errorf("unexpected lifecycle policy %v", v)
+	}
+
+	if _, ok := template["data_stream"]; ok {
+		t.Error("expected no data stream")
+	}
+}
+
+func TestDateIndices(t *testing.T) {
+	s := newTestServer("6.8.0")
+	defer s.Close()
+
+	b := newBackend(t, s, func(b *Backend) {
+		b.IndexDateFormat = "2006.01.02"
+		b.Fields = map[string]string{"sensor": "sensor.name", "token": ""}
+	})
+
+	date := time.Date(2018, 3, 4, 23, 0, 0, 0, time.UTC)
+	b.Send(event.New(
+		event.Custom("date", date),
+		event.Sensor("ssh"),
+		event.Custom("token", "secret"),
+		event.Custom("ssh.payload", []interface{}{map[string]interface{}{"a": 1}}),
+		event.Custom("tags", []string{"a", "b"}),
+	))
+	b.Close()
+
+	actions := s.bulkActions()
+	if len(actions) != 1 {
+		t.Fatalf("expected 1 action, got %d", len(actions))
+	}
+
+	a := actions[0]
+	if a.action != "index" || a.meta["_index"] != "honeytrap-2018.03.04" || a.meta["_type"] != "event" {
+		t.Errorf("unexpected action %s %v", a.action, a.meta)
+	}
+
+	if a.doc["sensor.name"] != "ssh" {
+		t.Errorf("expected sensor renamed, got %v", a.doc)
+	}
+
+	if _, ok := a.doc["token"]; ok {
+		t.Error("expected token removed")
+	}
+
+	if a.doc["ssh.payload"] != `[{"a":1}]` {
+		t.Errorf("expected payload encoded as json, got %v", a.doc["ssh.payload"])
+	}
+
+	if tags, ok := a.doc["tags"].([]interface{}); !ok || len(tags) != 2 {
+		t.Errorf("expected tags kept, got %v", a.doc["tags"])
+	}
+}
+
+func TestDataStream(t *testing.T) {
+	s := newTestServer("7.10.2")
+	defer s.Close()
+
+	b := newBackend(t, s, func(b *Backend) {
+		b.DataStream = true
+		b.APIKey = "key"
+	})
+
+	b.Send(event.New(event.Category("test")))
+	b.Close()
+
+	template := s.template("/_index_template/honeytrap")
+	if _, ok := template["data_stream"]; !ok {
+		t.Error("expected data stream template")
+	}
+
+	actions := s.bulkActions()
+	if len(actions) != 1 {
+		t.Fatalf("expected 1 action, got %d", len(actions))
+	}
+
+	a := actions[0]
+	if a.action != "create" || a.meta["_index"] != "honeytrap" {
+		t.Errorf("unexpected action %s %v", a.action, a.meta)
+	}
+
+	if _, ok := a.meta["_type"]; ok {
+		t.Error("expected no document type")
+	}
+
+	if _, ok := a.doc["@timestamp"]; !ok {
+		t.Error("expected @timestamp")
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for _, h := range s.headers {
+		if h.Get("Authorization") != "ApiKey key" {
+			t.Fatalf("unexpected authorization %s", h.Get("Authorization"))
+		}
+	}
+}
+
+func TestDataStreamUnsupported(t *testing.T) {
+	s := newTestServer("6.8.0")
+	defer s.Close()
+
+	_, err := New(func(c pushers.Channel) error {
+		b := c.(*Backend)
+		b.URL = s.URL + "/honeytrap"
+		b.DataStream = true
+		return nil
+	})
+
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestInvalidFlushInterval(t *testing.T) {
+	s := newTestServer("7.10.2")
+	defer s.Close()
+
+	_, err := New(func(c pushers.Channel) error {
+		b := c.(*Backend)
+		b.URL = s.URL + "/honeytrap"
+		b.FlushInterval = 0
+		return nil
+	})
+
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestBulkActions(t *testing.T) {
+	s := newTestServer("7.10.2")
+	defer s.Close()
+
+	b := newBackend(t, s, func(b *Backend) {
+		b.BulkActions = 2
+		b.Template = false
+	})
+	defer b.Close()
+
+	for i := 0; i < 4; i++ {
+		b.Send(event.New(event.Category("test")))
+	}
+
+	for i := 0; i < 200 && len(s.bulkActions()) < 4; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.bulks != 2 {
+		t.Errorf("expected 2 bulk requests, got %d", s.bulks)
+	}
+
+	if len(s.templates) != 0 {
+		t.Error("expected no template")
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	s := newTestServer("7.10.2")
+	defer s.Close()
+
+	s.failing = true
+
+	b := newBackend(t, s, func(b *Backend) {
+		b.BulkActions = 1
+		b.Template = false
+	})
+	defer b.Close()
+
+	// every event is flushed, the backlog is capped at 10 events
+	for i := 0; i < 15; i++ {
+		b.Send(event.New(event.Category("test"), event.Custom("n", i)))
+	}
+
+	bulks := func() int {
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		return s.bulks
+	}
+
+	for i := 0; i < 200 && bulks() < 15; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.m.Lock()
+	s.failing = false
+	s.m.Unlock()
+
+	b.Send(event.New(event.Category("test"), event.Custom("n", 15)))
+
+	for i := 0; i < 200 && len(s.bulkActions()) < 11; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	actions := s.bulkActions()
+	if len(actions) != 11 {
+		t.Fatalf("expected 11 indexed events, got %d", len(actions))
+	}
+
+	// the oldest events are dropped
+	for i, action := range actions {
+		if n := action.doc["n"]; n != float64(i+5) {
+			t.Errorf("expected event %d, got %v", i+5, n)
+		}
+	}
+}
+
+func TestTemplateFile(t *testing.T) {
+	s := newTestServer("7.10.2")
+	defer s.Close()
+
+	f, err := ioutil.TempFile("", "template")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	f.WriteString(`{"index_patterns": ["custom-*"]}`)
+
+	b := newBackend(t, s, func(b *Backend) {
+		b.TemplateFile = f.Name()
+	})
+	b.Close()
+
+	template := s.template("/_index_template/honeytrap")
+	if v := lookup(template, "index_patterns"); v == nil || v.([]interface{})[0] != "custom-*" {
+		t.Errorf("unexpected template %v", template)
+	}
+}
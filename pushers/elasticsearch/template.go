@@ -0,0 +1,208 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// version is the version of the Elasticsearch cluster.
+type version struct {
+	major, minor int
+}
+
+func parseVersion(s string) (version, error) {
+	parts := strings.SplitN(s, ".", 3)
+	if len(parts) < 2 {
+		return version{}, fmt.Errorf("Invalid Elasticsearch version: %s", s)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return version{}, fmt.Errorf("Invalid Elasticsearch version: %s", s)
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return version{}, fmt.Errorf("Invalid Elasticsearch version: %s", s)
+	}
+
+	return version{major, minor}, nil
+}
+
+func (v version) atLeast(major, minor int) bool {
+	return v.major > major || (v.major == major && v.minor >= minor)
+}
+
+// documentType returns the type of the documents, types are deprecated
+// since Elasticsearch 7.
+func (v version) documentType() string {
+	if v.atLeast(7, 0) {
+		return ""
+	}
+
+	return "event"
+}
+
+// composable returns true if the cluster supports composable index
+// templates.
+func (v version) composable() bool {
+	return v.atLeast(7, 8)
+}
+
+// properties are the mappings of the known fields of the events, all other
+// strings are mapped as keyword.
+func properties() map[string]interface{} {
+	keyword := map[string]interface{}{"type": "keyword", "ignore_above": 1024}
+
+	return map[string]interface{}{
+		"@timestamp":       map[string]interface{}{"type": "date"},
+		"date":             map[string]interface{}{"type": "date"},
+		"category":         keyword,
+		"type":             keyword,
+		"sensor":           keyword,
+		"session-id":       keyword,
+		"source-ip":        map[string]interface{}{"type": "ip"},
+		"source-port":      map[string]interface{}{"type": "integer"},
+		"destination-ip":   map[string]interface{}{"type": "ip"},
+		"destination-port": map[string]interface{}{"type": "integer"},
+		"payload":          map[string]interface{}{"type": "text"},
+		"payload-hex":      map[string]interface{}{"type": "keyword", "index": false, "doc_values": false},
+		"payload-length":   map[string]interface{}{"type": "integer"},
+		"source": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"location": map[string]interface{}{"type": "geo_point"},
+				"asn": map[string]interface{}{
+					"properties": map[string]interface{}{
+						"number":       map[string]interface{}{"type": "long"},
+						"organization": keyword,
+					},
+				},
+			},
+		},
+	}
+}
+
+// mappings returns the mappings of the index template.
+func mappings() map[string]interface{} {
+	return map[string]interface{}{
+		"dynamic_templates": []interface{}{
+			map[string]interface{}{
+				"strings": map[string]interface{}{
+					"match_mapping_type": "string",
+					"mapping": map[string]interface{}{
+						"type":         "keyword",
+						"ignore_above": 1024,
+					},
+				},
+			},
+		},
+		"properties": properties(),
+	}
+}
+
+// template returns the body of the index template for the version of the
+// cluster.
+func (c *Config) template(v version) map[string]interface{} {
+	settings := map[string]interface{}{}
+	if c.ILMPolicy != "" {
+		settings["index.lifecycle.name"] = c.ILMPolicy
+	}
+
+	if v.composable() {
+		body := map[string]interface{}{
+			"index_patterns": []string{c.pattern()},
+			"priority":       200,
+			"template": map[string]interface{}{
+				"settings": settings,
+				"mappings": mappings(),
+			},
+		}
+
+		if c.DataStream {
+			body["data_stream"] = map[string]interface{}{}
+		}
+
+		return body
+	}
+
+	body := map[string]interface{}{
+		"order":    1,
+		"settings": settings,
+	}
+
+	if v.atLeast(7, 0) {
+		body["mappings"] = mappings()
+	} else {
+		body["mappings"] = map[string]interface{}{
+			v.documentType(): mappings(),
+		}
+	}
+
+	if v.atLeast(6, 0) {
+		body["index_patterns"] = []string{c.pattern()}
+	} else {
+		body["template"] = c.pattern()
+	}
+
+	return body
+}
+
+// installTemplate puts the index template, named after the index.
+func (hc *Backend) installTemplate(ctx context.Context, v version) error {
+	var body interface{} = hc.template(v)
+
+	if hc.TemplateFile != "" {
+		data, err := ioutil.ReadFile(hc.TemplateFile)
+		if err != nil {
+			return err
+		}
+
+		if !json.Valid(data) {
+			return fmt.Errorf("Invalid template %s", hc.TemplateFile)
+		}
+
+		body = json.RawMessage(data)
+	}
+
+	if !v.composable() {
+		_, err := hc.es.IndexPutTemplate(hc.Index).BodyJson(body).Do(ctx)
+		return err
+	}
+
+	_, err := hc.es.PerformRequest(ctx, "PUT", "/_index_template/"+hc.Index, nil, body)
+	return err
+}
@@ -31,30 +31,331 @@
 package eventbus
 
 import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/metrics"
 	"github.com/honeytrap/honeytrap/pushers"
 )
 
+var (
+	enqueuedTotal = metrics.NewCounterVec(
+		"honeytrap_channel_enqueued_total",
+		"Number of events queued for a channel.",
+		"channel",
+	)
+
+	droppedTotal = metrics.NewCounterVec(
+		"honeytrap_channel_dropped_total",
+		"Number of events dropped because the queue of a channel was full.",
+		"channel",
+	)
+
+	deliveredTotal = metrics.NewCounterVec(
+		"honeytrap_channel_delivered_total",
+		"Number of events delivered to a channel.",
+		"channel",
+	)
+)
+
+// Policy defines what happens with an event when the queue of a subscriber
+// is full.
+type Policy string
+
+// Available overflow policies.
+const (
+	// Block waits until the subscriber has room in its queue, a stalled
+	// subscriber then slows down every sender.
+	Block Policy = "block"
+	// DropOldest discards the oldest queued event to make room.
+	DropOldest Policy = "drop-oldest"
+	// DropNewest discards the event being sent.
+	DropNewest Policy = "drop-newest"
+)
+
+// DefaultQueueSize defines the number of events queued per subscriber when
+// not configured.
+const DefaultQueueSize = 1024
+
+// ErrClosed is returned when subscribing to a closed bus.
+var ErrClosed = errors.New("eventbus: bus closed")
+
+// ParsePolicy returns the policy for s, defaulting to DropOldest when s is
+// empty.
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case "":
+		return DropOldest, nil
+	case Block, DropOldest, DropNewest:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy: %s", s)
+	}
+}
+
+// SubscribeOption defines a function type for configuring a subscription.
+type SubscribeOption func(*subscriber)
+
+// WithName sets the name the subscription is reported with.
+func WithName(name string) SubscribeOption {
+	return func(s *subscriber) {
+		s.name = name
+	}
+}
+
+// WithQueueSize sets the number of events queued for the subscriber.
+func WithQueueSize(size int) SubscribeOption {
+	return func(s *subscriber) {
+		if size > 0 {
+			s.size = size
+		}
+	}
+}
+
+// WithOverflow sets the policy applied when the queue is full.
+func WithOverflow(policy Policy) SubscribeOption {
+	return func(s *subscriber) {
+		s.policy = policy
+	}
+}
+
+type queued struct {
+	e event.Event
+	t time.Time
+}
+
+// subscriber delivers the events in its queue to the channel on its own
+// goroutine, so a slow channel doesn't hold up the sender.
+type subscriber struct {
+	channel pushers.Channel
+
+	name   string
+	size   int
+	policy Policy
+
+	queue chan queued
+	done  chan struct{}
+
+	enqueued  uint64
+	dropped   uint64
+	delivered uint64
+
+	// latency since the last snapshot, in nanoseconds
+	latencyTotal int64
+	latencyMax   int64
+	latencyCount int64
+}
+
+// enqueue queues the event according to the policy, a blocked enqueue gives
+// up and drops the event when closing is closed.
+func (s *subscriber) enqueue(e event.Event, closing <-chan struct{}) {
+	q := queued{e: e, t: time.Now()}
+
+	switch s.policy {
+	case DropNewest:
+		select {
+		case s.queue <- q:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+			droppedTotal.Inc(s.name)
+			return
+		}
+	case DropOldest:
+		for {
+			select {
+			case s.queue <- q:
+				atomic.AddUint64(&s.enqueued, 1)
+				enqueuedTotal.Inc(s.name)
+				return
+			default:
+			}
+
+			select {
+			case <-s.queue:
+				atomic.AddUint64(&s.dropped, 1)
+				droppedTotal.Inc(s.name)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.queue <- q:
+		case <-closing:
+			atomic.AddUint64(&s.dropped, 1)
+			droppedTotal.Inc(s.name)
+			return
+		}
+	}
+
+	atomic.AddUint64(&s.enqueued, 1)
+	enqueuedTotal.Inc(s.name)
+}
+
+func (s *subscriber) run() {
+	defer close(s.done)
+
+	for q := range s.queue {
+		s.channel.Send(q.e)
+
+		latency := int64(time.Since(q.t))
+
+		atomic.AddUint64(&s.delivered, 1)
+		deliveredTotal.Inc(s.name)
+		atomic.AddInt64(&s.latencyTotal, latency)
+		atomic.AddInt64(&s.latencyCount, 1)
+
+		for {
+			max := atomic.LoadInt64(&s.latencyMax)
+			if latency <= max || atomic.CompareAndSwapInt64(&s.latencyMax, max, latency) {
+				break
+			}
+		}
+	}
+}
+
+// Stats contains the counters of a single subscriber. Enqueued, Dropped and
+// Delivered count since the subscription, the latencies (time between Send
+// and delivery to the channel) since the previous call to Stats.
+type Stats struct {
+	Name string
+
+	Enqueued  uint64
+	Dropped   uint64
+	Delivered uint64
+	Queued    int
+
+	LatencyAvg time.Duration
+	LatencyMax time.Duration
+}
+
+func (s *subscriber) stats() Stats {
+	st := Stats{
+		Name:      s.name,
+		Enqueued:  atomic.LoadUint64(&s.enqueued),
+		Dropped:   atomic.LoadUint64(&s.dropped),
+		Delivered: atomic.LoadUint64(&s.delivered),
+		Queued:    len(s.queue),
+	}
+
+	total := atomic.SwapInt64(&s.latencyTotal, 0)
+	count := atomic.SwapInt64(&s.latencyCount, 0)
+	if count > 0 {
+		st.LatencyAvg = time.Duration(total / count)
+	}
+
+	st.LatencyMax = time.Duration(atomic.SwapInt64(&s.latencyMax, 0))
+	return st
+}
+
 // EventBus defines a structure which provides a pubsub bus where message.Events
-// are sent along it's wires for delivery
+// are sent along it's wires for delivery. Every subscriber has its own bounded
+// queue and worker.
 type EventBus struct {
-	subscribers []pushers.Channel
+	m sync.RWMutex
+
+	subscribers []*subscriber
+	closed      bool
+
+	// closing is closed first by Close, releasing the senders blocked
+	// on a full queue
+	closing chan struct{}
+	once    sync.Once
 }
 
 // NewEventBus returns a new instance of a EventBus.
 func New() *EventBus {
-	return &EventBus{}
+	return &EventBus{
+		closing: make(chan struct{}),
+	}
 }
 
 // Subscribe adds the giving channel to the list of subscribers for the giving bus.
-func (eb *EventBus) Subscribe(channel pushers.Channel) error {
-	eb.subscribers = append(eb.subscribers, channel)
+func (eb *EventBus) Subscribe(channel pushers.Channel, options ...SubscribeOption) error {
+	s := &subscriber{
+		channel: channel,
+		name:    fmt.Sprintf("%T", channel),
+		size:    DefaultQueueSize,
+		policy:  DropOldest,
+		done:    make(chan struct{}),
+	}
+
+	for _, fn := range options {
+		fn(s)
+	}
+
+	if _, err := ParsePolicy(string(s.policy)); err != nil {
+		return err
+	}
+
+	s.queue = make(chan queued, s.size)
+
+	eb.m.Lock()
+	defer eb.m.Unlock()
+
+	if eb.closed {
+		return ErrClosed
+	}
+
+	eb.subscribers = append(eb.subscribers, s)
+
+	go s.run()
 	return nil
 }
 
-// Send deliverers the slice of messages to all subscribers.
+// Send queues the event for delivery to all subscribers.
 func (eb *EventBus) Send(e event.Event) {
+	eb.m.RLock()
+	defer eb.m.RUnlock()
+
+	if eb.closed {
+		return
+	}
+
+	for _, subscriber := range eb.subscribers {
+		subscriber.enqueue(e, eb.closing)
+	}
+}
+
+// Stats returns the counters of all subscribers.
+func (eb *EventBus) Stats() []Stats {
+	eb.m.RLock()
+	defer eb.m.RUnlock()
+
+	stats := make([]Stats, len(eb.subscribers))
+	for i, subscriber := range eb.subscribers {
+		stats[i] = subscriber.stats()
+	}
+
+	return stats
+}
+
+// Close stops accepting events and waits until all queued events have been
+// delivered. Events of senders blocked on a full queue are dropped.
+func (eb *EventBus) Close() {
+	eb.once.Do(func() {
+		close(eb.closing)
+	})
+
+	eb.m.Lock()
+
+	if eb.closed {
+		eb.m.Unlock()
+		return
+	}
+
+	eb.closed = true
+
+	for _, subscriber := range eb.subscribers {
+		close(subscriber.queue)
+	}
+
+	eb.m.Unlock()
+
 	for _, subscriber := range eb.subscribers {
-		subscriber.Send(e)
+		<-subscriber.done
 	}
 }
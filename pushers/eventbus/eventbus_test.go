@@ -0,0 +1,190 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package eventbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+type blockingChannel struct {
+	release chan struct{}
+	ch      chan event.Event
+}
+
+func (c *blockingChannel) Send(e event.Event) {
+	<-c.release
+	c.ch <- e
+}
+
+func newBlockingChannel() *blockingChannel {
+	return &blockingChannel{
+		release: make(chan struct{}),
+		ch:      make(chan event.Event, 100),
+	}
+}
+
+func TestSendDoesNotBlock(t *testing.T) {
+	eb := New()
+
+	c := newBlockingChannel()
+	eb.Subscribe(c, WithQueueSize(10))
+
+	done := make(chan struct{})
+	go func() {
+		eb.Send(event.New())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Send blocked on slow subscriber")
+	}
+
+	close(c.release)
+	eb.Close()
+
+	if len(c.ch) != 1 {
+		t.Errorf("expected 1 event delivered, got %d", len(c.ch))
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	tests := []struct {
+		policy    Policy
+		delivered []int
+	}{
+		{DropNewest, []int{0, 1, 2}},
+		{DropOldest, []int{0, 4, 5}},
+	}
+
+	for _, test := range tests {
+		eb := New()
+
+		c := newBlockingChannel()
+		eb.Subscribe(c, WithName("test"), WithQueueSize(2), WithOverflow(test.policy))
+
+		// the first event is taken by the worker, which blocks on it.
+		eb.Send(event.New(event.Custom("seq", 0)))
+		for len(eb.subscribers[0].queue) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		for i := 1; i < 6; i++ {
+			eb.Send(event.New(event.Custom("seq", i)))
+		}
+
+		stats := eb.Stats()[0]
+		if stats.Name != "test" {
+			t.Errorf("%s: expected name test, got %s", test.policy, stats.Name)
+		}
+
+		if stats.Dropped != 3 {
+			t.Errorf("%s: expected 3 dropped, got %d", test.policy, stats.Dropped)
+		}
+
+		close(c.release)
+		eb.Close()
+
+		if len(c.ch) != len(test.delivered) {
+			t.Fatalf("%s: expected %d events, got %d", test.policy, len(test.delivered), len(c.ch))
+		}
+
+		for _, seq := range test.delivered {
+			e := <-c.ch
+
+			if v := event.ToMap(e)["seq"]; v != seq {
+				t.Errorf("%s: expected event %d, got %v", test.policy, seq, v)
+			}
+		}
+	}
+}
+
+func TestCloseReleasesBlockedSenders(t *testing.T) {
+	eb := New()
+
+	c := newBlockingChannel()
+	eb.Subscribe(c, WithQueueSize(1), WithOverflow(Block))
+
+	sent := make(chan struct{})
+	go func() {
+		// the first event is taken by the subscriber, the second is
+		// queued and the third blocks
+		for i := 0; i < 3; i++ {
+			eb.Send(event.New())
+		}
+
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+		t.Fatal("expected Send to block")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		eb.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't release the blocked sender")
+	}
+
+	close(c.release)
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't return")
+	}
+
+	if st := eb.Stats()[0]; st.Delivered != 2 || st.Dropped != 1 {
+		t.Errorf("expected 2 delivered and 1 dropped, got %d and %d", st.Delivered, st.Dropped)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	if p, err := ParsePolicy(""); err != nil || p != DropOldest {
+		t.Errorf("expected default policy drop-oldest, got %s (%v)", p, err)
+	}
+
+	if _, err := ParsePolicy("drop-everything"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
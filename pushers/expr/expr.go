@@ -0,0 +1,349 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+// Package expr implements a small expression language for filtering events.
+//
+// An expression combines predicates on event fields with and, or, not and
+// parentheses:
+//
+//	category == "ssh" and type =~ "auth" and not source-ip in 10.0.0.0/8
+//
+// Supported predicates:
+//
+//	field == value, field != value      equality, numeric when both are numbers
+//	field < value (<=, >, >=)           numeric comparison, string comparison for quoted values
+//	field =~ "regex", field !~ "regex"  regular expression match
+//	field exists, field not exists      presence of the field
+//	field in member, field not in member
+//	field in [member, member, ...]
+//
+// A member is a value, a cidr (10.0.0.0/8) matching ip addresses or an
+// inclusive numeric range (1..1024). Values can be quoted with " or ', or left
+// unquoted when consisting of letters, digits and -_.:/*.
+//
+// Predicates on fields that are not set are false, != and !~ are the negation
+// of == and =~ and are true for fields that are not set.
+package expr
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Expression defines a compiled expression.
+type Expression struct {
+	src  string
+	root node
+}
+
+// Parse compiles the expression s.
+func Parse(s string) (*Expression, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.typ != tokenEOF {
+		return nil, p.errorf(t, "expected and, or or end of expression")
+	}
+
+	return &Expression{
+		src:  s,
+		root: root,
+	}, nil
+}
+
+// MustParse compiles the expression s, and panics if it is invalid.
+func MustParse(s string) *Expression {
+	x, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return x
+}
+
+// Eval returns true if the event matches the expression.
+func (x *Expression) Eval(e event.Event) bool {
+	return x.root.eval(e)
+}
+
+func (x *Expression) String() string {
+	return x.src
+}
+
+type node interface {
+	eval(event.Event) bool
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n andNode) eval(e event.Event) bool {
+	return n.left.eval(e) && n.right.eval(e)
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n orNode) eval(e event.Event) bool {
+	return n.left.eval(e) || n.right.eval(e)
+}
+
+type notNode struct {
+	n node
+}
+
+func (n notNode) eval(e event.Event) bool {
+	return !n.n.eval(e)
+}
+
+type existsNode struct {
+	field string
+}
+
+func (n existsNode) eval(e event.Event) bool {
+	return e.Has(n.field)
+}
+
+type matchNode struct {
+	field string
+	re    *regexp.Regexp
+}
+
+func (n matchNode) eval(e event.Event) bool {
+	v, ok := e.Load(n.field)
+	if !ok {
+		return false
+	}
+
+	return n.re.MatchString(toString(v))
+}
+
+type compareNode struct {
+	field string
+	op    string
+	value literal
+}
+
+func (n compareNode) eval(e event.Event) bool {
+	v, ok := e.Load(n.field)
+	if !ok {
+		return false
+	}
+
+	if n.op == "==" {
+		return n.value.contains(v)
+	}
+
+	var c int
+	if f, ok := toNumber(v); ok && n.value.isNumber {
+		c = compareFloat(f, n.value.n)
+	} else if !n.value.quoted {
+		return false
+	} else if s := toString(v); s < n.value.s {
+		c = -1
+	} else if s > n.value.s {
+		c = 1
+	}
+
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+
+	return false
+}
+
+type inNode struct {
+	field   string
+	members []member
+}
+
+func (n inNode) eval(e event.Event) bool {
+	v, ok := e.Load(n.field)
+	if !ok {
+		return false
+	}
+
+	for _, m := range n.members {
+		if m.contains(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type member interface {
+	contains(interface{}) bool
+}
+
+type literal struct {
+	s        string
+	n        float64
+	isNumber bool
+	quoted   bool
+}
+
+func newLiteral(t token) literal {
+	l := literal{
+		s:      t.val,
+		quoted: t.typ == tokenString,
+	}
+
+	if l.quoted {
+	} else if f, err := strconv.ParseFloat(t.val, 64); err == nil {
+		l.n = f
+		l.isNumber = true
+	}
+
+	return l
+}
+
+func (l literal) contains(v interface{}) bool {
+	if !l.isNumber {
+	} else if f, ok := toNumber(v); ok {
+		return f == l.n
+	}
+
+	return toString(v) == l.s
+}
+
+type cidrMember struct {
+	ipnet *net.IPNet
+}
+
+func (m cidrMember) contains(v interface{}) bool {
+	ip, ok := v.(net.IP)
+	if !ok {
+		ip = net.ParseIP(toString(v))
+	}
+
+	if ip == nil {
+		return false
+	}
+
+	return m.ipnet.Contains(ip)
+}
+
+type rangeMember struct {
+	from, to float64
+}
+
+func (m rangeMember) contains(v interface{}) bool {
+	f, ok := toNumber(v)
+	if !ok {
+		return false
+	}
+
+	return f >= m.from && f <= m.to
+}
+
+func compareFloat(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+
+	return 0
+}
+
+func toString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.Format(time.RFC3339)
+	case error:
+		return x.Error()
+	case fmt.Stringer:
+		return x.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int8:
+		return float64(x), true
+	case int16:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case uint:
+		return float64(x), true
+	case uint8:
+		return float64(x), true
+	case uint16:
+		return float64(x), true
+	case uint32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	case string:
+		f, err := strconv.ParseFloat(x, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,117 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package expr
+
+import (
+	"net"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestEval(t *testing.T) {
+	e := event.New(
+		event.Category("ssh"),
+		event.Type("password-authentication"),
+		event.SourceAddr(&net.TCPAddr{IP: net.ParseIP("192.168.1.5"), Port: 51234}),
+		event.DestinationAddr(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}),
+		event.Payload([]byte("root:root")),
+		event.Custom("ssh.username", "root"),
+	)
+
+	tests := []struct {
+		expression string
+		expected   bool
+	}{
+		{`category == "ssh"`, true},
+		{`category == ssh`, true},
+		{`category != "heartbeat"`, true},
+		{`sensor != "heartbeat"`, true},
+		{`sensor == "heartbeat"`, false},
+		{`type =~ "auth"`, true},
+		{`type !~ "^password"`, false},
+		{`ssh.username exists`, true},
+		{`ssh.password exists`, false},
+		{`ssh.password not exists`, true},
+		{`source-ip in 10.0.0.0/8`, false},
+		{`destination-ip in 10.0.0.0/8`, true},
+		{`source-ip not in [10.0.0.0/8, 172.16.0.0/12]`, true},
+		{`destination-port == 22`, true},
+		{`destination-port == "22"`, true},
+		{`destination-port in 1..1024`, true},
+		{`source-port in 1..1024`, false},
+		{`destination-port in [21, 22, 23]`, true},
+		{`payload-length > 5 and payload-length <= 9`, true},
+		{`payload-length >= 10`, false},
+		{`category == "ssh" and type =~ "auth" and not source-ip in 10.0.0.0/8 and category != "heartbeat"`, true},
+		{`category == "http" or category == "ssh"`, true},
+		{`category == "http" or category == "ssh" and type == "other"`, false},
+		{`(category == "http" or category == "ssh") and not (type == "other")`, true},
+		{`NOT category == "http" AND ssh.username == 'root'`, true},
+		{`payload =~ "^root:\w+$"`, true},
+		{`unknown > 5`, false},
+	}
+
+	for _, test := range tests {
+		x, err := Parse(test.expression)
+		if err != nil {
+			t.Errorf("%s: %s", test.expression, err)
+			continue
+		}
+
+		if got := x.Eval(e); got != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.expression, test.expected, got)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`category ==`,
+		`category == "ssh" and`,
+		`category "ssh"`,
+		`(category == "ssh"`,
+		`category == "ssh")`,
+		`source-ip in 10.0.0.0/33`,
+		`type =~ "("`,
+		`port in 1..x`,
+		`category == "ssh`,
+		`category not == "ssh"`,
+		`port in [1, 2`,
+	}
+
+	for _, test := range tests {
+		if _, err := Parse(test); err == nil {
+			t.Errorf("%s: expected error", test)
+		}
+	}
+}
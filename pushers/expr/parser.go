@@ -0,0 +1,260 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package expr
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword returns true if the next token is the (case insensitive) keyword
+// kw, consuming it.
+func (p *parser) keyword(kw string) bool {
+	t := p.peek()
+	if t.typ != tokenWord || !strings.EqualFold(t.val, kw) {
+		return false
+	}
+
+	p.next()
+	return true
+}
+
+func (p *parser) errorf(t token, format string, a ...interface{}) error {
+	return fmt.Errorf("%s at position %d, got %s", fmt.Sprintf(format, a...), t.pos, t)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = orNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		left = andNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.keyword("not") {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return notNode{n}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.peek()
+
+	if t.typ == tokenLParen {
+		p.next()
+
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if t := p.next(); t.typ != tokenRParen {
+			return nil, p.errorf(t, "expected )")
+		}
+
+		return n, nil
+	}
+
+	if t.typ != tokenWord {
+		return nil, p.errorf(t, "expected field")
+	}
+
+	field := p.next().val
+
+	negate := p.keyword("not")
+
+	var n node
+
+	if p.keyword("exists") {
+		n = existsNode{field}
+	} else if p.keyword("in") {
+		members, err := p.parseMembers()
+		if err != nil {
+			return nil, err
+		}
+
+		n = inNode{field, members}
+	} else if negate {
+		return nil, p.errorf(p.peek(), "expected in or exists")
+	} else {
+		op := p.next()
+		if op.typ != tokenOperator {
+			return nil, p.errorf(op, "expected operator")
+		}
+
+		v := p.next()
+		if v.typ != tokenWord && v.typ != tokenString {
+			return nil, p.errorf(v, "expected value")
+		}
+
+		switch op.val {
+		case "=~", "!~":
+			re, err := regexp.Compile(v.val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression at position %d: %s", v.pos, err.Error())
+			}
+
+			n = matchNode{field, re}
+			negate = op.val == "!~"
+		case "!=":
+			n = compareNode{field, "==", newLiteral(v)}
+			negate = true
+		default:
+			n = compareNode{field, op.val, newLiteral(v)}
+		}
+	}
+
+	if negate {
+		return notNode{n}, nil
+	}
+
+	return n, nil
+}
+
+func (p *parser) parseMembers() ([]member, error) {
+	if p.peek().typ != tokenLBracket {
+		m, err := p.parseMember()
+		if err != nil {
+			return nil, err
+		}
+
+		return []member{m}, nil
+	}
+
+	p.next()
+
+	members := []member{}
+	for {
+		m, err := p.parseMember()
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, m)
+
+		t := p.next()
+		if t.typ == tokenRBracket {
+			return members, nil
+		} else if t.typ != tokenComma {
+			return nil, p.errorf(t, "expected , or ]")
+		}
+	}
+}
+
+func (p *parser) parseMember() (member, error) {
+	t := p.next()
+
+	if t.typ == tokenString {
+		return newLiteral(t), nil
+	} else if t.typ != tokenWord {
+		return nil, p.errorf(t, "expected value")
+	}
+
+	if strings.Contains(t.val, "/") {
+		_, ipnet, err := net.ParseCIDR(t.val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr at position %d: %s", t.pos, err.Error())
+		}
+
+		return cidrMember{ipnet}, nil
+	}
+
+	if parts := strings.Split(t.val, ".."); len(parts) == 2 {
+		from, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range at position %d: %s", t.pos, err.Error())
+		}
+
+		to, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range at position %d: %s", t.pos, err.Error())
+		}
+
+		return rangeMember{from, to}, nil
+	}
+
+	return newLiteral(t), nil
+}
@@ -0,0 +1,235 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package fschannel
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encoder encodes events as lines of a file.
+type encoder interface {
+	// header returns the data written at the start of every file.
+	header() []byte
+	encode(m map[string]interface{}) ([]byte, error)
+}
+
+// defaultColumns are the columns of csv files, if not configured.
+var defaultColumns = []string{
+	"date",
+	"sensor",
+	"category",
+	"type",
+	"session-id",
+	"source-ip",
+	"source-port",
+	"destination-ip",
+	"destination-port",
+}
+
+// defaultCEFMapping maps event keys to CEF extension keys.
+var defaultCEFMapping = map[string]string{
+	"source-ip":        "src",
+	"source-port":      "spt",
+	"destination-ip":   "dst",
+	"destination-port": "dpt",
+	"protocol":         "proto",
+	"category":         "cat",
+	"message":          "msg",
+	"service":          "app",
+	"session-id":       "externalId",
+}
+
+func (c *FileConfig) encoder() (encoder, error) {
+	switch c.Format {
+	case FormatJSON:
+		return jsonEncoder{}, nil
+	case FormatCSV:
+		columns := c.Columns
+		if len(columns) == 0 {
+			columns = defaultColumns
+		}
+
+		return csvEncoder{columns: columns}, nil
+	case FormatCEF:
+		if c.CEF.Severity < 0 || c.CEF.Severity > 10 {
+			return nil, fmt.Errorf("cef severity %d not between 0 and 10", c.CEF.Severity)
+		}
+
+		mapping := map[string]string{}
+		for k, v := range defaultCEFMapping {
+			mapping[k] = v
+		}
+
+		for k, v := range c.CEF.Mapping {
+			if v == "" {
+				delete(mapping, k)
+			} else {
+				mapping[k] = v
+			}
+		}
+
+		return cefEncoder{CEFConfig: c.CEF, mapping: mapping}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %s", c.Format)
+	}
+}
+
+// jsonEncoder encodes events as json, one per line.
+type jsonEncoder struct{}
+
+func (jsonEncoder) header() []byte {
+	return nil
+}
+
+func (jsonEncoder) encode(m map[string]interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(m); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// csvEncoder encodes the configured columns of events as csv.
+type csvEncoder struct {
+	columns []string
+}
+
+func (e csvEncoder) record(values []string) []byte {
+	buf := &bytes.Buffer{}
+
+	w := csv.NewWriter(buf)
+	w.Write(values)
+	w.Flush()
+
+	return buf.Bytes()
+}
+
+func (e csvEncoder) header() []byte {
+	return e.record(e.columns)
+}
+
+func (e csvEncoder) encode(m map[string]interface{}) ([]byte, error) {
+	values := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		values[i] = toString(m[column])
+	}
+
+	return e.record(values), nil
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// cefEncoder encodes events in the ArcSight Common Event Format.
+type cefEncoder struct {
+	CEFConfig
+
+	mapping map[string]string
+}
+
+func (e cefEncoder) header() []byte {
+	return nil
+}
+
+func (e cefEncoder) encode(m map[string]interface{}) ([]byte, error) {
+	date := time.Now()
+	if v, ok := m["date"].(time.Time); ok {
+		date = v
+	}
+
+	name := toString(m["category"])
+	if typ := toString(m["type"]); name == "" {
+		name = typ
+	} else if typ != "" {
+		name += " " + typ
+	}
+
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "CEF:0|%s|%s|%s|%s|%s|%d|rt=%d",
+		cefHeaderEscaper.Replace(e.Vendor),
+		cefHeaderEscaper.Replace(e.Product),
+		cefHeaderEscaper.Replace(e.Version),
+		cefHeaderEscaper.Replace(toString(m["type"])),
+		cefHeaderEscaper.Replace(name),
+		e.Severity,
+		date.UnixNano()/int64(time.Millisecond),
+	)
+
+	fields := [][2]string{}
+	for k, v := range m {
+		if ext, ok := e.mapping[k]; ok {
+			fields = append(fields, [2]string{ext, toString(v)})
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i][0] < fields[j][0]
+	})
+
+	for _, field := range fields {
+		fmt.Fprintf(buf, " %s=%s", field[0], cefValueEscaper.Replace(field[1]))
+	}
+
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ",")
+	case int:
+		return strconv.Itoa(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		return string(v)
+	case error:
+		return v.Error()
+	default:
+		return fmt.Sprint(v)
+	}
+}
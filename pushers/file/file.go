@@ -31,13 +31,10 @@
 package fschannel
 
 import (
-	"bytes"
-	"encoding/json"
+	"bufio"
 	"errors"
 	"fmt"
-	"io"
 	"os"
-	"path"
 	"path/filepath"
 	"sync"
 	"time"
@@ -53,204 +50,274 @@ var (
 )
 
 var (
-	defaultMaxSize  = 1024 * 1024 * 1024
-	defaultWaitTime = 5 * time.Second
-	crtlline        = []byte("\r\n")
-	log             = logging.MustGetLogger("channels/file")
+	defaultMaxSize       = int64(1024 * 1024 * 1024)
+	defaultFlushInterval = 5 * time.Second
+	log                  = logging.MustGetLogger("channels/file")
+)
+
+// Rotation intervals.
+const (
+	RotateNone   = ""
+	RotateHourly = "hourly"
+	RotateDaily  = "daily"
+)
+
+// Compression methods of rotated files.
+const (
+	CompressNone = ""
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// Encodings of events.
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatCEF  = "cef"
 )
 
 // New returns a new instance of a FileBackend.
 func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	fc := FileBackend{
 		FileConfig: FileConfig{
-			MaxSize: defaultMaxSize,
+			MaxSize:       defaultMaxSize,
+			Format:        FormatJSON,
+			FlushInterval: config.Delay(defaultFlushInterval),
+			CEF: CEFConfig{
+				Vendor:   "DutchSec",
+				Product:  "Honeytrap",
+				Version:  "1.0",
+				Severity: 5,
+			},
 		},
-		request: make(chan map[string]interface{}),
-		closer:  make(chan struct{}),
+		ch:      make(chan map[string]interface{}, 100),
+		rotated: make(chan rotation, 100),
+		done:    make(chan struct{}),
 	}
 
 	for _, optionFn := range options {
-		optionFn(&fc)
+		if err := optionFn(&fc); err != nil {
+			return nil, err
+		}
 	}
 
 	if fc.File == "" {
 		return nil, errors.New("File channel: filename not set")
 	}
 
-	if path.IsAbs(fc.File) {
-	} else if pwd, err := os.Getwd(); err == nil {
-		fc.File = filepath.Join(pwd, fc.File)
+	if !filepath.IsAbs(fc.File) {
+		if pwd, err := os.Getwd(); err == nil {
+			fc.File = filepath.Join(pwd, fc.File)
+		}
 	}
 
-	fc.timeout = config.MakeDuration(fc.Timeout, int(defaultWaitTime))
+	// timeout is the former name of flush_interval
+	if fc.Timeout != "" {
+		fc.FlushInterval = config.Delay(config.MakeDuration(fc.Timeout, int(defaultFlushInterval)))
+	}
+
+	if err := fc.validate(); err != nil {
+		return nil, fmt.Errorf("File channel: %s", err.Error())
+	}
+
+	enc, err := fc.encoder()
+	if err != nil {
+		return nil, fmt.Errorf("File channel: %s", err.Error())
+	}
+
+	fc.enc = enc
+
+	fc.wg.Add(2)
+	go fc.run()
+	go fc.housekeeper()
 
 	return &fc, nil
 }
 
+// CEFConfig defines the header values and extension keys of CEF encoded events.
+type CEFConfig struct {
+	Vendor   string `toml:"vendor"`
+	Product  string `toml:"product"`
+	Version  string `toml:"version"`
+	Severity int    `toml:"severity"`
+
+	// Mapping maps event keys to CEF extension keys, extending (or with an
+	// empty value, removing from) the default mapping.
+	Mapping map[string]string `toml:"mapping"`
+}
+
 // FileConfig defines the config used to setup the FileBackend.
 type FileConfig struct {
-	MaxSize int    `toml:"maxsize"`
+	// File is the path of the file, which can contain the date
+	// placeholders %Y, %m, %d, %H, %M and %S.
 	File    string `toml:"filename"`
+	MaxSize int64  `toml:"maxsize"`
 	Timeout string `toml:"timeout"`
-}
 
-// FileBackend defines a struct which implements the pushers.Pusher interface
-// and allows us to write PushMessage updates into a giving file path. Mainly for
-// the need to sync PushMessage to local files for persistence.
-// File paths provided are either created with a append mode if they already
-// exists else will be created. FileBackend will also restrict filesize to a max of 1gb by default else if
-// there exists a max size set in configuration, then that will be used instead,
-// also the old file will be renamed with the current timestamp and a new file created.
-type FileBackend struct {
-	FileConfig
-	timeout time.Duration
-	dest    *os.File
-	request chan map[string]interface{}
-	closer  chan struct{}
-	wg      sync.WaitGroup
-}
+	// Rotate is one of hourly or daily, files are rotated on size only if
+	// not set.
+	Rotate string `toml:"rotate"`
+	// Compress is gzip or zstd, or empty for no compression.
+	Compress string `toml:"compress"`
 
-// Wait calls the internal waiter.
-func (f *FileBackend) Wait() {
-	f.wg.Wait()
-}
+	// MaxFiles is the number of rotated files kept, MaxAge the age of the
+	// oldest rotated file kept. Both are unlimited if not set.
+	MaxFiles int          `toml:"max_files"`
+	MaxAge   config.Delay `toml:"max_age"`
 
-// Send delivers the giving if it passes all filtering criteria into the
-// FileBackend write queue.
-func (f *FileBackend) Send(message event.Event) {
-	if err := f.syncWrites(); err != nil {
-		log.Errorf("Error syncing writes: %+q", err)
-		return
-	}
+	// Format is one of json, csv or cef.
+	Format  string    `toml:"format"`
+	Columns []string  `toml:"columns"`
+	CEF     CEFConfig `toml:"cef"`
 
-	mp := make(map[string]interface{})
+	FlushInterval config.Delay `toml:"flush_interval"`
+}
 
-	message.Range(func(key, value interface{}) bool {
-		if keyName, ok := key.(string); ok {
-			mp[keyName] = value
-		}
-		return true
-	})
+func (c *FileConfig) validate() error {
+	switch c.Rotate {
+	case RotateNone, RotateHourly, RotateDaily:
+	default:
+		return fmt.Errorf("unknown rotate interval %s", c.Rotate)
+	}
 
-	f.request <- mp
-}
+	switch c.Compress {
+	case CompressNone, CompressGzip, CompressZstd:
+	default:
+		return fmt.Errorf("unknown compression %s", c.Compress)
+	}
 
-// syncWrites startups the channel procedure to listen for new writes to giving file.
-func (f *FileBackend) syncWrites() error {
-	if f.dest != nil && f.request != nil {
-		return nil
+	if c.MaxSize <= 0 {
+		return errors.New("maxsize should be positive")
 	}
 
-	// If the request channel has been niled but file is still opened,
-	// close it.
-	if f.dest != nil {
-		f.dest.Sync()
-		f.dest.Close()
+	if c.MaxFiles < 0 || c.MaxAge.Duration() < 0 {
+		return errors.New("max_files and max_age can't be negative")
 	}
 
-	if f.request == nil {
-		f.request = make(chan map[string]interface{})
+	if c.FlushInterval.Duration() <= 0 {
+		return errors.New("flush_interval should be positive")
 	}
 
-	var err error
+	return nil
+}
 
-	f.dest, err = newFile(f.File, f.MaxSize)
-	if err != nil {
-		log.Errorf("Failed create destination file: %s", err)
-		return err
+// FileBackend defines a struct which implements the pushers.Pusher interface
+// and allows us to write events into a file. Files are rotated when they
+// exceed the maximum size or the rotation interval passes, after which they
+// are compressed and pruned in the background.
+type FileBackend struct {
+	FileConfig
+
+	enc encoder
+
+	// the current file, its path, size and the start of its period
+	f      *os.File
+	w      *bufio.Writer
+	name   string
+	size   int64
+	period time.Time
+
+	// rotated queues the rotated files for the housekeeper
+	rotated chan rotation
+
+	ch   chan map[string]interface{}
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// Wait calls the internal waiter.
+func (f *FileBackend) Wait() {
+	f.wg.Wait()
+}
+
+// Send delivers the event into the FileBackend write queue.
+func (f *FileBackend) Send(message event.Event) {
+	select {
+	case f.ch <- event.ToMap(message):
+	case <-f.done:
 	}
+}
 
-	f.wg.Add(1)
-	go f.syncLoop()
+// Close writes all queued events, closes the file and waits until rotated
+// files have been compressed.
+func (f *FileBackend) Close() error {
+	f.once.Do(func() {
+		close(f.done)
+	})
 
+	f.wg.Wait()
 	return nil
 }
 
-// syncLoop handles configuration of the giving loop for writing to file.
-func (f *FileBackend) syncLoop() {
+func (f *FileBackend) run() {
 	defer f.wg.Done()
 
-	ticker := time.NewTimer(f.timeout)
-	var buf bytes.Buffer
-
-	{
-	writeSync:
-		for {
-			select {
-			case <-ticker.C:
-				f.dest.Close()
-				f.dest = nil
-
-				// Close request channel and nil it.
-				f.request = nil
-
-				break writeSync
-
-			case req, ok := <-f.request:
-				if !ok {
-					f.dest.Close()
-					f.dest = nil
-					f.request = nil
-					break writeSync
-				}
-
-				if err := json.NewEncoder(&buf).Encode(req); err != nil {
-					log.Errorf("Failed to marshal PushMessage to JSON : %+q", err)
-					continue writeSync
-				}
-
-				if buf.Len() < (500 * 1024) {
-					continue
-				}
-			case <-time.After(time.Second):
-			}
-
-			if _, err := io.Copy(f.dest, &buf); err != nil && err != io.EOF {
-				log.Errorf("Failed to copy data to File : %+q", err)
-			}
-
-			if err := f.dest.Sync(); err != nil {
-				log.Errorf("Failed to sync Write to File : %+q", err)
+	ticker := time.NewTicker(f.FlushInterval.Duration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case m := <-f.ch:
+			f.write(m)
+		case <-ticker.C:
+			f.flush()
+		case <-f.done:
+			f.drain()
+
+			if err := f.close(); err != nil {
+				log.Errorf("Error closing file %s: %s", f.name, err.Error())
+				pushers.Errors.Inc("file")
 			}
 
-			// Reset the buffer for reuse.
-			buf.Reset()
+			close(f.rotated)
+			return
 		}
 	}
 }
 
-// newFile returns a new file with the giving target path and returns the
-// new file object.
-func newFile(targetPath string, maxSize int) (*os.File, error) {
-	// Attempt to stat file, if it does not exists then create a new one.
-	stat, err := os.Stat(targetPath)
-	if err != nil {
-		dest, err := os.OpenFile(targetPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
-		if err != nil {
-			return nil, err
+// drain writes the queued events.
+func (f *FileBackend) drain() {
+	for {
+		select {
+		case m := <-f.ch:
+			f.write(m)
+		default:
+			return
 		}
+	}
+}
 
-		return dest, nil
+func (f *FileBackend) write(m map[string]interface{}) {
+	data, err := f.enc.encode(m)
+	if err != nil {
+		log.Errorf("Error encoding event: %s", err.Error())
+		pushers.Errors.Inc("file")
+		return
 	}
 
-	if stat.IsDir() {
-		return nil, errors.New("Only direct file paths allowed")
+	if err := f.prepare(time.Now(), int64(len(data))); err != nil {
+		log.Errorf("Error opening file: %s", err.Error())
+		pushers.Errors.Inc("file")
+		return
 	}
 
-	// if we dealing with a file still  below our max size, then
-	// open file if already exists else
-	if int(stat.Size()) <= maxSize {
-		dest, err := os.OpenFile(targetPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
-		if err != nil {
-			return nil, err
-		}
+	n, err := f.w.Write(data)
+	f.size += int64(n)
 
-		return dest, nil
+	if err != nil {
+		log.Errorf("Error writing to file %s: %s", f.name, err.Error())
+		pushers.Errors.Inc("file")
 	}
+}
 
-	if err := os.Rename(targetPath, fmt.Sprintf("%s-%s", targetPath, stat.ModTime().Format("20060102150405"))); err != nil {
-		return nil, err
+func (f *FileBackend) flush() {
+	if f.w == nil {
+		return
 	}
 
-	return os.OpenFile(targetPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err := f.w.Flush(); err != nil {
+		log.Errorf("Error writing to file %s: %s", f.name, err.Error())
+		pushers.Errors.Inc("file")
+	}
 }
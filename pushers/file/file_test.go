@@ -28,4 +28,317 @@
 * logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
 * must display the words "Powered by Honeytrap" and retain the original copyright notice.
  */
-package fschannel_test
+package fschannel
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/klauspost/compress/zstd"
+)
+
+func newBackend(t *testing.T, fn func(*FileBackend)) (*FileBackend, string) {
+	dir, err := ioutil.TempDir("", "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(func(c pushers.Channel) error {
+		b := c.(*FileBackend)
+		b.File = filepath.Join(dir, "honeytrap.log")
+		fn(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*FileBackend), dir
+}
+
+func testEvent(typ string) event.Event {
+	return event.New(
+		event.Sensor("test"),
+		event.Category("ssh"),
+		event.Type(typ),
+		event.Custom("source-ip", "192.0.2.1"),
+	)
+}
+
+func TestExpand(t *testing.T) {
+	date := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	if s := expand("log/%Y/%m/%d/%H%M%S-100%%.log", date); s != "log/2017/03/04/050607-100%.log" {
+		t.Errorf("unexpected expansion %s", s)
+	}
+
+	if s := pattern("log/%Y-%m-%d.log"); s != "log/*-*-*.log*" {
+		t.Errorf("unexpected pattern %s", s)
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	re := matcher("/var/log/%Y%m%d.log")
+
+	for name, expected := range map[string]bool{
+		"/var/log/20170304.log":                         true,
+		"/var/log/20170304.log-20170304235959":          true,
+		"/var/log/20170304.log-20170304235959.1.gz":     true,
+		"/var/log/20170304.log-20170304235959.zst":      true,
+		"/var/log/syslog.log":                           false,
+		"/var/log/20170304.log.bak":                     false,
+		"/var/log/2017030.log":                          false,
+		"/var/log/nested/20170304.log":                  false,
+		"/var/log/20170304.log-20170304235959.gz.other": false,
+	} {
+		if re.MatchString(name) != expected {
+			t.Errorf("%s: expected match %t", name, expected)
+		}
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	date := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	b := &FileBackend{}
+
+	b.Rotate = RotateHourly
+	if p := b.periodStart(date); !p.Equal(time.Date(2017, 3, 4, 5, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected hourly period %s", p)
+	}
+
+	b.Rotate = RotateDaily
+	if p := b.periodStart(date); !p.Equal(time.Date(2017, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected daily period %s", p)
+	}
+
+	b.Rotate = RotateNone
+	if p := b.periodStart(date); !p.IsZero() {
+		t.Errorf("unexpected period %s", p)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	b, dir := newBackend(t, func(b *FileBackend) {
+		b.Format = FormatCSV
+		b.Columns = []string{"category", "type", "source-ip"}
+	})
+	defer os.RemoveAll(dir)
+
+	b.Send(testEvent("password, authentication"))
+	b.Close()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "honeytrap.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "category,type,source-ip\nssh,\"password, authentication\",192.0.2.1\n"
+	if string(data) != expected {
+		t.Errorf("expected %q, got %q", expected, string(data))
+	}
+}
+
+func TestCEF(t *testing.T) {
+	b, dir := newBackend(t, func(b *FileBackend) {
+		b.Format = FormatCEF
+	})
+	defer os.RemoveAll(dir)
+
+	b.Send(testEvent("login|attempt"))
+	b.Close()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "honeytrap.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(string(data), `CEF:0|DutchSec|Honeytrap|1.0|login\|attempt|ssh login\|attempt|5|rt=`) {
+		t.Errorf("unexpected header: %s", string(data))
+	}
+
+	if !strings.HasSuffix(string(data), " cat=ssh src=192.0.2.1\n") {
+		t.Errorf("unexpected extension: %s", string(data))
+	}
+}
+
+func TestRotateSize(t *testing.T) {
+	b, dir := newBackend(t, func(b *FileBackend) {
+		b.MaxSize = 100
+		b.Compress = CompressGzip
+		b.MaxFiles = 2
+	})
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 10; i++ {
+		b.Send(testEvent("test"))
+	}
+
+	b.Close()
+
+	matches, err := filepath.Glob(filepath.Join(dir, "honeytrap.log-*.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 rotated files, got %d: %v", len(matches), matches)
+	}
+
+	f, err := os.Open(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := 0
+	for s := bufio.NewScanner(zr); s.Scan(); lines++ {
+		if !strings.Contains(s.Text(), `"type":"test"`) {
+			t.Errorf("unexpected line %s", s.Text())
+		}
+	}
+
+	if lines != 1 {
+		t.Errorf("expected 1 event per rotated file, got %d", lines)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "honeytrap.log")); err != nil {
+		t.Errorf("expected active file: %s", err.Error())
+	}
+}
+
+func TestRotateZstd(t *testing.T) {
+	b, dir := newBackend(t, func(b *FileBackend) {
+		b.MaxSize = 100
+		b.Compress = CompressZstd
+	})
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 3; i++ {
+		b.Send(testEvent("test"))
+	}
+
+	b.Close()
+
+	matches, err := filepath.Glob(filepath.Join(dir, "honeytrap.log-*.zst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 rotated files, got %d: %v", len(matches), matches)
+	}
+
+	f, err := os.Open(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer zr.Close()
+
+	lines := 0
+	for s := bufio.NewScanner(zr); s.Scan(); lines++ {
+		if !strings.Contains(s.Text(), `"type":"test"`) {
+			t.Errorf("unexpected line %s", s.Text())
+		}
+	}
+
+	if lines != 1 {
+		t.Errorf("expected 1 event per rotated file, got %d", lines)
+	}
+}
+
+func TestRotatePeriodOnOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "honeytrap.log")
+	if err := ioutil.WriteFile(name, []byte("{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	yesterday := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(name, yesterday, yesterday); err != nil {
+		t.Fatal(err)
+	}
+
+	b, tmp := newBackend(t, func(b *FileBackend) {
+		b.File = name
+		b.Rotate = RotateDaily
+		b.MaxAge = config.Delay(time.Hour)
+	})
+	defer os.RemoveAll(tmp)
+
+	b.Send(testEvent("test"))
+	b.Close()
+
+	matches, err := filepath.Glob(filepath.Join(dir, "honeytrap.log*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rotated file of yesterday exceeds max_age
+	if len(matches) != 1 || matches[0] != name {
+		t.Errorf("expected only the active file, got %v", matches)
+	}
+}
+
+func TestPruneKeepsForeignFiles(t *testing.T) {
+	b, dir := newBackend(t, func(b *FileBackend) {
+		b.MaxSize = 100
+		b.MaxFiles = 1
+	})
+	defer os.RemoveAll(dir)
+
+	b.File = filepath.Join(dir, "%Y%m%d.log")
+
+	foreign := filepath.Join(dir, "other.log")
+	if err := ioutil.WriteFile(foreign, []byte("keep\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		b.Send(testEvent("test"))
+	}
+
+	b.Close()
+
+	if _, err := os.Stat(foreign); err != nil {
+		t.Errorf("expected foreign file to be kept: %s", err.Error())
+	}
+
+	matches, err := filepath.Glob(filepath.Join(dir, "*.log-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != 1 {
+		t.Errorf("expected 1 rotated file, got %d: %v", len(matches), matches)
+	}
+}
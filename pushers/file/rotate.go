@@ -0,0 +1,403 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package fschannel
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/klauspost/compress/zstd"
+)
+
+// stampFormat is the format of the timestamp appended to rotated files.
+const stampFormat = "20060102150405"
+
+// expand replaces the date placeholders in name.
+func expand(name string, t time.Time) string {
+	return strings.NewReplacer(
+		"%Y", t.Format("2006"),
+		"%m", t.Format("01"),
+		"%d", t.Format("02"),
+		"%H", t.Format("15"),
+		"%M", t.Format("04"),
+		"%S", t.Format("05"),
+		"%%", "%",
+	).Replace(name)
+}
+
+// pattern returns the glob pattern matching all files of name, including
+// rotated and compressed ones. The pattern matches other files as well, see
+// matcher.
+func pattern(name string) string {
+	return strings.NewReplacer(
+		"%Y", "*", "%m", "*", "%d", "*",
+		"%H", "*", "%M", "*", "%S", "*",
+		"%%", "%",
+	).Replace(name) + "*"
+}
+
+// matcher returns the regular expression matching only the names expand can
+// produce for name, with the rotation stamp and compression extension.
+func matcher(name string) *regexp.Regexp {
+	expr := "^"
+
+	for i := 0; i < len(name); i++ {
+		if name[i] != '%' || i+1 == len(name) {
+			expr += regexp.QuoteMeta(name[i : i+1])
+			continue
+		}
+
+		switch name[i+1] {
+		case 'Y':
+			expr += `\d{4}`
+		case 'm', 'd', 'H', 'M', 'S':
+			expr += `\d{2}`
+		case '%':
+			expr += "%"
+		default:
+			expr += "%"
+			continue
+		}
+
+		i++
+	}
+
+	return regexp.MustCompile(expr + `(?:-\d{14}(?:\.\d+)?)?(?:\.gz|\.zst)?$`)
+}
+
+// periodStart returns the start of the rotation period of t, or the zero
+// time if files are rotated on size only.
+func (f *FileBackend) periodStart(t time.Time) time.Time {
+	switch f.Rotate {
+	case RotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case RotateDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+// prepare makes sure a file is opened that n more bytes can be written to,
+// rotating the current file if necessary.
+func (f *FileBackend) prepare(now time.Time, n int64) error {
+	name := expand(f.File, now)
+	period := f.periodStart(now)
+
+	if f.f != nil {
+		var err error
+
+		switch {
+		case name != f.name:
+			// the previous file is complete, it keeps its name
+			err = f.rotate(time.Time{}, name)
+		case !period.Equal(f.period):
+			err = f.rotate(f.period, name)
+		case f.size > 0 && f.size+n > f.MaxSize:
+			err = f.rotate(now, name)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if f.f != nil {
+		return nil
+	}
+
+	return f.open(name, now)
+}
+
+// open opens name for appending, rotating it first if it belongs to an
+// earlier period or exceeds the maximum size.
+func (f *FileBackend) open(name string, now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+
+	if stat, err := os.Stat(name); err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err != nil {
+	} else if stat.IsDir() {
+		return fmt.Errorf("%s is a directory", name)
+	} else if period := f.periodStart(stat.ModTime()); period.Before(f.periodStart(now)) {
+		if err := f.rotateFile(name, period, name); err != nil {
+			return err
+		}
+	} else if stat.Size() >= f.MaxSize {
+		if err := f.rotateFile(name, stat.ModTime(), name); err != nil {
+			return err
+		}
+	}
+
+	dest, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	stat, err := dest.Stat()
+	if err != nil {
+		dest.Close()
+		return err
+	}
+
+	f.f = dest
+	f.w = bufio.NewWriterSize(dest, 64*1024)
+	f.name = name
+	f.size = stat.Size()
+	f.period = f.periodStart(now)
+
+	if f.size == 0 {
+		header := f.enc.header()
+
+		n, err := f.w.Write(header)
+		f.size += int64(n)
+		return err
+	}
+
+	return nil
+}
+
+// close flushes and closes the current file.
+func (f *FileBackend) close() error {
+	if f.f == nil {
+		return nil
+	}
+
+	dest := f.f
+	f.f = nil
+
+	if err := f.w.Flush(); err != nil {
+		dest.Close()
+		return err
+	}
+
+	if err := dest.Sync(); err != nil {
+		dest.Close()
+		return err
+	}
+
+	return dest.Close()
+}
+
+// rotate closes the current file and rotates it, active is the name of the
+// file that will be written to next.
+func (f *FileBackend) rotate(stamp time.Time, active string) error {
+	name := f.name
+
+	if err := f.close(); err != nil {
+		return err
+	}
+
+	return f.rotateFile(name, stamp, active)
+}
+
+// rotateFile renames name with the stamp appended, unless the stamp is zero,
+// after which it is compressed and old files are pruned in the background.
+func (f *FileBackend) rotateFile(name string, stamp time.Time, active string) error {
+	rotated := name
+
+	if !stamp.IsZero() {
+		rotated = fmt.Sprintf("%s-%s", name, stamp.Format(stampFormat))
+
+		for i := 1; exists(rotated); i++ {
+			rotated = fmt.Sprintf("%s-%s.%d", name, stamp.Format(stampFormat), i)
+		}
+
+		if err := os.Rename(name, rotated); err != nil {
+			return err
+		}
+	}
+
+	log.Debugf("Rotated file %s to %s", name, rotated)
+
+	f.rotated <- rotation{name: rotated, active: active}
+	return nil
+}
+
+// exists returns true if name, or its compressed version, exists.
+func exists(name string) bool {
+	for _, ext := range []string{"", ".gz", ".zst"} {
+		if _, err := os.Stat(name + ext); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rotation is a rotated file, active is the file written to after the
+// rotation.
+type rotation struct {
+	name   string
+	active string
+}
+
+// housekeeper compresses the rotated files and prunes old ones, one rotation
+// at a time.
+func (f *FileBackend) housekeeper() {
+	defer f.wg.Done()
+
+	for r := range f.rotated {
+		if err := f.compress(r.name); os.IsNotExist(err) {
+			// pruned before it was compressed
+		} else if err != nil {
+			log.Errorf("Error compressing %s: %s", r.name, err.Error())
+			pushers.Errors.Inc("file")
+		}
+
+		if err := f.prune(r.active); err != nil {
+			log.Errorf("Error pruning files: %s", err.Error())
+			pushers.Errors.Inc("file")
+		}
+	}
+}
+
+// compress compresses the rotated file, replacing it.
+func (f *FileBackend) compress(name string) error {
+	switch f.Compress {
+	case CompressGzip:
+		return compressFile(name, ".gz", func(w io.Writer) (io.WriteCloser, error) {
+			zw := gzip.NewWriter(w)
+			zw.Name = filepath.Base(name)
+			return zw, nil
+		})
+	case CompressZstd:
+		return compressFile(name, ".zst", func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		})
+	}
+
+	return nil
+}
+
+// compressFile compresses name into name with ext appended, using the writer
+// returned by fn, and removes name.
+func compressFile(name, ext string, fn func(io.Writer) (io.WriteCloser, error)) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+ext, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	zw, err := fn(dst)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(name)
+}
+
+// prune removes the rotated files exceeding max_files or max_age, the active
+// file is never removed.
+func (f *FileBackend) prune(active string) error {
+	if f.MaxFiles == 0 && f.MaxAge == 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(pattern(f.File))
+	if err != nil {
+		return err
+	}
+
+	re := matcher(filepath.Clean(f.File))
+	active = filepath.Clean(active)
+
+	type rotatedFile struct {
+		name    string
+		modTime time.Time
+	}
+
+	files := []rotatedFile{}
+	for _, name := range matches {
+		if name == active || !re.MatchString(name) {
+			continue
+		}
+
+		stat, err := os.Stat(name)
+		if err != nil || stat.IsDir() {
+			continue
+		}
+
+		files = append(files, rotatedFile{name, stat.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+
+	for i, file := range files {
+		if f.MaxFiles > 0 && i >= f.MaxFiles {
+		} else if f.MaxAge > 0 && time.Since(file.modTime) > f.MaxAge.Duration() {
+		} else {
+			continue
+		}
+
+		log.Debugf("Removing rotated file %s", file.name)
+
+		if err := os.Remove(file.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -34,6 +34,7 @@ import (
 	"regexp"
 
 	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers/expr"
 )
 
 //==========================================================================================
@@ -83,6 +84,17 @@ func RegexFilterFunc(field string, expressions []string) FilterFunc {
 	}
 }
 
+// ExpressionFilterFunc returns a function for filtering events matching the
+// expression, see package expr for the syntax.
+func ExpressionFilterFunc(expression string) (FilterFunc, error) {
+	x, err := expr.Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return x.Eval, nil
+}
+
 // FilterChannel defines a struct which handles the delivery of giving
 // messages to a specific sets of backend channels based on specific criteria.
 func FilterChannel(channel Channel, fn FilterFunc) Channel {
@@ -0,0 +1,382 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package hpfeeds contains a channel publishing events to a hpfeeds broker.
+package hpfeeds
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:channels:hpfeeds")
+
+var (
+	_ = pushers.Register("hpfeeds", New)
+)
+
+const maxReconnectDelay = time.Minute
+
+// Config defines the configuration of the hpfeeds channel.
+type Config struct {
+	// Broker is the address of the broker, host:port.
+	Broker string `toml:"broker"`
+
+	Ident  string `toml:"ident"`
+	Secret string `toml:"secret"`
+
+	// Channel is the hpfeeds channel of the events, {category} is replaced
+	// by the category of the event. Channels overrides the channel per
+	// category.
+	Channel  string            `toml:"channel"`
+	Channels map[string]string `toml:"channels"`
+
+	Timeout config.Delay `toml:"timeout"`
+
+	// TLS is used to connect if enabled.
+	TLSEnabled bool              `toml:"tls_enabled"`
+	TLS        pushers.TLSConfig `toml:"tls"`
+}
+
+// Backend defines a struct which provides a channel publishing events to a
+// hpfeeds broker.
+type Backend struct {
+	Config
+
+	tlsConfig *tls.Config
+
+	m      sync.Mutex
+	client *client
+	// connected is closed once client is set
+	connected chan struct{}
+
+	ch chan map[string]interface{}
+}
+
+// New returns a hpfeeds channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	c := Backend{
+		Config: Config{
+			Channel: "honeytrap.{category}",
+			Timeout: config.Delay(10 * time.Second),
+		},
+		ch:        make(chan map[string]interface{}, 100),
+		connected: make(chan struct{}),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Broker == "" {
+		return nil, errors.New("Invalid Config: broker can not be empty")
+	}
+
+	if c.Ident == "" || c.Secret == "" {
+		return nil, errors.New("Invalid Config: ident and secret can not be empty")
+	}
+
+	if c.TLSEnabled {
+		var err error
+		if c.tlsConfig, err = c.TLS.Config(); err != nil {
+			return nil, err
+		}
+	}
+
+	go c.connector()
+	go c.run()
+
+	return &c, nil
+}
+
+// channel returns the hpfeeds channel of the event.
+func (b *Backend) channel(m map[string]interface{}) string {
+	category, _ := m["category"].(string)
+
+	if channel, ok := b.Channels[category]; ok {
+		return channel
+	}
+
+	if category == "" {
+		category = "unknown"
+	}
+
+	return strings.Replace(b.Channel, "{category}", category, -1)
+}
+
+// client is a connection to a hpfeeds broker.
+type client struct {
+	conn  net.Conn
+	ident string
+
+	m    sync.Mutex
+	err  error
+	done chan struct{}
+}
+
+func (b *Backend) connect() (*client, error) {
+	timeout := b.Timeout.Duration()
+
+	var conn net.Conn
+	var err error
+
+	if b.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", b.Broker, b.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", b.Broker, timeout)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	m, err := readMessage(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	name, nonce, err := parseInfo(m)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	auth, err := authMessage(b.Ident, b.Secret, nonce)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err := conn.Write(auth.bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	log.Infof("Connected to hpfeeds broker %s (%s)", b.Broker, name)
+
+	c := &client{
+		conn:  conn,
+		ident: b.Ident,
+		done:  make(chan struct{}),
+	}
+
+	go c.reader()
+
+	return c, nil
+}
+
+// reader reads the messages of the broker, which only sends errors (for
+// example on failed authentication) before closing the connection.
+func (c *client) reader() {
+	for {
+		m, err := readMessage(c.conn)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		if m.opcode == opError {
+			c.fail(fmt.Errorf("broker error: %s", string(m.payload)))
+			return
+		}
+	}
+}
+
+func (c *client) fail(err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+
+	c.conn.Close()
+}
+
+// Err returns the error that closed the connection.
+func (c *client) Err() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.err
+}
+
+func (c *client) Publish(channel string, data []byte, timeout time.Duration) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+
+	m, err := publishMessage(c.ident, channel, data)
+	if err != nil {
+		return err
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+
+	if _, err := c.conn.Write(m.bytes()); err != nil {
+		c.fail(err)
+		return err
+	}
+
+	return nil
+}
+
+func (c *client) Close() {
+	c.fail(errors.New("closed"))
+}
+
+// Healthy returns true if the channel is connected to the broker.
+func (b *Backend) Healthy() bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.client != nil && b.client.Err() == nil
+}
+
+// connector keeps the channel connected to the broker, reconnecting with
+// backoff when the connection is lost.
+func (b *Backend) connector() {
+	delay := time.Second
+
+	for {
+		c, err := b.connect()
+		if err != nil {
+			log.Errorf("Error connecting to hpfeeds broker %s: %s", b.Broker, err.Error())
+			pushers.Errors.Inc("hpfeeds")
+		} else {
+			start := time.Now()
+
+			b.m.Lock()
+			b.client = c
+			close(b.connected)
+			b.m.Unlock()
+
+			<-c.done
+
+			log.Errorf("Connection to hpfeeds broker %s lost: %s", b.Broker, c.Err().Error())
+			pushers.Errors.Inc("hpfeeds")
+
+			b.lost(c)
+
+			// keep backing off when connections are dropped right away,
+			// for example on failed authentication
+			if time.Since(start) > maxReconnectDelay {
+				delay = time.Second
+			}
+		}
+
+		time.Sleep(delay)
+
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// lost resets the connection state if c is the current client.
+func (b *Backend) lost(c *client) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.client != c {
+		return
+	}
+
+	b.client = nil
+	b.connected = make(chan struct{})
+}
+
+// publish publishes the data, waiting for the connector to (re)connect until
+// it succeeds.
+func (b *Backend) publish(channel string, data []byte) {
+	for {
+		b.m.Lock()
+		c, connected := b.client, b.connected
+		b.m.Unlock()
+
+		if c == nil {
+			<-connected
+			continue
+		}
+
+		err := c.Publish(channel, data, b.Timeout.Duration())
+		if err == nil {
+			return
+		}
+
+		if c.Err() == nil {
+			// the message itself is invalid, retrying won't help
+			log.Errorf("Error publishing to hpfeeds broker %s: %s", b.Broker, err.Error())
+			pushers.Errors.Inc("hpfeeds")
+			return
+		}
+
+		b.lost(c)
+	}
+}
+
+func (b *Backend) run() {
+	for m := range b.ch {
+		data, err := json.Marshal(m)
+		if err != nil {
+			log.Errorf("Error marshaling event: %s", err.Error())
+			pushers.Errors.Inc("hpfeeds")
+			continue
+		}
+
+		b.publish(b.channel(m), data)
+	}
+}
+
+// Send publishes the event.
+func (b *Backend) Send(message event.Event) {
+	b.ch <- event.ToMap(message)
+}
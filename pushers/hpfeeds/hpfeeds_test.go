@@ -0,0 +1,353 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package hpfeeds
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/spool"
+)
+
+type publication struct {
+	ident   string
+	channel string
+	payload []byte
+}
+
+// testBroker is a hpfeeds broker stand-in, accepting a single ident and
+// collecting the publications.
+type testBroker struct {
+	ln net.Listener
+
+	ident  string
+	secret string
+
+	m            sync.Mutex
+	publications []publication
+	authFailures int
+}
+
+func newTestBroker(t *testing.T, ident, secret string) *testBroker {
+	return listenTestBroker(t, "127.0.0.1:0", ident, secret)
+}
+
+func listenTestBroker(t *testing.T, addr, ident, secret string) *testBroker {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &testBroker{
+		ln:     ln,
+		ident:  ident,
+		secret: secret,
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go b.serve(conn)
+		}
+	}()
+
+	return b
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	nonce := []byte{1, 2, 3, 4}
+
+	info, _ := appendString(nil, "test-broker")
+	conn.Write(message{opcode: opInfo, payload: append(info, nonce...)}.bytes())
+
+	m, err := readMessage(conn)
+	if err != nil || m.opcode != opAuth {
+		return
+	}
+
+	ident, hash, err := readString(m.payload)
+	if err != nil {
+		return
+	}
+
+	expected := sha1.Sum(append(nonce, b.secret...))
+	if ident != b.ident || !bytes.Equal(hash, expected[:]) {
+		b.m.Lock()
+		b.authFailures++
+		b.m.Unlock()
+
+		conn.Write(message{opcode: opError, payload: []byte("authentication failed")}.bytes())
+		return
+	}
+
+	for {
+		m, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+
+		if m.opcode != opPublish {
+			continue
+		}
+
+		ident, rest, err := readString(m.payload)
+		if err != nil {
+			return
+		}
+
+		channel, payload, err := readString(rest)
+		if err != nil {
+			return
+		}
+
+		b.m.Lock()
+		b.publications = append(b.publications, publication{ident, channel, payload})
+		b.m.Unlock()
+	}
+}
+
+func (b *testBroker) wait(t *testing.T, n int) []publication {
+	for i := 0; i < 200; i++ {
+		b.m.Lock()
+		publications := b.publications
+		b.m.Unlock()
+
+		if len(publications) >= n {
+			return publications
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected %d publications", n)
+	return nil
+}
+
+func newBackend(t *testing.T, broker *testBroker, secret string) *Backend {
+	return newBackendAt(t, broker.ln.Addr().String(), secret)
+}
+
+func newBackendAt(t *testing.T, addr string, secret string) *Backend {
+	c, err := New(func(c pushers.Channel) error {
+		b := c.(*Backend)
+		b.Broker = addr
+		b.Ident = "sensor"
+		b.Secret = secret
+		b.Channels = map[string]string{"http": "honeytrap.web"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*Backend)
+}
+
+func TestPublish(t *testing.T) {
+	broker := newTestBroker(t, "sensor", "secret")
+	defer broker.ln.Close()
+
+	b := newBackend(t, broker, "secret")
+
+	b.Send(event.New(event.Category("ssh"), event.Type("password-authentication")))
+	b.Send(event.New(event.Category("http"), event.Type("request")))
+
+	publications := broker.wait(t, 2)
+
+	expected := []string{"honeytrap.ssh", "honeytrap.web"}
+	for i, p := range publications {
+		if p.ident != "sensor" {
+			t.Errorf("unexpected ident %s", p.ident)
+		}
+
+		if p.channel != expected[i] {
+			t.Errorf("expected channel %s, got %s", expected[i], p.channel)
+		}
+
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(p.payload, &m); err != nil {
+			t.Errorf("invalid json payload: %s", err.Error())
+		}
+	}
+
+	if !b.Healthy() {
+		t.Errorf("expected healthy channel")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	broker := newTestBroker(t, "sensor", "secret")
+	defer broker.ln.Close()
+
+	b := newBackend(t, broker, "secret")
+
+	b.Send(event.New(event.Category("ssh")))
+	broker.wait(t, 1)
+
+	// drop the connection, the connector reconnects
+	b.m.Lock()
+	b.client.conn.Close()
+	b.m.Unlock()
+
+	for i := 0; i < 100 && b.Healthy(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.Send(event.New(event.Category("ssh")))
+	broker.wait(t, 2)
+}
+
+func TestAuthenticationFailure(t *testing.T) {
+	broker := newTestBroker(t, "sensor", "secret")
+	defer broker.ln.Close()
+
+	b := newBackend(t, broker, "wrong")
+
+	b.Send(event.New(event.Category("ssh")))
+
+	for i := 0; i < 200; i++ {
+		broker.m.Lock()
+		failures := broker.authFailures
+		broker.m.Unlock()
+
+		if failures > 0 {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 100 && b.Healthy(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if b.Healthy() {
+		t.Errorf("expected unhealthy channel after failed authentication")
+	}
+
+	broker.m.Lock()
+	defer broker.m.Unlock()
+
+	if len(broker.publications) != 0 {
+		t.Errorf("expected no publications, got %d", len(broker.publications))
+	}
+}
+
+func TestAuthMessage(t *testing.T) {
+	m, err := authMessage("ident", "secret", []byte("nonce"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ident, hash, err := readString(m.payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := sha1.Sum([]byte("noncesecret"))
+	if ident != "ident" || !bytes.Equal(hash, expected[:]) {
+		t.Errorf("unexpected auth message %x", m.payload)
+	}
+
+	buf := bytes.NewReader(m.bytes())
+
+	read, err := readMessage(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if read.opcode != opAuth || !bytes.Equal(read.payload, m.payload) {
+		t.Errorf("message doesn't round trip")
+	}
+}
+
+func TestSpoolUntilBrokerStarts(t *testing.T) {
+	// reserve an address for the broker started later
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dir, err := ioutil.TempDir("", "hpfeeds")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	b := newBackendAt(t, addr, "secret")
+
+	s, err := spool.New(b, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		s.Send(event.New(event.Category("ssh")))
+	}
+
+	if stats := s.Stats(); stats.Depth != 10 {
+		t.Fatalf("expected events to be spooled while not connected, got %+v", stats)
+	}
+
+	broker := listenTestBroker(t, addr, "sensor", "secret")
+	defer broker.ln.Close()
+
+	for i := 0; i < 50 && !b.Healthy(); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if !b.Healthy() {
+		t.Fatal("expected channel to connect once the broker started")
+	}
+
+	broker.wait(t, 10)
+}
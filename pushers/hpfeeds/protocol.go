@@ -0,0 +1,152 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package hpfeeds
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// hpfeeds opcodes.
+const (
+	opError     = 0
+	opInfo      = 1
+	opAuth      = 2
+	opPublish   = 3
+	opSubscribe = 4
+)
+
+// maxMessageSize limits the size of messages read from the broker.
+const maxMessageSize = 1 << 20
+
+var errInvalidMessage = errors.New("invalid hpfeeds message")
+
+// message is a hpfeeds message, the length (4 bytes) of the message,
+// followed by the opcode and payload.
+type message struct {
+	opcode  byte
+	payload []byte
+}
+
+func (m message) bytes() []byte {
+	buf := make([]byte, 5+len(m.payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(buf)))
+	buf[4] = m.opcode
+	copy(buf[5:], m.payload)
+	return buf
+}
+
+func readMessage(r io.Reader) (message, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return message{}, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length < 5 || length > maxMessageSize {
+		return message{}, errInvalidMessage
+	}
+
+	payload := make([]byte, length-5)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return message{}, err
+	}
+
+	return message{opcode: header[4], payload: payload}, nil
+}
+
+// appendString appends the string, prefixed with its length (1 byte).
+func appendString(buf []byte, s string) ([]byte, error) {
+	if len(s) > 255 {
+		return nil, fmt.Errorf("%q exceeds 255 bytes", s)
+	}
+
+	buf = append(buf, byte(len(s)))
+	return append(buf, s...), nil
+}
+
+// readString reads a string prefixed with its length, returning the
+// remaining data.
+func readString(data []byte) (string, []byte, error) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return "", nil, errInvalidMessage
+	}
+
+	n := int(data[0])
+	return string(data[1 : 1+n]), data[1+n:], nil
+}
+
+// authMessage returns the authentication of ident, answering the nonce of
+// the broker info message with sha1(nonce + secret).
+func authMessage(ident, secret string, nonce []byte) (message, error) {
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(secret))
+
+	payload, err := appendString(nil, ident)
+	if err != nil {
+		return message{}, err
+	}
+
+	return message{opcode: opAuth, payload: h.Sum(payload)}, nil
+}
+
+func publishMessage(ident, channel string, data []byte) (message, error) {
+	payload, err := appendString(nil, ident)
+	if err != nil {
+		return message{}, err
+	}
+
+	if payload, err = appendString(payload, channel); err != nil {
+		return message{}, err
+	}
+
+	return message{opcode: opPublish, payload: append(payload, data...)}, nil
+}
+
+// parseInfo returns the broker name and nonce of an info message.
+func parseInfo(m message) (string, []byte, error) {
+	if m.opcode == opError {
+		return "", nil, fmt.Errorf("broker error: %s", string(m.payload))
+	} else if m.opcode != opInfo {
+		return "", nil, fmt.Errorf("expected info message, got opcode %d", m.opcode)
+	}
+
+	name, nonce, err := readString(m.payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return name, nonce, nil
+}
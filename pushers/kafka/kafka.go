@@ -32,6 +32,7 @@ package kafka
 
 import (
 	"encoding/json"
+	"sync/atomic"
 
 	sarama "github.com/Shopify/sarama"
 
@@ -55,6 +56,9 @@ type Backend struct {
 	producer sarama.AsyncProducer
 
 	ch chan map[string]interface{}
+
+	// failing is set while the last produced message failed
+	failing int32
 }
 
 func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
@@ -78,17 +82,19 @@ func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	c.producer = producer
 
 	go c.run()
+	go c.results()
 
 	return &c, nil
 }
 
-func (hc Backend) run() {
+func (hc *Backend) run() {
 	defer hc.producer.AsyncClose()
 
-	for doc := range <-hc.ch {
+	for doc := range hc.ch {
 		data, err := json.Marshal(doc)
 		if err != nil {
 			log.Errorf("Error marshaling event: %s", err.Error())
+			pushers.Errors.Inc("kafka")
 			continue
 		}
 
@@ -100,8 +106,41 @@ func (hc Backend) run() {
 	}
 }
 
+// results tracks the outcome of the produced messages, until the producer
+// is closed.
+func (hc *Backend) results() {
+	successes, failures := hc.producer.Successes(), hc.producer.Errors()
+
+	for successes != nil || failures != nil {
+		select {
+		case _, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+
+			atomic.StoreInt32(&hc.failing, 0)
+		case err, ok := <-failures:
+			if !ok {
+				failures = nil
+				continue
+			}
+
+			log.Errorf("Error producing event: %s", err.Error())
+			pushers.Errors.Inc("kafka")
+
+			atomic.StoreInt32(&hc.failing, 1)
+		}
+	}
+}
+
+// Healthy returns false if the last produced message failed.
+func (hc *Backend) Healthy() bool {
+	return atomic.LoadInt32(&hc.failing) == 0
+}
+
 // Send delivers the giving push messages into the internal elastic search endpoint.
-func (hc Backend) Send(message event.Event) {
+func (hc *Backend) Send(message event.Event) {
 	mp := make(map[string]interface{})
 
 	message.Range(func(key, value interface{}) bool {
@@ -33,6 +33,7 @@ package kafka
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/Shopify/sarama"
@@ -86,12 +87,76 @@ func TestChannelsKafkaSend(t *testing.T) {
 
 	kb := c.(*Backend)
 
-	select {
-	case <-kb.producer.Successes():
-	case msg := <-kb.producer.Errors():
-		t.Error(msg.Err)
+	waitProduced(t, leader)
+
+	if !kb.Healthy() {
+		t.Error("expected healthy channel after produced message")
 	}
 
 	close(kb.ch)
 
 }
+
+func TestChannelsKafkaHealthy(t *testing.T) {
+	seedBroker := sarama.NewMockBroker(t, 1)
+	defer seedBroker.Close()
+
+	leader := sarama.NewMockBroker(t, 2)
+	defer leader.Close()
+
+	metadataResponse := new(sarama.MetadataResponse)
+	metadataResponse.AddBroker(leader.Addr(), leader.BrokerID())
+	metadataResponse.AddTopicPartition("my_topic", 0, leader.BrokerID(), nil, nil, sarama.ErrNoError)
+
+	seedBroker.Returns(metadataResponse)
+
+	prodFailure := new(sarama.ProduceResponse)
+	prodFailure.AddTopicPartition("my_topic", 0, sarama.ErrMessageSizeTooLarge)
+
+	leader.Returns(prodFailure)
+
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode(fmt.Sprintf(config, seedBroker.Addr()), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(
+		pushers.WithConfig(s.P),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kb := c.(*Backend)
+	defer close(kb.ch)
+
+	c.Send(event.New())
+
+	for i := 0; kb.Healthy(); i++ {
+		if i == 100 {
+			t.Fatal("expected unhealthy channel after failed message")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitProduced waits until the broker received a produce request.
+func waitProduced(t *testing.T, broker *sarama.MockBroker) {
+	for i := 0; i < 100; i++ {
+		for _, rr := range broker.History() {
+			if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+				// the response is handled asynchronously
+				time.Sleep(10 * time.Millisecond)
+				return
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("no produce request received")
+}
@@ -120,17 +120,20 @@ func (hc Backend) run() {
 		req, err := http.NewRequest(http.MethodPost, hc.URL, pr)
 		if err != nil {
 			log.Errorf("Could create new request: %s", err.Error())
+			pushers.Errors.Inc("marija")
 			return
 		}
 
 		resp, err := client.Do(req)
 		if err != nil {
 			log.Errorf("Could not submit event to Marija: %s", err.Error())
+			pushers.Errors.Inc("marija")
 			return
 		}
 
 		if resp.StatusCode != http.StatusOK {
 			log.Errorf("Could not submit event to Marija: %d", resp.StatusCode)
+			pushers.Errors.Inc("marija")
 			return
 		}
 	}
@@ -191,5 +194,6 @@ func (hc Backend) Send(message event.Event) {
 	case hc.ch <- mp:
 	default:
 		log.Errorf("Could not send more messages, channel full")
+		pushers.Errors.Inc("marija")
 	}
 }
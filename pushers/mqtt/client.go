@@ -0,0 +1,248 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+var errClosed = errors.New("mqtt: connection closed")
+
+// client is a minimal mqtt client, publishing messages.
+type client struct {
+	conn    net.Conn
+	version byte
+
+	keepAlive time.Duration
+
+	w sync.Mutex
+
+	m        sync.Mutex
+	id       uint16
+	inflight map[uint16]chan struct{}
+	err      error
+
+	done chan struct{}
+}
+
+// connect sends CONNECT over conn and waits for the CONNACK.
+func connect(conn net.Conn, version byte, clientID, username, password string, keepAlive time.Duration, will *Message, timeout time.Duration) (*client, error) {
+	c := &client{
+		conn:      conn,
+		version:   version,
+		keepAlive: keepAlive,
+		inflight:  map[uint16]chan struct{}{},
+		done:      make(chan struct{}),
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := connectPacket(version, clientID, username, password, uint16(keepAlive/time.Second), will).WriteTo(conn); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+
+	p, err := readPacket(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Type != CONNACK {
+		return nil, fmt.Errorf("mqtt: expected CONNACK, got packet type %d", p.Type)
+	}
+
+	d := &decoder{b: p.Body}
+	d.byte() // session present
+
+	if code := d.byte(); d.err != nil {
+		return nil, d.err
+	} else if code != 0 {
+		return nil, fmt.Errorf("mqtt: connection refused, reason code %d", code)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	go c.reader(r)
+
+	if keepAlive > 0 {
+		go c.pinger()
+	}
+
+	return c, nil
+}
+
+func (c *client) write(p packet) error {
+	c.w.Lock()
+	defer c.w.Unlock()
+
+	_, err := p.WriteTo(c.conn)
+	return err
+}
+
+// fail closes the connection, failing all inflight messages.
+func (c *client) fail(err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = err
+	close(c.done)
+
+	c.conn.Close()
+}
+
+// complete marks the message with the packet id as delivered.
+func (c *client) complete(id uint16) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if ch, ok := c.inflight[id]; ok {
+		close(ch)
+		delete(c.inflight, id)
+	}
+}
+
+func (c *client) reader(r *bufio.Reader) {
+	for {
+		if c.keepAlive > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 2))
+		}
+
+		p, err := readPacket(r)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		d := &decoder{b: p.Body}
+
+		switch p.Type {
+		case PUBACK, PUBCOMP:
+			c.complete(d.uint16())
+		case PUBREC:
+			if err := c.write(ackPacket(PUBREL, d.uint16())); err != nil {
+				c.fail(err)
+				return
+			}
+		case PINGRESP:
+		case DISCONNECT:
+			c.fail(errClosed)
+			return
+		default:
+			c.fail(fmt.Errorf("mqtt: unexpected packet type %d", p.Type))
+			return
+		}
+	}
+}
+
+func (c *client) pinger() {
+	ticker := time.NewTicker(c.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.write(packet{Type: PINGREQ}); err != nil {
+				c.fail(err)
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Publish publishes m, waiting for the acknowledgement of QoS 1 and 2
+// messages.
+func (c *client) Publish(m Message, timeout time.Duration) error {
+	if m.QoS == 0 {
+		return c.write(publishPacket(c.version, m, 0, false))
+	}
+
+	c.m.Lock()
+	if c.err != nil {
+		c.m.Unlock()
+		return c.err
+	}
+
+	c.id++
+	if c.id == 0 {
+		c.id = 1
+	}
+
+	id := c.id
+
+	ch := make(chan struct{})
+	c.inflight[id] = ch
+	c.m.Unlock()
+
+	if err := c.write(publishPacket(c.version, m, id, false)); err != nil {
+		return err
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-c.done:
+		return c.Err()
+	case <-time.After(timeout):
+		c.m.Lock()
+		delete(c.inflight, id)
+		c.m.Unlock()
+
+		return fmt.Errorf("mqtt: no acknowledgement within %s", timeout)
+	}
+}
+
+// Err returns the error that closed the connection, if any.
+func (c *client) Err() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.err
+}
+
+// Close disconnects gracefully, the will isn't published.
+func (c *client) Close() error {
+	c.write(packet{Type: DISCONNECT})
+
+	c.fail(errClosed)
+	return nil
+}
@@ -0,0 +1,312 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package mqtt contains a channel publishing events to a mqtt broker.
+package mqtt
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/rs/xid"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:channels:mqtt")
+
+var (
+	_ = pushers.Register("mqtt", New)
+)
+
+const maxReconnectDelay = time.Minute
+
+// Config defines the configuration of the mqtt channel.
+type Config struct {
+	// Broker is the url of the broker, tcp://host:1883 or tls://host:8883.
+	Broker string `toml:"broker"`
+	// Version is the mqtt version, 3 (3.1.1) or 5.
+	Version int `toml:"version"`
+
+	ClientID string `toml:"client_id"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+
+	// Topic of the events, {field} is replaced by the value of the event
+	// field.
+	Topic  string `toml:"topic"`
+	QoS    int    `toml:"qos"`
+	Retain bool   `toml:"retain"`
+
+	// StatusTopic receives the retained heartbeats, and the retained
+	// last-will if the sensor disconnects unexpectedly.
+	StatusTopic       string       `toml:"status_topic"`
+	HeartbeatInterval config.Delay `toml:"heartbeat_interval"`
+
+	KeepAlive config.Delay `toml:"keep_alive"`
+	Timeout   config.Delay `toml:"timeout"`
+
+	TLS pushers.TLSConfig `toml:"tls"`
+}
+
+// Backend defines a struct which provides a channel publishing events to a mqtt
+// broker.
+type Backend struct {
+	Config
+
+	network   string
+	address   string
+	version   byte
+	tlsConfig *tls.Config
+
+	client *client
+
+	ch chan map[string]interface{}
+}
+
+// New returns a mqtt channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	c := Backend{
+		Config: Config{
+			Version:           3,
+			ClientID:          fmt.Sprintf("honeytrap-%s", xid.New().String()),
+			Topic:             "honeytrap/{sensor}/{category}/{type}",
+			QoS:               1,
+			StatusTopic:       "honeytrap/status/{client_id}",
+			HeartbeatInterval: config.Delay(time.Minute),
+			KeepAlive:         config.Delay(30 * time.Second),
+			Timeout:           config.Delay(10 * time.Second),
+		},
+		ch: make(chan map[string]interface{}, 100),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Broker == "" {
+		return nil, errors.New("Invalid Config: broker can not be empty")
+	}
+
+	u, err := url.Parse(c.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Config: broker: %s", err.Error())
+	}
+
+	c.address = u.Host
+
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		c.network = "tcp"
+	case "tls", "ssl", "mqtts":
+		c.network = "tls"
+
+		if c.tlsConfig, err = c.TLS.Config(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Invalid Config: unsupported broker scheme %s", u.Scheme)
+	}
+
+	switch c.Version {
+	case 3, V311:
+		c.version = V311
+	case V5:
+		c.version = V5
+	default:
+		return nil, fmt.Errorf("Invalid Config: unsupported version %d", c.Version)
+	}
+
+	if c.QoS < 0 || c.QoS > 2 {
+		return nil, fmt.Errorf("Invalid Config: unsupported qos %d", c.QoS)
+	}
+
+	if c.HeartbeatInterval.Duration() <= 0 {
+		return nil, errors.New("Invalid Config: heartbeat_interval should be positive")
+	}
+
+	c.StatusTopic = strings.Replace(c.StatusTopic, "{client_id}", c.ClientID, -1)
+
+	go c.run()
+
+	return &c, nil
+}
+
+var fieldPattern = regexp.MustCompile(`\{([^{}]+)\}`)
+
+var topicEscaper = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// topic returns the topic of the event.
+func (b *Backend) topic(m map[string]interface{}) string {
+	return fieldPattern.ReplaceAllStringFunc(b.Topic, func(s string) string {
+		v, ok := m[s[1:len(s)-1]]
+		if !ok || v == nil {
+			return "_"
+		}
+
+		return topicEscaper.Replace(fmt.Sprint(v))
+	})
+}
+
+func (b *Backend) status(status string) Message {
+	hostname, _ := os.Hostname()
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"status":    status,
+		"client-id": b.ClientID,
+		"hostname":  hostname,
+		"date":      time.Now(),
+	})
+
+	return Message{
+		Topic:   b.StatusTopic,
+		Payload: data,
+		QoS:     1,
+		Retain:  true,
+	}
+}
+
+func (b *Backend) connect() (*client, error) {
+	timeout := b.Timeout.Duration()
+
+	var conn net.Conn
+	var err error
+
+	if b.network == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", b.address, b.tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", b.address, timeout)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	will := b.status("offline")
+
+	c, err := connect(conn, b.version, b.ClientID, b.Username, b.Password, b.KeepAlive.Duration(), &will, timeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := c.Publish(b.status("online"), timeout); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// publish publishes m, (re)connecting until it succeeds.
+func (b *Backend) publish(m Message) {
+	delay := time.Second
+
+	for {
+		if b.client != nil && b.client.Err() != nil {
+			b.client = nil
+		}
+
+		if b.client == nil {
+			c, err := b.connect()
+			if err != nil {
+				log.Errorf("Error connecting to mqtt broker %s: %s", b.Broker, err.Error())
+				pushers.Errors.Inc("mqtt")
+			} else {
+				log.Infof("Connected to mqtt broker %s", b.Broker)
+				b.client = c
+			}
+		}
+
+		if b.client != nil {
+			err := b.client.Publish(m, b.Timeout.Duration())
+			if err == nil {
+				return
+			}
+
+			log.Errorf("Error publishing to mqtt broker %s: %s", b.Broker, err.Error())
+			pushers.Errors.Inc("mqtt")
+
+			b.client.Close()
+			b.client = nil
+		}
+
+		time.Sleep(delay)
+
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (b *Backend) run() {
+	ticker := time.NewTicker(b.HeartbeatInterval.Duration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case m := <-b.ch:
+			data, err := json.Marshal(m)
+			if err != nil {
+				log.Errorf("Error marshaling event: %s", err.Error())
+				pushers.Errors.Inc("mqtt")
+				continue
+			}
+
+			b.publish(Message{
+				Topic:   b.topic(m),
+				Payload: data,
+				QoS:     byte(b.QoS),
+				Retain:  b.Retain,
+			})
+		case <-ticker.C:
+			b.publish(b.status("online"))
+		}
+	}
+}
+
+// Send publishes the event.
+func (b *Backend) Send(message event.Event) {
+	b.ch <- event.ToMap(message)
+}
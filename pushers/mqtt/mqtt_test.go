@@ -0,0 +1,282 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+// parsePublish parses a PUBLISH packet for the test broker, returning the message and packet id.
+func parsePublish(version byte, p packet) (Message, uint16, error) {
+	d := &decoder{b: p.Body}
+
+	m := Message{
+		Topic:  d.string(),
+		QoS:    (p.Flags >> 1) & 0x03,
+		Retain: p.Flags&0x01 == 0x01,
+	}
+
+	var id uint16
+	if m.QoS > 0 {
+		id = d.uint16()
+	}
+
+	if version == V5 {
+		d.properties()
+	}
+
+	m.Payload = d.b
+	return m, id, d.err
+}
+
+// broker is a minimal mqtt broker, accepting a single client.
+type broker struct {
+	l net.Listener
+
+	version  byte
+	will     chan Message
+	messages chan Message
+}
+
+func newBroker(t *testing.T) *broker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &broker{
+		l:        l,
+		will:     make(chan Message, 1),
+		messages: make(chan Message, 10),
+	}
+
+	go b.serve(t)
+
+	return b
+}
+
+func (b *broker) serve(t *testing.T) {
+	conn, err := b.l.Accept()
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	p, err := readPacket(r)
+	if err != nil || p.Type != CONNECT {
+		t.Errorf("Test failed: expected CONNECT: %v", err)
+		return
+	}
+
+	d := &decoder{b: p.Body}
+	d.string() // protocol name
+	b.version = d.byte()
+	flags := d.byte()
+	d.uint16() // keep alive
+
+	if b.version == V5 {
+		d.properties()
+	}
+
+	d.string() // client id
+
+	if flags&0x04 == 0x04 {
+		if b.version == V5 {
+			d.properties()
+		}
+
+		b.will <- Message{Topic: d.string(), Payload: []byte(d.string()), Retain: flags&0x20 == 0x20}
+	}
+
+	connack := []byte{0, 0}
+	if b.version == V5 {
+		connack = append(connack, 0)
+	}
+
+	packet{Type: CONNACK, Body: connack}.WriteTo(conn)
+
+	for {
+		p, err := readPacket(r)
+		if err != nil {
+			return
+		}
+
+		switch p.Type {
+		case PUBLISH:
+			m, id, err := parsePublish(b.version, p)
+			if err != nil {
+				t.Errorf("Test failed: %s", err)
+				return
+			}
+
+			switch m.QoS {
+			case 1:
+				ackPacket(PUBACK, id).WriteTo(conn)
+			case 2:
+				ackPacket(PUBREC, id).WriteTo(conn)
+			}
+
+			b.messages <- m
+		case PUBREL:
+			d := &decoder{b: p.Body}
+			ackPacket(PUBCOMP, d.uint16()).WriteTo(conn)
+		case PINGREQ:
+			packet{Type: PINGRESP}.WriteTo(conn)
+		case DISCONNECT:
+			return
+		}
+	}
+}
+
+func (b *broker) receive(t *testing.T) Message {
+	select {
+	case m := <-b.messages:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("Test failed: no message received")
+	}
+
+	return Message{}
+}
+
+func newBackend(t *testing.T, config string) pushers.Channel {
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode(config, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(
+		pushers.WithConfig(s.P),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func testPublish(t *testing.T, version, qos int) {
+	b := newBroker(t)
+	defer b.l.Close()
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+broker = "tcp://%s"
+client_id = "sensor01"
+version = %d
+qos = %d
+`, b.l.Addr().String(), version, qos))
+
+	c.Send(event.New(event.Sensor("services"), event.Category("ssh"), event.Type("password/authentication")))
+
+	select {
+	case will := <-b.will:
+		if will.Topic != "honeytrap/status/sensor01" || !will.Retain || !strings.Contains(string(will.Payload), `"offline"`) {
+			t.Errorf("Test failed: unexpected will %+v", will)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Test failed: no will received")
+	}
+
+	if m := b.receive(t); m.Topic != "honeytrap/status/sensor01" || !m.Retain || !strings.Contains(string(m.Payload), `"online"`) {
+		t.Errorf("Test failed: unexpected status %+v", m)
+	}
+
+	m := b.receive(t)
+	if m.Topic != "honeytrap/services/ssh/password_authentication" {
+		t.Errorf("Test failed: got topic %s", m.Topic)
+	}
+
+	if int(m.QoS) != qos {
+		t.Errorf("Test failed: got qos %d, expected %d", m.QoS, qos)
+	}
+
+	if !strings.Contains(string(m.Payload), `"category":"ssh"`) {
+		t.Errorf("Test failed: unexpected payload %s", m.Payload)
+	}
+}
+
+func TestPublishV311(t *testing.T) {
+	testPublish(t, 3, 1)
+}
+
+func TestPublishV5(t *testing.T) {
+	testPublish(t, 5, 2)
+}
+
+func TestPublishQoS0(t *testing.T) {
+	testPublish(t, 3, 0)
+}
+
+func TestTopic(t *testing.T) {
+	b := &Backend{Config: Config{Topic: "honeytrap/{category}/{source-ip}/{missing}"}}
+
+	got := b.topic(map[string]interface{}{
+		"category":  "a/b+#",
+		"source-ip": "10.0.0.1",
+	})
+
+	if got != "honeytrap/a_b__/10.0.0.1/_" {
+		t.Errorf("Test failed: got %s", got)
+	}
+}
+
+func TestPacketRemainingLength(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 16383, 16384, 2097152} {
+		buf := &bytes.Buffer{}
+		packet{Type: PUBLISH, Body: make([]byte, n)}.WriteTo(buf)
+
+		p, err := readPacket(bufio.NewReader(buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(p.Body) != n {
+			t.Errorf("Test failed: got %d bytes, expected %d", len(p.Body), n)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types.
+const (
+	CONNECT    = 1
+	CONNACK    = 2
+	PUBLISH    = 3
+	PUBACK     = 4
+	PUBREC     = 5
+	PUBREL     = 6
+	PUBCOMP    = 7
+	PINGREQ    = 12
+	PINGRESP   = 13
+	DISCONNECT = 14
+)
+
+// Protocol levels.
+const (
+	V311 = 4
+	V5   = 5
+)
+
+const maxRemainingLength = 268435455
+
+var errMalformed = errors.New("mqtt: malformed packet")
+
+// packet is a control packet, the fixed header and the remaining bytes.
+type packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+func (p packet) WriteTo(w io.Writer) (int64, error) {
+	if len(p.Body) > maxRemainingLength {
+		return 0, fmt.Errorf("mqtt: packet of %d bytes too large", len(p.Body))
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte(p.Type<<4 | p.Flags&0x0f)
+
+	// remaining length, variable byte integer
+	n := len(p.Body)
+	for {
+		b := byte(n % 128)
+		if n /= 128; n > 0 {
+			b |= 0x80
+		}
+
+		buf.WriteByte(b)
+
+		if n == 0 {
+			break
+		}
+	}
+
+	buf.Write(p.Body)
+
+	written, err := w.Write(buf.Bytes())
+	return int64(written), err
+}
+
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	n, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return packet{}, errMalformed
+		}
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+
+		n += int(b&0x7f) * multiplier
+		multiplier *= 128
+
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+
+	return packet{Type: header >> 4, Flags: header & 0x0f, Body: body}, nil
+}
+
+// encoder builds the variable header and payload of packets.
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) uint16(v uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	e.Write(b[:])
+}
+
+func (e *encoder) binary(data []byte) {
+	e.uint16(uint16(len(data)))
+	e.Write(data)
+}
+
+func (e *encoder) string(s string) {
+	e.binary([]byte(s))
+}
+
+// decoder reads the variable header and payload of packets.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.b) < 1 {
+		d.err = errMalformed
+		return 0
+	}
+
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) uint16() uint16 {
+	if d.err != nil || len(d.b) < 2 {
+		d.err = errMalformed
+		return 0
+	}
+
+	v := binary.BigEndian.Uint16(d.b)
+	d.b = d.b[2:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := int(d.uint16())
+	if d.err != nil || len(d.b) < n {
+		d.err = errMalformed
+		return ""
+	}
+
+	v := string(d.b[:n])
+	d.b = d.b[n:]
+	return v
+}
+
+// properties skips the properties of mqtt 5 packets.
+func (d *decoder) properties() {
+	n, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b := d.byte()
+		if d.err != nil || i == 4 {
+			d.err = errMalformed
+			return
+		}
+
+		n += int(b&0x7f) * multiplier
+		multiplier *= 128
+
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	if len(d.b) < n {
+		d.err = errMalformed
+		return
+	}
+
+	d.b = d.b[n:]
+}
+
+// Message is an application message.
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// connectPacket returns the CONNECT packet.
+func connectPacket(version byte, clientID, username, password string, keepAlive uint16, will *Message) packet {
+	e := &encoder{}
+	e.string("MQTT")
+	e.WriteByte(version)
+
+	flags := byte(0x02) // clean session
+	if will != nil {
+		flags |= 0x04 | will.QoS<<3
+		if will.Retain {
+			flags |= 0x20
+		}
+	}
+
+	if password != "" {
+		flags |= 0x40
+	}
+
+	if username != "" {
+		flags |= 0x80
+	}
+
+	e.WriteByte(flags)
+	e.uint16(keepAlive)
+
+	if version == V5 {
+		e.WriteByte(0) // no properties
+	}
+
+	e.string(clientID)
+
+	if will != nil {
+		if version == V5 {
+			e.WriteByte(0) // no will properties
+		}
+
+		e.string(will.Topic)
+		e.binary(will.Payload)
+	}
+
+	if username != "" {
+		e.string(username)
+	}
+
+	if password != "" {
+		e.string(password)
+	}
+
+	return packet{Type: CONNECT, Body: e.Bytes()}
+}
+
+// publishPacket returns the PUBLISH packet of m, id is ignored for QoS 0.
+func publishPacket(version byte, m Message, id uint16, dup bool) packet {
+	e := &encoder{}
+	e.string(m.Topic)
+
+	if m.QoS > 0 {
+		e.uint16(id)
+	}
+
+	if version == V5 {
+		e.WriteByte(0) // no properties
+	}
+
+	e.Write(m.Payload)
+
+	flags := m.QoS << 1
+	if m.Retain {
+		flags |= 0x01
+	}
+
+	if dup {
+		flags |= 0x08
+	}
+
+	return packet{Type: PUBLISH, Flags: flags, Body: e.Bytes()}
+}
+
+// ackPacket returns a PUBACK, PUBREC, PUBREL or PUBCOMP packet.
+func ackPacket(typ byte, id uint16) packet {
+	e := &encoder{}
+	e.uint16(id)
+
+	flags := byte(0)
+	if typ == PUBREL {
+		flags = 0x02
+	}
+
+	return packet{Type: typ, Flags: flags, Body: e.Bytes()}
+}
@@ -0,0 +1,152 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// TCP flags.
+const (
+	tcpFin = 0x01
+	tcpSyn = 0x02
+	tcpPsh = 0x08
+	tcpAck = 0x10
+)
+
+const (
+	protocolTCP = 6
+	protocolUDP = 17
+
+	// mss is the maximum payload of synthesized tcp segments.
+	mss = 1460
+	// maxDatagram is the maximum payload of synthesized udp datagrams.
+	maxDatagram = 65507
+)
+
+// checksum returns the internet checksum of the data, continuing sum.
+func checksum(sum uint32, data []byte) uint32 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+
+	return sum
+}
+
+func fold(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+
+	return ^uint16(sum)
+}
+
+// ipPacket returns the ip packet from src to dst with the transport segment,
+// of which the checksum at offset csum is calculated. It returns nil if the
+// address families differ.
+func ipPacket(src, dst net.IP, protocol byte, id uint16, segment []byte, csum int) []byte {
+	var pseudo []byte
+	var header []byte
+
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		pseudo = make([]byte, 12)
+		copy(pseudo[0:4], src4)
+		copy(pseudo[4:8], dst4)
+		pseudo[9] = protocol
+		binary.BigEndian.PutUint16(pseudo[10:12], uint16(len(segment)))
+
+		header = make([]byte, 20)
+		header[0] = 0x45
+		binary.BigEndian.PutUint16(header[2:4], uint16(20+len(segment)))
+		binary.BigEndian.PutUint16(header[4:6], id)
+		// don't fragment
+		binary.BigEndian.PutUint16(header[6:8], 0x4000)
+		header[8] = 64
+		header[9] = protocol
+		copy(header[12:16], src4)
+		copy(header[16:20], dst4)
+		binary.BigEndian.PutUint16(header[10:12], fold(checksum(0, header)))
+	} else if src.To4() == nil && dst.To4() == nil && src.To16() != nil && dst.To16() != nil {
+		pseudo = make([]byte, 40)
+		copy(pseudo[0:16], src.To16())
+		copy(pseudo[16:32], dst.To16())
+		binary.BigEndian.PutUint32(pseudo[32:36], uint32(len(segment)))
+		pseudo[39] = protocol
+
+		header = make([]byte, 40)
+		header[0] = 0x60
+		binary.BigEndian.PutUint16(header[4:6], uint16(len(segment)))
+		header[6] = protocol
+		header[7] = 64
+		copy(header[8:24], src.To16())
+		copy(header[24:40], dst.To16())
+	} else {
+		return nil
+	}
+
+	sum := fold(checksum(checksum(0, pseudo), segment))
+	if sum == 0 && protocol == protocolUDP {
+		sum = 0xffff
+	}
+
+	binary.BigEndian.PutUint16(segment[csum:csum+2], sum)
+
+	return append(header, segment...)
+}
+
+// tcpSegment returns the tcp segment with the flags and payload.
+func tcpSegment(sport, dport uint16, seq, ack uint32, flags byte, payload []byte) []byte {
+	segment := make([]byte, 20+len(payload))
+	binary.BigEndian.PutUint16(segment[0:2], sport)
+	binary.BigEndian.PutUint16(segment[2:4], dport)
+	binary.BigEndian.PutUint32(segment[4:8], seq)
+	binary.BigEndian.PutUint32(segment[8:12], ack)
+	segment[12] = 5 << 4
+	segment[13] = flags
+	binary.BigEndian.PutUint16(segment[14:16], 65535)
+	copy(segment[20:], payload)
+	return segment
+}
+
+// udpDatagram returns the udp datagram with the payload.
+func udpDatagram(sport, dport uint16, payload []byte) []byte {
+	datagram := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint16(datagram[0:2], sport)
+	binary.BigEndian.PutUint16(datagram[2:4], dport)
+	binary.BigEndian.PutUint16(datagram[4:6], uint16(len(datagram)))
+	copy(datagram[8:], payload)
+	return datagram
+}
@@ -0,0 +1,507 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pcap
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	logging "github.com/op/go-logging"
+)
+
+var (
+	_ = pushers.Register("pcap", New)
+)
+
+var log = logging.MustGetLogger("channels/pcap")
+
+// Config defines the configuration of the pcap channel.
+type Config struct {
+	// Directory the files are written to, as <prefix>-<timestamp>.pcapng.
+	Directory string `toml:"directory"`
+	Prefix    string `toml:"prefix"`
+
+	// MaxSize is the size in bytes after which a new file is started.
+	MaxSize int64 `toml:"max_size"`
+	// RotateInterval is the time after which a new file is started,
+	// disabled if zero.
+	RotateInterval config.Delay `toml:"rotate_interval"`
+
+	// FlowTimeout is the time after which the state of an idle flow is
+	// forgotten.
+	FlowTimeout config.Delay `toml:"flow_timeout"`
+}
+
+// Backend writes the payloads of events as packets of synthesized flows to
+// pcapng files.
+type Backend struct {
+	Config
+
+	ch   chan map[string]interface{}
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+
+	f       *os.File
+	w       *bufio.Writer
+	size    int64
+	started time.Time
+
+	flows map[string]*flow
+	ipID  uint16
+}
+
+// flow contains the state of a synthesized tcp connection or udp exchange.
+type flow struct {
+	tcp bool
+
+	src, dst     net.IP
+	sport, dport uint16
+
+	// next sequence numbers of the client and the server
+	clientSeq uint32
+	serverSeq uint32
+
+	established bool
+	lastSeen    time.Time
+}
+
+// New returns a pcap channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	b := &Backend{
+		Config: Config{
+			Directory:      "pcap",
+			Prefix:         "honeytrap",
+			MaxSize:        100 * 1024 * 1024,
+			RotateInterval: config.Delay(time.Hour),
+			FlowTimeout:    config.Delay(10 * time.Minute),
+		},
+		ch:    make(chan map[string]interface{}, 100),
+		done:  make(chan struct{}),
+		flows: map[string]*flow{},
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(b); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.Directory == "" || b.Prefix == "" {
+		return nil, errors.New("pcap channel: directory and prefix should be set")
+	}
+
+	if b.MaxSize <= 0 {
+		return nil, errors.New("pcap channel: max_size should be positive")
+	}
+
+	if b.FlowTimeout.Duration() <= 0 {
+		return nil, errors.New("pcap channel: flow_timeout should be positive")
+	}
+
+	if err := os.MkdirAll(b.Directory, 0700); err != nil {
+		return nil, fmt.Errorf("pcap channel: %s", err.Error())
+	}
+
+	b.wg.Add(1)
+	go b.run()
+
+	return b, nil
+}
+
+// Send queues the event for writing.
+func (b *Backend) Send(e event.Event) {
+	select {
+	case b.ch <- event.ToMap(e):
+	case <-b.done:
+	}
+}
+
+// Close writes the queued events and closes the current file.
+func (b *Backend) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+
+	b.wg.Wait()
+	return nil
+}
+
+func (b *Backend) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case m := <-b.ch:
+			b.write(m)
+		case now := <-ticker.C:
+			b.flush()
+			b.expire(now)
+		case <-b.done:
+			for {
+				select {
+				case m := <-b.ch:
+					b.write(m)
+					continue
+				default:
+				}
+
+				break
+			}
+
+			if err := b.close(); err != nil {
+				log.Errorf("Error closing pcap file: %s", err.Error())
+				pushers.Errors.Inc("pcap")
+			}
+
+			return
+		}
+	}
+}
+
+// write writes the packets of the event.
+func (b *Backend) write(m map[string]interface{}) {
+	date, ok := m["date"].(time.Time)
+	if !ok {
+		date = time.Now()
+	}
+
+	for i, p := range b.packets(m) {
+		if err := b.prepare(date); err != nil {
+			log.Errorf("Error opening pcap file: %s", err.Error())
+			pushers.Errors.Inc("pcap")
+			return
+		}
+
+		// keep the packets of an event in order
+		n, err := (&pcapngWriter{b.w}).packet(date.Add(time.Duration(i)*time.Microsecond), p, comment(m))
+		b.size += int64(n)
+
+		if err != nil {
+			log.Errorf("Error writing pcap file: %s", err.Error())
+			pushers.Errors.Inc("pcap")
+			return
+		}
+	}
+}
+
+// comment returns the comment of the packets of the event.
+func comment(m map[string]interface{}) string {
+	parts := []string{}
+	for _, key := range []string{"session-id", "service", "category", "type"} {
+		if v, ok := m[key].(string); ok && v != "" {
+			parts = append(parts, fmt.Sprintf("%s=%s", key, v))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// packets returns the packets synthesized for the event.
+func (b *Backend) packets(m map[string]interface{}) [][]byte {
+	src := net.ParseIP(toString(m["source-ip"]))
+	dst := net.ParseIP(toString(m["destination-ip"]))
+	sport, dport := toPort(m["source-port"]), toPort(m["destination-port"])
+
+	if src == nil || dst == nil {
+		return nil
+	}
+
+	tcp := toString(m["protocol"]) != "udp"
+
+	key := toString(m["session-id"])
+	if key == "" {
+		key = fmt.Sprintf("%t %s %d %s %d", tcp, src, sport, dst, dport)
+	}
+
+	typ := toString(m["type"])
+
+	f, ok := b.flows[key]
+	if !ok {
+		if typ == "CONNECTION:CLOSED" {
+			return nil
+		}
+
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		isn := h.Sum32()
+
+		f = &flow{
+			tcp:       tcp,
+			src:       src,
+			dst:       dst,
+			sport:     sport,
+			dport:     dport,
+			clientSeq: isn,
+			serverSeq: isn ^ 0x5a5a5a5a,
+		}
+
+		b.flows[key] = f
+	}
+
+	f.lastSeen = time.Now()
+
+	payload := toPayload(m)
+
+	if !f.tcp {
+		if len(payload) == 0 {
+			return nil
+		}
+
+		if len(payload) > maxDatagram {
+			payload = payload[:maxDatagram]
+		}
+
+		return b.nonNil(ipPacket(f.src, f.dst, protocolUDP, b.nextID(), udpDatagram(f.sport, f.dport, payload), 6))
+	}
+
+	packets := [][]byte{}
+
+	if !f.established {
+		packets = append(packets,
+			b.clientSegment(f, tcpSyn, nil),
+			b.serverSegment(f, tcpSyn|tcpAck),
+			b.clientSegment(f, tcpAck, nil),
+		)
+
+		f.established = true
+	}
+
+	for len(payload) > 0 {
+		n := len(payload)
+		if n > mss {
+			n = mss
+		}
+
+		packets = append(packets,
+			b.clientSegment(f, tcpPsh|tcpAck, payload[:n]),
+			b.serverSegment(f, tcpAck),
+		)
+
+		payload = payload[n:]
+	}
+
+	if typ == "CONNECTION:CLOSED" {
+		packets = append(packets,
+			b.clientSegment(f, tcpFin|tcpAck, nil),
+			b.serverSegment(f, tcpFin|tcpAck),
+			b.clientSegment(f, tcpAck, nil),
+		)
+
+		delete(b.flows, key)
+	}
+
+	return b.nonNil(packets...)
+}
+
+// nonNil returns the packets that could be built.
+func (b *Backend) nonNil(packets ...[]byte) [][]byte {
+	result := [][]byte{}
+	for _, p := range packets {
+		if p != nil {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
+
+func (b *Backend) nextID() uint16 {
+	b.ipID++
+	return b.ipID
+}
+
+// clientSegment returns a segment from the client, advancing its sequence
+// number.
+func (b *Backend) clientSegment(f *flow, flags byte, payload []byte) []byte {
+	ack := uint32(0)
+	if flags&tcpAck != 0 {
+		ack = f.serverSeq
+	}
+
+	segment := tcpSegment(f.sport, f.dport, f.clientSeq, ack, flags, payload)
+
+	f.clientSeq += uint32(len(payload))
+	if flags&(tcpSyn|tcpFin) != 0 {
+		f.clientSeq++
+	}
+
+	return ipPacket(f.src, f.dst, protocolTCP, b.nextID(), segment, 16)
+}
+
+// serverSegment returns a segment from the server, advancing its sequence
+// number.
+func (b *Backend) serverSegment(f *flow, flags byte) []byte {
+	segment := tcpSegment(f.dport, f.sport, f.serverSeq, f.clientSeq, flags, nil)
+
+	if flags&(tcpSyn|tcpFin) != 0 {
+		f.serverSeq++
+	}
+
+	return ipPacket(f.dst, f.src, protocolTCP, b.nextID(), segment, 16)
+}
+
+// expire forgets the flows idle for longer than the flow timeout.
+func (b *Backend) expire(now time.Time) {
+	for key, f := range b.flows {
+		if now.Sub(f.lastSeen) > b.FlowTimeout.Duration() {
+			delete(b.flows, key)
+		}
+	}
+}
+
+// prepare makes sure a file is opened, starting a new file if the current
+// one exceeds the maximum size or the rotation interval.
+func (b *Backend) prepare(now time.Time) error {
+	if b.f != nil {
+		if b.size < b.MaxSize && (b.RotateInterval == 0 || time.Since(b.started) < b.RotateInterval.Duration()) {
+			return nil
+		}
+
+		if err := b.close(); err != nil {
+			return err
+		}
+	}
+
+	name := filepath.Join(b.Directory, fmt.Sprintf("%s-%s.pcapng", b.Prefix, time.Now().Format("20060102150405")))
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			break
+		}
+
+		name = filepath.Join(b.Directory, fmt.Sprintf("%s-%s.%d.pcapng", b.Prefix, time.Now().Format("20060102150405"), i))
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Writing packets to %s", name)
+
+	b.f = f
+	b.w = bufio.NewWriter(f)
+	b.started = time.Now()
+
+	n, err := (&pcapngWriter{b.w}).header("honeytrap")
+	b.size = int64(n)
+	return err
+}
+
+func (b *Backend) flush() {
+	if b.w == nil {
+		return
+	}
+
+	if err := b.w.Flush(); err != nil {
+		log.Errorf("Error writing pcap file: %s", err.Error())
+		pushers.Errors.Inc("pcap")
+	}
+}
+
+// close flushes and closes the current file.
+func (b *Backend) close() error {
+	if b.f == nil {
+		return nil
+	}
+
+	f := b.f
+	b.f = nil
+
+	if err := b.w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// toPayload returns the payload of the event.
+func toPayload(m map[string]interface{}) []byte {
+	if s, ok := m["payload-hex"].(string); ok {
+		if data, err := hex.DecodeString(s); err == nil {
+			return data
+		}
+	}
+
+	switch v := m["payload"].(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	}
+
+	return nil
+}
+
+func toPort(v interface{}) uint16 {
+	switch v := v.(type) {
+	case int:
+		return uint16(v)
+	case uint16:
+		return v
+	case float64:
+		return uint16(v)
+	case string:
+		n, _ := strconv.ParseUint(v, 10, 16)
+		return uint16(n)
+	default:
+		n, _ := strconv.ParseUint(fmt.Sprint(v), 10, 16)
+		return uint16(n)
+	}
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
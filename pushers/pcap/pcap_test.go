@@ -0,0 +1,260 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pcap
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+type block struct {
+	typ  uint32
+	body []byte
+}
+
+// readBlocks parses the pcapng file, checking the block lengths.
+func readBlocks(t *testing.T, data []byte) []block {
+	blocks := []block{}
+
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("truncated block")
+		}
+
+		typ := binary.LittleEndian.Uint32(data[0:4])
+		length := binary.LittleEndian.Uint32(data[4:8])
+
+		if length%4 != 0 || int(length) > len(data) {
+			t.Fatalf("invalid block length %d", length)
+		}
+
+		if trailer := binary.LittleEndian.Uint32(data[length-4 : length]); trailer != length {
+			t.Fatalf("block length %d doesn't match trailer %d", length, trailer)
+		}
+
+		blocks = append(blocks, block{typ, data[8 : length-4]})
+		data = data[length:]
+	}
+
+	return blocks
+}
+
+func newBackend(t *testing.T) (*Backend, string) {
+	dir, err := ioutil.TempDir("", "pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(func(c pushers.Channel) error {
+		c.(*Backend).Directory = dir
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*Backend), dir
+}
+
+func readFile(t *testing.T, dir string) []block {
+	matches, err := filepath.Glob(filepath.Join(dir, "honeytrap-*.pcapng"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 file, got %v", matches)
+	}
+
+	data, err := ioutil.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := readBlocks(t, data)
+	if len(blocks) < 2 || blocks[0].typ != blockSectionHeader || blocks[1].typ != blockInterfaceDesc {
+		t.Fatalf("expected section header and interface description")
+	}
+
+	if binary.LittleEndian.Uint32(blocks[0].body[0:4]) != byteOrderMagic {
+		t.Fatalf("invalid byte order magic")
+	}
+
+	if binary.LittleEndian.Uint16(blocks[1].body[0:2]) != linkTypeRaw {
+		t.Fatalf("expected raw link type")
+	}
+
+	return blocks[2:]
+}
+
+// packet returns the packet data and comment of an enhanced packet block.
+func packet(t *testing.T, b block) ([]byte, string) {
+	if b.typ != blockEnhancedPacket {
+		t.Fatalf("expected enhanced packet block, got %x", b.typ)
+	}
+
+	length := binary.LittleEndian.Uint32(b.body[12:16])
+	data := b.body[20 : 20+length]
+
+	comment := ""
+	if options := b.body[20+pad(int(length)):]; len(options) > 4 && binary.LittleEndian.Uint16(options[0:2]) == optComment {
+		comment = string(options[4 : 4+binary.LittleEndian.Uint16(options[2:4])])
+	}
+
+	return data, comment
+}
+
+func TestTCPFlow(t *testing.T) {
+	b, dir := newBackend(t)
+	defer os.RemoveAll(dir)
+
+	src := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000}
+	dst := &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 22}
+
+	options := []event.Option{
+		event.Custom("session-id", "abc"),
+		event.Service("ssh"),
+		event.Protocol("tcp"),
+		event.SourceAddr(src),
+		event.DestinationAddr(dst),
+	}
+
+	b.Send(event.New(append(options, event.ConnectionOpened)...))
+	b.Send(event.New(append(options, event.Payload([]byte(strings.Repeat("x", 2000))))...))
+	b.Send(event.New(append(options, event.ConnectionClosed)...))
+	b.Close()
+
+	blocks := readFile(t, dir)
+
+	// handshake, two segments with acks and the teardown
+	expected := []byte{
+		tcpSyn, tcpSyn | tcpAck, tcpAck,
+		tcpPsh | tcpAck, tcpAck, tcpPsh | tcpAck, tcpAck,
+		tcpFin | tcpAck, tcpFin | tcpAck, tcpAck,
+	}
+
+	if len(blocks) != len(expected) {
+		t.Fatalf("expected %d packets, got %d", len(expected), len(blocks))
+	}
+
+	payload := 0
+	for i, bl := range blocks {
+		data, comment := packet(t, bl)
+
+		if fold(checksum(0, data[:20])) != 0 {
+			t.Errorf("packet %d: invalid ip checksum", i)
+		}
+
+		pseudo := make([]byte, 12)
+		copy(pseudo[0:8], data[12:20])
+		pseudo[9] = protocolTCP
+		binary.BigEndian.PutUint16(pseudo[10:12], uint16(len(data)-20))
+
+		if fold(checksum(checksum(0, pseudo), data[20:])) != 0 {
+			t.Errorf("packet %d: invalid tcp checksum", i)
+		}
+
+		if flags := data[20+13]; flags != expected[i] {
+			t.Errorf("packet %d: expected flags %x, got %x", i, expected[i], flags)
+		}
+
+		if !strings.Contains(comment, "session-id=abc") || !strings.Contains(comment, "service=ssh") {
+			t.Errorf("packet %d: unexpected comment %q", i, comment)
+		}
+
+		payload += len(data) - 40
+	}
+
+	if payload != 2000 {
+		t.Errorf("expected 2000 bytes of payload, got %d", payload)
+	}
+
+	// the ack of the server acknowledges all data
+	data, _ := packet(t, blocks[6])
+	first, _ := packet(t, blocks[3])
+
+	if ack, seq := binary.BigEndian.Uint32(data[28:32]), binary.BigEndian.Uint32(first[24:28]); ack-seq != 2000 {
+		t.Errorf("expected ack of 2000 bytes, got %d", ack-seq)
+	}
+}
+
+func TestUDPDatagram(t *testing.T) {
+	b, dir := newBackend(t)
+	defer os.RemoveAll(dir)
+
+	b.Send(event.New(
+		event.Protocol("udp"),
+		event.SourceAddr(&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 5353}),
+		event.DestinationAddr(&net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 53}),
+		event.Payload([]byte("query")),
+	))
+
+	// mixed address families can't be written
+	b.Send(event.New(
+		event.Protocol("udp"),
+		event.SourceAddr(&net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 5353}),
+		event.DestinationAddr(&net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 53}),
+		event.Payload([]byte("query")),
+	))
+
+	b.Close()
+
+	blocks := readFile(t, dir)
+	if len(blocks) != 1 {
+		t.Fatalf("expected 1 packet, got %d", len(blocks))
+	}
+
+	data, _ := packet(t, blocks[0])
+	if data[0]>>4 != 6 || data[6] != protocolUDP {
+		t.Fatalf("expected ipv6 udp packet")
+	}
+
+	if string(data[48:]) != "query" {
+		t.Errorf("unexpected payload %q", data[48:])
+	}
+
+	pseudo := make([]byte, 40)
+	copy(pseudo[0:32], data[8:40])
+	binary.BigEndian.PutUint32(pseudo[32:36], uint32(len(data)-40))
+	pseudo[39] = protocolUDP
+
+	if fold(checksum(checksum(0, pseudo), data[40:])) != 0 {
+		t.Errorf("invalid udp checksum")
+	}
+}
@@ -0,0 +1,146 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// pcapng block types and options, see
+// https://tools.ietf.org/html/draft-tuexen-opsawg-pcapng
+const (
+	blockSectionHeader       = 0x0A0D0D0A
+	blockInterfaceDesc       = 0x00000001
+	blockEnhancedPacket      = 0x00000006
+	byteOrderMagic           = 0x1A2B3C4D
+	optEndOfOpt              = 0
+	optComment               = 1
+	optShbUserAppl           = 4
+	optIfName                = 2
+	optIfTsresol             = 9
+	linkTypeRaw              = 101
+	snapLen                  = 262144
+	microsecondsPerTimestamp = 6
+)
+
+// pcapngWriter writes pcapng blocks, in little endian byte order.
+type pcapngWriter struct {
+	w io.Writer
+}
+
+// option returns the encoded option, padded to 32 bits.
+func option(code uint16, value []byte) []byte {
+	buf := make([]byte, 4+pad(len(value)))
+	binary.LittleEndian.PutUint16(buf[0:2], code)
+	binary.LittleEndian.PutUint16(buf[2:4], uint16(len(value)))
+	copy(buf[4:], value)
+	return buf
+}
+
+func pad(n int) int {
+	return (n + 3) &^ 3
+}
+
+// block writes a block with the body and options.
+func (w *pcapngWriter) block(typ uint32, body []byte, options ...[]byte) (int, error) {
+	if len(options) > 0 {
+		options = append(options, option(optEndOfOpt, nil))
+	}
+
+	length := 12 + len(body)
+	for _, o := range options {
+		length += len(o)
+	}
+
+	buf := make([]byte, 0, length)
+
+	header := make([]byte, 8)
+	binary.LittleEndian.PutUint32(header[0:4], typ)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(length))
+	buf = append(buf, header...)
+	buf = append(buf, body...)
+
+	for _, o := range options {
+		buf = append(buf, o...)
+	}
+
+	buf = append(buf, header[4:8]...)
+
+	return w.w.Write(buf)
+}
+
+// header writes the section header and the description of the single
+// interface, capturing raw ip packets.
+func (w *pcapngWriter) header(application string) (int, error) {
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:4], byteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:6], 1)
+	binary.LittleEndian.PutUint16(shb[6:8], 0)
+	// unknown section length
+	binary.LittleEndian.PutUint64(shb[8:16], 0xFFFFFFFFFFFFFFFF)
+
+	n, err := w.block(blockSectionHeader, shb, option(optShbUserAppl, []byte(application)))
+	if err != nil {
+		return n, err
+	}
+
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:2], linkTypeRaw)
+	binary.LittleEndian.PutUint32(idb[4:8], snapLen)
+
+	m, err := w.block(blockInterfaceDesc, idb,
+		option(optIfName, []byte(application)),
+		option(optIfTsresol, []byte{microsecondsPerTimestamp}),
+	)
+
+	return n + m, err
+}
+
+// packet writes an enhanced packet block with the comment.
+func (w *pcapngWriter) packet(t time.Time, data []byte, comment string) (int, error) {
+	ts := uint64(t.UnixNano() / int64(time.Microsecond))
+
+	body := make([]byte, 20+pad(len(data)))
+	binary.LittleEndian.PutUint32(body[0:4], 0)
+	binary.LittleEndian.PutUint32(body[4:8], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(body[8:12], uint32(ts))
+	binary.LittleEndian.PutUint32(body[12:16], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:20], uint32(len(data)))
+	copy(body[20:], data)
+
+	if comment == "" {
+		return w.block(blockEnhancedPacket, body)
+	}
+
+	return w.block(blockEnhancedPacket, body, option(optComment, []byte(comment)))
+}
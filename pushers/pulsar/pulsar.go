@@ -142,6 +142,7 @@ func (p *producer) run() {
 			ws, _, err := d.Dial(p.URL, headers)
 			if err != nil {
 				log.Errorf("Error connecting to Pulsar: %s: %s", p.URL, err.Error())
+				pushers.Errors.Inc("pulsar")
 				return
 			}
 
@@ -158,9 +159,11 @@ func (p *producer) run() {
 						break
 					} else if err != nil {
 						log.Errorf("Error reading message: %s", err.Error())
+						pushers.Errors.Inc("pulsar")
 						break
 					} else if ack.Result != "ok" {
 						log.Errorf("Error ack result: %s", *ack.ErrorMsg)
+						pushers.Errors.Inc("pulsar")
 					}
 				}
 			}(ws)
@@ -176,6 +179,7 @@ func (p *producer) run() {
 						Key:        &m.Key,
 					}); err != nil {
 						log.Errorf("Error writing message: %s", err.Error())
+						pushers.Errors.Inc("pulsar")
 						continue
 					}
 				}
@@ -185,6 +189,7 @@ func (p *producer) run() {
 		time.Sleep(time.Second * 5)
 
 		log.Errorf("Connection lost. Reconnecting in 5 seconds.")
+		pushers.Errors.Inc("pulsar")
 	}
 }
 
@@ -202,6 +207,7 @@ func (p *producer) Send(e event.Event) {
 	msg, err := json.Marshal(mp)
 	if err != nil {
 		log.Errorf("Failed to serialize event: %s", err.Error())
+		pushers.Errors.Inc("pulsar")
 		return
 	}
 
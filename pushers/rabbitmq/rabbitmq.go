@@ -118,6 +118,7 @@ func (b *AMQPObject) Send(e event.Event) {
 	msg, err := json.Marshal(mp)
 	if err != nil {
 		log.Errorf("Failed to serialize event: %s", err.Error())
+		pushers.Errors.Inc("rabbitmq")
 		return
 	}
 	err = b.amqpChannel.Publish(
@@ -132,6 +133,7 @@ func (b *AMQPObject) Send(e event.Event) {
 	)
 	if err != nil {
 		log.Errorf("Failed to send event: %s", err.Error())
+		pushers.Errors.Inc("rabbitmq")
 		return
 	}
 }
@@ -102,6 +102,7 @@ func (hc Backend) run() {
 			c, _, err := d.Dial(hc.Server, headers)
 			if err != nil {
 				log.Errorf("Error connecting to Raven server: %s: %s", hc.Server, err.Error())
+				pushers.Errors.Inc("raven")
 				return
 			}
 
@@ -119,6 +120,7 @@ func (hc Backend) run() {
 					_, r, err := c.ReadMessage()
 					if err != nil {
 						log.Errorf("Error received: %s", err.Error())
+						pushers.Errors.Inc("raven")
 						return
 					}
 					readChan <- r
@@ -144,11 +146,13 @@ func (hc Backend) run() {
 						if err != nil {
 							// handle errors
 							log.Errorf("Error occurred while marshalling: %s", err.Error())
+							pushers.Errors.Inc("raven")
 							continue
 						}
 						err = c.WriteMessage(websocket.BinaryMessage, data)
 						if err != nil {
 							log.Errorf("Could not write: %s", err.Error())
+							pushers.Errors.Inc("raven")
 							return
 						}
 					}
@@ -0,0 +1,79 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// Recorder is a Channel that keeps every event sent to it, for use in tests.
+type Recorder struct {
+	m      sync.Mutex
+	events []event.Event
+}
+
+// Send records the event.
+func (r *Recorder) Send(e event.Event) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.events = append(r.events, e)
+}
+
+// Events returns a copy of the events recorded so far.
+func (r *Recorder) Events() []event.Event {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return append([]event.Event{}, r.events...)
+}
+
+// Wait waits until at least n events have been recorded and returns them,
+// or returns false when the timeout passes first.
+func (r *Recorder) Wait(n int, timeout time.Duration) ([]event.Event, bool) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		events := r.Events()
+		if len(events) >= n {
+			return events, true
+		}
+
+		if time.Now().After(deadline) {
+			return events, false
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
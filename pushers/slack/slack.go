@@ -104,18 +104,21 @@ func (b Backend) run() {
 		category, ok := ev["category"].(string)
 		if !ok {
 			log.Errorf("Error event has no category value")
+			pushers.Errors.Inc("slack")
 			return
 		}
 
 		sensor, ok := ev["sensor"].(string)
 		if !ok {
 			log.Errorf("Error event has no sensor value")
+			pushers.Errors.Inc("slack")
 			return
 		}
 
 		etype, ok := ev["type"].(string)
 		if !ok {
 			log.Errorf("Error event has no type value")
+			pushers.Errors.Inc("slack")
 			return
 		}
 
@@ -179,12 +182,14 @@ func (b Backend) run() {
 		data := new(bytes.Buffer)
 		if err := json.NewEncoder(data).Encode(newMessage); err != nil {
 			log.Errorf("Error encoding new SlackMessage: %+q", err)
+			pushers.Errors.Inc("slack")
 			return
 		}
 
 		req, err := http.NewRequest("POST", b.WebhookURL, data)
 		if err != nil {
 			log.Errorf("Error while creating new request object: %+q", err)
+			pushers.Errors.Inc("slack")
 			return
 		}
 
@@ -193,6 +198,7 @@ func (b Backend) run() {
 		res, err := client.Do(req)
 		if err != nil {
 			log.Errorf("Error while making request to endpoint(%q): %q", b.WebhookURL, err.Error())
+			pushers.Errors.Inc("slack")
 			return
 		}
 
@@ -206,6 +212,7 @@ func (b Backend) run() {
 		} else if res.StatusCode == http.StatusCreated {
 		} else {
 			log.Errorf("API Response with unexpected Status Code[%d] to endpoint: %q", res.StatusCode, b.WebhookURL)
+			pushers.Errors.Inc("slack")
 			return
 		}
 
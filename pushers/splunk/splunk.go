@@ -32,6 +32,7 @@ package splunk
 
 import (
 	"net/http"
+	"sync/atomic"
 
 	"time"
 
@@ -55,6 +56,9 @@ type Backend struct {
 	Config
 
 	ch chan map[string]interface{}
+
+	// failing is set while the last request failed
+	failing int32
 }
 
 func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
@@ -73,7 +77,7 @@ func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
 	return &c, nil
 }
 
-func (hc Backend) run() {
+func (hc *Backend) run() {
 	log.Debug("Splunk indexer started...")
 	defer log.Debug("Splunk indexer stopped...")
 
@@ -108,7 +112,10 @@ func (hc Backend) run() {
 
 		if err := client.WriteBatch(batch); err != nil {
 			log.Errorf("Error indexing: %s", err.Error())
+			pushers.Errors.Inc("splunk")
+			atomic.StoreInt32(&hc.failing, 1)
 		} else {
+			atomic.StoreInt32(&hc.failing, 0)
 			count += len(batch)
 
 			log.Infof("Bulk indexing: %d total %d", len(batch), count)
@@ -118,8 +125,13 @@ func (hc Backend) run() {
 	}
 }
 
+// Healthy returns false if the last request failed.
+func (hc *Backend) Healthy() bool {
+	return atomic.LoadInt32(&hc.failing) == 0
+}
+
 // Send delivers the giving push messages into the internal elastic search endpoint.
-func (hc Backend) Send(message event.Event) {
+func (hc *Backend) Send(message event.Event) {
 	mp := make(map[string]interface{})
 
 	message.Range(func(key, value interface{}) bool {
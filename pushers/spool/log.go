@@ -0,0 +1,435 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Records are stored in append-only segment files, named after their
+// sequence number. Every record consists of the length (4 bytes) and the
+// crc32 (4 bytes) of the data, followed by the data.
+const (
+	headerSize    = 8
+	segmentExt    = ".seg"
+	positionFile  = "position"
+	maxRecordSize = 1 << 24
+)
+
+var errCorrupt = errors.New("corrupt record")
+
+// segment contains the size and number of records of a segment file.
+type segment struct {
+	seq   uint64
+	size  int64
+	count int64
+}
+
+// segmentLog is a log of records spread over segment files. Records are read
+// in the order they have been appended, segments are removed once read.
+type segmentLog struct {
+	dir         string
+	segmentSize int64
+
+	segments []*segment
+
+	w *os.File
+
+	// the reader position in the first segment
+	r      *os.File
+	br     *bufio.Reader
+	offset int64
+	read   int64
+}
+
+func segmentName(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016d%s", seq, segmentExt))
+}
+
+// openLog opens the log in dir, recovering the segments and reader
+// position of a previous run.
+func openLog(dir string, segmentSize int64) (*segmentLog, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	l := &segmentLog{
+		dir:         dir,
+		segmentSize: segmentSize,
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fi := range files {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != segmentExt {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(fi.Name(), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		l.segments = append(l.segments, &segment{seq: seq})
+	}
+
+	sort.Slice(l.segments, func(i, j int) bool {
+		return l.segments[i].seq < l.segments[j].seq
+	})
+
+	for i, s := range l.segments {
+		// a partial record at the end of the last segment is truncated,
+		// records after a corrupt one are lost
+		s.size, s.count, err = scan(segmentName(dir, s.seq), i == len(l.segments)-1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := l.restorePosition(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// scan counts the valid records of the segment file.
+func scan(name string, truncate bool) (int64, int64, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0600)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+
+	size, count := int64(0), int64(0)
+	for {
+		data, err := readRecord(br)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if truncate {
+				return size, count, f.Truncate(size)
+			}
+
+			break
+		}
+
+		size += int64(headerSize + len(data))
+		count++
+	}
+
+	return size, count, nil
+}
+
+func readRecord(r io.Reader) ([]byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, errCorrupt
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxRecordSize {
+		return nil, errCorrupt
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errCorrupt
+	}
+
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errCorrupt
+	}
+
+	return data, nil
+}
+
+// restorePosition restores the reader position, if it refers to an existing
+// segment.
+func (l *segmentLog) restorePosition() error {
+	data, err := ioutil.ReadFile(filepath.Join(l.dir, positionFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var seq uint64
+	var offset, read int64
+	if _, err := fmt.Sscanf(string(data), "%d %d %d", &seq, &offset, &read); err != nil {
+		return nil
+	}
+
+	// segments before the position have been read completely
+	for len(l.segments) > 0 && l.segments[0].seq < seq {
+		if err := l.removeFirst(); err != nil {
+			return err
+		}
+	}
+
+	if len(l.segments) == 0 || l.segments[0].seq != seq || offset > l.segments[0].size {
+		return nil
+	}
+
+	l.offset, l.read = offset, read
+	return nil
+}
+
+// savePosition persists the reader position.
+func (l *segmentLog) savePosition() error {
+	name := filepath.Join(l.dir, positionFile)
+
+	// sequence numbers start over once all segments have been read
+	if len(l.segments) == 0 {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	data := fmt.Sprintf("%d %d %d\n", l.segments[0].seq, l.offset, l.read)
+	if err := ioutil.WriteFile(name+".tmp", []byte(data), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(name+".tmp", name)
+}
+
+// Size returns the size of all segments.
+func (l *segmentLog) Size() int64 {
+	size := int64(0)
+	for _, s := range l.segments {
+		size += s.size
+	}
+
+	return size
+}
+
+// Len returns the number of records that haven't been read.
+func (l *segmentLog) Len() int64 {
+	count := -l.read
+	for _, s := range l.segments {
+		count += s.count
+	}
+
+	return count
+}
+
+// Append appends a record, starting a new segment if the current one
+// exceeds the segment size.
+func (l *segmentLog) Append(data []byte) error {
+	if len(data) > maxRecordSize {
+		return fmt.Errorf("record of %d bytes exceeds maximum size", len(data))
+	}
+
+	if l.w == nil || l.segments[len(l.segments)-1].size >= l.segmentSize {
+		if err := l.nextSegment(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(data))
+	copy(buf[headerSize:], data)
+
+	last := l.segments[len(l.segments)-1]
+
+	if _, err := l.w.Write(buf); err != nil {
+		// don't leave a partial record behind
+		l.w.Truncate(last.size)
+		return err
+	}
+
+	last.size += int64(len(buf))
+	last.count++
+	return nil
+}
+
+// nextSegment continues writing in the last segment if it has room, or in a
+// new segment.
+func (l *segmentLog) nextSegment() error {
+	if l.w != nil {
+		if err := l.w.Close(); err != nil {
+			return err
+		}
+
+		l.w = nil
+	}
+
+	var last *segment
+	if len(l.segments) > 0 {
+		last = l.segments[len(l.segments)-1]
+	}
+
+	if last == nil || last.size >= l.segmentSize {
+		seq := uint64(1)
+		if last != nil {
+			seq = last.seq + 1
+		}
+
+		last = &segment{seq: seq}
+		l.segments = append(l.segments, last)
+	}
+
+	f, err := os.OpenFile(segmentName(l.dir, last.seq), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	l.w = f
+	return nil
+}
+
+// Next returns the next record, or io.EOF if all records have been read.
+// Completely read segments are removed.
+func (l *segmentLog) Next() ([]byte, error) {
+	for len(l.segments) > 0 {
+		first := l.segments[0]
+
+		if l.read < first.count {
+			if l.r == nil {
+				f, err := os.Open(segmentName(l.dir, first.seq))
+				if err != nil {
+					return nil, err
+				}
+
+				if _, err := f.Seek(l.offset, io.SeekStart); err != nil {
+					f.Close()
+					return nil, err
+				}
+
+				l.r = f
+				l.br = bufio.NewReader(f)
+			}
+
+			data, err := readRecord(l.br)
+			if err != nil {
+				return nil, err
+			}
+
+			l.offset += int64(headerSize + len(data))
+			l.read++
+			return data, nil
+		}
+
+		// the segment that is being written to is kept
+		if len(l.segments) == 1 && l.w != nil {
+			break
+		}
+
+		if err := l.removeFirst(); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, io.EOF
+}
+
+// DropFirst removes the first segment, returning the number of unread
+// records that have been dropped. The segment that is being written to is
+// never dropped.
+func (l *segmentLog) DropFirst() (int64, error) {
+	if len(l.segments) < 2 {
+		return 0, nil
+	}
+
+	dropped := l.segments[0].count - l.read
+	return dropped, l.removeFirst()
+}
+
+func (l *segmentLog) removeFirst() error {
+	if l.r != nil {
+		l.r.Close()
+		l.r, l.br = nil, nil
+	}
+
+	first := l.segments[0]
+	l.segments = l.segments[1:]
+	l.offset, l.read = 0, 0
+
+	if err := os.Remove(segmentName(l.dir, first.seq)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return l.savePosition()
+}
+
+// Sync flushes the current segment to disk.
+func (l *segmentLog) Sync() error {
+	if l.w == nil {
+		return nil
+	}
+
+	return l.w.Sync()
+}
+
+// Close persists the reader position and closes the segments.
+func (l *segmentLog) Close() error {
+	if l.r != nil {
+		l.r.Close()
+		l.r, l.br = nil, nil
+	}
+
+	if l.w != nil {
+		if err := l.w.Sync(); err != nil {
+			return err
+		}
+
+		if err := l.w.Close(); err != nil {
+			return err
+		}
+
+		l.w = nil
+	}
+
+	return l.savePosition()
+}
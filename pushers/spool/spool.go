@@ -0,0 +1,443 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package spool contains a channel wrapper that persists events to disk while
+// the wrapped channel is unhealthy or slow, and replays them in order once
+// it recovers. Events are delivered at least once: events replayed just
+// before a crash can be replayed again.
+package spool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("channels/spool")
+
+// Defaults of the spool options.
+const (
+	DefaultMaxSize     = 1024 * 1024 * 1024
+	DefaultSegmentSize = 16 * 1024 * 1024
+	DefaultQueueSize   = 100
+
+	DefaultProbeInterval = 10 * time.Second
+)
+
+// positionInterval is the number of replayed events after which the reader
+// position is persisted.
+const positionInterval = 100
+
+// Option configures a spool.
+type Option func(*Spool) error
+
+// WithName sets the name used in logging and stats.
+func WithName(name string) Option {
+	return func(s *Spool) error {
+		s.name = name
+		return nil
+	}
+}
+
+// WithMaxSize sets the maximum disk usage in bytes, the oldest events are
+// dropped once exceeded.
+func WithMaxSize(size int64) Option {
+	return func(s *Spool) error {
+		if size <= 0 {
+			return errors.New("spool max size should be positive")
+		}
+
+		s.maxSize = size
+		return nil
+	}
+}
+
+// WithSegmentSize sets the size of the segment files.
+func WithSegmentSize(size int64) Option {
+	return func(s *Spool) error {
+		if size <= 0 {
+			return errors.New("spool segment size should be positive")
+		}
+
+		s.segmentSize = size
+		return nil
+	}
+}
+
+// WithQueueSize sets the number of events queued in memory, before events
+// are spooled to disk.
+func WithQueueSize(size int) Option {
+	return func(s *Spool) error {
+		if size < 0 {
+			return errors.New("spool queue size can't be negative")
+		}
+
+		s.queueSize = size
+		return nil
+	}
+}
+
+// WithProbeInterval sets the interval at which a spooled event is forwarded
+// while the channel is unhealthy, for channels that only notice they
+// recovered when sending. A channel still failing is responsible for
+// retrying the probed event.
+func WithProbeInterval(d time.Duration) Option {
+	return func(s *Spool) error {
+		if d <= 0 {
+			return errors.New("spool probe interval should be positive")
+		}
+
+		s.probeInterval = d
+		return nil
+	}
+}
+
+// Stats contains the counters of a spool.
+type Stats struct {
+	Name string
+
+	// Depth is the number of events on disk waiting to be replayed.
+	Depth int64
+	// Size is the disk usage in bytes.
+	Size int64
+	// Dropped is the number of events dropped because the spool was full.
+	Dropped uint64
+	// Spooling is true while events are being spooled to disk.
+	Spooling bool
+}
+
+// Spool wraps a channel, spooling events to disk while the channel is
+// unhealthy or doesn't keep up.
+type Spool struct {
+	channel pushers.Channel
+
+	name        string
+	maxSize     int64
+	segmentSize int64
+	queueSize   int
+
+	probeInterval time.Duration
+	// probed is the time of the last probe, only used by forward
+	probed time.Time
+
+	queue  chan event.Event
+	notify chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	m        sync.Mutex
+	log      *segmentLog
+	spooling bool
+	closed   bool
+	dropped  uint64
+	replayed int
+}
+
+// New returns a spool in dir wrapping channel. Events spooled in a previous
+// run are replayed first.
+func New(channel pushers.Channel, dir string, options ...Option) (*Spool, error) {
+	s := &Spool{
+		channel:     channel,
+		name:        dir,
+		maxSize:     DefaultMaxSize,
+		segmentSize: DefaultSegmentSize,
+		queueSize:   DefaultQueueSize,
+		notify:      make(chan struct{}, 1),
+		done:        make(chan struct{}),
+
+		probeInterval: DefaultProbeInterval,
+		probed:        time.Now(),
+	}
+
+	for _, fn := range options {
+		if err := fn(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.maxSize < 2*s.segmentSize {
+		return nil, errors.New("spool max size should be at least two segments")
+	}
+
+	l, err := openLog(dir, s.segmentSize)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log = l
+	s.queue = make(chan event.Event, s.queueSize)
+
+	if depth := l.Len(); depth > 0 {
+		log.Infof("Spool %s: replaying %d events of previous run", s.name, depth)
+		s.spooling = true
+	}
+
+	s.wg.Add(1)
+	go s.forward()
+
+	return s, nil
+}
+
+// Send queues the event for the wrapped channel, or spools it to disk if
+// the channel is unhealthy, the queue is full or events are being spooled
+// already.
+func (s *Spool) Send(e event.Event) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	if !s.spooling && pushers.Healthy(s.channel) {
+		select {
+		case s.queue <- e:
+			return
+		default:
+		}
+	}
+
+	if !s.spooling {
+		log.Warningf("Spool %s: channel unhealthy or slow, spooling events to disk", s.name)
+	}
+
+	s.spooling = true
+
+	if err := s.append(e); err != nil {
+		log.Errorf("Spool %s: error spooling event: %s", s.name, err.Error())
+		pushers.Errors.Inc("spool")
+		return
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// append writes the event to disk, dropping the oldest segments if the
+// spool exceeds its maximum size.
+func (s *Spool) append(e event.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := s.log.Append(data); err != nil {
+		return err
+	}
+
+	for s.log.Size() > s.maxSize {
+		dropped, err := s.log.DropFirst()
+		if err != nil {
+			return err
+		} else if dropped == 0 && len(s.log.segments) < 2 {
+			break
+		}
+
+		log.Errorf("Spool %s: full, dropped %d events", s.name, dropped)
+		s.dropped += uint64(dropped)
+	}
+
+	return nil
+}
+
+// forward delivers the queued events to the channel, followed by the
+// spooled events once the channel is healthy.
+func (s *Spool) forward() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e := <-s.queue:
+			s.channel.Send(e)
+			continue
+		case <-s.done:
+			return
+		default:
+		}
+
+		if e, ok := s.next(); ok {
+			s.channel.Send(e)
+			continue
+		}
+
+		select {
+		case e := <-s.queue:
+			s.channel.Send(e)
+		case <-s.notify:
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// next returns the next spooled event, if the channel is healthy or a probe
+// is due. Spooling stops once all spooled events have been replayed.
+func (s *Spool) next() (event.Event, bool) {
+	if pushers.Healthy(s.channel) {
+	} else if time.Since(s.probed) < s.probeInterval {
+		return event.Event{}, false
+	} else {
+		s.probed = time.Now()
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if !s.spooling {
+		return event.Event{}, false
+	}
+
+	for {
+		data, err := s.log.Next()
+		if err == io.EOF {
+			log.Infof("Spool %s: all spooled events replayed", s.name)
+
+			s.spooling = false
+			s.savePosition()
+			return event.Event{}, false
+		} else if err != nil {
+			// skip the rest of the segment
+			log.Errorf("Spool %s: error reading spooled event: %s", s.name, err.Error())
+			pushers.Errors.Inc("spool")
+
+			if _, err := s.log.DropFirst(); err != nil || len(s.log.segments) < 2 {
+				s.spooling = false
+				return event.Event{}, false
+			}
+
+			continue
+		}
+
+		s.replayed++
+		if s.replayed%positionInterval == 0 {
+			s.savePosition()
+		}
+
+		e, err := decode(data)
+		if err != nil {
+			log.Errorf("Spool %s: error decoding spooled event: %s", s.name, err.Error())
+			pushers.Errors.Inc("spool")
+			continue
+		}
+
+		return e, true
+	}
+}
+
+func (s *Spool) savePosition() {
+	if err := s.log.savePosition(); err != nil {
+		log.Errorf("Spool %s: error saving position: %s", s.name, err.Error())
+	}
+}
+
+// decode returns the event of the spooled data.
+func decode(data []byte) (event.Event, error) {
+	m := map[string]interface{}{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(&m); err != nil {
+		return event.Event{}, err
+	}
+
+	if v, ok := m["date"].(string); !ok {
+	} else if date, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		m["date"] = date
+	}
+
+	return event.New(event.CopyFrom(m)), nil
+}
+
+// Stats returns the counters of the spool.
+func (s *Spool) Stats() Stats {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return Stats{
+		Name:     s.name,
+		Depth:    s.log.Len(),
+		Size:     s.log.Size(),
+		Dropped:  s.dropped,
+		Spooling: s.spooling,
+	}
+}
+
+// Close stops forwarding events, spools the queued events to disk and
+// closes the spool. Queued events are spooled after the events already on
+// disk, so these can be replayed out of order.
+func (s *Spool) Close() error {
+	s.m.Lock()
+	if s.closed {
+		s.m.Unlock()
+		return nil
+	}
+
+	s.closed = true
+	s.m.Unlock()
+
+	close(s.done)
+	s.wg.Wait()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for {
+		select {
+		case e := <-s.queue:
+			s.spooling = true
+
+			if err := s.append(e); err != nil {
+				log.Errorf("Spool %s: error spooling event: %s", s.name, err.Error())
+			}
+
+			continue
+		default:
+		}
+
+		break
+	}
+
+	return s.log.Close()
+}
@@ -0,0 +1,283 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package spool
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// testChannel collects the events it receives while healthy.
+type testChannel struct {
+	healthy int32
+
+	m      sync.Mutex
+	events []event.Event
+}
+
+func (c *testChannel) Send(e event.Event) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.events = append(c.events, e)
+}
+
+func (c *testChannel) Healthy() bool {
+	return atomic.LoadInt32(&c.healthy) == 1
+}
+
+func (c *testChannel) setHealthy(healthy bool) {
+	v := int32(0)
+	if healthy {
+		v = 1
+	}
+
+	atomic.StoreInt32(&c.healthy, v)
+}
+
+func (c *testChannel) wait(t *testing.T, n int) []event.Event {
+	for i := 0; i < 500; i++ {
+		c.m.Lock()
+		events := c.events
+		c.m.Unlock()
+
+		if len(events) >= n {
+			return events
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected %d events, got %d", n, len(c.events))
+	return nil
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func testEvent(i int) event.Event {
+	return event.New(
+		event.Category("test"),
+		event.Custom("index", strconv.Itoa(i)),
+	)
+}
+
+func checkOrder(t *testing.T, events []event.Event, n int) {
+	if len(events) != n {
+		t.Fatalf("expected %d events, got %d", n, len(events))
+	}
+
+	for i, e := range events {
+		if e.Get("index") != strconv.Itoa(i) {
+			t.Fatalf("expected event %d, got %s", i, e.Get("index"))
+		}
+	}
+}
+
+func TestSpoolWhileUnhealthy(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	c := &testChannel{}
+
+	s, err := New(c, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	for i := 0; i < 50; i++ {
+		s.Send(testEvent(i))
+	}
+
+	if stats := s.Stats(); stats.Depth != 50 || !stats.Spooling {
+		t.Fatalf("expected 50 spooled events, got %+v", stats)
+	}
+
+	c.setHealthy(true)
+
+	for i := 50; i < 60; i++ {
+		s.Send(testEvent(i))
+	}
+
+	checkOrder(t, c.wait(t, 60), 60)
+
+	if v, _ := c.events[0].Load("date"); v == nil {
+		t.Errorf("expected date of replayed event")
+	} else if _, ok := v.(time.Time); !ok {
+		t.Errorf("expected date of replayed event as time, got %T", v)
+	}
+}
+
+// recoveringChannel becomes healthy by sending, like a channel that
+// connects on its first event.
+type recoveringChannel struct {
+	testChannel
+}
+
+func (c *recoveringChannel) Send(e event.Event) {
+	c.testChannel.Send(e)
+	c.setHealthy(true)
+}
+
+func TestSpoolProbe(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	c := &recoveringChannel{}
+
+	s, err := New(c, dir, WithProbeInterval(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	for i := 0; i < 20; i++ {
+		s.Send(testEvent(i))
+	}
+
+	checkOrder(t, c.wait(t, 20), 20)
+
+	for i := 0; s.Stats().Spooling; i++ {
+		if i == 100 {
+			t.Fatalf("expected spooling to stop after replay, got %+v", s.Stats())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSpoolReplayAfterRestart(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	c := &testChannel{}
+
+	s, err := New(c, dir, WithSegmentSize(512), WithMaxSize(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		s.Send(testEvent(i))
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.setHealthy(true)
+
+	s, err = New(c, dir, WithSegmentSize(512), WithMaxSize(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	checkOrder(t, c.wait(t, 20), 20)
+
+	for i := 0; i < 100; i++ {
+		if s.Stats().Depth == 0 && !s.Stats().Spooling {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats := s.Stats(); stats.Depth != 0 || stats.Spooling {
+		t.Errorf("expected empty spool, got %+v", stats)
+	}
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	c := &testChannel{}
+
+	s, err := New(c, dir, WithSegmentSize(1024), WithMaxSize(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	for i := 0; i < 200; i++ {
+		s.Send(testEvent(i))
+	}
+
+	stats := s.Stats()
+	if stats.Size > 4096 {
+		t.Errorf("expected at most 4096 bytes, got %d", stats.Size)
+	}
+
+	if stats.Dropped == 0 || int64(stats.Dropped)+stats.Depth != 200 {
+		t.Errorf("expected dropped and spooled events to add up to 200, got %+v", stats)
+	}
+}
+
+func TestSpoolSlowChannel(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	c := &testChannel{}
+	c.setHealthy(true)
+
+	s, err := New(c, dir, WithQueueSize(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	// the channel doesn't keep up with an unbuffered queue
+	for i := 0; i < 100; i++ {
+		s.Send(testEvent(i))
+	}
+
+	checkOrder(t, c.wait(t, 100), 100)
+}
@@ -0,0 +1,173 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package sqlchannel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dialect contains the differences between the supported databases.
+type dialect struct {
+	// driver is the name of the database/sql driver.
+	driver string
+	// tag is the build tag including the driver.
+	tag string
+
+	// placeholder returns the placeholder of the nth (from 1) argument.
+	placeholder func(n int) string
+
+	// stripNUL is set if the database can't store NUL characters in text.
+	stripNUL bool
+
+	// migrations are the statements migrating the schema to the next
+	// version, %s is replaced by the table name.
+	migrations [][]string
+}
+
+var dialects = map[string]*dialect{
+	"sqlite3": {
+		driver: "sqlite3",
+		tag:    "sqlite",
+		placeholder: func(n int) string {
+			return "?"
+		},
+		migrations: [][]string{
+			{
+				`CREATE TABLE IF NOT EXISTS %s (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					time TIMESTAMP NOT NULL,
+					sensor TEXT,
+					category TEXT,
+					type TEXT,
+					service TEXT,
+					source_ip TEXT,
+					source_port INTEGER,
+					destination_ip TEXT,
+					destination_port INTEGER,
+					session_id TEXT,
+					data TEXT
+				)`,
+			},
+			{
+				`CREATE INDEX IF NOT EXISTS %[1]s_time ON %[1]s (time)`,
+				`CREATE INDEX IF NOT EXISTS %[1]s_category_type ON %[1]s (category, type)`,
+				`CREATE INDEX IF NOT EXISTS %[1]s_session_id ON %[1]s (session_id)`,
+				`CREATE INDEX IF NOT EXISTS %[1]s_source_ip ON %[1]s (source_ip)`,
+			},
+			{
+				`ALTER TABLE %s ADD COLUMN event_id TEXT`,
+				`CREATE INDEX IF NOT EXISTS %[1]s_event_id ON %[1]s (event_id)`,
+			},
+		},
+	},
+	"postgres": {
+		driver: "postgres",
+		tag:    "postgres",
+		placeholder: func(n int) string {
+			return fmt.Sprintf("$%d", n)
+		},
+		stripNUL: true,
+		migrations: [][]string{
+			{
+				`CREATE TABLE IF NOT EXISTS %s (
+					id BIGSERIAL PRIMARY KEY,
+					time TIMESTAMPTZ NOT NULL,
+					sensor TEXT,
+					category TEXT,
+					type TEXT,
+					service TEXT,
+					source_ip INET,
+					source_port INTEGER,
+					destination_ip INET,
+					destination_port INTEGER,
+					session_id TEXT,
+					data JSONB
+				)`,
+			},
+			{
+				`CREATE INDEX IF NOT EXISTS %[1]s_time ON %[1]s (time)`,
+				`CREATE INDEX IF NOT EXISTS %[1]s_category_type ON %[1]s (category, type)`,
+				`CREATE INDEX IF NOT EXISTS %[1]s_session_id ON %[1]s (session_id)`,
+				`CREATE INDEX IF NOT EXISTS %[1]s_source_ip ON %[1]s (source_ip)`,
+			},
+			{
+				`ALTER TABLE %s ADD COLUMN event_id TEXT`,
+				`CREATE INDEX IF NOT EXISTS %[1]s_event_id ON %[1]s (event_id)`,
+			},
+		},
+	},
+}
+
+func init() {
+	dialects["sqlite"] = dialects["sqlite3"]
+	dialects["postgresql"] = dialects["postgres"]
+}
+
+// columns are the core columns, filled from the event fields, in order of
+// the insert statement. All other fields are stored in the data column.
+var columns = []struct {
+	name  string
+	field string
+}{
+	{"time", "date"},
+	{"event_id", "event-id"},
+	{"sensor", "sensor"},
+	{"category", "category"},
+	{"type", "type"},
+	{"service", "service"},
+	{"source_ip", "source-ip"},
+	{"source_port", "source-port"},
+	{"destination_ip", "destination-ip"},
+	{"destination_port", "destination-port"},
+	{"session_id", "session-id"},
+}
+
+// insert returns the insert statement of an event.
+func (d *dialect) insert(table string) string {
+	names := []string{}
+	placeholders := []string{}
+
+	for i, c := range columns {
+		names = append(names, c.name)
+		placeholders = append(placeholders, d.placeholder(i+1))
+	}
+
+	names = append(names, "data")
+	placeholders = append(placeholders, d.placeholder(len(columns)+1))
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(names, ", "), strings.Join(placeholders, ", "))
+}
+
+// purge returns the statement deleting events older than its argument.
+func (d *dialect) purge(table string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE time < %s", table, d.placeholder(1))
+}
@@ -0,0 +1,497 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package sqlchannel contains a channel storing events in a SQL database.
+//
+// The database drivers are not compiled in by default, build with the tags
+// sqlite and / or postgres to include them.
+package sqlchannel
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:channels:sql")
+
+var (
+	_ = pushers.Register("sql", New)
+)
+
+var validTable = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Config defines the configuration of the sql channel.
+type Config struct {
+	// Driver is one of sqlite3 or postgres.
+	Driver string `toml:"driver"`
+	DSN    string `toml:"dsn"`
+	Table  string `toml:"table"`
+
+	// Events are inserted in a single transaction per batch, when the batch
+	// is full or the interval elapsed.
+	BatchSize     int          `toml:"batch_size"`
+	BatchInterval config.Delay `toml:"batch_interval"`
+
+	// Retention is the age of the oldest event kept, events are kept
+	// forever if not set.
+	Retention     config.Delay `toml:"retention"`
+	PurgeInterval config.Delay `toml:"purge_interval"`
+}
+
+// Backend defines a struct which provides a channel storing events in a SQL
+// database.
+type Backend struct {
+	Config
+
+	dialect *dialect
+	db      *sql.DB
+
+	// batch contains the events not yet inserted
+	batch [][]interface{}
+
+	// failing is set while the last insert failed
+	failing int32
+
+	ch   chan map[string]interface{}
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// New returns a sql channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	c := Backend{
+		Config: Config{
+			Driver:        "sqlite3",
+			Table:         "events",
+			BatchSize:     100,
+			BatchInterval: config.Delay(5 * time.Second),
+			PurgeInterval: config.Delay(time.Hour),
+		},
+		ch:   make(chan map[string]interface{}, 100),
+		done: make(chan struct{}),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	d, ok := dialects[c.Driver]
+	if !ok {
+		return nil, fmt.Errorf("Invalid Config: unsupported driver %s", c.Driver)
+	}
+
+	if !driverAvailable(d.driver) {
+		return nil, fmt.Errorf("Invalid Config: driver %s not compiled in, build with -tags %s", d.driver, d.tag)
+	}
+
+	if c.DSN == "" {
+		return nil, errors.New("Invalid Config: dsn can not be empty")
+	}
+
+	if !validTable.MatchString(c.Table) {
+		return nil, fmt.Errorf("Invalid Config: invalid table name %s", c.Table)
+	}
+
+	if c.BatchSize <= 0 {
+		return nil, errors.New("Invalid Config: batch_size should be positive")
+	}
+
+	if c.BatchInterval.Duration() <= 0 {
+		return nil, errors.New("Invalid Config: batch_interval should be positive")
+	}
+
+	if c.Retention > 0 && c.PurgeInterval.Duration() <= 0 {
+		return nil, errors.New("Invalid Config: purge_interval should be positive")
+	}
+
+	db, err := sql.Open(d.driver, c.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	c.dialect = d
+	c.db = db
+
+	if err := c.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Error migrating schema: %s", err.Error())
+	}
+
+	c.wg.Add(1)
+	go c.run()
+
+	return &c, nil
+}
+
+func driverAvailable(name string) bool {
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// migrate creates the schema_migrations table and applies the migrations of
+// the table not applied yet.
+func (b *Backend) migrate() error {
+	if _, err := b.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (name TEXT PRIMARY KEY, version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	p := b.dialect.placeholder
+
+	version := 0
+	err := b.db.QueryRow(fmt.Sprintf("SELECT version FROM schema_migrations WHERE name = %s", p(1)), b.Table).Scan(&version)
+	if err == sql.ErrNoRows {
+	} else if err != nil {
+		return err
+	}
+
+	for i := version; i < len(b.dialect.migrations); i++ {
+		tx, err := b.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		for _, stmt := range b.dialect.migrations[i] {
+			if _, err := tx.Exec(fmt.Sprintf(stmt, b.Table)); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+
+		if i == 0 {
+			_, err = tx.Exec(fmt.Sprintf("INSERT INTO schema_migrations (name, version) VALUES (%s, %s)", p(1), p(2)), b.Table, i+1)
+		} else {
+			_, err = tx.Exec(fmt.Sprintf("UPDATE schema_migrations SET version = %s WHERE name = %s", p(1), p(2)), i+1, b.Table)
+		}
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		log.Infof("Migrated table %s to version %d", b.Table, i+1)
+	}
+
+	return nil
+}
+
+// Healthy returns false if the last insert failed.
+func (b *Backend) Healthy() bool {
+	return atomic.LoadInt32(&b.failing) == 0
+}
+
+// Send queues the event for insertion.
+func (b *Backend) Send(message event.Event) {
+	select {
+	case b.ch <- event.ToMap(message):
+	case <-b.done:
+	}
+}
+
+// Close inserts the queued events and closes the database.
+func (b *Backend) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+
+	b.wg.Wait()
+	return b.db.Close()
+}
+
+func (b *Backend) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.BatchInterval.Duration())
+	defer ticker.Stop()
+
+	var purge <-chan time.Time
+	if b.Retention > 0 {
+		b.purge()
+
+		purgeTicker := time.NewTicker(b.PurgeInterval.Duration())
+		defer purgeTicker.Stop()
+
+		purge = purgeTicker.C
+	}
+
+	for {
+		select {
+		case m := <-b.ch:
+			b.batch = append(b.batch, row(m, b.dialect.stripNUL))
+
+			if len(b.batch) >= b.BatchSize {
+				b.flush()
+			}
+		case <-ticker.C:
+			b.flush()
+		case <-purge:
+			b.purge()
+		case <-b.done:
+			b.drain()
+			b.flush()
+			return
+		}
+	}
+}
+
+// drain adds the queued events to the batch.
+func (b *Backend) drain() {
+	for {
+		select {
+		case m := <-b.ch:
+			b.batch = append(b.batch, row(m, b.dialect.stripNUL))
+		default:
+			return
+		}
+	}
+}
+
+// flush inserts the batch in a single transaction. If the database can't be
+// reached the batch is kept to be retried, dropping the oldest events if it
+// grows too large. Otherwise the events are inserted one by one, dropping
+// the events the database refuses.
+func (b *Backend) flush() {
+	if len(b.batch) == 0 {
+		return
+	}
+
+	err := b.insert(b.batch)
+	if err == nil {
+		atomic.StoreInt32(&b.failing, 0)
+
+		b.batch = b.batch[:0]
+		return
+	}
+
+	log.Errorf("Error inserting %d events: %s", len(b.batch), err.Error())
+	pushers.Errors.Inc("sql")
+
+	if err := b.db.Ping(); err == nil {
+		b.batch = b.insertEach(b.batch)
+	}
+
+	if len(b.batch) == 0 {
+		atomic.StoreInt32(&b.failing, 0)
+		return
+	}
+
+	atomic.StoreInt32(&b.failing, 1)
+
+	if max := b.BatchSize * 10; len(b.batch) > max {
+		log.Errorf("Dropping %d events", len(b.batch)-max)
+		b.batch = b.batch[len(b.batch)-max:]
+	}
+}
+
+func (b *Backend) insert(rows [][]interface{}) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(b.dialect.insert(b.Table))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	defer stmt.Close()
+
+	for _, args := range rows {
+		if _, err := stmt.Exec(args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insertEach inserts the rows one by one, a row the database refuses is
+// dropped. It returns the rows not inserted because the database became
+// unreachable.
+func (b *Backend) insertEach(rows [][]interface{}) [][]interface{} {
+	query := b.dialect.insert(b.Table)
+
+	for i, args := range rows {
+		_, err := b.db.Exec(query, args...)
+		if err == nil {
+			continue
+		}
+
+		if err := b.db.Ping(); err != nil {
+			return rows[i:]
+		}
+
+		log.Errorf("Dropping event %v: %s", args[1], err.Error())
+		pushers.Errors.Inc("sql")
+	}
+
+	return rows[:0]
+}
+
+// purge deletes the events older than the retention.
+func (b *Backend) purge() {
+	before := time.Now().Add(-b.Retention.Duration()).UTC()
+
+	result, err := b.db.Exec(b.dialect.purge(b.Table), before)
+	if err != nil {
+		log.Errorf("Error purging events: %s", err.Error())
+		pushers.Errors.Inc("sql")
+		return
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		log.Infof("Purged %d events older than %s", n, before.Format(time.RFC3339))
+	}
+}
+
+// row returns the values of the columns of the event, the fields not stored
+// in a core column are stored as json in the data column. NUL characters
+// are removed if stripNUL is set.
+func row(m map[string]interface{}, stripNUL bool) []interface{} {
+	args := make([]interface{}, 0, len(columns)+1)
+
+	for _, c := range columns {
+		v, ok := m[c.field]
+		delete(m, c.field)
+
+		switch {
+		case c.name == "time":
+			t, ok := v.(time.Time)
+			if !ok {
+				t = time.Now()
+			}
+
+			args = append(args, t.UTC())
+		case !ok:
+			args = append(args, nil)
+		case c.name == "source_port" || c.name == "destination_port":
+			args = append(args, toInt(v))
+		default:
+			s := fmt.Sprintf("%v", v)
+			if stripNUL {
+				s = strings.Replace(s, "\x00", "", -1)
+			}
+
+			if s == "" {
+				args = append(args, nil)
+				continue
+			}
+
+			args = append(args, s)
+		}
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		log.Errorf("Error marshaling event: %s", err.Error())
+		pushers.Errors.Inc("sql")
+
+		data = []byte("{}")
+	}
+
+	if stripNUL {
+		data = stripJSONNUL(data)
+	}
+
+	return append(args, string(data))
+}
+
+// stripJSONNUL removes the escaped NUL characters from the json strings.
+func stripJSONNUL(data []byte) []byte {
+	if !bytes.Contains(data, []byte(`\u0000`)) {
+		return data
+	}
+
+	stripped := make([]byte, 0, len(data))
+
+	for i := 0; i < len(data); i++ {
+		if data[i] != '\\' || i+1 == len(data) {
+			stripped = append(stripped, data[i])
+			continue
+		}
+
+		if bytes.HasPrefix(data[i+1:], []byte("u0000")) {
+			i += 5
+			continue
+		}
+
+		// keep the escaped character, it may be a backslash
+		stripped = append(stripped, data[i], data[i+1])
+		i++
+	}
+
+	return stripped
+}
+
+func toInt(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case int64:
+		return v
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,490 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package sqlchannel
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+// testDB is the state of a database of the test driver, it records the
+// statements of committed transactions.
+type testDB struct {
+	m sync.Mutex
+
+	version    int
+	statements []testStatement
+	commits    int
+	fail       bool
+
+	// reject is refused in the arguments of an insert
+	reject string
+}
+
+type testStatement struct {
+	query string
+	args  []driver.Value
+}
+
+func (db *testDB) inserts() []testStatement {
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	inserts := []testStatement{}
+	for _, s := range db.statements {
+		if strings.HasPrefix(s.query, "INSERT INTO events") {
+			inserts = append(inserts, s)
+		}
+	}
+
+	return inserts
+}
+
+func (db *testDB) setFail(fail bool) {
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	db.fail = fail
+}
+
+var testDBs = struct {
+	sync.Mutex
+	m map[string]*testDB
+}{m: map[string]*testDB{}}
+
+type testDriver struct{}
+
+func (testDriver) Open(dsn string) (driver.Conn, error) {
+	testDBs.Lock()
+	defer testDBs.Unlock()
+
+	db, ok := testDBs.m[dsn]
+	if !ok {
+		db = &testDB{}
+		testDBs.m[dsn] = db
+	}
+
+	return &testConn{db: db}, nil
+}
+
+type testConn struct {
+	db *testDB
+	tx []testStatement
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	return &testStmt{c: c, query: query}, nil
+}
+
+func (c *testConn) Close() error { return nil }
+
+func (c *testConn) Ping(ctx context.Context) error {
+	c.db.m.Lock()
+	defer c.db.m.Unlock()
+
+	if c.db.fail {
+		return driver.ErrBadConn
+	}
+
+	return nil
+}
+
+func (c *testConn) Begin() (driver.Tx, error) {
+	c.tx = []testStatement{}
+	return c, nil
+}
+
+func (c *testConn) Commit() error {
+	c.db.m.Lock()
+	defer c.db.m.Unlock()
+
+	c.db.statements = append(c.db.statements, c.tx...)
+	c.db.commits++
+	c.tx = nil
+	return nil
+}
+
+func (c *testConn) Rollback() error {
+	c.tx = nil
+	return nil
+}
+
+type testStmt struct {
+	c     *testConn
+	query string
+}
+
+func (s *testStmt) Close() error  { return nil }
+func (s *testStmt) NumInput() int { return -1 }
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.c.db
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if db.fail && strings.HasPrefix(s.query, "INSERT INTO events") {
+		return nil, errors.New("database unavailable")
+	}
+
+	if db.reject != "" && strings.HasPrefix(s.query, "INSERT INTO events") {
+		for _, arg := range args {
+			if v, ok := arg.(string); ok && strings.Contains(v, db.reject) {
+				return nil, errors.New("invalid input")
+			}
+		}
+	}
+
+	if strings.HasPrefix(s.query, "INSERT INTO schema_migrations") {
+		db.version = int(args[1].(int64))
+	} else if strings.HasPrefix(s.query, "UPDATE schema_migrations") {
+		db.version = int(args[0].(int64))
+	}
+
+	statement := testStatement{s.query, args}
+	if s.c.tx != nil {
+		s.c.tx = append(s.c.tx, statement)
+	} else {
+		db.statements = append(db.statements, statement)
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	db := s.c.db
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if !strings.HasPrefix(s.query, "SELECT version FROM schema_migrations") {
+		return nil, errors.New("unsupported query")
+	}
+
+	return &testRows{version: db.version}, nil
+}
+
+type testRows struct {
+	version int
+	read    bool
+}
+
+func (r *testRows) Columns() []string { return []string{"version"} }
+func (r *testRows) Close() error      { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if r.read || r.version == 0 {
+		return io.EOF
+	}
+
+	r.read = true
+	dest[0] = int64(r.version)
+	return nil
+}
+
+func init() {
+	sql.Register("testsql", testDriver{})
+
+	dialects["testsql"] = &dialect{
+		driver:      "testsql",
+		placeholder: dialects["sqlite3"].placeholder,
+		migrations:  dialects["sqlite3"].migrations,
+	}
+}
+
+func newBackend(t *testing.T, dsn string, options ...func(*Backend)) *Backend {
+	c, err := New(func(c pushers.Channel) error {
+		b := c.(*Backend)
+		b.Driver = "testsql"
+		b.DSN = dsn
+		b.BatchSize = 2
+
+		for _, fn := range options {
+			fn(b)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*Backend)
+}
+
+func testDatabase(dsn string) *testDB {
+	testDBs.Lock()
+	defer testDBs.Unlock()
+
+	return testDBs.m[dsn]
+}
+
+func TestMigrate(t *testing.T) {
+	b := newBackend(t, "migrate")
+	b.Close()
+
+	db := testDatabase("migrate")
+	if db.version != len(dialects["sqlite3"].migrations) {
+		t.Fatalf("expected version %d, got %d", len(dialects["sqlite3"].migrations), db.version)
+	}
+
+	n := len(db.statements)
+
+	// already migrated, only the schema_migrations table is created
+	b = newBackend(t, "migrate")
+	b.Close()
+
+	if len(db.statements) != n+1 {
+		t.Errorf("expected no migrations, got %d statements", len(db.statements)-n)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	b := newBackend(t, "insert")
+
+	date := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	b.Send(event.New(
+		event.Custom("date", date),
+		event.Sensor("ssh"),
+		event.Category("ssh"),
+		event.Type("password-authentication"),
+		event.Custom("source-ip", "10.0.0.1"),
+		event.Custom("source-port", 1234),
+		event.Custom("destination-port", "22"),
+		event.Custom("ssh.username", "root"),
+	))
+	b.Send(event.New(event.Category("http")))
+
+	b.Close()
+
+	db := testDatabase("insert")
+
+	inserts := db.inserts()
+	if len(inserts) != 2 {
+		t.Fatalf("expected 2 inserts, got %d", len(inserts))
+	}
+
+	args := inserts[0].args
+	if len(args) != len(columns)+1 {
+		t.Fatalf("expected %d arguments, got %d", len(columns)+1, len(args))
+	}
+
+	if tm, ok := args[0].(time.Time); !ok || !tm.Equal(date) {
+		t.Errorf("unexpected time %v", args[0])
+	}
+
+	if id, ok := args[1].(string); !ok || id == "" {
+		t.Errorf("unexpected event id %v", args[1])
+	}
+
+	expected := []interface{}{"ssh", "ssh", "password-authentication", nil, "10.0.0.1", int64(1234), nil, int64(22), nil}
+	for i, v := range expected {
+		if args[i+2] != v {
+			t.Errorf("expected %s %v, got %v", columns[i+2].name, v, args[i+2])
+		}
+	}
+
+	data := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(args[len(args)-1].(string)), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) != 1 || data["ssh.username"] != "root" {
+		t.Errorf("unexpected data %v", data)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	b := newBackend(t, "batch", func(b *Backend) {
+		b.BatchSize = 3
+	})
+
+	db := testDatabase("batch")
+
+	db.m.Lock()
+	commits := db.commits
+	db.m.Unlock()
+
+	for i := 0; i < 3; i++ {
+		b.Send(event.New(event.Category("test")))
+	}
+
+	for i := 0; i < 200 && len(db.inserts()) < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	db.m.Lock()
+	if db.commits != commits+1 {
+		t.Errorf("expected a single transaction, got %d", db.commits-commits)
+	}
+	db.m.Unlock()
+
+	b.Close()
+}
+
+func TestRetry(t *testing.T) {
+	b := newBackend(t, "retry")
+
+	db := testDatabase("retry")
+	db.setFail(true)
+
+	b.Send(event.New(event.Category("test")))
+	b.Send(event.New(event.Category("test")))
+
+	for i := 0; i < 200 && b.Healthy(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if b.Healthy() {
+		t.Fatal("expected channel to be unhealthy")
+	}
+
+	db.setFail(false)
+	b.Close()
+
+	if n := len(db.inserts()); n != 2 {
+		t.Errorf("expected 2 inserts, got %d", n)
+	}
+}
+
+func TestDropRefused(t *testing.T) {
+	b := newBackend(t, "refused", func(b *Backend) {
+		b.BatchSize = 3
+	})
+
+	db := testDatabase("refused")
+
+	db.m.Lock()
+	db.reject = "refused"
+	db.m.Unlock()
+
+	b.Send(event.New(event.Category("test")))
+	b.Send(event.New(event.Category("refused")))
+	b.Send(event.New(event.Category("test")))
+
+	b.Close()
+
+	if n := len(db.inserts()); n != 2 {
+		t.Errorf("expected 2 inserts, got %d", n)
+	}
+
+	if !b.Healthy() {
+		t.Error("expected channel to be healthy")
+	}
+}
+
+func TestStripNUL(t *testing.T) {
+	args := row(map[string]interface{}{
+		"category": "te\x00st",
+		"payload":  "a\x00b\\u0000c",
+	}, true)
+
+	if args[3] != "test" {
+		t.Errorf("expected category test, got %q", args[3])
+	}
+
+	data := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(args[len(args)-1].(string)), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if data["payload"] != "ab\\u0000c" {
+		t.Errorf("unexpected payload %q", data["payload"])
+	}
+}
+
+func TestPurge(t *testing.T) {
+	b := newBackend(t, "purge", func(b *Backend) {
+		b.Retention.UnmarshalText([]byte("24h"))
+	})
+	b.Close()
+
+	db := testDatabase("purge")
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	for _, s := range db.statements {
+		if !strings.HasPrefix(s.query, "DELETE FROM events WHERE time < ?") {
+			continue
+		}
+
+		before := s.args[0].(time.Time)
+		if d := time.Since(before); d < 23*time.Hour || d > 25*time.Hour {
+			t.Errorf("unexpected purge before %s", before)
+		}
+
+		return
+	}
+
+	t.Error("expected events to be purged")
+}
+
+func TestInvalidConfig(t *testing.T) {
+	options := []func(*Backend){
+		func(b *Backend) { b.Driver = "oracle" },
+		func(b *Backend) { b.Driver = "postgres" },
+		func(b *Backend) { b.DSN = "" },
+		func(b *Backend) { b.Table = "events; DROP TABLE events" },
+		func(b *Backend) { b.BatchInterval = 0 },
+		func(b *Backend) {
+			b.Retention = config.Delay(time.Hour)
+			b.PurgeInterval = 0
+		},
+	}
+
+	for i, fn := range options {
+		_, err := New(func(c pushers.Channel) error {
+			b := c.(*Backend)
+			b.Driver = "testsql"
+			b.DSN = "invalid"
+			fn(b)
+			return nil
+		})
+
+		if err == nil {
+			t.Errorf("%d: expected error", i)
+		}
+	}
+}
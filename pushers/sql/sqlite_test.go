@@ -0,0 +1,155 @@
+// +build sqlite
+
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package sqlchannel
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func newSQLiteBackend(t *testing.T, dsn string) *Backend {
+	c, err := New(func(c pushers.Channel) error {
+		b := c.(*Backend)
+		b.Driver = "sqlite3"
+		b.DSN = dsn
+		b.Retention.UnmarshalText([]byte("24h"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*Backend)
+}
+
+func TestSQLite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	dsn := filepath.Join(dir, "events.db")
+
+	b := newSQLiteBackend(t, dsn)
+
+	b.Send(event.New(
+		event.Custom("date", time.Now().Add(-48*time.Hour)),
+		event.Category("old"),
+	))
+	b.Close()
+
+	// reopening doesn't migrate again and purges the old event
+	b = newSQLiteBackend(t, dsn)
+
+	b.Send(event.New(
+		event.Category("ssh"),
+		event.Type("password-authentication"),
+		event.Custom("source-ip", "10.0.0.1"),
+		event.Custom("source-port", 1234),
+		event.Custom("ssh.password", "se\x00cret"),
+	))
+	b.Close()
+
+	c, err := New(func(c pushers.Channel) error {
+		b := c.(*Backend)
+		b.Driver = "sqlite3"
+		b.DSN = dsn
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b = c.(*Backend)
+	defer b.Close()
+
+	var version int
+	if err := b.db.QueryRow("SELECT version FROM schema_migrations WHERE name = ?", "events").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+
+	if version != len(b.dialect.migrations) {
+		t.Errorf("expected version %d, got %d", len(b.dialect.migrations), version)
+	}
+
+	rows, err := b.db.Query("SELECT category, type, source_ip, source_port, data FROM events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var (
+			category, typ, sourceIP, data string
+			sourcePort                    int
+		)
+
+		if err := rows.Scan(&category, &typ, &sourceIP, &sourcePort, &data); err != nil {
+			t.Fatal(err)
+		}
+
+		if category != "ssh" || typ != "password-authentication" || sourceIP != "10.0.0.1" || sourcePort != 1234 {
+			t.Errorf("unexpected row %s %s %s %d", category, typ, sourceIP, sourcePort)
+		}
+
+		m := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			t.Fatal(err)
+		}
+
+		if m["ssh.password"] != "se\x00cret" {
+			t.Errorf("unexpected data %s", data)
+		}
+
+		n++
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("expected 1 event, got %d", n)
+	}
+}
@@ -0,0 +1,404 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package stix
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// namespace is the STIX 2.1 namespace of deterministic cyber observable ids.
+var namespace = uuid.FromStringOrNil("00abedb4-aa42-466c-9c01-fed23315a9b7")
+
+const specVersion = "2.1"
+
+// timestamp formats t as STIX timestamp.
+func timestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// observableID returns the deterministic id of a cyber observable, derived
+// from its id contributing properties.
+func observableID(typ string, properties map[string]interface{}) string {
+	// json.Marshal sorts the keys of maps, which makes it canonical for the
+	// simple values used here.
+	data, _ := json.Marshal(properties)
+	return fmt.Sprintf("%s--%s", typ, uuid.NewV5(namespace, string(data)))
+}
+
+// sighting counts the observations of objects.
+type sighting struct {
+	first time.Time
+	last  time.Time
+	count int
+}
+
+func (s *sighting) observe(t time.Time) {
+	if s.count == 0 || t.Before(s.first) {
+		s.first = t
+	}
+
+	if s.count == 0 || t.After(s.last) {
+		s.last = t
+	}
+
+	s.count++
+}
+
+type observation struct {
+	sighting
+
+	refs []string
+}
+
+// builder collects the observables of events, deduplicating sightings of the
+// same observables.
+type builder struct {
+	Config
+
+	identity map[string]interface{}
+
+	objects   map[string]map[string]interface{}
+	sightings map[string]*sighting
+	order     []string
+
+	observations     map[string]*observation
+	observationOrder []string
+
+	// credentials are the sightings of the credentials tried per account
+	credentials     map[string]map[string]*sighting
+	credentialOrder map[string][]string
+}
+
+func newBuilder(c Config) *builder {
+	now := timestamp(time.Now())
+
+	return &builder{
+		Config: c,
+		identity: map[string]interface{}{
+			"type":           "identity",
+			"spec_version":   specVersion,
+			"id":             fmt.Sprintf("identity--%s", uuid.NewV5(namespace, c.Identity)),
+			"created":        now,
+			"modified":       now,
+			"name":           c.Identity,
+			"identity_class": "system",
+		},
+		objects:         map[string]map[string]interface{}{},
+		sightings:       map[string]*sighting{},
+		observations:    map[string]*observation{},
+		credentials:     map[string]map[string]*sighting{},
+		credentialOrder: map[string][]string{},
+	}
+}
+
+// Len returns the number of distinct observations.
+func (b *builder) Len() int {
+	return len(b.observations)
+}
+
+// object adds the object if it doesn't exist yet and returns its id.
+func (b *builder) object(o map[string]interface{}, t time.Time) string {
+	id := o["id"].(string)
+
+	if _, ok := b.objects[id]; !ok {
+		b.objects[id] = o
+		b.sightings[id] = &sighting{}
+		b.order = append(b.order, id)
+	}
+
+	b.sightings[id].observe(t)
+	return id
+}
+
+func (b *builder) ip(s string, t time.Time) (string, bool) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return "", false
+	}
+
+	typ := "ipv4-addr"
+	if ip.To4() == nil {
+		typ = "ipv6-addr"
+	}
+
+	properties := map[string]interface{}{"value": ip.String()}
+
+	return b.object(map[string]interface{}{
+		"type":         typ,
+		"spec_version": specVersion,
+		"id":           observableID(typ, properties),
+		"value":        ip.String(),
+	}, t), true
+}
+
+func (b *builder) url(s string, t time.Time) string {
+	properties := map[string]interface{}{"value": s}
+
+	return b.object(map[string]interface{}{
+		"type":         "url",
+		"spec_version": specVersion,
+		"id":           observableID("url", properties),
+		"value":        s,
+	}, t)
+}
+
+func (b *builder) file(data []byte, t time.Time) string {
+	sha := sha256.Sum256(data)
+	md := md5.Sum(data)
+
+	hashes := map[string]interface{}{
+		"SHA-256": hex.EncodeToString(sha[:]),
+		"MD5":     hex.EncodeToString(md[:]),
+	}
+
+	id := b.object(map[string]interface{}{
+		"type":         "file",
+		"spec_version": specVersion,
+		"id":           observableID("file", map[string]interface{}{"hashes": map[string]interface{}{"SHA-256": hashes["SHA-256"]}}),
+		"hashes":       hashes,
+		"size":         len(data),
+	}, t)
+
+	// stub, to be completed by analysis
+	now := timestamp(time.Now())
+
+	b.object(map[string]interface{}{
+		"type":           "malware-analysis",
+		"spec_version":   specVersion,
+		"id":             fmt.Sprintf("malware-analysis--%s", uuid.NewV5(namespace, id)),
+		"created_by_ref": b.identity["id"],
+		"created":        now,
+		"modified":       now,
+		"product":        "honeytrap",
+		"result":         "unknown",
+		"sample_ref":     id,
+	}, t)
+
+	return id
+}
+
+func (b *builder) account(username, password string, t time.Time) string {
+	properties := map[string]interface{}{
+		"account_login": username,
+	}
+
+	id := b.object(map[string]interface{}{
+		"type":          "user-account",
+		"spec_version":  specVersion,
+		"id":            observableID("user-account", properties),
+		"account_login": username,
+	}, t)
+
+	// the credentials tried on the account don't contribute to its id, they
+	// are listed in a custom property instead
+	if _, ok := b.credentials[id]; !ok {
+		b.credentials[id] = map[string]*sighting{}
+	}
+
+	s, ok := b.credentials[id][password]
+	if !ok {
+		s = &sighting{}
+		b.credentials[id][password] = s
+		b.credentialOrder[id] = append(b.credentialOrder[id], password)
+		b.objects[id]["x_honeytrap_credentials"] = b.credentialOrder[id]
+	}
+
+	s.observe(t)
+	return id
+}
+
+// add adds the observables of the event.
+func (b *builder) add(m map[string]interface{}) {
+	t := time.Now()
+	if v, ok := m["date"].(time.Time); ok {
+		t = v
+	}
+
+	refs := []string{}
+
+	if s, ok := m["source-ip"].(string); !ok {
+	} else if id, ok := b.ip(s, t); ok {
+		refs = append(refs, id)
+	}
+
+	if path, ok := m["http.url"].(string); !ok {
+	} else if host, ok := m["http.host"].(string); ok && strings.HasPrefix(path, "/") {
+		refs = append(refs, b.url("http://"+host+path, t))
+	} else {
+		refs = append(refs, b.url(path, t))
+	}
+
+	for _, field := range b.URLFields {
+		switch v := m[field].(type) {
+		case string:
+			if v != "" {
+				refs = append(refs, b.url(v, t))
+			}
+		case []string:
+			for _, s := range v {
+				refs = append(refs, b.url(s, t))
+			}
+		}
+	}
+
+	for _, field := range b.FileFields {
+		switch v := m[field].(type) {
+		case []byte:
+			refs = append(refs, b.file(v, t))
+		case string:
+			refs = append(refs, b.file([]byte(v), t))
+		}
+	}
+
+	for usernameField, passwordField := range b.Credentials {
+		username, ok := m[usernameField].(string)
+		if !ok {
+			continue
+		}
+
+		password, _ := m[passwordField].(string)
+		refs = append(refs, b.account(username, password, t))
+	}
+
+	if len(refs) == 0 {
+		return
+	}
+
+	sort.Strings(refs)
+
+	key := strings.Join(refs, ",")
+
+	o, ok := b.observations[key]
+	if !ok {
+		o = &observation{refs: refs}
+		b.observations[key] = o
+		b.observationOrder = append(b.observationOrder, key)
+	}
+
+	o.observe(t)
+}
+
+// bundle returns the STIX 2.1 bundle of all observations.
+func (b *builder) bundle() map[string]interface{} {
+	objects := []interface{}{b.identity}
+
+	for _, id := range b.order {
+		objects = append(objects, b.objects[id])
+	}
+
+	now := timestamp(time.Now())
+
+	for _, key := range b.observationOrder {
+		o := b.observations[key]
+
+		objects = append(objects, map[string]interface{}{
+			"type":            "observed-data",
+			"spec_version":    specVersion,
+			"id":              fmt.Sprintf("observed-data--%s", uuid.NewV4()),
+			"created_by_ref":  b.identity["id"],
+			"created":         now,
+			"modified":        now,
+			"first_observed":  timestamp(o.first),
+			"last_observed":   timestamp(o.last),
+			"number_observed": o.count,
+			"object_refs":     o.refs,
+		})
+	}
+
+	return map[string]interface{}{
+		"type":    "bundle",
+		"id":      fmt.Sprintf("bundle--%s", uuid.NewV4()),
+		"objects": objects,
+	}
+}
+
+// mispEvent returns the MISP event of all observations.
+func (b *builder) mispEvent() map[string]interface{} {
+	attributes := []interface{}{}
+
+	attribute := func(typ, category, value, comment string, s *sighting) {
+		attributes = append(attributes, map[string]interface{}{
+			"type":       typ,
+			"category":   category,
+			"value":      value,
+			"to_ids":     false,
+			"comment":    fmt.Sprintf("%s, observed %d times", comment, s.count),
+			"first_seen": s.first.UTC().Format(time.RFC3339),
+			"last_seen":  s.last.UTC().Format(time.RFC3339),
+		})
+	}
+
+	for _, id := range b.order {
+		o, s := b.objects[id], b.sightings[id]
+
+		switch o["type"] {
+		case "ipv4-addr", "ipv6-addr":
+			attribute("ip-src", "Network activity", o["value"].(string), "attacker", s)
+		case "url":
+			attribute("url", "Network activity", o["value"].(string), "requested url", s)
+		case "file":
+			hashes := o["hashes"].(map[string]interface{})
+			attribute("sha256", "Payload delivery", hashes["SHA-256"].(string), "uploaded file", s)
+			attribute("md5", "Payload delivery", hashes["MD5"].(string), "uploaded file", s)
+		case "user-account":
+			for _, credential := range b.credentialOrder[id] {
+				attribute("text", "Other", fmt.Sprintf("%s:%s", o["account_login"], credential), "tried credentials", b.credentials[id][credential])
+			}
+		}
+	}
+
+	tags := []interface{}{}
+	for _, tag := range b.MISP.Tags {
+		tags = append(tags, map[string]interface{}{"name": tag})
+	}
+
+	return map[string]interface{}{
+		"Event": map[string]interface{}{
+			"info":            b.MISP.Info,
+			"date":            time.Now().UTC().Format("2006-01-02"),
+			"distribution":    b.MISP.Distribution,
+			"threat_level_id": b.MISP.ThreatLevel,
+			"analysis":        b.MISP.Analysis,
+			"Attribute":       attributes,
+			"Tag":             tags,
+		},
+	}
+}
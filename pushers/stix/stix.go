@@ -0,0 +1,322 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package stix contains a channel exporting the observables of events as
+// STIX 2.1 bundles, or as MISP events.
+package stix
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:channels:stix")
+
+var (
+	_ = pushers.Register("stix", New)
+)
+
+// Outputs of the channel.
+const (
+	OutputFile = "file"
+	OutputMISP = "misp"
+)
+
+// MISPConfig defines the MISP instance events are posted to.
+type MISPConfig struct {
+	URL          string   `toml:"url"`
+	Key          string   `toml:"key"`
+	Info         string   `toml:"info"`
+	Distribution int      `toml:"distribution"`
+	ThreatLevel  int      `toml:"threat_level"`
+	Analysis     int      `toml:"analysis"`
+	Tags         []string `toml:"tags"`
+
+	TLS pushers.TLSConfig `toml:"tls"`
+}
+
+// Config defines the configuration of the stix channel.
+type Config struct {
+	// Output is either file, writing bundles to Directory, or misp.
+	Output    string `toml:"output"`
+	Directory string `toml:"directory"`
+
+	// Interval between exports, an export is made earlier if
+	// MaxObservations distinct observations have been collected.
+	Interval        config.Delay `toml:"interval"`
+	MaxObservations int          `toml:"max_observations"`
+
+	// Identity is the name of the identity creating the objects.
+	Identity string `toml:"identity"`
+
+	// URLFields and FileFields are the event fields containing urls and
+	// file contents, http.host and http.url are combined into an url.
+	URLFields  []string `toml:"url_fields"`
+	FileFields []string `toml:"file_fields"`
+
+	// Credentials maps username fields to password fields.
+	Credentials map[string]string `toml:"credentials"`
+
+	MISP MISPConfig `toml:"misp"`
+}
+
+// Backend defines a struct which provides a channel exporting the observables
+// of events.
+type Backend struct {
+	Config
+
+	client *http.Client
+
+	ch chan map[string]interface{}
+
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// New returns a stix channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	c := Backend{
+		Config: Config{
+			Output:          OutputFile,
+			Directory:       "stix",
+			Interval:        config.Delay(time.Hour),
+			MaxObservations: 10000,
+			Identity:        "honeytrap",
+			URLFields:       []string{"url", "ioc.urls"},
+			FileFields:      []string{"tftp.file"},
+			Credentials: map[string]string{
+				"ssh.username": "ssh.password",
+			},
+			MISP: MISPConfig{
+				Info:         "honeytrap observations",
+				Distribution: 0,
+				ThreatLevel:  4,
+				Analysis:     0,
+			},
+		},
+		ch:   make(chan map[string]interface{}, 100),
+		done: make(chan struct{}),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Interval.Duration() <= 0 {
+		return nil, errors.New("Invalid Config: interval should be positive")
+	}
+
+	switch c.Output {
+	case OutputFile:
+		if !filepath.IsAbs(c.Directory) {
+			if pwd, err := os.Getwd(); err == nil {
+				c.Directory = filepath.Join(pwd, c.Directory)
+			}
+		}
+
+		if err := os.MkdirAll(c.Directory, 0750); err != nil {
+			return nil, err
+		}
+	case OutputMISP:
+		if c.MISP.URL == "" {
+			return nil, errors.New("Invalid Config: misp url can not be empty")
+		}
+
+		tc, err := c.MISP.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+
+		c.client = &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tc,
+			},
+			Timeout: 30 * time.Second,
+		}
+	default:
+		return nil, fmt.Errorf("Invalid Config: unknown output %s", c.Output)
+	}
+
+	c.wg.Add(1)
+	go c.run()
+
+	return &c, nil
+}
+
+func (b *Backend) writeBundle(bl *builder) error {
+	data, err := json.MarshalIndent(bl.bundle(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Join(b.Directory, fmt.Sprintf("bundle-%s.json", time.Now().UTC().Format("20060102T150405.000Z")))
+
+	// write to a temporary file first, so readers never see partial bundles
+	if err := ioutil.WriteFile(name+".tmp", data, 0640); err != nil {
+		return err
+	}
+
+	return os.Rename(name+".tmp", name)
+}
+
+func (b *Backend) postMISP(bl *builder) error {
+	data, err := json.Marshal(bl.mispEvent())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(b.MISP.URL, "/")+"/events", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", b.MISP.Key)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (b *Backend) export(bl *builder) {
+	var err error
+
+	if b.Output == OutputMISP {
+		err = b.postMISP(bl)
+	} else {
+		err = b.writeBundle(bl)
+	}
+
+	if err != nil {
+		log.Errorf("Error exporting %d observations: %s", bl.Len(), err.Error())
+		pushers.Errors.Inc("stix")
+		return
+	}
+
+	log.Debugf("Exported %d observations", bl.Len())
+}
+
+func (b *Backend) run() {
+	defer b.wg.Done()
+
+	bl := newBuilder(b.Config)
+
+	ticker := time.NewTicker(b.Interval.Duration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case m := <-b.ch:
+			bl.add(m)
+			if bl.Len() < b.MaxObservations {
+				continue
+			}
+		case <-ticker.C:
+		case <-b.done:
+			b.drain(bl)
+
+			if bl.Len() > 0 {
+				b.export(bl)
+			}
+
+			return
+		}
+
+		if bl.Len() == 0 {
+			continue
+		}
+
+		b.export(bl)
+
+		bl = newBuilder(b.Config)
+	}
+}
+
+// drain adds the queued events to the builder.
+func (b *Backend) drain(bl *builder) {
+	for {
+		select {
+		case m := <-b.ch:
+			bl.add(m)
+		default:
+			return
+		}
+	}
+}
+
+// Send adds the observables of the event to the next export.
+func (b *Backend) Send(message event.Event) {
+	select {
+	case b.ch <- event.ToMap(message):
+	case <-b.done:
+	}
+}
+
+// Close exports the pending observations.
+func (b *Backend) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+
+	b.wg.Wait()
+	return nil
+}
@@ -0,0 +1,316 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package stix
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func newBackend(t *testing.T, config string) pushers.Channel {
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode(config, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(
+		pushers.WithConfig(s.P),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func testBuilder() *builder {
+	b := newBuilder(Config{
+		Identity:   "honeytrap",
+		URLFields:  []string{"url"},
+		FileFields: []string{"tftp.file"},
+		Credentials: map[string]string{
+			"ssh.username": "ssh.password",
+		},
+	})
+
+	first := time.Date(2017, 11, 28, 14, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		b.add(map[string]interface{}{
+			"date":         first.Add(time.Duration(i) * time.Minute),
+			"source-ip":    "192.168.1.2",
+			"ssh.username": "root",
+			"ssh.password": "toor",
+		})
+	}
+
+	b.add(map[string]interface{}{
+		"date":      first,
+		"source-ip": "192.168.1.2",
+		"http.host": "example.com",
+		"http.url":  "/wp-login.php",
+	})
+
+	b.add(map[string]interface{}{
+		"date":      first,
+		"source-ip": "2001:db8::1",
+		"tftp.file": []byte("malware"),
+	})
+
+	return b
+}
+
+func TestBundle(t *testing.T) {
+	b := testBuilder()
+
+	if b.Len() != 3 {
+		t.Fatalf("Test failed: got %d observations, expected 3", b.Len())
+	}
+
+	count := map[string]int{}
+	var observed map[string]interface{}
+
+	for _, o := range b.bundle()["objects"].([]interface{}) {
+		m := o.(map[string]interface{})
+		count[m["type"].(string)]++
+
+		if m["type"] == "observed-data" && m["number_observed"] == 3 {
+			observed = m
+		}
+
+		if m["type"] == "url" && m["value"] != "http://example.com/wp-login.php" {
+			t.Errorf("Test failed: got url %v", m["value"])
+		}
+	}
+
+	expected := map[string]int{
+		"identity":         1,
+		"ipv4-addr":        1,
+		"ipv6-addr":        1,
+		"url":              1,
+		"user-account":     1,
+		"file":             1,
+		"malware-analysis": 1,
+		"observed-data":    3,
+	}
+
+	for typ, n := range expected {
+		if count[typ] != n {
+			t.Errorf("Test failed: got %d objects of type %s, expected %d", count[typ], typ, n)
+		}
+	}
+
+	if observed == nil {
+		t.Fatalf("Test failed: deduplicated observation not found")
+	}
+
+	if observed["first_observed"] != "2017-11-28T14:00:00.000Z" || observed["last_observed"] != "2017-11-28T14:02:00.000Z" {
+		t.Errorf("Test failed: got %v - %v", observed["first_observed"], observed["last_observed"])
+	}
+}
+
+func TestAccount(t *testing.T) {
+	b := testBuilder()
+
+	b.add(map[string]interface{}{
+		"date":         time.Date(2017, 11, 28, 15, 0, 0, 0, time.UTC),
+		"source-ip":    "192.168.1.3",
+		"ssh.username": "root",
+		"ssh.password": "admin",
+	})
+
+	var accounts []map[string]interface{}
+
+	for _, o := range b.bundle()["objects"].([]interface{}) {
+		if m := o.(map[string]interface{}); m["type"] == "user-account" {
+			accounts = append(accounts, m)
+		}
+	}
+
+	if len(accounts) != 1 {
+		t.Fatalf("Test failed: got %d accounts, expected 1", len(accounts))
+	}
+
+	// the id derives from the account only, not from the credentials
+	if id := observableID("user-account", map[string]interface{}{"account_login": "root"}); accounts[0]["id"] != id {
+		t.Errorf("Test failed: got id %v, expected %s", accounts[0]["id"], id)
+	}
+
+	if _, ok := accounts[0]["credential"]; ok {
+		t.Errorf("Test failed: unexpected credential %v", accounts[0]["credential"])
+	}
+
+	if credentials := fmt.Sprint(accounts[0]["x_honeytrap_credentials"]); credentials != "[toor admin]" {
+		t.Errorf("Test failed: got credentials %s", credentials)
+	}
+
+	values := map[string]string{}
+
+	for _, a := range b.mispEvent()["Event"].(map[string]interface{})["Attribute"].([]interface{}) {
+		m := a.(map[string]interface{})
+		if m["type"] == "text" {
+			values[m["value"].(string)] = m["comment"].(string)
+		}
+	}
+
+	expected := map[string]string{
+		"root:toor":  "tried credentials, observed 3 times",
+		"root:admin": "tried credentials, observed 1 times",
+	}
+
+	if fmt.Sprint(values) != fmt.Sprint(expected) {
+		t.Errorf("Test failed: got attributes %v, expected %v", values, expected)
+	}
+}
+
+func TestObservableID(t *testing.T) {
+	// uuid v5 of {"value":"198.51.100.3"} within the STIX namespace
+	id := observableID("ipv4-addr", map[string]interface{}{"value": "198.51.100.3"})
+	if id != "ipv4-addr--28bb3599-77cd-5a82-a950-b5bc3caf07c4" {
+		t.Errorf("Test failed: got %s", id)
+	}
+}
+
+func TestMISP(t *testing.T) {
+	ch := make(chan map[string]interface{}, 1)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" || r.Header.Get("Authorization") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		m := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&m)
+		ch <- m
+	}))
+	defer s.Close()
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+output = "misp"
+interval = "50ms"
+[P.misp]
+url = "%s"
+key = "key"
+tags = ["tlp:green"]
+`, s.URL))
+
+	c.Send(event.New(event.Custom("source-ip", "192.168.1.2"), event.Custom("ssh.username", "root"), event.Custom("ssh.password", "toor")))
+	c.Send(event.New(event.Custom("source-ip", "192.168.1.2")))
+
+	select {
+	case m := <-ch:
+		attributes := m["Event"].(map[string]interface{})["Attribute"].([]interface{})
+		if len(attributes) != 2 {
+			t.Fatalf("Test failed: got %d attributes, expected 2", len(attributes))
+		}
+
+		ip := attributes[0].(map[string]interface{})
+		if ip["type"] != "ip-src" || ip["value"] != "192.168.1.2" || ip["comment"] != "attacker, observed 2 times" {
+			t.Errorf("Test failed: got attribute %v", ip)
+		}
+
+		credentials := attributes[1].(map[string]interface{})
+		if credentials["value"] != "root:toor" {
+			t.Errorf("Test failed: got attribute %v", credentials)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Test failed: no MISP event received")
+	}
+}
+
+func TestFileOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stix")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+directory = "%s"
+max_observations = 1
+`, dir))
+
+	c.Send(event.New(event.Custom("source-ip", "192.168.1.2")))
+
+	for i := 0; i < 100; i++ {
+		files, _ := filepath.Glob(filepath.Join(dir, "bundle-*.json"))
+		if len(files) == 1 {
+			return
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Error("Test failed: no bundle written")
+}
+
+func TestCloseExports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stix")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+directory = "%s"
+`, dir))
+
+	c.Send(event.New(event.Custom("source-ip", "192.168.1.2")))
+
+	if err := c.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "bundle-*.json")); len(files) != 1 {
+		t.Errorf("Test failed: expected pending bundle written on close, got %d bundles", len(files))
+	}
+}
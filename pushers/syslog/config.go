@@ -0,0 +1,205 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+// Protocols supported by the syslog channel.
+const (
+	RFC5424 = "rfc5424"
+	RFC3164 = "rfc3164"
+)
+
+// Formats of the message body.
+const (
+	FormatJSON = "json"
+	FormatCEF  = "cef"
+	FormatLEEF = "leef"
+)
+
+// ErrAddressNotSet is returned when the syslog address isn't configured.
+var ErrAddressNotSet = errors.New("syslog: address not set")
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3,
+	"auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// defaultMapping maps event keys to CEF extension keys.
+var defaultMapping = map[string]string{
+	"source-ip":        "src",
+	"source-port":      "spt",
+	"destination-ip":   "dst",
+	"destination-port": "dpt",
+	"protocol":         "proto",
+	"category":         "cat",
+	"message":          "msg",
+	"service":          "app",
+	"session-id":       "externalId",
+}
+
+// defaultLEEFMapping maps event keys to LEEF attributes.
+var defaultLEEFMapping = map[string]string{
+	"source-ip":        "src",
+	"source-port":      "srcPort",
+	"destination-ip":   "dst",
+	"destination-port": "dstPort",
+	"protocol":         "proto",
+	"category":         "cat",
+	"message":          "msg",
+	"service":          "app",
+	"session-id":       "sessionId",
+}
+
+// Config defines the configuration of the syslog channel.
+type Config struct {
+	// Address of the syslog server, host:port.
+	Address string `toml:"address"`
+	// Network is one of udp, tcp or tls.
+	Network string `toml:"network"`
+	// Protocol is one of rfc5424 or rfc3164.
+	Protocol string `toml:"protocol"`
+	// Framing of messages over tcp and tls, octet-counting or
+	// non-transparent (newline delimited). Defaults to octet-counting for
+	// rfc5424 and non-transparent for rfc3164.
+	Framing string `toml:"framing"`
+	// Format of the message body, one of json, cef or leef.
+	Format string `toml:"format"`
+
+	Facility string `toml:"facility"`
+	Hostname string `toml:"hostname"`
+	AppName  string `toml:"app_name"`
+
+	Vendor  string `toml:"vendor"`
+	Product string `toml:"product"`
+	Version string `toml:"version"`
+
+	// Mapping maps event keys to CEF extension keys or LEEF attributes,
+	// extending (or with an empty value, removing from) the default mapping.
+	Mapping map[string]string `toml:"mapping"`
+
+	// SeverityKey is the event key whose value is looked up in Severities.
+	SeverityKey     string         `toml:"severity_key"`
+	Severities      map[string]int `toml:"severities"`
+	DefaultSeverity int            `toml:"default_severity"`
+
+	ReconnectDelay config.Delay `toml:"reconnect_delay"`
+	Timeout        config.Delay `toml:"timeout"`
+
+	TLS pushers.TLSConfig `toml:"tls"`
+}
+
+func (c *Config) validate() error {
+	if c.Address == "" {
+		return ErrAddressNotSet
+	}
+
+	switch c.Network {
+	case "udp", "tcp", "tls":
+	default:
+		return fmt.Errorf("syslog: unsupported network %s", c.Network)
+	}
+
+	switch c.Protocol {
+	case RFC5424, RFC3164:
+	default:
+		return fmt.Errorf("syslog: unsupported protocol %s", c.Protocol)
+	}
+
+	if c.Framing == "" && c.Protocol == RFC5424 {
+		c.Framing = "octet-counting"
+	} else if c.Framing == "" {
+		c.Framing = "non-transparent"
+	}
+
+	switch c.Framing {
+	case "octet-counting", "non-transparent":
+	default:
+		return fmt.Errorf("syslog: unsupported framing %s", c.Framing)
+	}
+
+	switch c.Format {
+	case FormatJSON, FormatCEF, FormatLEEF:
+	default:
+		return fmt.Errorf("syslog: unsupported format %s", c.Format)
+	}
+
+	if _, ok := facilities[strings.ToLower(c.Facility)]; !ok {
+		return fmt.Errorf("syslog: unsupported facility %s", c.Facility)
+	}
+
+	if c.DefaultSeverity < 0 || c.DefaultSeverity > 10 {
+		return fmt.Errorf("syslog: default_severity should be within 0-10")
+	}
+
+	for k, v := range c.Severities {
+		if v < 0 || v > 10 {
+			return fmt.Errorf("syslog: severity of %s should be within 0-10", k)
+		}
+	}
+
+	return nil
+}
+
+// mapping returns the effective mapping of event keys for the format.
+func (c *Config) mapping() map[string]string {
+	m := map[string]string{}
+
+	defaults := defaultMapping
+	if c.Format == FormatLEEF {
+		defaults = defaultLEEFMapping
+	}
+
+	for k, v := range defaults {
+		m[k] = v
+	}
+
+	for k, v := range c.Mapping {
+		if v == "" {
+			delete(m, k)
+			continue
+		}
+
+		m[k] = v
+	}
+
+	return m
+}
@@ -0,0 +1,227 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package syslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatter formats events as syslog messages.
+type formatter struct {
+	Config
+
+	mapping  map[string]string
+	facility int
+	pid      int
+}
+
+// severity returns the severity (0-10) of the event.
+func (f *formatter) severity(m map[string]interface{}) int {
+	if v, ok := m[f.SeverityKey]; ok {
+		if sev, ok := f.Severities[toString(v)]; ok {
+			return sev
+		}
+	}
+
+	return f.DefaultSeverity
+}
+
+// syslogSeverity maps a severity (0-10) to a syslog severity.
+func syslogSeverity(sev int) int {
+	switch {
+	case sev >= 9:
+		return 2 // critical
+	case sev >= 7:
+		return 3 // error
+	case sev >= 4:
+		return 4 // warning
+	default:
+		return 6 // informational
+	}
+}
+
+// message returns the syslog message of the event, without transport framing.
+func (f *formatter) message(m map[string]interface{}) ([]byte, error) {
+	date := time.Now()
+	if v, ok := m["date"].(time.Time); ok {
+		date = v
+	}
+
+	sev := f.severity(m)
+
+	var body []byte
+	switch f.Format {
+	case FormatCEF:
+		body = f.cef(m, date, sev)
+	case FormatLEEF:
+		body = f.leef(m, date, sev)
+	default:
+		var err error
+		if body, err = json.Marshal(m); err != nil {
+			return nil, err
+		}
+	}
+
+	pri := f.facility*8 + syslogSeverity(sev)
+
+	buf := &bytes.Buffer{}
+
+	if f.Protocol == RFC3164 {
+		fmt.Fprintf(buf, "<%d>%s %s %s[%d]: ", pri, date.Format(time.Stamp), f.Hostname, f.AppName, f.pid)
+	} else {
+		fmt.Fprintf(buf, "<%d>1 %s %s %s %d %s - ", pri, date.Format("2006-01-02T15:04:05.000000Z07:00"), header(f.Hostname, 255), header(f.AppName, 48), f.pid, header(toString(m["type"]), 32))
+	}
+
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+// header returns s as an rfc5424 header field, printable ascii of at most
+// max characters, or the nil value.
+func header(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+
+	if len(s) > max {
+		s = s[:max]
+	}
+
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// fields returns the mapped fields of the event, sorted by their mapped key.
+func (f *formatter) fields(m map[string]interface{}) [][2]string {
+	fields := [][2]string{}
+	for k, v := range m {
+		if mk, ok := f.mapping[k]; ok {
+			fields = append(fields, [2]string{mk, toString(v)})
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i][0] < fields[j][0]
+	})
+
+	return fields
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+	leefEscaper      = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ", `|`, `\|`)
+)
+
+func (f *formatter) cef(m map[string]interface{}, date time.Time, sev int) []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		cefHeaderEscaper.Replace(f.Vendor),
+		cefHeaderEscaper.Replace(f.Product),
+		cefHeaderEscaper.Replace(f.Version),
+		cefHeaderEscaper.Replace(toString(m["type"])),
+		cefHeaderEscaper.Replace(name(m)),
+		sev,
+	)
+
+	fmt.Fprintf(buf, "rt=%d", date.UnixNano()/int64(time.Millisecond))
+
+	for _, field := range f.fields(m) {
+		fmt.Fprintf(buf, " %s=%s", field[0], cefValueEscaper.Replace(field[1]))
+	}
+
+	return buf.Bytes()
+}
+
+func (f *formatter) leef(m map[string]interface{}, date time.Time, sev int) []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "LEEF:2.0|%s|%s|%s|%s|",
+		leefEscaper.Replace(f.Vendor),
+		leefEscaper.Replace(f.Product),
+		leefEscaper.Replace(f.Version),
+		leefEscaper.Replace(toString(m["type"])),
+	)
+
+	fmt.Fprintf(buf, "devTime=%s\tsev=%d", date.Format("Jan 02 2006 15:04:05"), sev)
+
+	for _, field := range f.fields(m) {
+		fmt.Fprintf(buf, "\t%s=%s", field[0], leefEscaper.Replace(field[1]))
+	}
+
+	return buf.Bytes()
+}
+
+// name returns the human readable name of the event.
+func name(m map[string]interface{}) string {
+	category, typ := toString(m["category"]), toString(m["type"])
+
+	switch {
+	case category != "" && typ != "":
+		return category + " " + typ
+	case category != "":
+		return category
+	default:
+		return typ
+	}
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ",")
+	case int:
+		return strconv.Itoa(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case error:
+		return v.Error()
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,265 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package syslog contains a channel sending events to a syslog server, as
+// json, CEF or LEEF messages.
+package syslog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var (
+	_ = pushers.Register("syslog", New)
+)
+
+var log = logging.MustGetLogger("channels/syslog")
+
+const maxReconnectDelay = time.Minute
+
+// Backend defines a struct which provides a channel for delivery
+// of events to a syslog server.
+type Backend struct {
+	Config
+
+	f *formatter
+
+	tlsConfig *tls.Config
+
+	conn net.Conn
+
+	ch chan map[string]interface{}
+
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// New returns a syslog channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	hostname, _ := os.Hostname()
+
+	c := Backend{
+		Config: Config{
+			Network:         "udp",
+			Protocol:        RFC5424,
+			Format:          FormatJSON,
+			Facility:        "local0",
+			Hostname:        hostname,
+			AppName:         "honeytrap",
+			Vendor:          "DutchSec",
+			Product:         "honeytrap",
+			Version:         "1.0",
+			SeverityKey:     "category",
+			DefaultSeverity: 5,
+			ReconnectDelay:  config.Delay(time.Second),
+			Timeout:         config.Delay(10 * time.Second),
+		},
+		ch:   make(chan map[string]interface{}, 100),
+		done: make(chan struct{}),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	c.Network = strings.ToLower(c.Network)
+	c.Protocol = strings.ToLower(c.Protocol)
+	c.Format = strings.ToLower(c.Format)
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	if c.Network == "tls" {
+		tc, err := c.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+
+		c.tlsConfig = tc
+	}
+
+	c.f = &formatter{
+		Config:   c.Config,
+		mapping:  c.mapping(),
+		facility: facilities[strings.ToLower(c.Facility)],
+		pid:      os.Getpid(),
+	}
+
+	c.wg.Add(1)
+	go c.run()
+
+	return &c, nil
+}
+
+func (b *Backend) dial() (net.Conn, error) {
+	timeout := b.Timeout.Duration()
+
+	switch b.Network {
+	case "tls":
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", b.Address, b.tlsConfig)
+	default:
+		return net.DialTimeout(b.Network, b.Address, timeout)
+	}
+}
+
+// frame returns the message framed for the transport.
+func (b *Backend) frame(msg []byte) []byte {
+	if b.Network == "udp" {
+		return msg
+	}
+
+	if b.Framing == "octet-counting" {
+		return append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+
+	return append(msg, '\n')
+}
+
+// write writes data, (re)connecting until it succeeds. Once the channel is
+// closing, data is written at most once.
+func (b *Backend) write(data []byte) {
+	delay := b.ReconnectDelay.Duration()
+
+	for {
+		if b.conn == nil {
+			conn, err := b.dial()
+			if err == nil {
+				log.Infof("Connected to syslog server %s (%s)", b.Address, b.Network)
+				b.conn = conn
+			} else {
+				log.Errorf("Error connecting to syslog server %s: %s", b.Address, err.Error())
+				pushers.Errors.Inc("syslog")
+			}
+		}
+
+		if b.conn != nil {
+			b.conn.SetWriteDeadline(time.Now().Add(b.Timeout.Duration()))
+
+			_, err := b.conn.Write(data)
+			if err == nil {
+				return
+			}
+
+			log.Errorf("Error writing to syslog server %s: %s", b.Address, err.Error())
+			pushers.Errors.Inc("syslog")
+
+			b.conn.Close()
+			b.conn = nil
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-b.done:
+			log.Errorf("Dropping message, syslog server %s unavailable on close", b.Address)
+			return
+		}
+
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+func (b *Backend) run() {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case m := <-b.ch:
+			b.send(m)
+		case <-b.done:
+			b.drain()
+
+			if b.conn != nil {
+				b.conn.Close()
+			}
+
+			return
+		}
+	}
+}
+
+// drain sends the queued messages.
+func (b *Backend) drain() {
+	for {
+		select {
+		case m := <-b.ch:
+			b.send(m)
+		default:
+			return
+		}
+	}
+}
+
+func (b *Backend) send(m map[string]interface{}) {
+	msg, err := b.f.message(m)
+	if err != nil {
+		log.Errorf("Error formatting event: %s", err.Error())
+		pushers.Errors.Inc("syslog")
+		return
+	}
+
+	b.write(b.frame(msg))
+}
+
+// Send delivers the event to the syslog server.
+func (b *Backend) Send(message event.Event) {
+	select {
+	case b.ch <- event.ToMap(message):
+	case <-b.done:
+	}
+}
+
+// Close sends the queued messages and closes the connection.
+func (b *Backend) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+
+	b.wg.Wait()
+	return nil
+}
@@ -0,0 +1,306 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package syslog
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+func newBackend(t *testing.T, config string) *Backend {
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode(config, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(
+		pushers.WithConfig(s.P),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.(*Backend)
+}
+
+func testEvent() map[string]interface{} {
+	return map[string]interface{}{
+		"date":             time.Date(2017, 11, 28, 14, 9, 0, 0, time.UTC),
+		"category":         "ssh",
+		"type":             "password-authentication",
+		"source-ip":        "192.168.1.2",
+		"destination-port": 22,
+		"message":          "user=root password=a=b",
+	}
+}
+
+func TestFormatCEF(t *testing.T) {
+	b := newBackend(t, `
+[P]
+address = "127.0.0.1:514"
+format = "cef"
+hostname = "sensor01"
+[P.severities]
+ssh = 8
+[P.mapping]
+message = ""
+`)
+
+	msg, err := b.f.message(testEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf("<131>1 2017-11-28T14:09:00.000000Z sensor01 honeytrap %d password-authentication - CEF:0|DutchSec|honeytrap|1.0|password-authentication|ssh password-authentication|8|rt=1511878140000 cat=ssh dpt=22 src=192.168.1.2", b.f.pid)
+	if string(msg) != expected {
+		t.Errorf("Test failed: got %q, expected %q", msg, expected)
+	}
+}
+
+func TestFormatLEEF3164(t *testing.T) {
+	b := newBackend(t, `
+[P]
+address = "127.0.0.1:514"
+protocol = "rfc3164"
+format = "leef"
+facility = "auth"
+hostname = "sensor01"
+`)
+
+	msg, err := b.f.message(testEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := fmt.Sprintf("<36>Nov 28 14:09:00 sensor01 honeytrap[%d]: LEEF:2.0|DutchSec|honeytrap|1.0|password-authentication|devTime=Nov 28 2017 14:09:00\tsev=5\tcat=ssh\tdstPort=22\tmsg=user=root password=a=b\tsrc=192.168.1.2", b.f.pid)
+	if string(msg) != expected {
+		t.Errorf("Test failed: got %q, expected %q", msg, expected)
+	}
+}
+
+func TestCEFEscaping(t *testing.T) {
+	b := newBackend(t, `
+[P]
+address = "127.0.0.1:514"
+format = "cef"
+`)
+
+	m := testEvent()
+	m["type"] = "a|b"
+	m["message"] = "x=1\ny\\z"
+
+	msg, err := b.f.message(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(msg), `|a\|b|ssh a\|b|`) {
+		t.Errorf("Test failed: header not escaped: %q", msg)
+	}
+
+	if !strings.Contains(string(msg), `msg=x\=1\ny\\z`) {
+		t.Errorf("Test failed: extension not escaped: %q", msg)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, config := range []string{
+		`network = "tcp"`,
+		`address = "127.0.0.1:514"
+		network = "sctp"`,
+		`address = "127.0.0.1:514"
+		format = "xml"`,
+		`address = "127.0.0.1:514"
+		facility = "local9"`,
+	} {
+		s := struct {
+			P toml.Primitive
+		}{}
+
+		if _, err := toml.Decode("[P]\n"+config, &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := New(pushers.WithConfig(s.P)); err == nil {
+			t.Errorf("Test failed: expected error for config %q", config)
+		}
+	}
+}
+
+func TestSendTCPReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+address = "%s"
+network = "tcp"
+reconnect_delay = "10ms"
+`, l.Addr().String()))
+
+	read := func() string {
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer conn.Close()
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		r := bufio.NewReader(conn)
+
+		var size int
+		if _, err := fmt.Fscanf(r, "%d ", &size); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := make([]byte, size)
+		if _, err := r.Read(buf); err != nil {
+			t.Fatal(err)
+		}
+
+		return string(buf)
+	}
+
+	c.Send(event.New(event.Category("test"), event.Type("first")))
+
+	if msg := read(); !strings.Contains(msg, `"type":"first"`) {
+		t.Errorf("Test failed: unexpected message %q", msg)
+	}
+
+	// the server closed the connection, the channel should reconnect
+	c.Send(event.New(event.Category("test"), event.Type("second")))
+	c.Send(event.New(event.Category("test"), event.Type("third")))
+
+	if msg := read(); !strings.Contains(msg, `"type":"second"`) && !strings.Contains(msg, `"type":"third"`) {
+		t.Errorf("Test failed: unexpected message %q", msg)
+	}
+}
+
+func TestClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer l.Close()
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+address = "%s"
+network = "tcp"
+framing = "non-transparent"
+`, l.Addr().String()))
+
+	for i := 0; i < 10; i++ {
+		c.Send(event.New(event.Category("test"), event.Type(fmt.Sprintf("event-%d", i))))
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// sending after close is a no-op
+	c.Send(event.New(event.Category("test")))
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	count := 0
+
+	s := bufio.NewScanner(conn)
+	for s.Scan() {
+		count++
+	}
+
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the connection is closed after the queued messages
+	if count != 10 {
+		t.Errorf("Test failed: got %d messages, expected %d", count, 10)
+	}
+}
+
+func TestCloseUnavailable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := l.Addr().String()
+	l.Close()
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+address = "%s"
+network = "tcp"
+reconnect_delay = "1h"
+`, address))
+
+	c.Send(event.New(event.Category("test")))
+
+	done := make(chan struct{})
+
+	go func() {
+		c.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Test failed: close blocked on an unavailable server")
+	}
+}
@@ -0,0 +1,230 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+// TransformConfig defines the field transformations of a transforming
+// channel. Fields are matched by patterns, eg. "http.cookie.*". The
+// transformations are applied in the order drop, truncate, mask, hash, rename
+// and add.
+type TransformConfig struct {
+	// Drop removes the fields.
+	Drop []string `toml:"drop"`
+
+	// Truncate limits the fields to a maximum length.
+	Truncate map[string]int `toml:"truncate"`
+
+	// Mask replaces the values of the fields with MaskWith.
+	Mask     []string `toml:"mask"`
+	MaskWith string   `toml:"mask_with"`
+
+	// Hash replaces the values of the fields with their hex encoded SHA-256
+	// hash, or HMAC-SHA256 when HashKey is set.
+	Hash    []string `toml:"hash"`
+	HashKey string   `toml:"hash_key"`
+
+	// Rename renames the fields, from old to new name.
+	Rename map[string]string `toml:"rename"`
+
+	// Add adds static fields.
+	Add map[string]interface{} `toml:"add"`
+}
+
+const defaultMaskWith = "********"
+
+type transformChannel struct {
+	Channel
+
+	TransformConfig
+}
+
+// TransformChannel returns a Channel which delivers a transformed copy of
+// the events, leaving the original event untouched for other channels.
+func TransformChannel(channel Channel, c TransformConfig) (Channel, error) {
+	patterns := append([]string{}, c.Drop...)
+	patterns = append(patterns, c.Mask...)
+	patterns = append(patterns, c.Hash...)
+
+	for pattern, max := range c.Truncate {
+		if max < 0 {
+			return nil, fmt.Errorf("invalid truncate length %d for %s", max, pattern)
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	for pattern := range c.Rename {
+		patterns = append(patterns, pattern)
+	}
+
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.MaskWith == "" {
+		c.MaskWith = defaultMaskWith
+	}
+
+	return &transformChannel{
+		Channel:         channel,
+		TransformConfig: c,
+	}, nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Send delivers the transformed copy of the event.
+func (tc *transformChannel) Send(e event.Event) {
+	mp := event.ToMap(e)
+
+	for name := range mp {
+		if matchAny(tc.Drop, name) {
+			delete(mp, name)
+		}
+	}
+
+	// sorted for deterministic results when patterns overlap
+	truncate := []string{}
+	for pattern := range tc.Truncate {
+		truncate = append(truncate, pattern)
+	}
+
+	sort.Strings(truncate)
+
+	for name, value := range mp {
+		for _, pattern := range truncate {
+			if ok, _ := path.Match(pattern, name); !ok {
+				continue
+			}
+
+			max := tc.Truncate[pattern]
+			value = mapStrings(value, func(s string) string {
+				if len(s) <= max {
+					return s
+				}
+
+				// don't split a multi-byte character
+				n := max
+				for n > 0 && !utf8.RuneStart(s[n]) {
+					n--
+				}
+
+				return s[:n]
+			})
+
+			break
+		}
+
+		if matchAny(tc.Mask, name) {
+			value = mapStrings(value, func(string) string {
+				return tc.MaskWith
+			})
+		}
+
+		if matchAny(tc.Hash, name) {
+			value = mapStrings(value, tc.hash)
+		}
+
+		mp[name] = value
+	}
+
+	renamed := map[string]interface{}{}
+	for name, value := range mp {
+		for from, to := range tc.Rename {
+			if ok, _ := path.Match(from, name); ok {
+				name = to
+				break
+			}
+		}
+
+		renamed[name] = value
+	}
+
+	for name, value := range tc.Add {
+		renamed[name] = value
+	}
+
+	tc.Channel.Send(event.New(
+		event.CopyFrom(renamed),
+	))
+}
+
+func (tc *transformChannel) hash(s string) string {
+	var h hash.Hash
+	if tc.HashKey == "" {
+		h = sha256.New()
+	} else {
+		h = hmac.New(sha256.New, []byte(tc.HashKey))
+	}
+
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// mapStrings applies fn to string values, and to every element of string
+// slices. Other values are converted to strings first.
+func mapStrings(v interface{}, fn func(string) string) interface{} {
+	switch x := v.(type) {
+	case []string:
+		result := make([]string, len(x))
+		for i, s := range x {
+			result[i] = fn(s)
+		}
+
+		return result
+	case []byte:
+		return fn(string(x))
+	default:
+		return fn(toString(v))
+	}
+}
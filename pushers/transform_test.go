@@ -0,0 +1,132 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package pushers
+
+import (
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestTransformChannel(t *testing.T) {
+	rc := &recordingChannel{ch: make(chan event.Event, 1)}
+
+	c, err := TransformChannel(rc, TransformConfig{
+		Drop:     []string{"payload-hex", "http.cookie.*"},
+		Truncate: map[string]int{"payload": 4},
+		Mask:     []string{"ftp.password"},
+		Hash:     []string{"ssh.password"},
+		Rename:   map[string]string{"source-ip": "src"},
+		Add:      map[string]interface{}{"environment": "production"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := event.New(
+		event.Category("ssh"),
+		event.Payload([]byte("password")),
+		event.Custom("source-ip", "1.2.3.4"),
+		event.Custom("ssh.password", "password"),
+		event.Custom("ftp.password", "secret"),
+		event.Custom("http.cookie.session", "abc"),
+	)
+
+	c.Send(e)
+
+	mp := event.ToMap(<-rc.ch)
+
+	expected := map[string]interface{}{
+		"category":     "ssh",
+		"payload":      "pass",
+		"src":          "1.2.3.4",
+		"ssh.password": "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8",
+		"ftp.password": defaultMaskWith,
+		"environment":  "production",
+	}
+
+	for name, value := range expected {
+		if mp[name] != value {
+			t.Errorf("%s: expected %v, got %v", name, value, mp[name])
+		}
+	}
+
+	for _, name := range []string{"payload-hex", "http.cookie.session", "source-ip"} {
+		if _, ok := mp[name]; ok {
+			t.Errorf("%s: expected field to be removed", name)
+		}
+	}
+
+	if e.Get("ssh.password") != "password" {
+		t.Errorf("original event modified")
+	}
+}
+
+func TestTransformChannelInvalidPattern(t *testing.T) {
+	if _, err := TransformChannel(&recordingChannel{}, TransformConfig{Drop: []string{"["}}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestTransformChannelInvalidTruncate(t *testing.T) {
+	if _, err := TransformChannel(&recordingChannel{}, TransformConfig{Truncate: map[string]int{"payload": -1}}); err == nil {
+		t.Error("expected error for negative truncate length")
+	}
+}
+
+func TestTransformChannelTruncateUTF8(t *testing.T) {
+	rc := &recordingChannel{ch: make(chan event.Event, 1)}
+
+	c, err := TransformChannel(rc, TransformConfig{
+		Truncate: map[string]int{"http.*": 4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Send(event.New(
+		event.Custom("http.url", "/café"),
+		event.Custom("http.host", "€€"),
+	))
+
+	mp := event.ToMap(<-rc.ch)
+
+	expected := map[string]interface{}{
+		"http.url":  "/caf",
+		"http.host": "€",
+	}
+
+	for name, value := range expected {
+		if mp[name] != value {
+			t.Errorf("%s: expected %q, got %q", name, value, mp[name])
+		}
+	}
+}
@@ -0,0 +1,397 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package webhook contains a channel posting events to a HTTP endpoint, with
+// templated bodies, batching, retries and HMAC signing.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:channels:webhook")
+
+var (
+	_ = pushers.Register("webhook", New)
+)
+
+// DefaultSignatureHeader is the header containing the HMAC-SHA256 signature
+// of the body, as sha256=<hex>.
+const DefaultSignatureHeader = "X-Honeytrap-Signature"
+
+// Config defines the configuration of the webhook channel.
+type Config struct {
+	URL     string            `toml:"url"`
+	Method  string            `toml:"method"`
+	Headers map[string]string `toml:"headers"`
+
+	ContentType string `toml:"content_type"`
+
+	// Template renders the body of a single event, BatchTemplate the body
+	// of a batch of events.
+	Template      string `toml:"template"`
+	BatchTemplate string `toml:"batch_template"`
+
+	BatchSize     int          `toml:"batch_size"`
+	BatchInterval config.Delay `toml:"batch_interval"`
+
+	MaxRetries    int          `toml:"max_retries"`
+	RetryDelay    config.Delay `toml:"retry_delay"`
+	MaxRetryDelay config.Delay `toml:"max_retry_delay"`
+
+	Secret          string `toml:"secret"`
+	SignatureHeader string `toml:"signature_header"`
+
+	Timeout config.Delay `toml:"timeout"`
+
+	TLS pushers.TLSConfig `toml:"tls"`
+}
+
+// Backend defines a struct which provides a channel for delivery
+// of events to a webhook.
+type Backend struct {
+	Config
+
+	template      *template.Template
+	batchTemplate *template.Template
+
+	client *http.Client
+
+	ch chan map[string]interface{}
+
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"date": func(layout string, v interface{}) string {
+		if t, ok := v.(time.Time); ok {
+			return t.Format(layout)
+		}
+		return ""
+	},
+}
+
+// New returns a webhook channel.
+func New(options ...func(pushers.Channel) error) (pushers.Channel, error) {
+	c := Backend{
+		Config: Config{
+			Method:          http.MethodPost,
+			ContentType:     "application/json",
+			BatchSize:       1,
+			BatchInterval:   config.Delay(5 * time.Second),
+			MaxRetries:      5,
+			RetryDelay:      config.Delay(time.Second),
+			MaxRetryDelay:   config.Delay(time.Minute),
+			SignatureHeader: DefaultSignatureHeader,
+			Timeout:         config.Delay(20 * time.Second),
+		},
+		ch:   make(chan map[string]interface{}, 100),
+		done: make(chan struct{}),
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.URL == "" {
+		return nil, errors.New("Invalid Config: url can not be empty")
+	}
+
+	if c.BatchSize < 1 {
+		return nil, errors.New("Invalid Config: batch_size should be at least 1")
+	}
+
+	if c.BatchInterval.Duration() <= 0 {
+		return nil, errors.New("Invalid Config: batch_interval should be positive")
+	}
+
+	if c.Template != "" {
+		t, err := template.New("template").Funcs(funcs).Parse(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Config: template: %s", err.Error())
+		}
+
+		c.template = t
+	}
+
+	if c.BatchTemplate != "" {
+		t, err := template.New("batch_template").Funcs(funcs).Parse(c.BatchTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Config: batch_template: %s", err.Error())
+		}
+
+		c.batchTemplate = t
+	}
+
+	tc, err := c.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	c.client = &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: 5,
+			TLSClientConfig:     tc,
+		},
+		Timeout: c.Timeout.Duration(),
+	}
+
+	c.wg.Add(1)
+	go c.run()
+
+	return &c, nil
+}
+
+// body renders the request body of events.
+func (b *Backend) body(events []map[string]interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	if b.BatchSize == 1 && b.template != nil {
+		err := b.template.Execute(buf, events[0])
+		return buf.Bytes(), err
+	} else if b.BatchSize == 1 {
+		return json.Marshal(events[0])
+	}
+
+	if b.batchTemplate != nil {
+		err := b.batchTemplate.Execute(buf, events)
+		return buf.Bytes(), err
+	} else if b.template == nil {
+		return json.Marshal(events)
+	}
+
+	// events rendered by template, one per line
+	for _, e := range events {
+		if err := b.template.Execute(buf, e); err != nil {
+			return nil, err
+		}
+
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// sign returns the signature of the body.
+func (b *Backend) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(b.Secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// errPermanent marks errors that shouldn't be retried.
+type errPermanent struct {
+	error
+}
+
+func (b *Backend) do(body []byte) error {
+	req, err := http.NewRequest(b.Method, b.URL, bytes.NewReader(body))
+	if err != nil {
+		return errPermanent{err}
+	}
+
+	req.Header.Set("Content-Type", b.ContentType)
+
+	for k, v := range b.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if b.Secret != "" {
+		req.Header.Set(b.SignatureHeader, b.sign(body))
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	default:
+		return errPermanent{fmt.Errorf("unexpected status %s", resp.Status)}
+	}
+}
+
+// deliver posts the events, retrying with exponential backoff. Once the
+// channel is closing, the events are posted at most once.
+func (b *Backend) deliver(events []map[string]interface{}) {
+	body, err := b.body(events)
+	if err != nil {
+		log.Errorf("Error rendering body: %s", err.Error())
+		pushers.Errors.Inc("webhook")
+		return
+	}
+
+	delay := b.RetryDelay.Duration()
+
+	for retry := 0; ; retry++ {
+		err := b.do(body)
+		if err == nil {
+			return
+		}
+
+		if _, ok := err.(errPermanent); ok {
+			log.Errorf("Error delivering %d events to webhook: %s", len(events), err.Error())
+			pushers.Errors.Inc("webhook")
+			return
+		}
+
+		if retry >= b.MaxRetries {
+			log.Errorf("Error delivering %d events to webhook, giving up after %d retries: %s", len(events), retry, err.Error())
+			pushers.Errors.Inc("webhook")
+			return
+		}
+
+		log.Errorf("Error delivering to webhook, retrying in %s: %s", delay, err.Error())
+		pushers.Errors.Inc("webhook")
+
+		select {
+		case <-time.After(delay):
+		case <-b.done:
+			log.Errorf("Error delivering %d events to webhook, giving up on close: %s", len(events), err.Error())
+			return
+		}
+
+		if delay *= 2; delay > b.MaxRetryDelay.Duration() {
+			delay = b.MaxRetryDelay.Duration()
+		}
+	}
+}
+
+func (b *Backend) run() {
+	defer b.wg.Done()
+
+	batch := []map[string]interface{}{}
+
+	ticker := time.NewTicker(b.BatchInterval.Duration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e := <-b.ch:
+			batch = append(batch, e)
+			if len(batch) < b.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-b.done:
+			batch = b.drain(batch)
+
+			// deliver the pending events in batches of batch_size
+			for len(batch) > 0 {
+				n := b.BatchSize
+				if n > len(batch) {
+					n = len(batch)
+				}
+
+				b.deliver(batch[:n])
+				batch = batch[n:]
+			}
+
+			return
+		}
+
+		if len(batch) == 0 {
+			continue
+		}
+
+		b.deliver(batch)
+
+		batch = []map[string]interface{}{}
+	}
+}
+
+// drain adds the queued events to the batch.
+func (b *Backend) drain(batch []map[string]interface{}) []map[string]interface{} {
+	for {
+		select {
+		case e := <-b.ch:
+			batch = append(batch, e)
+		default:
+			return batch
+		}
+	}
+}
+
+// Send delivers the event to the webhook.
+func (b *Backend) Send(message event.Event) {
+	select {
+	case b.ch <- event.ToMap(message):
+	case <-b.done:
+	}
+}
+
+// Close delivers the pending events and waits until they are posted.
+func (b *Backend) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+
+	b.wg.Wait()
+	return nil
+}
@@ -0,0 +1,290 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+type request struct {
+	header http.Header
+	body   string
+}
+
+func newBackend(t *testing.T, config string) pushers.Channel {
+	s := struct {
+		P toml.Primitive
+	}{}
+
+	if _, err := toml.Decode(config, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(
+		pushers.WithConfig(s.P),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func newServer(status func(int) int) (*httptest.Server, chan request) {
+	ch := make(chan request, 10)
+
+	var count int32
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		n := int(atomic.AddInt32(&count, 1))
+		if code := status(n); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+
+		ch <- request{header: r.Header, body: string(body)}
+	})), ch
+}
+
+func receive(t *testing.T, ch chan request) request {
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("Test failed: no request received")
+	}
+
+	return request{}
+}
+
+func TestWebhookTemplateSigned(t *testing.T) {
+	s, ch := newServer(func(int) int { return http.StatusOK })
+	defer s.Close()
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+url = "%s"
+secret = "secret"
+headers = { Authorization = "Bearer token" }
+template = '{"text": "{{ index . "category" }} from {{ index . "source-ip" }}"}'
+`, s.URL))
+
+	c.Send(event.New(event.Category("ssh"), event.Custom("source-ip", "10.0.0.1")))
+
+	r := receive(t, ch)
+
+	expected := `{"text": "ssh from 10.0.0.1"}`
+	if r.body != expected {
+		t.Errorf("Test failed: got %q, expected %q", r.body, expected)
+	}
+
+	if got := r.header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Test failed: got authorization %q", got)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(expected))
+
+	if got, expected := r.header.Get(DefaultSignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != expected {
+		t.Errorf("Test failed: got signature %q, expected %q", got, expected)
+	}
+}
+
+func TestWebhookBatch(t *testing.T) {
+	s, ch := newServer(func(int) int { return http.StatusOK })
+	defer s.Close()
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+url = "%s"
+batch_size = 3
+batch_interval = "1h"
+batch_template = '{{ range . }}{{ index . "type" }};{{ end }}'
+`, s.URL))
+
+	for _, typ := range []string{"a", "b", "c"} {
+		c.Send(event.New(event.Type(typ)))
+	}
+
+	if r := receive(t, ch); r.body != "a;b;c;" {
+		t.Errorf("Test failed: got %q, expected %q", r.body, "a;b;c;")
+	}
+}
+
+func TestWebhookBatchInterval(t *testing.T) {
+	s, ch := newServer(func(int) int { return http.StatusOK })
+	defer s.Close()
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+url = "%s"
+batch_size = 100
+batch_interval = "50ms"
+template = '{{ index . "type" }}'
+`, s.URL))
+
+	c.Send(event.New(event.Type("a")))
+	c.Send(event.New(event.Type("b")))
+
+	if r := receive(t, ch); r.body != "a\nb\n" {
+		t.Errorf("Test failed: got %q, expected %q", r.body, "a\nb\n")
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	// fail the first two attempts
+	s, ch := newServer(func(n int) int {
+		if n <= 2 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	defer s.Close()
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+url = "%s"
+retry_delay = "10ms"
+`, s.URL))
+
+	c.Send(event.New(event.Type("retried")))
+
+	r := receive(t, ch)
+	if r.header.Get("Content-Type") != "application/json" {
+		t.Errorf("Test failed: got content type %q", r.header.Get("Content-Type"))
+	}
+}
+
+func TestWebhookInvalidConfig(t *testing.T) {
+	for _, config := range []string{
+		`method = "POST"`,
+		`url = "http://127.0.0.1/"
+		template = "{{ .Foo "`,
+		`url = "http://127.0.0.1/"
+		batch_size = 0`,
+	} {
+		s := struct {
+			P toml.Primitive
+		}{}
+
+		if _, err := toml.Decode("[P]\n"+config, &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := New(pushers.WithConfig(s.P)); err == nil {
+			t.Errorf("Test failed: expected error for config %q", config)
+		}
+	}
+}
+
+func TestWebhookClose(t *testing.T) {
+	s, ch := newServer(func(int) int { return http.StatusOK })
+	defer s.Close()
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+url = "%s"
+batch_size = 2
+batch_interval = "1h"
+`, s.URL))
+
+	for i := 0; i < 3; i++ {
+		c.Send(event.New(event.Category("ssh")))
+	}
+
+	if err := c.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// sending after close is a no-op
+	c.Send(event.New(event.Category("ssh")))
+
+	if len(ch) != 2 {
+		t.Fatalf("Test failed: got %d requests, expected %d", len(ch), 2)
+	}
+
+	var events []map[string]interface{}
+	for i := 0; i < 2; i++ {
+		var batch []map[string]interface{}
+		if err := json.Unmarshal([]byte((<-ch).body), &batch); err != nil {
+			t.Fatal(err)
+		}
+
+		events = append(events, batch...)
+	}
+
+	if len(events) != 3 {
+		t.Errorf("Test failed: got %d events, expected %d", len(events), 3)
+	}
+}
+
+func TestWebhookCloseRetry(t *testing.T) {
+	s, _ := newServer(func(int) int { return http.StatusServiceUnavailable })
+	defer s.Close()
+
+	c := newBackend(t, fmt.Sprintf(`
+[P]
+url = "%s"
+retry_delay = "1h"
+`, s.URL))
+
+	c.Send(event.New(event.Category("ssh")))
+
+	done := make(chan struct{})
+
+	go func() {
+		c.(io.Closer).Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Test failed: close blocked on retries")
+	}
+}
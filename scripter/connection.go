@@ -30,10 +30,13 @@
  */
 package scripter
 
+import "context"
+
 //ConnectionStruct
 type ConnectionStruct struct {
 	Service string
 	Conn    ScrConn
+	Ctx     context.Context
 }
 
 // GetScrConn returns the ScrConn
@@ -44,7 +47,7 @@ func (w *ConnectionStruct) GetScrConn() ScrConn {
 // Handle incoming message string
 // Get all scripts for a given service and pass the string to each script
 func (w *ConnectionStruct) Handle(message string) (string, error) {
-	result, err := w.Conn.Handle(w.Service, message)
+	result, err := w.Conn.Handle(w.Ctx, w.Service, message)
 
 	if err != nil {
 		log.Errorf("Error while handling scripts: %s", err)
@@ -31,9 +31,12 @@
 package scripter
 
 import (
+	"context"
 	"fmt"
 	"github.com/honeytrap/honeytrap/abtester"
+	"github.com/honeytrap/honeytrap/artifact"
 	"net"
+	"net/http"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/yuin/gopher-lua"
 	"bytes"
@@ -60,6 +63,9 @@ type dummyScripter struct {
 
 	ab abtester.AbTester
 
+	artifacts *artifact.Store
+	client    *http.Client
+
 	c pushers.Channel
 }
 
@@ -78,6 +84,26 @@ func (l *dummyScripter) SetAbTester(ab abtester.AbTester) {
 	l.ab = ab
 }
 
+//SetArtifacts sets the store of the downloaded files
+func (l *dummyScripter) SetArtifacts(st *artifact.Store) {
+	l.artifacts = st
+}
+
+//GetArtifacts returns the store of the downloaded files
+func (l *dummyScripter) GetArtifacts() *artifact.Store {
+	return l.artifacts
+}
+
+//SetClient sets the http client files are downloaded with
+func (l *dummyScripter) SetClient(client *http.Client) {
+	l.client = client
+}
+
+//GetClient returns the http client files are downloaded with
+func (l *dummyScripter) GetClient() *http.Client {
+	return l.client
+}
+
 //Set the abTester from which differential responses can be retrieved
 func (l *dummyScripter) GetAbTester() abtester.AbTester {
 	return l.ab
@@ -91,8 +117,8 @@ func (l *dummyScripter) Init(service string) error {
 }
 
 //GetConnection returns a connection for the given ip-address, if no connection exists yet, create it.
-func (l *dummyScripter) GetConnection(service string, conn net.Conn) ConnectionWrapper {
-	return &ConnectionStruct{Service: service, Conn: nil}
+func (l *dummyScripter) GetConnection(ctx context.Context, service string, conn net.Conn) ConnectionWrapper {
+	return &ConnectionStruct{Service: service, Conn: nil, Ctx: ctx}
 }
 
 // CanHandle checks whether scripter can handle incoming connection for the peeked message
@@ -118,6 +144,7 @@ func (l *dummyScripter) CleanConnections() {
 
 type dummyConn struct {
 	conn net.Conn
+	ctx  context.Context
 
 	//List of lua scripts running for this connection: directory/scriptname
 	scripts map[string]map[string]*lua.LState
@@ -132,6 +159,11 @@ func (c *dummyConn) GetConn() net.Conn {
 	return c.conn
 }
 
+//GetContext returns the context of the message being handled for the SrcConn
+func (c *dummyConn) GetContext() context.Context {
+	return c.ctx
+}
+
 //GetAbTester returns the ab tester for the SrcConn
 func (c *dummyConn) GetAbTester() abtester.AbTester {
 	return c.abTester
@@ -173,7 +205,7 @@ func (c *dummyConn) GetConnectionBuffer() *bytes.Buffer {
 }
 
 // Handle calls the handle method on the lua state with the message as the argument
-func (c *dummyConn) Handle(service string, message string) (*Result, error) {
+func (c *dummyConn) Handle(ctx context.Context, service string, message string) (*Result, error) {
 	return nil, nil
 }
 
@@ -1,18 +1,24 @@
 package lua
 
 import (
+	"context"
 	"fmt"
 	"github.com/honeytrap/honeytrap/abtester"
 	"github.com/honeytrap/honeytrap/scripter"
 	"github.com/yuin/gopher-lua"
 	"net"
 	"bytes"
+	"sync"
 	"time"
 )
 
 // Scripter Connection struct
 type luaConn struct {
 	conn net.Conn
+	ctx  context.Context
+
+	//Serializes the calls on the lua states, shared by the sessions of an ip-address
+	m sync.Mutex
 
 	//List of lua scripts running for this connection: directory/scriptname
 	scripts map[string]map[string]*lua.LState
@@ -29,6 +35,11 @@ func (c *luaConn) GetConn() net.Conn {
 	return c.conn
 }
 
+//GetContext returns the context of the message being handled for the SrcConn
+func (c *luaConn) GetContext() context.Context {
+	return c.ctx
+}
+
 //GetAbTester returns the ab tester for the SrcConn
 func (c *luaConn) GetAbTester() abtester.AbTester {
 	return c.abTester
@@ -102,6 +113,7 @@ func (c *luaConn) AddScripts(service string, scripts map[string]string, folder s
 		ls := lua.NewState()
 		ls.DoString(fmt.Sprintf("package.path = './%s/lua/?.lua;' .. package.path", folder))
 		if err := ls.DoFile(script); err != nil {
+			scripter.Errors.Inc("lua", service, "load")
 			err = fmt.Errorf("unable to load lua script: %s", err)
 			continue
 		}
@@ -156,10 +168,17 @@ func callHandle(ls *lua.LState, message string) (*scripter.Result, error) {
 }
 
 // Handle calls the handle method on the lua state with the message as the argument
-func (c *luaConn) Handle(service string, message string) (*scripter.Result, error) {
+// The context is available to the Go functions called by the script through GetContext
+func (c *luaConn) Handle(ctx context.Context, service string, message string) (*scripter.Result, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.ctx = ctx
+
 	for _, script := range c.scripts[service] {
 		canHandle, err := callCanHandle(script, message)
 		if err != nil {
+			scripter.Errors.Inc("lua", service, "canHandle")
 			return nil, err
 		}
 		if !canHandle {
@@ -168,6 +187,7 @@ func (c *luaConn) Handle(service string, message string) (*scripter.Result, erro
 
 		result, err := callHandle(script, message)
 		if err != nil {
+			scripter.Errors.Inc("lua", service, "handle")
 			return nil, err
 		}
 
@@ -31,16 +31,20 @@
 package lua
 
 import (
+	"context"
 	"fmt"
 	"github.com/honeytrap/honeytrap/abtester"
+	"github.com/honeytrap/honeytrap/artifact"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/honeytrap/honeytrap/scripter"
 	"github.com/op/go-logging"
 	"github.com/yuin/gopher-lua"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -80,11 +84,15 @@ type luaScripter struct {
 	scripts map[string]map[string]string
 	//List of connections keyed by 'ip'
 	connections map[string]*luaConn
+	m           sync.Mutex
 	//Lua states to check whether the connection can be handled with the script
 	canHandleStates map[string]map[string]*lua.LState
 
 	ab abtester.AbTester
 
+	artifacts *artifact.Store
+	client    *http.Client
+
 	c pushers.Channel
 }
 
@@ -103,6 +111,26 @@ func (l *luaScripter) SetAbTester(ab abtester.AbTester) {
 	l.ab = ab
 }
 
+//SetArtifacts sets the store of the downloaded files
+func (l *luaScripter) SetArtifacts(st *artifact.Store) {
+	l.artifacts = st
+}
+
+//GetArtifacts returns the store of the downloaded files
+func (l *luaScripter) GetArtifacts() *artifact.Store {
+	return l.artifacts
+}
+
+//SetClient sets the http client files are downloaded with
+func (l *luaScripter) SetClient(client *http.Client) {
+	l.client = client
+}
+
+//GetClient returns the http client files are downloaded with
+func (l *luaScripter) GetClient() *http.Client {
+	return l.client
+}
+
 // Init initializes the scripts from a specific service
 // The service name is given and the method will loop over all files in the scripts folder with the given service name
 // All of these scripts are then loaded and stored in the scripts map
@@ -113,7 +141,10 @@ func (l *luaScripter) Init(service string) error {
 	}
 
 	// TODO: Load basic lua functions from shared context
+	l.m.Lock()
 	l.connections = map[string]*luaConn{}
+	l.m.Unlock()
+
 	l.scripts[service] = map[string]string{}
 	l.canHandleStates[service] = map[string]*lua.LState{}
 
@@ -137,9 +168,13 @@ func (l *luaScripter) Init(service string) error {
 }
 
 //GetConnection returns a connection for the given ip-address, if no connection exists yet, create it.
-func (l *luaScripter) GetConnection(service string, conn net.Conn) scripter.ConnectionWrapper {
+//The context of the session is passed to the scripts with every message handled on the returned wrapper.
+func (l *luaScripter) GetConnection(ctx context.Context, service string, conn net.Conn) scripter.ConnectionWrapper {
 	ip := getConnIP(conn)
 
+	l.m.Lock()
+	defer l.m.Unlock()
+
 	sConn, ok := l.connections[ip]
 	if !ok {
 		sConn = &luaConn{
@@ -159,7 +194,7 @@ func (l *luaScripter) GetConnection(service string, conn net.Conn) scripter.Conn
 		scripter.SetBasicMethods(l, sConn, service)
 	}
 
-	return &scripter.ConnectionStruct{Service: service, Conn: sConn}
+	return &scripter.ConnectionStruct{Service: service, Conn: sConn, Ctx: ctx}
 }
 
 // CanHandle checks whether scripter can handle incoming connection for the peeked message
@@ -169,6 +204,7 @@ func (l *luaScripter) CanHandle(service string, message string) bool {
 		canHandle, err := callCanHandle(ls, message)
 		if err != nil {
 			log.Errorf("%s", err)
+			scripter.Errors.Inc("lua", service, "canHandle")
 		} else if canHandle {
 			return true
 		}
@@ -189,6 +225,9 @@ func (l *luaScripter) GetScriptFolder() string {
 
 // CleanConnections Check all connections removing all that haven't been used for more than 60 minutes to open up memory
 func (l *luaScripter) CleanConnections() {
+	l.m.Lock()
+	defer l.m.Unlock()
+
 	count := 0
 	total := len(l.connections)
 	for key, connection := range l.connections {
@@ -31,8 +31,10 @@
 package lua
 
 import (
+	"context"
 	"testing"
 	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/scripter"
 	"github.com/pkg/errors"
 	"os"
@@ -192,7 +194,7 @@ func TestLuaScripter_GetScripts(t *testing.T) {
 
 // TestLuaScripter_GetConnection tests whether a new connection gets the right struct back
 func TestLuaScripter_GetConnection(t *testing.T) {
-	conn := ls.GetConnection("test", client)
+	conn := ls.GetConnection(context.Background(), "test", client)
 	got := getConnIP(conn.GetScrConn().GetConn())
 
 	expected := getConnIP(client)
@@ -203,7 +205,7 @@ func TestLuaScripter_GetConnection(t *testing.T) {
 
 // TestLuaScripter_GetConnection2 tests whether a existing connection gets the right struct back
 func TestLuaScripter_GetConnection2(t *testing.T) {
-	conn := ls.GetConnection("test", client)
+	conn := ls.GetConnection(context.Background(), "test", client)
 	got := getConnIP(conn.GetScrConn().GetConn())
 
 	expected := getConnIP(client)
@@ -212,11 +214,43 @@ func TestLuaScripter_GetConnection2(t *testing.T) {
 	}
 }
 
+// TestLuaScripter_GetConnectionSessions tests whether sessions from the same ip-address share the connection
+// and the scripts get the context of the session handled
+func TestLuaScripter_GetConnectionSessions(t *testing.T) {
+	first := ls.GetConnection(event.NewSessionContext(context.Background(), "first"), "test", client)
+	second := ls.GetConnection(event.NewSessionContext(context.Background(), "second"), "test", client)
+
+	if first.GetScrConn() != second.GetScrConn() {
+		t.Errorf("Test %s failed: expected sessions of the same ip-address to share the connection", "GetConnectionSessions")
+	}
+
+	for _, conn := range []scripter.ConnectionWrapper{first, second, first} {
+		var got string
+
+		err := conn.GetScrConn().SetStringFunction("parameterTest", func() string {
+			got, _ = event.SessionFromContext(conn.GetScrConn().GetContext())
+			return ""
+		}, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := conn.Handle("test"); err != nil {
+			t.Fatal(err)
+		}
+
+		expected, _ := event.SessionFromContext(conn.(*scripter.ConnectionStruct).Ctx)
+		if got != expected {
+			t.Errorf("Test %s failed: got session %s, expected %s", "GetConnectionSessions", got, expected)
+		}
+	}
+}
+
 // TestLuaConn_Handle tests the handle method on a connection
 func TestLuaConn_Handle(t *testing.T) {
-	conn := ls.GetConnection("test", client)
+	conn := ls.GetConnection(context.Background(), "test", client)
 
-	result, err := conn.GetScrConn().Handle("test", "test")
+	result, err := conn.GetScrConn().Handle(context.Background(), "test", "test")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -247,7 +281,7 @@ func TestLuaConn_callHandle(t *testing.T) {
 
 // TestLuaConn_AddScripts tests whether a script can be added to a connection
 func TestLuaConn_AddScripts(t *testing.T) {
-	conn := ls.GetConnection("test", client)
+	conn := ls.GetConnection(context.Background(), "test", client)
 
 	err := conn.GetScrConn().AddScripts("test", map[string]string{"test_other.lua": "../../test-scripts/lua/test_other/test_other.lua"}, "../../test-scripts")
 	if err != nil {
@@ -263,7 +297,7 @@ func TestLuaConn_AddScripts(t *testing.T) {
 
 // TestLuaConn_SetStringFunction test the string functions from Go into Lua
 func TestLuaConn_SetStringFunction(t *testing.T) {
-	conn := ls.GetConnection("test", client)
+	conn := ls.GetConnection(context.Background(), "test", client)
 
 	err := conn.GetScrConn().SetStringFunction("parameterTest", func() string {
 		return "test"
@@ -273,7 +307,7 @@ func TestLuaConn_SetStringFunction(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result, err := conn.GetScrConn().Handle("test", "test")
+	result, err := conn.GetScrConn().Handle(context.Background(), "test", "test")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -287,7 +321,7 @@ func TestLuaConn_SetStringFunction(t *testing.T) {
 
 // TestLuaConn_SetFloatFunction test the float functions from Go into Lua
 func TestLuaConn_SetFloatFunction(t *testing.T) {
-	conn := ls.GetConnection("test", client)
+	conn := ls.GetConnection(context.Background(), "test", client)
 
 	err := conn.GetScrConn().SetFloatFunction("parameterTest", func() float64 {
 		return 2
@@ -297,7 +331,7 @@ func TestLuaConn_SetFloatFunction(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result, err := conn.GetScrConn().Handle("test", "test")
+	result, err := conn.GetScrConn().Handle(context.Background(), "test", "test")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -311,7 +345,7 @@ func TestLuaConn_SetFloatFunction(t *testing.T) {
 
 // TestLuaConn_SetVoidFunction tests the void functions from Go in Lua
 func TestLuaConn_SetVoidFunction(t *testing.T) {
-	conn := ls.GetConnection("test", client)
+	conn := ls.GetConnection(context.Background(), "test", client)
 
 	err := conn.GetScrConn().SetVoidFunction("parameterTest", func() {
 		got, err := conn.GetScrConn().GetParameters([]string{"key", "value"}, "test")
@@ -329,14 +363,14 @@ func TestLuaConn_SetVoidFunction(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if _, err := conn.GetScrConn().Handle("test", "test"); err != nil {
+	if _, err := conn.GetScrConn().Handle(context.Background(), "test", "test"); err != nil {
 		t.Fatal(err)
 	}
 }
 
 // TestLuaConn_GetParameters test the parameter retrieval from Lua in Go
 func TestLuaConn_GetParameters(t *testing.T) {
-	conn := ls.GetConnection("test", client)
+	conn := ls.GetConnection(context.Background(), "test", client)
 
 	err := conn.GetScrConn().SetStringFunction("parameterTest", func() string {
 		got, err := conn.GetScrConn().GetParameters([]string{"key", "value"}, "test")
@@ -352,7 +386,7 @@ func TestLuaConn_GetParameters(t *testing.T) {
 		return "test"
 	}, "test")
 
-	_, err = conn.GetScrConn().Handle("test", "test")
+	_, err = conn.GetScrConn().Handle(context.Background(), "test", "test")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2,9 +2,15 @@ package scripter
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/honeytrap/honeytrap/artifact"
 	"github.com/honeytrap/honeytrap/event"
-	"github.com/honeytrap/honeytrap/utils/files"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
 	"time"
 )
 
@@ -28,12 +34,13 @@ func getDatetime() func() string {
 	}
 }
 
-// getFileDownload returns a function that downloads a file from URL
-func getFileDownload(c ScrConn, service string) func() string {
+// getFileDownload returns a function that downloads a file from URL into the artifact store, using client
+// Downloads are refused without artifact store or client
+func getFileDownload(st *artifact.Store, client *http.Client, c ScrConn, service string) func() string {
 	return func() string {
-		params, _ := c.GetParameters([]string{"url", "path"}, service)
+		params, _ := c.GetParameters([]string{"url"}, service)
 
-		if err := files.Download(params["url"], params["path"]); err != nil {
+		if err := downloadArtifact(st, client, c, service, params["url"]); err != nil {
 			log.Errorf("error downloading file: %s", err)
 			return "no"
 		}
@@ -41,6 +48,42 @@ func getFileDownload(c ScrConn, service string) func() string {
 	}
 }
 
+// downloadArtifact downloads the file at rawurl into the artifact store
+func downloadArtifact(st *artifact.Store, client *http.Client, c ScrConn, service string, rawurl string) error {
+	if st == nil || client == nil {
+		return errors.New("downloads are disabled")
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url %s", rawurl)
+	}
+
+	resp, err := client.Get(rawurl)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var addr net.Addr
+	if conn := c.GetConn(); conn != nil {
+		addr = conn.RemoteAddr()
+	}
+
+	src := artifact.NewSource(c.GetContext(), service, addr, path.Base(u.Path))
+	src.URL = rawurl
+
+	_, err = st.Put(io.LimitReader(resp.Body, st.MaxSize+1), src)
+	return err
+}
+
 // getAbTest returns a function that returns a value from the AB tester
 func getAbTest(ab ScrAbTester, c ScrConn, service string) func() string {
 	return func() string {
@@ -69,6 +112,7 @@ func channelSend(s Scripter, c ScrConn, service string) func() {
 		}
 		event.Custom("destination-ip", c.GetConn().LocalAddr().String())(message)
 		event.Custom("source-ip", c.GetConn().RemoteAddr().String())(message)
+		event.Session(c.GetContext())(message)
 
 		s.GetChannel().Send(message)
 	}
@@ -123,7 +167,13 @@ func SetBasicMethods(s Scripter, c ScrConn, service string) {
 
 	c.SetStringFunction("getDatetime", getDatetime(), service)
 
-	c.SetStringFunction("getFileDownload", getFileDownload(c, service), service)
+	//Downloads are stored in the artifact store, fetched with the client of the scripter
+	var st *artifact.Store
+	var client *http.Client
+	if a, ok := s.(ScrArtifacter); ok {
+		st, client = a.GetArtifacts(), a.GetClient()
+	}
+	c.SetStringFunction("getFileDownload", getFileDownload(st, client, c, service), service)
 
 	if ab, ok := c.(ScrAbTester); ok {
 		//In the script the function 'getAbTest(key)' can be called, returning a random result for the given key
@@ -35,6 +35,11 @@ import (
 	"reflect"
 	"time"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"github.com/honeytrap/honeytrap/artifact"
 	"github.com/honeytrap/honeytrap/abtester"
 	"github.com/BurntSushi/toml"
 	"github.com/honeytrap/honeytrap/pushers"
@@ -77,9 +82,9 @@ func TestGetDatetime(t *testing.T) {
 	}
 }
 
-//TestGetFileDownload tests the file download functionality from a connection
+//TestGetFileDownload tests the file download is refused without artifact store
 func TestGetFileDownload(t *testing.T) {
-	got := getFileDownload(connectionWrapper.Conn, "test")()
+	got := getFileDownload(nil, http.DefaultClient, connectionWrapper.Conn, "test")()
 
 	expected := "no"
 
@@ -88,6 +93,46 @@ func TestGetFileDownload(t *testing.T) {
 	}
 }
 
+//TestDownloadArtifact tests the download of a file into the artifact store
+func TestDownloadArtifact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scripter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	st, err := artifact.New(artifact.WithPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#!/bin/sh")
+	}))
+	defer ts.Close()
+
+	if err := downloadArtifact(st, nil, connectionWrapper.Conn, "test", ts.URL+"/x.sh"); err == nil {
+		t.Errorf("expected download without client to fail")
+	}
+
+	if err := downloadArtifact(st, ts.Client(), connectionWrapper.Conn, "test", "file:///etc/passwd"); err == nil {
+		t.Errorf("expected download of file url to fail")
+	}
+
+	if err := downloadArtifact(st, ts.Client(), connectionWrapper.Conn, "test", ts.URL+"/x.sh"); err != nil {
+		t.Fatal(err)
+	}
+
+	if artifacts := st.Query(artifact.Query{}); len(artifacts) != 1 || artifacts[0].Size != 9 {
+		t.Errorf("expected downloaded artifact, got %v", artifacts)
+	}
+}
+
 //TestGetAbTester tests the ab tester retrieval from a connection wrapper
 func TestGetAbTester(t *testing.T) {
 	abt, err := abtester.Dummy("test", toml.Primitive{})
@@ -32,12 +32,15 @@ package scripter
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/BurntSushi/toml"
 	"github.com/honeytrap/honeytrap/abtester"
+	"github.com/honeytrap/honeytrap/artifact"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/op/go-logging"
 	"net"
+	"net/http"
 	"time"
 )
 
@@ -90,10 +93,30 @@ func WithAbTester(ab abtester.AbTester) ScripterFunc {
 	}
 }
 
+//WithArtifacts returns a function to set the store of the downloaded files
+func WithArtifacts(st *artifact.Store) ScripterFunc {
+	return func(s Scripter) error {
+		if scrArtifacter, ok := s.(ScrArtifacter); ok {
+			scrArtifacter.SetArtifacts(st)
+		}
+		return nil
+	}
+}
+
+//WithClient returns a function to set the http client files are downloaded with
+func WithClient(client *http.Client) ScripterFunc {
+	return func(s Scripter) error {
+		if scrArtifacter, ok := s.(ScrArtifacter); ok {
+			scrArtifacter.SetClient(client)
+		}
+		return nil
+	}
+}
+
 //Scripter interface that implements basic scripter methods
 type Scripter interface {
 	Init(string) error
-	GetConnection(service string, conn net.Conn) ConnectionWrapper
+	GetConnection(ctx context.Context, service string, conn net.Conn) ConnectionWrapper
 	CanHandle(service string, message string) bool
 	SetChannel(c pushers.Channel)
 	GetChannel() pushers.Channel
@@ -115,13 +138,14 @@ type ConnectionWrapper interface {
 //ScrConn wraps a connection and exposes methods to interact with the connection and scripter
 type ScrConn interface {
 	GetConn() net.Conn
+	GetContext() context.Context
 	SetStringFunction(name string, getString func() string, service string) error
 	SetFloatFunction(name string, getFloat func() float64, service string) error
 	SetVoidFunction(name string, doVoid func(), service string) error
 	GetParameters(params []string, service string) (map[string]string, error)
 	HasScripts(service string) bool
 	AddScripts(service string, scripts map[string]string, folder string) error
-	Handle(service string, message string) (*Result, error)
+	Handle(ctx context.Context, service string, message string) (*Result, error)
 	GetConnectionBuffer() *bytes.Buffer
 	GetLastUsed() time.Time
 }
@@ -138,6 +162,14 @@ type ScrAbTester interface {
 	GetAbTester() abtester.AbTester
 }
 
+//ScrArtifacter exposes methods to interact with the artifact store and the http client files are downloaded with
+type ScrArtifacter interface {
+	SetArtifacts(st *artifact.Store)
+	GetArtifacts() *artifact.Store
+	SetClient(client *http.Client)
+	GetClient() *http.Client
+}
+
 //WithConfig returns a function to attach the config to the scripter
 func WithConfig(c toml.Primitive) ScripterFunc {
 	return func(scr Scripter) error {
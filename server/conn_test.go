@@ -0,0 +1,69 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+func TestCountingConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	cConn := CountingConn(server)
+	defer cConn.Close()
+
+	go func() {
+		client.Write([]byte("hello"))
+
+		buf := make([]byte, 3)
+		io.ReadFull(client, buf)
+	}()
+
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(cConn, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cConn.Write([]byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := cConn.BytesIn(); n != 5 {
+		t.Errorf("expected 5 bytes in, got %d", n)
+	}
+
+	if n := cConn.BytesOut(); n != 3 {
+		t.Errorf("expected 3 bytes out, got %d", n)
+	}
+}
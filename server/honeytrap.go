@@ -33,9 +33,12 @@ package server
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -50,6 +53,14 @@ import (
 	"github.com/honeytrap/honeytrap/scripter"
 	"github.com/honeytrap/honeytrap/web"
 
+	"github.com/honeytrap/honeytrap/enricher"
+	// Import your enrichers here.
+	_ "github.com/honeytrap/honeytrap/enricher/geoip"
+	_ "github.com/honeytrap/honeytrap/enricher/ioc"
+	_ "github.com/honeytrap/honeytrap/enricher/rdns"
+	_ "github.com/honeytrap/honeytrap/enricher/sensor"
+	_ "github.com/honeytrap/honeytrap/enricher/tags"
+
 	"github.com/honeytrap/honeytrap/director"
 	// Import your directors here.
 	_ "github.com/honeytrap/honeytrap/director/forward"
@@ -61,6 +72,8 @@ import (
 
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/honeytrap/honeytrap/pushers/eventbus"
+	"github.com/honeytrap/honeytrap/pushers/spool"
+	"github.com/honeytrap/honeytrap/transcript"
 
 	"github.com/honeytrap/honeytrap/services"
 	_ "github.com/honeytrap/honeytrap/services/elasticsearch"
@@ -89,18 +102,29 @@ import (
 	_ "github.com/honeytrap/honeytrap/pushers/console"
 	_ "github.com/honeytrap/honeytrap/pushers/elasticsearch"
 	_ "github.com/honeytrap/honeytrap/pushers/file"
+	_ "github.com/honeytrap/honeytrap/pushers/hpfeeds"
 	_ "github.com/honeytrap/honeytrap/pushers/kafka"
 	_ "github.com/honeytrap/honeytrap/pushers/marija"
+	_ "github.com/honeytrap/honeytrap/pushers/mqtt"
+	_ "github.com/honeytrap/honeytrap/pushers/pcap"
 	_ "github.com/honeytrap/honeytrap/pushers/pulsar"
 	_ "github.com/honeytrap/honeytrap/pushers/rabbitmq"
 	_ "github.com/honeytrap/honeytrap/pushers/raven"
 	_ "github.com/honeytrap/honeytrap/pushers/slack"
 	_ "github.com/honeytrap/honeytrap/pushers/splunk"
+	_ "github.com/honeytrap/honeytrap/pushers/sql"
+	_ "github.com/honeytrap/honeytrap/pushers/stix"
+	_ "github.com/honeytrap/honeytrap/pushers/syslog"
+	_ "github.com/honeytrap/honeytrap/pushers/webhook"
 
 	"github.com/op/go-logging"
+	"github.com/rs/xid"
 	"github.com/honeytrap/honeytrap/utils"
 	"encoding/json"
 	"github.com/honeytrap/honeytrap/abtester"
+	"github.com/honeytrap/honeytrap/alert"
+	"github.com/honeytrap/honeytrap/artifact"
+	"github.com/honeytrap/honeytrap/credentials"
 )
 
 var log = logging.MustGetLogger("honeytrap/server")
@@ -115,12 +139,32 @@ type Honeytrap struct {
 	// TODO(nl5887): rename to bus, should we encapsulate this?
 	bus *eventbus.EventBus
 
+	// events receives the events of all components, enriching them before
+	// they are sent on the bus.
+	events pushers.Channel
+
 	director director.Director
 
 	token string
 
 	dataDir string
 
+	// transcripts records the data of all connections, nil if disabled
+	transcripts *transcript.Store
+
+	// artifacts stores the files captured by the services, nil if disabled
+	artifacts *artifact.Store
+
+	// client downloads files for the scripters, through the egress of the
+	// fetcher
+	client *http.Client
+
+	// closers are the channels closed on Stop, after the bus delivered all
+	// queued events
+	closers []io.Closer
+
+	spools []*spool.Spool
+
 	// Maps a port and a protocol to an array of pointers to services
 	tcpPorts map[int][]*ServiceMap
 	udpPorts map[int][]*ServiceMap
@@ -142,6 +186,7 @@ func New(options ...OptionFn) (*Honeytrap, error) {
 		config:   conf,
 		director: director.MustDummy(),
 		bus:      bus,
+		events:   metricsChannel{bus},
 		profiler: profiler.Dummy(),
 	}
 
@@ -192,6 +237,16 @@ type ServiceMap struct {
  *         - If it implements CanHandle, peek the connection and pass the peeked
  *           data to CanHandle. If it returns true, pick it
  */
+// noServiceError is returned by findService if none of the services
+// configured for the port can handle the connection.
+type noServiceError struct {
+	payload []byte
+}
+
+func (e *noServiceError) Error() string {
+	return "No suitable service for the given port"
+}
+
 func (hc *Honeytrap) findService(conn net.Conn) (*ServiceMap, net.Conn, error) {
 	localAddr := conn.LocalAddr()
 	var port int
@@ -251,7 +306,42 @@ func (hc *Honeytrap) findService(conn net.Conn) (*ServiceMap, net.Conn, error) {
 	}
 	// There are some services for that port, but non can handle the connection.
 	// Let the caller deal with it.
-	return nil, nil, fmt.Errorf("No suitable service for the given port")
+	return nil, nil, &noServiceError{payload: buffer[:n]}
+}
+
+// aggregateChannelFunc returns a function wrapping a channel in an
+// aggregating channel configured by c.
+func aggregateChannelFunc(c *pushers.AggregateConfig) (func(pushers.Channel) pushers.Channel, error) {
+	if len(c.Keys) == 0 {
+		return nil, fmt.Errorf("keys not set")
+	}
+
+	window, err := time.ParseDuration(c.Window)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window: %s", err.Error())
+	}
+
+	var matchFn pushers.FilterFunc
+	if c.Match == "" {
+	} else if fn, err := pushers.ExpressionFilterFunc(c.Match); err != nil {
+		return nil, err
+	} else {
+		matchFn = fn
+	}
+
+	return func(channel pushers.Channel) pushers.Channel {
+		return pushers.AggregateChannel(channel, c.Keys, window, c.Fields, c.MaxValues, matchFn)
+	}, nil
+}
+
+// pruneTranscripts periodically removes the expired transcripts and recounts
+// their size, resuming recording once below the quota.
+func (hc *Honeytrap) pruneTranscripts() {
+	for range time.Tick(time.Hour) {
+		if err := hc.transcripts.Prune(); err != nil {
+			log.Errorf("Error pruning transcripts: %s", err.Error())
+		}
+	}
 }
 
 func (hc *Honeytrap) heartbeat() {
@@ -260,7 +350,7 @@ func (hc *Honeytrap) heartbeat() {
 	count := 0
 
 	for range beat {
-		hc.bus.Send(event.New(
+		hc.events.Send(event.New(
 			event.Sensor("honeytrap"),
 			event.Category("heartbeat"),
 			event.SeverityInfo,
@@ -337,14 +427,123 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 
 	log.Debugf("Using datadir: %s", hc.dataDir)
 
+	// initialize enrichers, in order of their names
+	enricherNames := []string{}
+	for key := range hc.config.Enrichers {
+		enricherNames = append(enricherNames, key)
+	}
+
+	sort.Strings(enricherNames)
+
+	enrichers := []enricher.Enricher{}
+	availableEnricherNames := enricher.GetAvailableEnricherNames()
+
+	for _, key := range enricherNames {
+		s := hc.config.Enrichers[key]
+
+		x := struct {
+			Type string `toml:"type"`
+		}{}
+
+		err := toml.PrimitiveDecode(s, &x)
+		if err != nil {
+			log.Error("Error parsing configuration of enricher: %s", err.Error())
+			continue
+		}
+
+		if x.Type == "" {
+			log.Error("Error parsing configuration of enricher %s: type not set", key)
+			continue
+		}
+
+		if enricherFunc, ok := enricher.Get(x.Type); !ok {
+			log.Error("Enricher type=%s not supported on platform (enricher=%s). Available enrichers: %s", x.Type, key, strings.Join(availableEnricherNames, ", "))
+		} else if e, err := enricherFunc(
+			enricher.WithConfig(s),
+		); err != nil {
+			log.Fatalf("Error initializing enricher %s(%s): %s", key, x.Type, err)
+		} else {
+			enrichers = append(enrichers, e)
+		}
+	}
+
+	if len(enrichers) > 0 {
+		enrichment := struct {
+			QueueSize int `toml:"queue_size"`
+		}{}
+
+		if err := toml.PrimitiveDecode(hc.config.Enrichment, &enrichment); err != nil {
+			log.Fatalf("Error parsing configuration of enrichment: %s", err.Error())
+		}
+
+		hc.events = enricher.Channel(metricsChannel{hc.bus}, enrichment.QueueSize, enrichers...)
+	}
+
+	if ts, err := transcript.New(
+		transcript.WithDataDir(hc.dataDir),
+		transcript.WithConfig(hc.config.Transcript),
+	); err != nil {
+		log.Fatalf("Error initializing transcripts: %s", err.Error())
+	} else if ts.Enabled {
+		if err := ts.Prune(); err != nil {
+			log.Errorf("Error pruning transcripts: %s", err.Error())
+		}
+
+		log.Infof("Recording transcripts in: %s", ts.Dir())
+		hc.transcripts = ts
+
+		go hc.pruneTranscripts()
+	}
+
+	if st, err := artifact.New(
+		artifact.WithDataDir(hc.dataDir),
+		artifact.WithConfig(hc.config.Artifacts),
+		artifact.WithChannel(hc.events),
+	); err != nil {
+		log.Fatalf("Error initializing artifacts: %s", err.Error())
+	} else if !st.Enabled {
+	} else if err := st.Load(); err != nil {
+		log.Fatalf("Error loading artifacts: %s", err.Error())
+	} else {
+		log.Infof("Storing artifacts in: %s", st.Dir())
+		hc.artifacts = st
+	}
+
 	go hc.heartbeat()
+	go hc.busStats()
 
 	hc.profiler.Start()
 
+	credentialStore, err := hc.credentials()
+	if err != nil {
+		log.Fatalf("Error initializing credentials: %s", err.Error())
+	}
+
+	if err := hc.fetcher(); err != nil {
+		log.Fatalf("Error initializing fetcher: %s", err.Error())
+	}
+
+	credentialsHandler := http.NotFoundHandler()
+	if credentialStore.Token == "" {
+		log.Warning("Credentials api disabled, no token configured")
+	} else {
+		credentialsHandler = credentials.Handler(credentialStore)
+	}
+
+	artifactHandler := http.NotFoundHandler()
+	if hc.artifacts == nil {
+	} else if hc.artifacts.Token == "" {
+		log.Warning("Artifact api disabled, no token configured")
+	} else {
+		artifactHandler = http.StripPrefix("/api/artifacts", artifact.Handler(hc.artifacts))
+	}
+
 	web, err := web.New(
 		web.WithEventBus(hc.bus),
 		web.WithDataDir(hc.dataDir),
 		web.WithConfig(hc.config.Web),
+		web.WithHandler("/api/credentials", credentialsHandler),
+		web.WithHandler("/api/artifacts/", artifactHandler),
 	)
 	if err != nil {
 		log.Error("Error parsing configuration of web: %s", err.Error())
@@ -353,11 +552,19 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 	web.Start()
 
 	channels := map[string]pushers.Channel{}
+	subscribeOptions := map[string][]eventbus.SubscribeOption{}
 	// sane defaults!
 
 	for key, s := range hc.config.Channels {
 		x := struct {
-			Type string `toml:"type"`
+			Type      string `toml:"type"`
+			QueueSize int    `toml:"queue_size"`
+			Overflow  string `toml:"overflow"`
+
+			Spool        string `toml:"spool"`
+			SpoolMaxSize int64  `toml:"spool_max_size"`
+
+			Transform *pushers.TransformConfig `toml:"transform"`
 		}{}
 
 		err := toml.PrimitiveDecode(s, &x)
@@ -371,6 +578,18 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 			continue
 		}
 
+		policy, err := eventbus.ParsePolicy(x.Overflow)
+		if err != nil {
+			log.Error("Error parsing configuration of channel %s: %s", key, err.Error())
+			continue
+		}
+
+		subscribeOptions[key] = []eventbus.SubscribeOption{
+			eventbus.WithName(key),
+			eventbus.WithQueueSize(x.QueueSize),
+			eventbus.WithOverflow(policy),
+		}
+
 		if channelFunc, ok := pushers.Get(x.Type); !ok {
 			log.Error("Channel %s not supported on platform (%s)", x.Type, key)
 		} else if d, err := channelFunc(
@@ -378,7 +597,26 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 		); err != nil {
 			log.Fatalf("Error initializing channel %s(%s): %s", key, x.Type, err)
 		} else {
-			channels[key] = d
+			if c, ok := d.(io.Closer); ok {
+				hc.closers = append(hc.closers, c)
+			}
+
+			if x.Spool != "" {
+				sp, err := hc.spool(key, d, x.Spool, x.SpoolMaxSize)
+				if err != nil {
+					log.Fatalf("Error initializing spool of channel %s: %s", key, err)
+				}
+
+				d = sp
+			}
+
+			if x.Transform == nil {
+				channels[key] = d
+			} else if d, err = pushers.TransformChannel(d, *x.Transform); err != nil {
+				log.Error("Error parsing transform configuration of channel %s: %s", key, err.Error())
+			} else {
+				channels[key] = d
+			}
 		}
 	}
 
@@ -387,6 +625,10 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 			Channels   []string `toml:"channel"`
 			Services   []string `toml:"services"`
 			Categories []string `toml:"categories"`
+			Expression string   `toml:"expression"`
+
+			Aggregate *pushers.AggregateConfig `toml:"aggregate"`
+			Transform *pushers.TransformConfig `toml:"transform"`
 		}{}
 
 		err := toml.PrimitiveDecode(s, &x)
@@ -395,6 +637,26 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 			continue
 		}
 
+		var expressionFn pushers.FilterFunc
+		if x.Expression == "" {
+		} else if fn, err := pushers.ExpressionFilterFunc(x.Expression); err != nil {
+			log.Error("Error parsing expression of filter: %s", err.Error())
+			continue
+		} else {
+			expressionFn = fn
+		}
+
+		var aggregateFn func(pushers.Channel) pushers.Channel
+		if x.Aggregate != nil {
+			fn, err := aggregateChannelFunc(x.Aggregate)
+			if err != nil {
+				log.Error("Error parsing aggregate configuration of filter: %s", err.Error())
+				continue
+			}
+
+			aggregateFn = fn
+		}
+
 		for _, name := range x.Channels {
 			channel, ok := channels[name]
 			if !ok {
@@ -404,6 +666,24 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 
 			channel = pushers.TokenChannel(channel, hc.token)
 
+			if aggregateFn != nil {
+				channel = aggregateFn(channel)
+
+				// deliver the pending summaries before the
+				// channels are closed
+				if c, ok := channel.(io.Closer); ok {
+					hc.closers = append([]io.Closer{c}, hc.closers...)
+				}
+			}
+
+			if x.Transform != nil {
+				channel, err = pushers.TransformChannel(channel, *x.Transform)
+				if err != nil {
+					log.Error("Error parsing transform configuration of filter: %s", err.Error())
+					continue
+				}
+			}
+
 			if len(x.Categories) != 0 {
 				channel = pushers.FilterChannel(channel, pushers.RegexFilterFunc("category", x.Categories))
 			}
@@ -412,12 +692,34 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 				channel = pushers.FilterChannel(channel, pushers.RegexFilterFunc("service", x.Services))
 			}
 
-			if err := hc.bus.Subscribe(channel); err != nil {
+			if expressionFn != nil {
+				channel = pushers.FilterChannel(channel, expressionFn)
+			}
+
+			if err := hc.bus.Subscribe(channel, subscribeOptions[name]...); err != nil {
 				log.Error("Could not add channel %s to bus: %s", name, err.Error())
 			}
 		}
 	}
 
+	if len(hc.config.Alerts) > 0 {
+		engine, err := alert.New(
+			alert.WithConfig(hc.config.Alerts...),
+			alert.WithChannel(hc.events),
+		)
+		if err != nil {
+			log.Fatalf("Error initializing alerts: %s", err.Error())
+		}
+
+		if err := hc.bus.Subscribe(engine, eventbus.WithName("alert")); err != nil {
+			log.Error("Could not add alerts to bus: %s", err.Error())
+		}
+
+		log.Infof("Evaluating %d alert rules", engine.Len())
+	}
+
+	go hc.spoolStats()
+
 	// initialize directors
 	directors := map[string]director.Director{}
 	availableDirectorNames := director.GetAvailableDirectorNames()
@@ -441,7 +743,7 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 		if directorFunc, ok := director.Get(x.Type); !ok {
 			log.Error("Director type=%s not supported on platform (director=%s). Available directors: %s", x.Type, key, strings.Join(availableDirectorNames, ", "))
 		} else if d, err := directorFunc(
-			director.WithChannel(hc.bus),
+			director.WithChannel(hc.events),
 			director.WithConfig(s),
 		); err != nil {
 			log.Fatalf("Error initializing director %s(%s): %s", key, x.Type, err)
@@ -481,8 +783,10 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 		} else if scr, err := scripterFunc(
 			key,
 			scripter.WithConfig(s),
-			scripter.WithChannel(hc.bus),
+			scripter.WithChannel(hc.events),
 			scripter.WithAbTester(ab),
+			scripter.WithArtifacts(hc.artifacts),
+			scripter.WithClient(hc.client),
 		); err != nil {
 			log.Fatalf("Error initializing scripter %s(%s): %s", key, x.Type, err)
 		} else {
@@ -542,8 +846,9 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 
 		// individual configuration per service
 		options := []services.ServicerFunc{
-			services.WithChannel(hc.bus),
+			services.WithChannel(hc.events),
 			services.WithConfig(s),
+			services.WithArtifacts(hc.artifacts),
 		}
 
 		if x.Director == "" {
@@ -585,7 +890,7 @@ func (hc *Honeytrap) Run(ctx context.Context) {
 	}
 
 	l, err := listenerFunc(
-		listener.WithChannel(hc.bus),
+		listener.WithChannel(hc.events),
 		listener.WithConfig(hc.config.Listener),
 	)
 	if err != nil {
@@ -749,6 +1054,14 @@ func (hc *Honeytrap) handle(conn net.Conn) {
 		}
 	}()
 
+	// every event of this connection carries the same session id
+	session := xid.New().String()
+	ctx := event.NewSessionContext(context.Background(), session)
+
+	if hc.transcripts != nil {
+		conn = hc.transcripts.Conn(session, conn)
+	}
+
 	defer conn.Close()
 
 	defer func() {
@@ -758,8 +1071,9 @@ func (hc *Honeytrap) handle(conn net.Conn) {
 				message = event.Message("%+v", err)
 			}
 
-			hc.bus.Send(event.New(
+			hc.events.Send(event.New(
 				event.SeverityFatal,
+				event.Session(ctx),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
 				event.Stack(),
@@ -771,23 +1085,79 @@ func (hc *Honeytrap) handle(conn net.Conn) {
 	log.Debug("Accepted connection for %s => %s", conn.RemoteAddr(), conn.LocalAddr())
 	defer log.Debug("Disconnected connection for %s => %s", conn.RemoteAddr(), conn.LocalAddr())
 
+	cConn := CountingConn(conn)
+
+	start := time.Now()
+
+	hc.events.Send(event.New(
+		event.ConnectionSensor,
+		event.ConnectionOpened,
+		event.Session(ctx),
+		event.Protocol(conn.LocalAddr().Network()),
+		event.SourceAddr(conn.RemoteAddr()),
+		event.DestinationAddr(conn.LocalAddr()),
+	))
+
+	// options of the closed event, appended to while handling
+	options := []event.Option{}
+
+	defer func() {
+		hc.events.Send(event.New(append([]event.Option{
+			event.ConnectionSensor,
+			event.ConnectionClosed,
+			event.Session(ctx),
+			event.Protocol(conn.LocalAddr().Network()),
+			event.SourceAddr(conn.RemoteAddr()),
+			event.DestinationAddr(conn.LocalAddr()),
+			event.Custom("connection.duration-ms", int64(time.Since(start)/time.Millisecond)),
+			event.Custom("connection.bytes-in", cConn.BytesIn()),
+			event.Custom("connection.bytes-out", cConn.BytesOut()),
+		}, options...)...))
+	}()
+
 	/* conn is the original connection. newConn can be either the same
 	 * connection, or a wrapper in the form of a PeekConnection.
 	 */
-	sm, newConn, err := hc.findService(conn)
+	protocol, port := addrLabels(conn.LocalAddr())
+
+	sm, newConn, err := hc.findService(cConn)
 	if sm == nil {
 		log.Debug("No suitable handler for %s => %s: %s", conn.RemoteAddr(), conn.LocalAddr(), err.Error())
+
+		connectionsTotal.Inc(protocol, port, "")
+		findServiceMisses.Inc(protocol, port)
+
+		options = append(options,
+			event.Custom("connection.find-service", "failed"),
+			event.Custom("connection.find-service-error", err.Error()),
+		)
+
+		if nse, ok := err.(*noServiceError); ok {
+			options = append(options, event.Payload(nse.payload))
+		}
+
 		return
 	}
 
+	connectionsTotal.Inc(protocol, port, sm.Name)
+
+	options = append(options,
+		event.Service(sm.Name),
+		event.Custom("connection.find-service", "matched"),
+		event.Custom("connection.service-type", sm.Type),
+	)
+
 	log.Debug("Handling connection for %s => %s %s(%s)", conn.RemoteAddr(), conn.LocalAddr(), sm.Name, sm.Type)
 
+	ctx = event.NewServiceContext(ctx, sm.Name)
+
 	//
 	// Call suitable Lua handling methods
 	//
-	ctx := context.Background()
 	if err := sm.Service.Handle(ctx, newConn); err != nil {
 		log.Errorf(color.RedString("Error handling service: %s: %s", sm.Name, err.Error()))
+
+		options = append(options, event.Custom("connection.error", err.Error()))
 	}
 }
 
@@ -795,5 +1165,19 @@ func (hc *Honeytrap) handle(conn net.Conn) {
 func (hc *Honeytrap) Stop() {
 	hc.profiler.Stop()
 
+	// enrich and deliver queued events before exiting
+	if c, ok := hc.events.(io.Closer); ok {
+		c.Close()
+	}
+
+	hc.bus.Close()
+
+	// flush and close the channels holding resources
+	for _, c := range hc.closers {
+		if err := c.Close(); err != nil {
+			log.Errorf("Error closing channel: %s", err.Error())
+		}
+	}
+
 	fmt.Println(color.YellowString("Honeytrap stopped."))
 }
@@ -0,0 +1,220 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+type recordingChannel chan event.Event
+
+func (c recordingChannel) Send(e event.Event) {
+	c <- e
+}
+
+// testService reads the request and writes the response, or only peeks when
+// it can't handle the connection.
+type testService struct {
+	canHandle bool
+	request   int
+	response  string
+	delay     time.Duration
+}
+
+func (s *testService) SetChannel(pushers.Channel) {
+}
+
+func (s *testService) CanHandle(payload []byte) bool {
+	return s.canHandle
+}
+
+func (s *testService) Handle(ctx context.Context, conn net.Conn) error {
+	buf := make([]byte, s.request)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+
+	time.Sleep(s.delay)
+
+	_, err := conn.Write([]byte(s.response))
+	return err
+}
+
+// handle accepts a connection on a port served by services, writes request
+// and returns the opened and closed events of the connection.
+func handle(t *testing.T, services []*testService, request string) (event.Event, event.Event) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ln.Close()
+
+	rc := make(recordingChannel, 10)
+
+	hc := &Honeytrap{
+		events:   rc,
+		tcpPorts: map[int][]*ServiceMap{},
+	}
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	for _, s := range services {
+		hc.tcpPorts[port] = append(hc.tcpPorts[port], &ServiceMap{
+			Service: s,
+			Name:    "test",
+			Type:    "test",
+		})
+	}
+
+	go func() {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		conn.Write([]byte(request))
+		io.Copy(ioutil.Discard, conn)
+	}()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc.handle(conn)
+
+	if len(rc) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(rc))
+	}
+
+	opened, closed := <-rc, <-rc
+
+	if v := opened.Get("type"); v != "CONNECTION:OPENED" {
+		t.Errorf("expected opened event, got %s", v)
+	}
+
+	if v := closed.Get("type"); v != "CONNECTION:CLOSED" {
+		t.Errorf("expected closed event, got %s", v)
+	}
+
+	if opened.Get("session-id") == "" || opened.Get("session-id") != closed.Get("session-id") {
+		t.Errorf("expected the events to share the session, got %q and %q", opened.Get("session-id"), closed.Get("session-id"))
+	}
+
+	return opened, closed
+}
+
+func TestHandleConnectionEvents(t *testing.T) {
+	_, closed := handle(t, []*testService{
+		{request: 5, response: "world!", delay: 20 * time.Millisecond},
+	}, "hello")
+
+	if v, _ := closed.Load("connection.bytes-in"); v != int64(5) {
+		t.Errorf("expected 5 bytes in, got %v", v)
+	}
+
+	if v, _ := closed.Load("connection.bytes-out"); v != int64(6) {
+		t.Errorf("expected 6 bytes out, got %v", v)
+	}
+
+	if v, _ := closed.Load("connection.duration-ms"); v.(int64) < 20 {
+		t.Errorf("expected a duration of at least 20ms, got %v", v)
+	}
+
+	if v := closed.Get("connection.find-service"); v != "matched" {
+		t.Errorf("expected find-service matched, got %s", v)
+	}
+
+	if v := closed.Get("service"); v != "test" {
+		t.Errorf("expected service test, got %s", v)
+	}
+}
+
+func TestHandleConnectionEventsPeeked(t *testing.T) {
+	_, closed := handle(t, []*testService{
+		{canHandle: false},
+		{canHandle: true, request: 5, response: "world"},
+	}, "hello")
+
+	// the peeked bytes are counted once
+	if v, _ := closed.Load("connection.bytes-in"); v != int64(5) {
+		t.Errorf("expected 5 bytes in, got %v", v)
+	}
+
+	if v, _ := closed.Load("connection.bytes-out"); v != int64(5) {
+		t.Errorf("expected 5 bytes out, got %v", v)
+	}
+}
+
+func TestHandleConnectionEventsNoService(t *testing.T) {
+	_, closed := handle(t, []*testService{
+		{canHandle: false},
+		{canHandle: false},
+	}, "hello")
+
+	if v := closed.Get("connection.find-service"); v != "failed" {
+		t.Errorf("expected find-service failed, got %s", v)
+	}
+
+	if v := closed.Get("connection.find-service-error"); v != (&noServiceError{}).Error() {
+		t.Errorf("expected no service error, got %s", v)
+	}
+
+	if v := closed.Get("payload"); v != "hello" {
+		t.Errorf("expected the peeked payload, got %q", v)
+	}
+
+	if v, _ := closed.Load("connection.bytes-in"); v != int64(5) {
+		t.Errorf("expected 5 bytes in, got %v", v)
+	}
+}
+
+func TestHandleConnectionEventsNoPort(t *testing.T) {
+	_, closed := handle(t, nil, "hello")
+
+	if v := closed.Get("connection.find-service-error"); v != "no services for the given port" {
+		t.Errorf("expected no services error, got %s", v)
+	}
+
+	if closed.Has("payload") {
+		t.Errorf("expected no payload, got %q", closed.Get("payload"))
+	}
+}
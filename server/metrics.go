@@ -0,0 +1,93 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package server
+
+import (
+	"net"
+	"strings"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/metrics"
+	"github.com/honeytrap/honeytrap/pushers"
+)
+
+var (
+	connectionsTotal = metrics.NewCounterVec(
+		"honeytrap_connections_total",
+		"Number of connections, per port and service.",
+		"protocol", "port", "service",
+	)
+
+	findServiceMisses = metrics.NewCounterVec(
+		"honeytrap_find_service_misses_total",
+		"Number of connections without a service that could handle them.",
+		"protocol", "port",
+	)
+
+	eventsTotal = metrics.NewCounterVec(
+		"honeytrap_events_total",
+		"Number of events, per category and type.",
+		"category", "type",
+	)
+
+	authAttemptsTotal = metrics.NewCounterVec(
+		"honeytrap_auth_attempts_total",
+		"Number of authentication attempts, per service.",
+		"service", "type",
+	)
+)
+
+// addrLabels returns the protocol and port labels of the address.
+func addrLabels(addr net.Addr) (string, string) {
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		port = ""
+	}
+
+	return addr.Network(), port
+}
+
+// metricsChannel counts the events sent through it.
+type metricsChannel struct {
+	pushers.Channel
+}
+
+func (mc metricsChannel) Send(e event.Event) {
+	category, typ := e.Get("category"), e.Get("type")
+
+	eventsTotal.Inc(category, typ)
+
+	if strings.HasSuffix(typ, "-authentication") {
+		authAttemptsTotal.Inc(e.Get("service"), typ)
+	}
+
+	mc.Channel.Send(e)
+}
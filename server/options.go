@@ -91,18 +91,23 @@ func WithRemoteConfig(s string) (OptionFn, error) {
 	}, nil
 }
 
-func WithDataDir(s string) (OptionFn, error) {
-	var err error
-
+// DataDir returns the absolute path of data directory s, expanding ~ to the
+// home directory of the current user.
+func DataDir(s string) (string, error) {
 	p, err := expand(s)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	p, err = filepath.Abs(p)
+	return filepath.Abs(p)
+}
+
+func WithDataDir(s string) (OptionFn, error) {
+	p, err := DataDir(s)
 	if err != nil {
 		return nil, err
 	}
+
 	_, err = os.Stat(p)
 	if err != nil {
 		if os.IsNotExist(err) {
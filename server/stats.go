@@ -30,4 +30,83 @@
  */
 package server
 
-// logging "github.com/op/go-logging"
+import (
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/pushers"
+	"github.com/honeytrap/honeytrap/pushers/spool"
+)
+
+// busStats periodically sends the counters of every bus subscriber as
+// operational events.
+func (hc *Honeytrap) busStats() {
+	for range time.Tick(60 * time.Second) {
+		for _, stats := range hc.bus.Stats() {
+			hc.events.Send(event.New(
+				event.Sensor("honeytrap"),
+				event.Category("eventbus"),
+				event.Operational,
+				event.Custom("eventbus.channel", stats.Name),
+				event.Custom("eventbus.enqueued", stats.Enqueued),
+				event.Custom("eventbus.dropped", stats.Dropped),
+				event.Custom("eventbus.delivered", stats.Delivered),
+				event.Custom("eventbus.queued", stats.Queued),
+				event.Custom("eventbus.latency-avg-ms", stats.LatencyAvg.Seconds()*1000),
+				event.Custom("eventbus.latency-max-ms", stats.LatencyMax.Seconds()*1000),
+			))
+		}
+	}
+}
+
+// spool wraps the channel in a spool in dir, relative to the data directory.
+// The spool is closed before the channel, spooling the events still queued.
+func (hc *Honeytrap) spool(name string, channel pushers.Channel, dir string, maxSize int64) (*spool.Spool, error) {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(hc.dataDir, dir)
+	}
+
+	options := []spool.Option{
+		spool.WithName(name),
+	}
+
+	if maxSize != 0 {
+		options = append(options, spool.WithMaxSize(maxSize))
+	}
+
+	sp, err := spool.New(channel, dir, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	hc.spools = append(hc.spools, sp)
+	hc.closers = append([]io.Closer{sp}, hc.closers...)
+	return sp, nil
+}
+
+// spoolStats periodically sends the depth of every spool as operational
+// events.
+func (hc *Honeytrap) spoolStats() {
+	if len(hc.spools) == 0 {
+		return
+	}
+
+	for range time.Tick(60 * time.Second) {
+		for _, sp := range hc.spools {
+			stats := sp.Stats()
+
+			hc.events.Send(event.New(
+				event.Sensor("honeytrap"),
+				event.Category("spool"),
+				event.Operational,
+				event.Custom("spool.channel", stats.Name),
+				event.Custom("spool.depth", stats.Depth),
+				event.Custom("spool.size", stats.Size),
+				event.Custom("spool.dropped", stats.Dropped),
+				event.Custom("spool.spooling", stats.Spooling),
+			))
+		}
+	}
+}
@@ -73,14 +73,14 @@ func (s *copyService) Handle(ctx context.Context, conn net.Conn) error {
 	switch conn.(type) {
 	case *listener.DummyUDPConn:
 		defer s.c.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("copy"),
 			event.Type("tcp"),
 			event.SourceAddr(conn.RemoteAddr()),
 			event.DestinationAddr(conn.LocalAddr()),
 		))
 
-		conn2, err := s.d.Dial(conn)
+		conn2, err := s.d.Dial(ctx, conn)
 		if err != nil {
 			return err
 		}
@@ -93,14 +93,14 @@ func (s *copyService) Handle(ctx context.Context, conn net.Conn) error {
 		return err
 	case *net.TCPConn:
 		defer s.c.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("copy"),
 			event.Type("udp"),
 			event.SourceAddr(conn.RemoteAddr()),
 			event.DestinationAddr(conn.LocalAddr()),
 		))
 
-		conn2, err := s.d.Dial(conn)
+		conn2, err := s.d.Dial(ctx, conn)
 		if err != nil {
 			return err
 		}
@@ -125,7 +125,7 @@ func (s *counterStrikeService) Handle(ctx context.Context, conn net.Conn) error
 		payload := string(buf[5:])
 
 		s.ch.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("counterstrike"),
 			event.Protocol(conn.RemoteAddr().Network()),
 			event.Type("request"),
@@ -139,7 +139,7 @@ func (s *counterStrikeService) Handle(ctx context.Context, conn net.Conn) error
 	} else if query == COUNTERSTRIKE_A2S_PLAYER {
 		// Challenge number
 		s.ch.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("counterstrike"),
 			event.Protocol(conn.RemoteAddr().Network()),
 			event.Type("request"),
@@ -151,7 +151,7 @@ func (s *counterStrikeService) Handle(ctx context.Context, conn net.Conn) error
 
 	} else if query == COUNTERSTRIKE_A2S_RULES {
 		s.ch.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("counterstrike"),
 			event.Protocol(conn.RemoteAddr().Network()),
 			event.Type("request"),
@@ -163,7 +163,7 @@ func (s *counterStrikeService) Handle(ctx context.Context, conn net.Conn) error
 
 	} else if query == COUNTERSTRIKE_A2S_SERVERQUERY_GETCHALLENGE {
 		s.ch.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("counterstrike"),
 			event.Protocol(conn.RemoteAddr().Network()),
 			event.Type("request"),
@@ -175,7 +175,7 @@ func (s *counterStrikeService) Handle(ctx context.Context, conn net.Conn) error
 
 	} else if query == COUNTERSTRIKE_A2A_PING {
 		s.ch.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("counterstrike"),
 			event.Protocol(conn.RemoteAddr().Network()),
 			event.Type("request"),
@@ -152,7 +152,7 @@ func (s *cwmpService) Handle(ctx context.Context, conn net.Conn) error {
 			msg, err := parseXML([]byte(requestBody))
 			// Send the event even if an error occurs; error out only later
 			s.c.Send(event.New(
-				EventOptions,
+				EventOptions(ctx),
 				event.Category("cwmp"),
 				event.Type("request"),
 				event.SourceAddr(conn.RemoteAddr()),
@@ -80,7 +80,7 @@ func (s *dnsProxy) Handle(ctx context.Context, conn net.Conn) error {
 			return err
 		}
 
-		conn2, err := s.d.Dial(conn)
+		conn2, err := s.d.Dial(ctx, conn)
 		if err != nil {
 			return err
 		}
@@ -97,7 +97,7 @@ func (s *dnsProxy) Handle(ctx context.Context, conn net.Conn) error {
 		}
 
 		s.c.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("dns-proxy"),
 			event.Type("dns"),
 			event.Protocol(conn.RemoteAddr().Network()),
@@ -130,7 +130,7 @@ func (s *dnsProxy) Handle(ctx context.Context, conn net.Conn) error {
 		}
 
 		s.c.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("dns-proxy"),
 			event.Type("dns"),
 			event.Protocol(conn.RemoteAddr().Network()),
@@ -142,7 +142,7 @@ func (s *dnsProxy) Handle(ctx context.Context, conn net.Conn) error {
 			event.Custom("dns.questions", req.Question),
 		))
 
-		conn2, err := s.d.Dial(conn)
+		conn2, err := s.d.Dial(ctx, conn)
 		if err != nil {
 			return err
 		}
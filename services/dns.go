@@ -94,7 +94,7 @@ func (s *dnsService) Handle(ctx context.Context, conn net.Conn) error {
 	}
 
 	s.c.Send(event.New(
-		EventOptions,
+		EventOptions(ctx),
 		event.Category("dns"),
 		event.Type("dns"),
 		event.SourceAddr(conn.RemoteAddr()),
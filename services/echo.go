@@ -76,7 +76,7 @@ func (s *echoService) Handle(ctx context.Context, conn net.Conn) error {
 		return err
 	}
 	s.c.Send(event.New(
-		EventOptions,
+		EventOptions(ctx),
 		event.Category("echo"),
 		event.SourceAddr(conn.RemoteAddr()),
 		event.DestinationAddr(conn.LocalAddr()),
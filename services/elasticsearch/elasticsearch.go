@@ -116,7 +116,7 @@ func (s *service) Handle(ctx context.Context, conn net.Conn) error {
 	io.Copy(ioutil.Discard, req.Body)
 
 	s.c.Send(event.New(
-		services.EventOptions,
+		services.EventOptions(ctx),
 		event.Category("elasticsearch"),
 		event.Type("request"),
 		event.SourceAddr(conn.RemoteAddr()),
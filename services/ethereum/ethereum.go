@@ -216,7 +216,7 @@ func (s *ethereumService) Handle(ctx context.Context, conn net.Conn) error {
 	}
 
 	s.c.Send(event.New(
-		services.EventOptions,
+		services.EventOptions(ctx),
 		event.Category("ethereum"),
 		event.Type(method),
 		event.SourceAddr(conn.RemoteAddr()),
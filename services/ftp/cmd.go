@@ -981,7 +981,11 @@ func (cmd commandStor) Execute(conn *Conn, param string) {
 		conn.appendData = false
 	}()
 
-	bytes, err := conn.driver.PutFile(param, conn.dataConn, conn.appendData)
+	data, done := conn.upload(param, conn.dataConn)
+
+	bytes, err := conn.driver.PutFile(param, data, conn.appendData)
+	done(err)
+
 	if err == nil {
 		msg := "OK, received " + strconv.Itoa(int(bytes)) + " bytes"
 		conn.writeMessage(226, msg)
@@ -2,6 +2,7 @@ package ftp
 
 import (
 	"bufio"
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/tls"
@@ -12,6 +13,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/honeytrap/honeytrap/artifact"
+
 	mrand "math/rand"
 )
 
@@ -39,6 +42,30 @@ type Conn struct {
 	closed        bool
 	tls           bool
 	rcv           chan string
+	ctx           context.Context
+	artifacts     *artifact.Store
+}
+
+// upload returns data, capturing the uploaded file as artifact. The returned
+// function commits the artifact when the upload succeeded.
+func (conn *Conn) upload(filename string, data io.Reader) (io.Reader, func(error)) {
+	if conn.artifacts == nil {
+		return data, func(error) {}
+	}
+
+	w, err := conn.artifacts.NewWriter(artifact.NewSource(conn.ctx, "ftp", conn.conn.RemoteAddr(), filename))
+	if err != nil {
+		log.Errorf("Error capturing artifact: %s", err.Error())
+		return data, func(error) {}
+	}
+
+	return io.TeeReader(data, w), func(err error) {
+		if err != nil {
+			w.Discard()
+		} else if _, err := w.Commit(); err != nil {
+			log.Errorf("Error storing artifact: %s", err.Error())
+		}
+	}
 }
 
 func (conn *Conn) LoginUser() string {
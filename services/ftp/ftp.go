@@ -5,6 +5,7 @@ import (
 	"net"
 	"strings"
 
+	"github.com/honeytrap/honeytrap/artifact"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/honeytrap/honeytrap/services"
@@ -94,20 +95,28 @@ type ftpService struct {
 	recv chan string
 
 	c pushers.Channel
+
+	artifacts *artifact.Store
 }
 
 func (s *ftpService) SetChannel(c pushers.Channel) {
 	s.c = c
 }
 
+func (s *ftpService) SetArtifacts(st *artifact.Store) {
+	s.artifacts = st
+}
+
 func (s *ftpService) Handle(ctx context.Context, conn net.Conn) error {
 
 	ftpConn := s.server.newConn(conn, s.driver, s.recv)
+	ftpConn.ctx = ctx
+	ftpConn.artifacts = s.artifacts
 
 	go func() {
 		for msg := range s.recv {
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ftp"),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
@@ -83,7 +83,7 @@ func (s *genericService) Handle(ctx context.Context, conn net.Conn) error {
 	if s.scr == nil {
 		return fmt.Errorf("%s","undefined scripter")
 	}
-	connW := s.scr.GetConnection("generic", pConn)
+	connW := s.scr.GetConnection(ctx, "generic", pConn)
 
 	s.setMethods(connW)
 
@@ -76,7 +76,7 @@ func (s *httpProxy) SetChannel(c pushers.Channel) {
 func (s *httpProxy) Handle(ctx context.Context, conn net.Conn) error {
 	defer conn.Close()
 
-	conn2, err := s.d.Dial(conn)
+	conn2, err := s.d.Dial(ctx, conn)
 	if err != nil {
 		return err
 	}
@@ -151,7 +151,7 @@ func (s *httpService) Handle(ctx context.Context, conn net.Conn) error {
 			return err
 		}
 
-		sConn := s.scr.GetConnection("http", conn)
+		sConn := s.scr.GetConnection(ctx, "http", conn)
 		sConn.SetStringFunction("getRequestURL", func() string { return req.URL.String() })
 		sConn.SetStringFunction("getRequestMethod", func() string { return req.Method })
 
@@ -165,7 +165,7 @@ func (s *httpService) Handle(ctx context.Context, conn net.Conn) error {
 		io.Copy(ioutil.Discard, req.Body)
 
 		s.c.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("http"),
 			event.Type("request"),
 			event.SourceAddr(conn.RemoteAddr()),
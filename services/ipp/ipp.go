@@ -32,6 +32,7 @@ package ipp
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -41,6 +42,7 @@ import (
 	"path"
 	"time"
 
+	"github.com/honeytrap/honeytrap/artifact"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/honeytrap/honeytrap/services"
@@ -85,12 +87,18 @@ type ippService struct {
 	Config
 
 	ch pushers.Channel
+
+	artifacts *artifact.Store
 }
 
 func (s *ippService) SetChannel(c pushers.Channel) {
 	s.ch = c
 }
 
+func (s *ippService) SetArtifacts(st *artifact.Store) {
+	s.artifacts = st
+}
+
 func (s *ippService) Handle(ctx context.Context, conn net.Conn) error {
 
 	br := bufio.NewReader(conn)
@@ -128,10 +136,19 @@ func (s *ippService) Handle(ctx context.Context, conn net.Conn) error {
 
 	if len(ippResp.data) == 0 {
 		// no print data
-	} else if s.StorageDir == "" {
-		// no storage location
 	} else if len(ippResp.data) > s.SizeLimit {
 		log.Debug("Data exceeds size limit")
+	} else if s.artifacts != nil {
+		a, err := s.artifacts.Put(bytes.NewReader(ippResp.data), artifact.NewSource(
+			ctx, "ipp", conn.RemoteAddr(), string(ippResp.jobname),
+		))
+		if err != nil {
+			log.Errorf("Error storing print data: %s", err.Error())
+		} else {
+			ippResp.data = []byte("Print data stored as artifact " + a.SHA256)
+		}
+	} else if s.StorageDir == "" {
+		// no storage location
 	} else {
 		ext := ""
 
@@ -153,7 +170,7 @@ func (s *ippService) Handle(ctx context.Context, conn net.Conn) error {
 	}
 
 	s.ch.Send(event.New(
-		services.EventOptions,
+		services.EventOptions(ctx),
 		event.Category("ipp"),
 		event.Type("request"),
 		event.SourceAddr(conn.RemoteAddr()),
@@ -96,7 +96,7 @@ func (s *memcachedService) Handle(ctx context.Context, conn net.Conn) error {
 		}
 
 		s.ch.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("memcached"),
 			event.Protocol(conn.RemoteAddr().Network()),
 			event.Type("memcached-command"),
@@ -210,7 +210,7 @@ END\r\n
 			b.Discard(count)
 
 			s.ch.Send(event.New(
-				EventOptions,
+				EventOptions(ctx),
 				event.Category("memcached"),
 				event.Protocol(conn.RemoteAddr().Network()),
 				event.Type(fmt.Sprintf("memcached-%s", string(parts[0]))),
@@ -166,13 +166,22 @@ func (s *redisService) Handle(ctx context.Context, conn net.Conn) error {
 		}
 		answer, closeConn := s.REDISHandler(command, items[1:])
 
+		args := []string{}
+		for _, item := range items[1:] {
+			if datum, ok := item.(redisDatum); !ok {
+			} else if arg, ok := datum.ToString(); ok {
+				args = append(args, arg)
+			}
+		}
+
 		s.ch.Send(event.New(
-			services.EventOptions,
+			services.EventOptions(ctx),
 			event.Category("redis"),
 			event.Type("redis-command"),
 			event.SourceAddr(conn.RemoteAddr()),
 			event.DestinationAddr(conn.LocalAddr()),
 			event.Custom("redis.command", command),
+			event.Custom("redis.args", args),
 		))
 
 		if closeConn {
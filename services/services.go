@@ -35,12 +35,14 @@ import (
 	"net"
 
 	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/artifact"
 	"github.com/honeytrap/honeytrap/director"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 
 	logging "github.com/op/go-logging"
 	"github.com/honeytrap/honeytrap/scripter"
+	"github.com/rs/xid"
 )
 
 var log = logging.MustGetLogger("services")
@@ -106,6 +108,21 @@ func WithDirector(d director.Director) ServicerFunc {
 	}
 }
 
+// Artifacter is implemented by services capturing files.
+type Artifacter interface {
+	SetArtifacts(*artifact.Store)
+}
+
+// WithArtifacts sets the store of the files captured by the service.
+func WithArtifacts(st *artifact.Store) ServicerFunc {
+	return func(s Servicer) error {
+		if a, ok := s.(Artifacter); ok {
+			a.SetArtifacts(st)
+		}
+		return nil
+	}
+}
+
 func WithConfig(c toml.Primitive) ServicerFunc {
 	return func(s Servicer) error {
 		err := toml.PrimitiveDecode(c, s)
@@ -124,11 +141,27 @@ func WithScripter(service string, scr scripter.Scripter) ServicerFunc {
 
 var (
 	SensorLow = event.Sensor("services")
+)
+
+// SessionID returns the session id carried by ctx, or a new one if ctx
+// carries none.
+func SessionID(ctx context.Context) string {
+	if id, ok := event.SessionFromContext(ctx); ok {
+		return id
+	}
 
-	EventOptions = event.NewWith(
+	return xid.New().String()
+}
+
+// EventOptions returns the options of all service events, including the
+// session id and service name carried by ctx.
+func EventOptions(ctx context.Context) event.Option {
+	return event.NewWith(
 		SensorLow,
+		event.Session(ctx),
+		event.ContextService(ctx),
 	)
-)
+}
 
 /*
 
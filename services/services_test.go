@@ -0,0 +1,62 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/honeytrap/honeytrap/event"
+)
+
+func TestEventOptionsSession(t *testing.T) {
+	ctx := event.NewSessionContext(context.Background(), "b9r5ef2tjkgg00e1uu8g")
+
+	e := event.New(EventOptions(ctx))
+	if got := e.Get("session-id"); got != "b9r5ef2tjkgg00e1uu8g" {
+		t.Errorf("Test failed: got %+#v, expected %+#v", got, "b9r5ef2tjkgg00e1uu8g")
+	}
+
+	if got := SessionID(ctx); got != "b9r5ef2tjkgg00e1uu8g" {
+		t.Errorf("Test failed: got %+#v, expected %+#v", got, "b9r5ef2tjkgg00e1uu8g")
+	}
+}
+
+func TestEventOptionsWithoutSession(t *testing.T) {
+	e := event.New(EventOptions(context.Background()))
+	if _, ok := e.Load("session-id"); ok {
+		t.Errorf("Test failed: unexpected session-id")
+	}
+
+	if got := SessionID(context.Background()); got == "" {
+		t.Errorf("Test failed: expected a new session id")
+	}
+}
@@ -0,0 +1,118 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package smtp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+)
+
+// maxDepth is the maximum nesting of multipart messages.
+const maxDepth = 8
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Filename string
+	Data     []byte
+}
+
+// Attachments returns the attachments of the message, the parts of a
+// multipart message with a filename or an attachment disposition.
+func (m *Message) Attachments() []Attachment {
+	if m.Header == nil || m.Body == nil {
+		return nil
+	}
+
+	return attachments(textproto.MIMEHeader(m.Header), bytes.NewReader(m.Body.Bytes()), 0)
+}
+
+func attachments(header textproto.MIMEHeader, r io.Reader, depth int) []Attachment {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || depth > maxDepth {
+		return nil
+	}
+
+	result := []Attachment{}
+
+	mr := multipart.NewReader(r, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			// io.EOF or a malformed message
+			return result
+		}
+
+		if nested := attachments(part.Header, part, depth+1); len(nested) > 0 {
+			result = append(result, nested...)
+			continue
+		}
+
+		disposition, dparams, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+
+		filename := dparams["filename"]
+		if filename == "" {
+			_, cparams, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			filename = cparams["name"]
+		}
+
+		if disposition != "attachment" && filename == "" {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(decode(part.Header.Get("Content-Transfer-Encoding"), part))
+		if err != nil || len(data) == 0 {
+			continue
+		}
+
+		result = append(result, Attachment{
+			Filename: filename,
+			Data:     data,
+		})
+	}
+}
+
+func decode(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
@@ -0,0 +1,93 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package smtp
+
+import (
+	"strings"
+	"testing"
+)
+
+const multipartMessage = "From: sender@testing.com\r\n" +
+	"To: recipient@example.net\r\n" +
+	"Subject: invoice\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Please see the attached invoice.\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/octet-stream; name=\"invoice.exe\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice.exe\"\r\n" +
+	"\r\n" +
+	"TVqQAAMAAAAE\r\n" +
+	"AAAA//8AAA==\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"caf=C3=A9\r\n" +
+	"--outer--\r\n"
+
+func TestAttachments(t *testing.T) {
+	m := Message{}
+	if err := m.Read(strings.NewReader(multipartMessage)); err != nil {
+		t.Fatal(err)
+	}
+
+	attachments := m.Attachments()
+	if len(attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(attachments))
+	}
+
+	if a := attachments[0]; a.Filename != "invoice.exe" || string(a.Data) != "MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff\x00\x00" {
+		t.Errorf("unexpected attachment %s %q", a.Filename, a.Data)
+	}
+
+	if a := attachments[1]; a.Filename != "notes.txt" || string(a.Data) != "café" {
+		t.Errorf("unexpected attachment %s %q", a.Filename, a.Data)
+	}
+
+	m = Message{}
+	if err := m.Read(strings.NewReader(body)); err != nil {
+		t.Fatal(err)
+	}
+
+	if attachments := m.Attachments(); len(attachments) != 0 {
+		t.Errorf("expected no attachments, got %d", len(attachments))
+	}
+}
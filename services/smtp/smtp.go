@@ -31,9 +31,11 @@
 package smtp
 
 import (
+	"bytes"
 	"context"
 	"net"
 
+	"github.com/honeytrap/honeytrap/artifact"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 	"github.com/honeytrap/honeytrap/services"
@@ -101,12 +103,33 @@ type Service struct {
 	Config
 
 	ch pushers.Channel
+
+	artifacts *artifact.Store
 }
 
 func (s *Service) SetChannel(c pushers.Channel) {
 	s.ch = c
 }
 
+func (s *Service) SetArtifacts(st *artifact.Store) {
+	s.artifacts = st
+}
+
+// storeAttachments stores the attachments of the message as artifacts.
+func (s *Service) storeAttachments(ctx context.Context, conn net.Conn, message Message) {
+	if s.artifacts == nil {
+		return
+	}
+
+	for _, a := range message.Attachments() {
+		if _, err := s.artifacts.Put(bytes.NewReader(a.Data), artifact.NewSource(
+			ctx, "smtp", conn.RemoteAddr(), a.Filename,
+		)); err != nil {
+			log.Errorf("Error storing attachment %s: %s", a.Filename, err.Error())
+		}
+	}
+}
+
 func (s *Service) Handle(ctx context.Context, conn net.Conn) error {
 
 	rcvLine := make(chan string)
@@ -118,7 +141,7 @@ func (s *Service) Handle(ctx context.Context, conn net.Conn) error {
 			case message := <-s.receiveChan:
 				log.Debug("Message Received")
 				s.ch.Send(event.New(
-					services.EventOptions,
+					services.EventOptions(ctx),
 					event.Category("smtp"),
 					event.Type("email"),
 					event.SourceAddr(conn.RemoteAddr()),
@@ -127,9 +150,11 @@ func (s *Service) Handle(ctx context.Context, conn net.Conn) error {
 					event.Custom("smtp.to", message.To),
 					event.Custom("smtp.body", message.Body.String()),
 				))
+
+				s.storeAttachments(ctx, conn, message)
 			case line := <-rcvLine:
 				s.ch.Send(event.New(
-					services.EventOptions,
+					services.EventOptions(ctx),
 					event.Category("smtp"),
 					event.Type("input"),
 					event.SourceAddr(conn.RemoteAddr()),
@@ -88,7 +88,7 @@ func (s *sshAuthService) Handle(ctx context.Context, conn net.Conn) error {
 		ServerVersion: s.Banner,
 		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("publickey-authentication"),
 				event.SourceAddr(conn.RemoteAddr()),
@@ -101,7 +101,7 @@ func (s *sshAuthService) Handle(ctx context.Context, conn net.Conn) error {
 		},
 		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("password-authentication"),
 				event.SourceAddr(conn.RemoteAddr()),
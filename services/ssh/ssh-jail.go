@@ -51,7 +51,6 @@ import (
 
 	"io/ioutil"
 
-	"github.com/rs/xid"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/terminal"
 )
@@ -103,18 +102,18 @@ func (s *sshJailService) SetChannel(c pushers.Channel) {
 }
 
 func (s *sshJailService) Handle(ctx context.Context, conn net.Conn) error {
-	id := xid.New()
+	id := services.SessionID(ctx)
 
 	config := ssh.ServerConfig{
 		ServerVersion: s.Banner,
 		PublicKeyCallback: func(cm ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("publickey-authentication"),
 				event.SourceAddr(cm.RemoteAddr()),
 				event.DestinationAddr(cm.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.username", cm.User()),
 				event.Custom("ssh.publickey-type", key.Type()),
 				event.Custom("ssh.publickey", hex.EncodeToString(key.Marshal())),
@@ -124,12 +123,12 @@ func (s *sshJailService) Handle(ctx context.Context, conn net.Conn) error {
 		},
 		PasswordCallback: func(cm ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("password-authentication"),
 				event.SourceAddr(cm.RemoteAddr()),
 				event.DestinationAddr(cm.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.username", cm.User()),
 				event.Custom("ssh.password", string(password)),
 			))
@@ -181,12 +180,12 @@ func (s *sshJailService) Handle(ctx context.Context, conn net.Conn) error {
 			decoder := PayloadDecoder(newChannel.ExtraData())
 
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("ssh-channel"),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.channel-type", newChannel.ChannelType()),
 				event.Custom("ssh.forwarded-tcpip.address-that-was-connected", decoder.String()),
 				event.Custom("ssh.forwarded-tcpip.port-that-was-connected", fmt.Sprintf("%d", decoder.Uint32())),
@@ -210,12 +209,12 @@ func (s *sshJailService) Handle(ctx context.Context, conn net.Conn) error {
 			}
 
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("ssh-channel"),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.channel-type", newChannel.ChannelType()),
 				event.Custom("ssh.forwarded-tcpip.address-that-was-connected", decoder.String()),
 				event.Custom("ssh.forwarded-tcpip.port-that-was-connected", fmt.Sprintf("%d", decoder.Uint32())),
@@ -229,12 +228,12 @@ func (s *sshJailService) Handle(ctx context.Context, conn net.Conn) error {
 			decoder := PayloadDecoder(newChannel.ExtraData())
 
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("ssh-channel"),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.channel-type", newChannel.ChannelType()),
 				event.Custom("ssh.direct-tcpip.host-to-connect", decoder.String()),
 				event.Custom("ssh.direct-tcpip.port-to-connect", fmt.Sprintf("%d", decoder.Uint32())),
@@ -257,12 +256,12 @@ func (s *sshJailService) Handle(ctx context.Context, conn net.Conn) error {
 			}
 
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("ssh-channel"),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.channel-type", newChannel.ChannelType()),
 				event.Custom("ssh.direct-tcpip.host-to-connect", decoder.String()),
 				event.Custom("ssh.direct-tcpip.port-to-connect", fmt.Sprintf("%d", decoder.Uint32())),
@@ -274,12 +273,12 @@ func (s *sshJailService) Handle(ctx context.Context, conn net.Conn) error {
 			continue
 		default:
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("ssh-channel"),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.channel-type", newChannel.ChannelType()),
 				event.Payload(newChannel.ExtraData()),
 			))
@@ -299,12 +298,12 @@ func (s *sshJailService) Handle(ctx context.Context, conn net.Conn) error {
 
 		func() {
 			options := []event.Option{
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("ssh-request"),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 			}
 
 			defer s.c.Send(event.New(
@@ -442,12 +441,12 @@ func (s *sshJailService) Handle(ctx context.Context, conn net.Conn) error {
 							}
 
 							s.c.Send(event.New(
-								services.EventOptions,
+								services.EventOptions(ctx),
 								event.Category("ssh"),
 								event.Type("shell"),
 								event.SourceAddr(conn.RemoteAddr()),
 								event.DestinationAddr(conn.LocalAddr()),
-								event.Custom("ssh.sessionid", id.String()),
+								event.Custom("ssh.sessionid", id),
 								event.Custom("ssh.command", line),
 							))
 
@@ -514,12 +513,12 @@ func (s *sshJailService) Handle(ctx context.Context, conn net.Conn) error {
 							}()
 
 							options2 := []event.Option{
-								services.EventOptions,
+								services.EventOptions(ctx),
 								event.Category("ssh"),
 								event.Type("exec"),
 								event.SourceAddr(conn.RemoteAddr()),
 								event.DestinationAddr(conn.LocalAddr()),
-								event.Custom("ssh.sessionid", id.String()),
+								event.Custom("ssh.sessionid", id),
 								event.Custom("ssh.command", payload),
 							}
 
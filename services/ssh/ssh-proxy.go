@@ -44,7 +44,6 @@ import (
 
 	"encoding/base64"
 
-	"github.com/rs/xid"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -91,7 +90,7 @@ func (s *sshProxyService) SetDirector(d director.Director) {
 }
 
 func (s *sshProxyService) Handle(ctx context.Context, conn net.Conn) error {
-	id := xid.New()
+	id := services.SessionID(ctx)
 
 	var client *ssh.Client
 
@@ -100,12 +99,12 @@ func (s *sshProxyService) Handle(ctx context.Context, conn net.Conn) error {
 		MaxAuthTries:  -1,
 		PublicKeyCallback: func(cm ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("publickey-authentication"),
 				event.SourceAddr(cm.RemoteAddr()),
 				event.DestinationAddr(cm.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.username", cm.User()),
 				event.Custom("ssh.publickey-type", key.Type()),
 				event.Custom("ssh.publickey", hex.EncodeToString(key.Marshal())),
@@ -115,12 +114,12 @@ func (s *sshProxyService) Handle(ctx context.Context, conn net.Conn) error {
 		},
 		PasswordCallback: func(cm ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("password-authentication"),
 				event.SourceAddr(cm.RemoteAddr()),
 				event.DestinationAddr(cm.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.username", cm.User()),
 				event.Custom("ssh.password", string(password)),
 			))
@@ -136,7 +135,7 @@ func (s *sshProxyService) Handle(ctx context.Context, conn net.Conn) error {
 				ssh.Password(string(password)),
 			}
 
-			cconn, err := s.d.Dial(conn)
+			cconn, err := s.d.Dial(ctx, conn)
 			if err != nil {
 				return nil, err
 			}
@@ -193,12 +192,12 @@ func (s *sshProxyService) Handle(ctx context.Context, conn net.Conn) error {
 		}
 
 		s.c.Send(event.New(
-			services.EventOptions,
+			services.EventOptions(ctx),
 			event.Category("ssh"),
 			event.Type("ssh-channel"),
 			event.SourceAddr(conn.RemoteAddr()),
 			event.DestinationAddr(conn.LocalAddr()),
-			event.Custom("ssh.sessionid", id.String()),
+			event.Custom("ssh.sessionid", id),
 			event.Custom("ssh.channel-type", newChannel.ChannelType()),
 		))
 
@@ -217,12 +216,12 @@ func (s *sshProxyService) Handle(ctx context.Context, conn net.Conn) error {
 				}
 
 				options := []event.Option{
-					services.EventOptions,
+					services.EventOptions(ctx),
 					event.Category("ssh"),
 					event.Type("ssh-request"),
 					event.SourceAddr(conn.RemoteAddr()),
 					event.DestinationAddr(conn.LocalAddr()),
-					event.Custom("ssh.sessionid", id.String()),
+					event.Custom("ssh.sessionid", id),
 					event.Custom("ssh.request-type", req.Type),
 					event.Custom("ssh.payload", req.Payload),
 				}
@@ -280,12 +279,12 @@ func (s *sshProxyService) Handle(ctx context.Context, conn net.Conn) error {
 		copyFn(channel, wrappedChannel2)
 
 		s.c.Send(event.New(
-			services.EventOptions,
+			services.EventOptions(ctx),
 			event.Category("ssh"),
 			event.Type("ssh-session"),
 			event.SourceAddr(conn.RemoteAddr()),
 			event.DestinationAddr(conn.LocalAddr()),
-			event.Custom("ssh.sessionid", id.String()),
+			event.Custom("ssh.sessionid", id),
 			event.Custom("ssh.recording", twrc.String()),
 		))
 
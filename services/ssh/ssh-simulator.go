@@ -47,7 +47,6 @@ import (
 	"bytes"
 
 	"github.com/honeytrap/honeytrap/scripter"
-	"github.com/rs/xid"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/terminal"
 )
@@ -123,6 +122,27 @@ func (s *sshSimulatorService) SetChannel(c pushers.Channel) {
 	s.c = c
 }
 
+// authenticate returns true if the username and password match one of the
+// credentials, "*" accepts all.
+func (s *sshSimulatorService) authenticate(username, password string) bool {
+	for _, credential := range s.Credentials {
+		if credential == "*" {
+			return true
+		}
+
+		parts := strings.Split(credential, ":")
+		if len(parts) != 2 {
+			continue
+		}
+
+		if username == parts[0] && password == parts[1] {
+			return true
+		}
+	}
+
+	return false
+}
+
 type payloadDecoder struct {
 	decoder.Decoder
 }
@@ -140,20 +160,20 @@ func PayloadDecoder(payload []byte) *payloadDecoder {
 }
 
 func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
-	scrConn := s.scr.GetConnection("ssh-simulator", conn)
-	id := xid.New()
+	scrConn := s.scr.GetConnection(ctx, "ssh-simulator", conn)
+	id := services.SessionID(ctx)
 
 	config := ssh.ServerConfig{
 		ServerVersion: s.Banner,
 		MaxAuthTries:  s.MaxAuthTries,
 		PublicKeyCallback: func(cm ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("publickey-authentication"),
 				event.SourceAddr(cm.RemoteAddr()),
 				event.DestinationAddr(cm.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.username", cm.User()),
 				event.Custom("ssh.publickey-type", key.Type()),
 				event.Custom("ssh.publickey", hex.EncodeToString(key.Marshal())),
@@ -162,31 +182,23 @@ func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
 			return nil, errors.New("Unknown key")
 		},
 		PasswordCallback: func(cm ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			authenticated := s.authenticate(cm.User(), string(password))
+
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("password-authentication"),
 				event.SourceAddr(cm.RemoteAddr()),
 				event.DestinationAddr(cm.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.username", cm.User()),
 				event.Custom("ssh.password", string(password)),
+				event.Custom("ssh.authenticated", authenticated),
 			))
 
-			for _, credential := range s.Credentials {
-				if credential == "*" {
-					return nil, nil
-				}
-
-				parts := strings.Split(credential, ":")
-				if len(parts) != 2 {
-					continue
-				}
-
-				if cm.User() == parts[0] && string(password) == parts[1] {
-					log.Debug("User authenticated successfully. user=%s password=%s", cm.User(), string(password))
-					return nil, nil
-				}
+			if authenticated {
+				log.Debug("User authenticated successfully. user=%s password=%s", cm.User(), string(password))
+				return nil, nil
 			}
 
 			return nil, fmt.Errorf("Password rejected for %q", cm.User())
@@ -220,12 +232,12 @@ func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
 			decoder := PayloadDecoder(newChannel.ExtraData())
 
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("ssh-channel"),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.channel-type", newChannel.ChannelType()),
 				event.Custom("ssh.forwarded-tcpip.address-that-was-connected", decoder.String()),
 				event.Custom("ssh.forwarded-tcpip.port-that-was-connected", fmt.Sprintf("%d", decoder.Uint32())),
@@ -240,12 +252,12 @@ func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
 			decoder := PayloadDecoder(newChannel.ExtraData())
 
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("ssh-channel"),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.channel-type", newChannel.ChannelType()),
 				event.Custom("ssh.direct-tcpip.host-to-connect", decoder.String()),
 				event.Custom("ssh.direct-tcpip.port-to-connect", fmt.Sprintf("%d", decoder.Uint32())),
@@ -258,12 +270,12 @@ func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
 			continue
 		default:
 			s.c.Send(event.New(
-				services.EventOptions,
+				services.EventOptions(ctx),
 				event.Category("ssh"),
 				event.Type("ssh-channel"),
 				event.SourceAddr(conn.RemoteAddr()),
 				event.DestinationAddr(conn.LocalAddr()),
-				event.Custom("ssh.sessionid", id.String()),
+				event.Custom("ssh.sessionid", id),
 				event.Custom("ssh.channel-type", newChannel.ChannelType()),
 				event.Payload(newChannel.ExtraData()),
 			))
@@ -286,12 +298,12 @@ func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
 				log.Debugf("Request: %s %s %s %s\n", channel, req.Type, req.WantReply, req.Payload)
 
 				options := []event.Option{
-					services.EventOptions,
+					services.EventOptions(ctx),
 					event.Category("ssh"),
 					event.Type("ssh-request"),
 					event.SourceAddr(conn.RemoteAddr()),
 					event.DestinationAddr(conn.LocalAddr()),
-					event.Custom("ssh.sessionid", id.String()),
+					event.Custom("ssh.sessionid", id),
 					event.Custom("ssh.request-type", req.Type),
 					event.Custom("ssh.payload", req.Payload),
 				}
@@ -402,12 +414,12 @@ func (s *sshSimulatorService) Handle(ctx context.Context, conn net.Conn) error {
 							}
 
 							s.c.Send(event.New(
-								services.EventOptions,
+								services.EventOptions(ctx),
 								event.Category("ssh"),
 								event.Type("ssh-channel"),
 								event.SourceAddr(conn.RemoteAddr()),
 								event.DestinationAddr(conn.LocalAddr()),
-								event.Custom("ssh.sessionid", id.String()),
+								event.Custom("ssh.sessionid", id),
 								event.Custom("ssh.command", line),
 								event.Custom("response", resp),
 							))
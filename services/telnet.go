@@ -40,7 +40,6 @@ import (
 
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
-	"github.com/rs/xid"
 )
 
 var (
@@ -81,7 +80,7 @@ func (s *telnetService) SetChannel(c pushers.Channel) {
 }
 
 func (s *telnetService) Handle(ctx context.Context, conn net.Conn) error {
-	id := xid.New()
+	id := SessionID(ctx)
 
 	defer conn.Close()
 
@@ -98,12 +97,12 @@ func (s *telnetService) Handle(ctx context.Context, conn net.Conn) error {
 		}
 
 		s.c.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("telnet"),
 			event.Type("session"),
 			event.SourceAddr(conn.RemoteAddr()),
 			event.DestinationAddr(conn.LocalAddr()),
-			event.Custom("telnet.sessionid", id.String()),
+			event.Custom("telnet.sessionid", id),
 			event.Custom("telnet.command", line),
 		))
 
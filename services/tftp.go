@@ -32,10 +32,13 @@ package services
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/hex"
 	"net"
+	"strings"
 
+	"github.com/honeytrap/honeytrap/artifact"
 	"github.com/honeytrap/honeytrap/event"
 	"github.com/honeytrap/honeytrap/pushers"
 )
@@ -64,6 +67,8 @@ type tftpFile struct {
 type tftpService struct {
 	ch pushers.Channel
 
+	artifacts *artifact.Store
+
 	limiter *Limiter
 
 	buffers map[string]*tftpFile
@@ -73,6 +78,10 @@ func (s *tftpService) SetChannel(c pushers.Channel) {
 	s.ch = c
 }
 
+func (s *tftpService) SetArtifacts(st *artifact.Store) {
+	s.artifacts = st
+}
+
 func (s *tftpService) Handle(ctx context.Context, conn net.Conn) error {
 	if conn.RemoteAddr().Network() == "udp" {
 		/* Selectively drop packets to prevent amplification attacks. This is a
@@ -112,7 +121,7 @@ func (s *tftpService) Handle(ctx context.Context, conn net.Conn) error {
 			return err
 		}
 		s.ch.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("tftp"),
 			event.Protocol(conn.RemoteAddr().Network()),
 			event.Type("tftp-read"),
@@ -150,7 +159,7 @@ func (s *tftpService) Handle(ctx context.Context, conn net.Conn) error {
 			return err
 		}
 		s.ch.Send(event.New(
-			EventOptions,
+			EventOptions(ctx),
 			event.Category("tftp"),
 			event.Protocol(conn.RemoteAddr().Network()),
 			event.Type("tftp-write"),
@@ -195,7 +204,7 @@ func (s *tftpService) Handle(ctx context.Context, conn net.Conn) error {
 			file := s.buffers[addr]
 			delete(s.buffers, addr)
 			s.ch.Send(event.New(
-				EventOptions,
+				EventOptions(ctx),
 				event.Category("tftp"),
 				event.Protocol(conn.RemoteAddr().Network()),
 				event.Type("tftp-write-file"),
@@ -206,6 +215,13 @@ func (s *tftpService) Handle(ctx context.Context, conn net.Conn) error {
 				event.Custom("tftp.file", file.content),
 				event.Custom("tftp.file-hex", hex.EncodeToString(file.content)),
 			))
+
+			if s.artifacts == nil {
+			} else if _, err := s.artifacts.Put(bytes.NewReader(file.content), artifact.NewSource(
+				ctx, "tftp", conn.RemoteAddr(), strings.TrimRight(file.filename, "\x00"),
+			)); err != nil {
+				log.Errorf("Error storing artifact: %s", err.Error())
+			}
 		}
 	case ACK:
 		/*
@@ -25,6 +25,7 @@ package vnc
 
 import (
 	"bufio"
+	"crypto/rand"
 	"encoding/binary"
 	"fmt"
 	"image"
@@ -38,6 +39,7 @@ const (
 	v8 = "RFB 003.008\n"
 
 	authNone = 1
+	authVNC  = 2
 
 	statusOK     = 0
 	statusFailed = 1
@@ -85,6 +87,9 @@ type LockableImage struct {
 type Conn struct {
 	serverName string
 
+	// auth requests VNC authentication, instead of none
+	auth bool
+
 	c      net.Conn
 	br     *bufio.Reader
 	bw     *bufio.Writer
@@ -181,21 +186,29 @@ func (c *Conn) serve() {
 	}
 
 	// Auth
+	authType := byte(authNone)
+	if c.auth {
+		authType = authVNC
+	}
+
 	if ver >= v7 {
-		// Just 1 auth type supported: 1 (no auth)
-		c.bw.WriteString("\x01\x01")
+		// Just 1 auth type supported: 1 (no auth) or 2 (vnc auth)
+		c.bw.WriteString("\x01")
+		c.bw.WriteByte(authType)
 		c.flush()
 		wanted := c.readByte("6.1.2:client requested security-type")
-		if wanted != authNone {
-			c.failf("client wanted auth type %d, not None", int(wanted))
+		if wanted != authType {
+			c.failf("client wanted auth type %d, not %d", int(wanted), int(authType))
 		}
 	} else {
-		// Old way. Just tell client we're doing no auth.
-		c.w(uint32(authNone))
+		// Old way. Just tell client the auth type.
+		c.w(uint32(authType))
 		c.flush()
 	}
 
-	if ver >= v8 {
+	if authType == authVNC {
+		c.authenticate()
+	} else if ver >= v8 {
 		// 6.1.3. SecurityResult
 		c.w(uint32(statusOK))
 		c.flush()
@@ -501,6 +514,36 @@ func (c *Conn) handleUpdateRequest() {
 }
 
 // 6.4.4
+// AuthEvent is the response of the client to the VNC authentication
+// challenge, the challenge encrypted with DES using the password as key.
+type AuthEvent struct {
+	Challenge []byte
+	Response  []byte
+}
+
+// 6.2.2, every response is accepted
+func (c *Conn) authenticate() {
+	challenge := make([]byte, 16)
+	if _, err := rand.Read(challenge); err != nil {
+		c.failf("generating challenge: %v", err)
+	}
+
+	c.bw.Write(challenge)
+	c.flush()
+
+	response := make([]byte, 16)
+	c.read("6.2.2:challenge response", response)
+
+	c.event <- AuthEvent{
+		Challenge: challenge,
+		Response:  response,
+	}
+
+	// 6.1.3. SecurityResult
+	c.w(uint32(statusOK))
+	c.flush()
+}
+
 type KeyEvent struct {
 	DownFlag uint8
 	Key      uint32
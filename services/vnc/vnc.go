@@ -32,6 +32,7 @@ package vnc
 
 import (
 	"context"
+	"encoding/hex"
 	"net"
 	"os"
 	"path/filepath"
@@ -91,6 +92,10 @@ type vncService struct {
 
 	ImagePath  string `toml:"image"`
 	ServerName string `toml:"server-name"`
+
+	// Auth requests VNC authentication, recording the challenge and
+	// response, and accepts every password.
+	Auth bool `toml:"auth"`
 }
 
 func (s *vncService) SetChannel(c pushers.Channel) {
@@ -104,6 +109,7 @@ func (s *vncService) Handle(ctx context.Context, conn net.Conn) error {
 
 	c := newConn(bounds.Dx(), bounds.Dy(), conn)
 	c.serverName = s.ServerName
+	c.auth = s.Auth
 
 	go c.serve()
 
@@ -143,10 +149,24 @@ func (s *vncService) Handle(ctx context.Context, conn net.Conn) error {
 	}()
 
 	for e := range c.Event {
-		_ = e
+		if ae, ok := e.(AuthEvent); ok {
+			s.c.Send(event.New(
+				services.EventOptions(ctx),
+				event.Service("vnc"),
+				event.Category("vnc"),
+				event.Type("password-authentication"),
+				event.SourceAddr(conn.RemoteAddr()),
+				event.DestinationAddr(conn.LocalAddr()),
+				event.Custom("vnc.challenge", hex.EncodeToString(ae.Challenge)),
+				event.Custom("vnc.response", hex.EncodeToString(ae.Response)),
+			))
+
+			continue
+		}
+
 		/*
 			s.c.Send(event.New(
-				EventOptions,
+				EventOptions(ctx),
 				event.Category("vnc"),
 				event.Type("vnc-event"),
 				event.SourceAddr(conn.RemoteAddr()),
@@ -0,0 +1,195 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package storage
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+// Formats supported by Export and Import.
+const (
+	FormatJSON = "json"
+	FormatTar  = "tar"
+)
+
+// backupVersion is the version of the json export format.
+const backupVersion = 1
+
+// Backup defines the portable json representation of the database. Values are
+// base64 encoded, keys stored before namespaces were enforced are contained in
+// the empty namespace.
+type Backup struct {
+	Version    int                          `json:"version"`
+	Date       time.Time                    `json:"date"`
+	Namespaces map[string]map[string][]byte `json:"namespaces"`
+}
+
+// Export writes the contents of the given namespaces, or of all namespaces
+// when none are given, in format to w.
+func Export(w io.Writer, format string, namespaces ...string) error {
+	if len(namespaces) == 0 {
+		var err error
+		if namespaces, err = Namespaces(); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case FormatJSON:
+		backup := Backup{
+			Version:    backupVersion,
+			Date:       time.Now(),
+			Namespaces: map[string]map[string][]byte{},
+		}
+
+		for _, namespace := range namespaces {
+			values := map[string][]byte{}
+
+			s, _ := Namespace(namespace)
+			if err := s.Range(func(key string, value []byte) error {
+				values[key] = value
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			backup.Namespaces[namespace] = values
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(backup)
+	case FormatTar:
+		tw := tar.NewWriter(w)
+
+		for _, namespace := range namespaces {
+			s, _ := Namespace(namespace)
+			if err := s.Range(func(key string, value []byte) error {
+				hdr := &tar.Header{
+					Name:    string(s.key(key)),
+					Mode:    0600,
+					Size:    int64(len(value)),
+					ModTime: time.Now(),
+				}
+
+				if err := tw.WriteHeader(hdr); err != nil {
+					return err
+				}
+
+				_, err := tw.Write(value)
+				return err
+			}); err != nil {
+				return err
+			}
+		}
+
+		return tw.Close()
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// Import restores the keys read in format from r, returning the number of keys
+// restored. Existing keys are only overwritten when overwrite is set.
+func Import(r io.Reader, format string, overwrite bool) (int, error) {
+	count := 0
+
+	set := func(key []byte, value []byte) error {
+		return db.Update(func(txn *badger.Txn) error {
+			if overwrite {
+			} else if _, err := txn.Get(key); err == nil {
+				return nil
+			} else if err != badger.ErrKeyNotFound {
+				return err
+			}
+
+			count++
+			return txn.Set(key, value)
+		})
+	}
+
+	switch format {
+	case FormatJSON:
+		backup := Backup{}
+		if err := json.NewDecoder(r).Decode(&backup); err != nil {
+			return count, err
+		}
+
+		if backup.Version != backupVersion {
+			return count, fmt.Errorf("unsupported backup version: %d", backup.Version)
+		}
+
+		for namespace, values := range backup.Namespaces {
+			s, _ := Namespace(namespace)
+
+			for key, value := range values {
+				if err := set(s.key(key), value); err != nil {
+					return count, err
+				}
+			}
+		}
+
+		return count, nil
+	case FormatTar:
+		tr := tar.NewReader(r)
+
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return count, nil
+			} else if err != nil {
+				return count, err
+			}
+
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+
+			value, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return count, err
+			}
+
+			if err := set([]byte(hdr.Name), value); err != nil {
+				return count, err
+			}
+		}
+	default:
+		return count, fmt.Errorf("unsupported format: %s", format)
+	}
+}
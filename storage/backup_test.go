@@ -0,0 +1,205 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+)
+
+func openTemp(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "honeytrap-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Open(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatTar} {
+		cleanup := openTemp(t)
+
+		s, _ := Namespace("ssh")
+		if err := s.Set("private-key", []byte("secret")); err != nil {
+			t.Fatal(err)
+		}
+
+		s, _ = Namespace("ftp")
+		if err := s.Set("pemkey", []byte{0x00, 0xff}); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := Export(buf, format, "ssh"); err != nil {
+			t.Fatal(err)
+		}
+
+		cleanup()
+
+		cleanup = openTemp(t)
+
+		if n, err := Import(bytes.NewReader(buf.Bytes()), format, true); err != nil {
+			t.Fatal(err)
+		} else if n != 1 {
+			t.Errorf("%s: expected 1 key imported, got %d", format, n)
+		}
+
+		s, _ = Namespace("ssh")
+		if v, err := s.Get("private-key"); err != nil {
+			t.Errorf("%s: %s", format, err)
+		} else if string(v) != "secret" {
+			t.Errorf("%s: expected secret, got %q", format, v)
+		}
+
+		if namespaces, err := Namespaces(); err != nil {
+			t.Error(err)
+		} else if len(namespaces) != 1 || namespaces[0] != "ssh" {
+			t.Errorf("%s: expected only namespace ssh, got %v", format, namespaces)
+		}
+
+		cleanup()
+	}
+}
+
+func TestImportKeepsExisting(t *testing.T) {
+	cleanup := openTemp(t)
+	defer cleanup()
+
+	s, _ := Namespace("ssh")
+	s.Set("private-key", []byte("current"))
+
+	buf := new(bytes.Buffer)
+	if err := Export(buf, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Set("private-key", []byte("newer"))
+
+	if n, err := Import(buf, FormatJSON, false); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Errorf("expected no keys imported, got %d", n)
+	}
+
+	if v, _ := s.Get("private-key"); string(v) != "newer" {
+		t.Errorf("expected existing value to be kept, got %q", v)
+	}
+}
+
+func TestLegacyKeys(t *testing.T) {
+	cleanup := openTemp(t)
+	defer cleanup()
+
+	legacy, _ := Namespace("")
+	legacy.Set("private-key", []byte("legacy"))
+
+	s, _ := Namespace("ssh")
+	if v, err := s.Get("private-key"); err != nil {
+		t.Fatal(err)
+	} else if string(v) != "legacy" {
+		t.Errorf("expected legacy value, got %q", v)
+	}
+}
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "honeytrap-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	// a database written before namespaces were enforced
+	dataDir = dir
+
+	d, err := badger.Open(func() badger.Options {
+		opts := badger.DefaultOptions
+		opts.Dir = filepath.Join(dir, "badger.db")
+		opts.ValueDir = opts.Dir
+		return opts
+	}())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Update(func(txn *badger.Txn) error {
+		txn.Set([]byte("private-key"), []byte("legacy"))
+		txn.Set([]byte("pemkey"), []byte("pem"))
+		return txn.Set([]byte("unknown"), []byte("value"))
+	})
+
+	d.Close()
+
+	if err := Open(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	defer Close()
+
+	values := map[string]string{}
+
+	s, _ := Namespace("ssh")
+	s.Range(func(key string, value []byte) error {
+		values[key] = string(value)
+		return nil
+	})
+
+	if values["private-key"] != "legacy" {
+		t.Errorf("expected legacy private-key within namespace ssh, got %v", values)
+	}
+
+	for _, namespace := range []string{"ftp", "smtp"} {
+		s, _ := Namespace(namespace)
+		if v, err := s.Get("pemkey"); err != nil || string(v) != "pem" {
+			t.Errorf("%s: expected legacy pemkey, got %q (%v)", namespace, v, err)
+		}
+	}
+
+	if namespaces, err := Namespaces(); err != nil {
+		t.Error(err)
+	} else if strings.Join(namespaces, ",") != ",ftp,smtp,ssh" {
+		t.Errorf("expected unknown legacy keys to stay in the empty namespace, got %v", namespaces)
+	}
+}
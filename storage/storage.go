@@ -31,8 +31,10 @@
 package storage
 
 import (
+	"bytes"
 	"log"
 	"path/filepath"
+	"sort"
 
 	"github.com/dgraph-io/badger"
 )
@@ -42,6 +44,9 @@ type storage interface {
 	Set(string, []byte) error
 }
 
+// separator divides the namespace from the key within the database.
+const separator = "/"
+
 var db *badger.DB
 var dataDir string
 
@@ -50,7 +55,41 @@ func SetDataDir(s string) {
 	db = MustDB()
 }
 
+// Open opens the database within the data directory s, returning an error
+// instead of exiting when the database can not be opened (eg. because it is
+// locked by a running honeytrap).
+func Open(s string) error {
+	dataDir = s
+
+	d, err := open()
+	if err != nil {
+		return err
+	}
+
+	db = d
+	return nil
+}
+
+// Close closes the database.
+func Close() error {
+	if db == nil {
+		return nil
+	}
+
+	return db.Close()
+}
+
 func MustDB() *badger.DB {
+	db, err := open()
+	if err != nil {
+		log.Fatal(err)
+		return nil
+	}
+
+	return db
+}
+
+func open() (*badger.DB, error) {
 	opts := badger.DefaultOptions
 
 	p := filepath.Join(dataDir, "badger.db")
@@ -61,13 +100,69 @@ func MustDB() *badger.DB {
 		fn(&opts)
 	}
 
-	db, err := badger.Open(opts)
+	d, err := badger.Open(opts)
 	if err != nil {
-		log.Fatal(err)
-		return nil
+		return nil, err
 	}
 
-	return db
+	if err := migrate(d); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// legacyKeys are the keys stored without namespace before namespaces were
+// enforced, with the namespaces that read them.
+var legacyKeys = map[string][]string{
+	"private-key": {"ssh"},
+	"base":        {"ftp"},
+	"fs_root":     {"ftp"},
+	"pemkey":      {"ftp", "smtp"},
+	"pemcert":     {"ftp", "smtp"},
+	"key":         {"agent"},
+}
+
+// migrate moves the legacy keys into their namespaces, so they are listed
+// and exported with the namespace. Values already stored within the
+// namespace take precedence.
+func migrate(d *badger.DB) error {
+	return d.Update(func(txn *badger.Txn) error {
+		for key, namespaces := range legacyKeys {
+			item, err := txn.Get([]byte(key))
+			if err == badger.ErrKeyNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			for _, namespace := range namespaces {
+				k := []byte(namespace + separator + key)
+
+				if _, err := txn.Get(k); err == nil {
+					continue
+				} else if err != badger.ErrKeyNotFound {
+					return err
+				}
+
+				if err := txn.Set(k, v); err != nil {
+					return err
+				}
+			}
+
+			if err := txn.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 type Storage interface {
@@ -77,24 +172,79 @@ type Storage interface {
 
 func Namespace(namespace string) (*badgeStorage, error) {
 	return &badgeStorage{
-		db: db,
+		db:        db,
+		namespace: namespace,
 	}, nil
 }
 
+// Namespaces returns the sorted names of all namespaces containing keys. Legacy
+// keys that could not be migrated are reported in the empty namespace.
+func Namespaces() ([]string, error) {
+	seen := map[string]bool{}
+
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			namespace, _ := splitKey(it.Item().Key())
+			seen[namespace] = true
+		}
+
+		return nil
+	})
+
+	namespaces := []string{}
+	for namespace := range seen {
+		namespaces = append(namespaces, namespace)
+	}
+
+	sort.Strings(namespaces)
+	return namespaces, err
+}
+
+func splitKey(k []byte) (string, string) {
+	parts := bytes.SplitN(k, []byte(separator), 2)
+	if len(parts) == 1 {
+		return "", string(parts[0])
+	}
+
+	return string(parts[0]), string(parts[1])
+}
+
 type badgeStorage struct {
 	db *badger.DB
+
+	namespace string
+}
+
+func (s *badgeStorage) key(key string) []byte {
+	if s.namespace == "" {
+		return []byte(key)
+	}
+
+	return []byte(s.namespace + separator + key)
 }
 
 func (s *badgeStorage) Get(key string) ([]byte, error) {
 	val := []byte{}
 
 	err := s.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(key))
+		item, err := txn.Get(s.key(key))
+		if err == badger.ErrKeyNotFound {
+			// values persisted before namespaces were enforced
+			// are stored without prefix.
+			item, err = txn.Get([]byte(key))
+		}
+
 		if err != nil {
 			return err
 		}
 
-		v, err := item.Value()
+		v, err := item.ValueCopy(nil)
 		if err != nil {
 			return err
 		}
@@ -108,7 +258,42 @@ func (s *badgeStorage) Get(key string) ([]byte, error) {
 
 func (s *badgeStorage) Set(key string, data []byte) error {
 	return s.db.Update(func(txn *badger.Txn) error {
-		err := txn.Set([]byte(key), data)
+		err := txn.Set(s.key(key), data)
 		return err
 	})
 }
+
+// Delete removes the key from the namespace.
+func (s *badgeStorage) Delete(key string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(s.key(key))
+	})
+}
+
+// Range calls fn for every key and value within the namespace, in key order.
+func (s *badgeStorage) Range(fn func(key string, value []byte) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+
+			namespace, key := splitKey(item.Key())
+			if namespace != s.namespace {
+				continue
+			}
+
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			if err := fn(key, v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
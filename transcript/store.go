@@ -0,0 +1,434 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package transcript
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/honeytrap/honeytrap/config"
+	logging "github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("honeytrap:transcript")
+
+// DefaultMaxSize is the default size of a transcript segment, before the
+// transcript continues in a next segment.
+const DefaultMaxSize = 10 * 1024 * 1024
+
+// DefaultQuota is the default maximum size of all transcripts together.
+const DefaultQuota = 1024 * 1024 * 1024
+
+// ErrQuotaExceeded is returned when recording would exceed the quota.
+var ErrQuotaExceeded = errors.New("transcript quota exceeded")
+
+const ext = ".trn"
+
+var validSession = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Store stores the transcripts of sessions within a directory, a session is
+// stored in one or more segments named <session>.trn, <session>.1.trn, etc.
+// Recording stops once the transcripts together use Quota bytes, segments
+// older than MaxAge are removed by Prune.
+type Store struct {
+	Enabled bool         `toml:"enabled"`
+	Path    string       `toml:"path"`
+	MaxSize int64        `toml:"max_size"`
+	Quota   int64        `toml:"quota"`
+	MaxAge  config.Delay `toml:"max_age"`
+
+	dataDir string
+
+	m        sync.Mutex
+	used     int64
+	exceeded bool
+}
+
+// New returns a Store, configured by options.
+func New(options ...func(*Store) error) (*Store, error) {
+	s := &Store{
+		Path:    "transcripts",
+		MaxSize: DefaultMaxSize,
+		Quota:   DefaultQuota,
+	}
+
+	for _, optionFn := range options {
+		if err := optionFn(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.MaxSize <= 0 {
+		return nil, fmt.Errorf("invalid max_size %d", s.MaxSize)
+	}
+
+	if s.Quota < 0 {
+		return nil, fmt.Errorf("invalid quota %d", s.Quota)
+	}
+
+	if s.MaxAge < 0 {
+		return nil, fmt.Errorf("invalid max_age %s", s.MaxAge.Duration())
+	}
+
+	return s, nil
+}
+
+// WithConfig decodes the transcript configuration.
+func WithConfig(c toml.Primitive) func(*Store) error {
+	return func(s *Store) error {
+		return toml.PrimitiveDecode(c, s)
+	}
+}
+
+// WithDataDir sets the directory relative paths are resolved against.
+func WithDataDir(dataDir string) func(*Store) error {
+	return func(s *Store) error {
+		s.dataDir = dataDir
+		return nil
+	}
+}
+
+// WithPath sets the directory transcripts are stored in.
+func WithPath(path string) func(*Store) error {
+	return func(s *Store) error {
+		s.Path = path
+		return nil
+	}
+}
+
+// Dir returns the directory transcripts are stored in.
+func (s *Store) Dir() string {
+	if filepath.IsAbs(s.Path) {
+		return s.Path
+	}
+
+	return filepath.Join(s.dataDir, s.Path)
+}
+
+func (s *Store) segment(session string, n int) string {
+	if n == 0 {
+		return filepath.Join(s.Dir(), session+ext)
+	}
+
+	return filepath.Join(s.Dir(), fmt.Sprintf("%s.%d%s", session, n, ext))
+}
+
+// Prune removes the segments older than MaxAge, when set, and recounts the
+// size of all transcripts.
+func (s *Store) Prune() error {
+	files, err := filepath.Glob(filepath.Join(s.Dir(), "*"+ext))
+	if err != nil {
+		return err
+	}
+
+	used := int64(0)
+
+	for _, name := range files {
+		fi, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if s.MaxAge > 0 && time.Since(fi.ModTime()) > s.MaxAge.Duration() {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			continue
+		}
+
+		used += fi.Size()
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.used = used
+
+	if s.exceeded && (s.Quota == 0 || used < s.Quota) {
+		log.Infof("Transcripts below quota, recording resumed")
+		s.exceeded = false
+	}
+
+	return nil
+}
+
+// Used returns the size of all transcripts.
+func (s *Store) Used() int64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.used
+}
+
+// reserve returns ErrQuotaExceeded when the transcripts exceed the quota,
+// logging once until the usage drops below the quota again.
+func (s *Store) reserve() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.Quota == 0 || s.used < s.Quota {
+		return nil
+	}
+
+	if !s.exceeded {
+		log.Errorf("Transcript quota of %d bytes exceeded, not recording transcripts", s.Quota)
+		s.exceeded = true
+	}
+
+	return ErrQuotaExceeded
+}
+
+func (s *Store) add(n int64) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.used += n
+}
+
+// Sessions returns the ids of all recorded sessions.
+func (s *Store) Sessions() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir(), "*"+ext))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []string{}
+	for _, name := range files {
+		session := strings.TrimSuffix(filepath.Base(name), ext)
+		if !validSession.MatchString(session) {
+			// continued segment
+			continue
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	sort.Strings(sessions)
+	return sessions, nil
+}
+
+// Records calls fn for every record of session, in order.
+func (s *Store) Records(session string, fn func(Record) error) error {
+	if !validSession.MatchString(session) {
+		return fmt.Errorf("invalid session id %q", session)
+	}
+
+	for n := 0; ; n++ {
+		f, err := os.Open(s.segment(session, n))
+		if os.IsNotExist(err) && n > 0 {
+			return nil
+		} else if os.IsNotExist(err) {
+			return fmt.Errorf("no transcript for session %s", session)
+		} else if err != nil {
+			return err
+		}
+
+		err = readRecords(f, fn)
+		f.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func readRecords(r io.Reader, fn func(Record) error) error {
+	tr, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	for {
+		record, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// Conn returns conn, recording all data read and written to the transcript
+// of session. Recording stops at the first error, the connection itself is
+// never affected.
+func (s *Store) Conn(session string, conn net.Conn) net.Conn {
+	if !validSession.MatchString(session) {
+		log.Errorf("Not recording transcript for invalid session id %q", session)
+		return conn
+	}
+
+	if err := os.MkdirAll(s.Dir(), 0750); err != nil {
+		log.Errorf("Error creating transcript directory: %s", err.Error())
+		return conn
+	}
+
+	return &recordingConn{
+		Conn:    conn,
+		store:   s,
+		session: session,
+	}
+}
+
+type recordingConn struct {
+	net.Conn
+
+	store   *Store
+	session string
+
+	m       sync.Mutex
+	segment int
+	f       *os.File
+	w       *Writer
+	failed  bool
+}
+
+func (c *recordingConn) record(d Direction, data []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.failed {
+		return
+	}
+
+	if err := c.write(d, data); err == ErrQuotaExceeded {
+		// logged by the store
+		c.failed = true
+		c.close()
+	} else if err != nil {
+		log.Errorf("Error recording transcript of session %s: %s", c.session, err.Error())
+
+		c.failed = true
+		c.close()
+	}
+}
+
+func (c *recordingConn) write(d Direction, data []byte) error {
+	if err := c.store.reserve(); err != nil {
+		return err
+	}
+
+	if c.w != nil && c.w.Size() >= c.store.MaxSize {
+		c.close()
+		c.segment++
+	}
+
+	if c.w == nil {
+		f, err := os.OpenFile(c.store.segment(c.session, c.segment), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+		if err != nil {
+			return err
+		}
+
+		w, err := NewWriter(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+
+		c.f, c.w = f, w
+		c.store.add(w.Size())
+	}
+
+	for len(data) > 0 {
+		size := c.w.Size()
+
+		n := len(data)
+		if n > MaxRecordSize {
+			n = MaxRecordSize
+		}
+
+		err := c.w.Write(Record{
+			Time:      time.Now(),
+			Direction: d,
+			Data:      data[:n],
+		})
+
+		c.store.add(c.w.Size() - size)
+
+		if err != nil {
+			return err
+		}
+
+		data = data[n:]
+	}
+
+	return nil
+}
+
+func (c *recordingConn) close() {
+	if c.f == nil {
+		return
+	}
+
+	c.f.Close()
+	c.f, c.w = nil, nil
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.record(In, b[:n])
+	}
+	return n, err
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.record(Out, b[:n])
+	}
+	return n, err
+}
+
+func (c *recordingConn) Close() error {
+	c.m.Lock()
+	c.close()
+	c.failed = true
+	c.m.Unlock()
+
+	return c.Conn.Close()
+}
@@ -0,0 +1,180 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+
+// Package transcript records the raw, timestamped data flowing in both
+// directions of connections.
+//
+// A transcript is a sequence of length-prefixed records, stored per session:
+//
+//	magic   "HTTR" version(1)
+//	record  direction(1) time(8, unix nano) length(4) data(length)
+//
+// All integers are big endian.
+package transcript
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	magic   = "HTTR"
+	version = 1
+
+	recordHeaderSize = 1 + 8 + 4
+)
+
+// MaxRecordSize is the maximum size of the data of a single record.
+const MaxRecordSize = 1 << 24
+
+// ErrInvalid is returned when reading data that isn't a transcript.
+var ErrInvalid = errors.New("invalid transcript")
+
+// Direction defines the direction of the data within a record.
+type Direction byte
+
+const (
+	// In is data received from the remote peer.
+	In Direction = 'i'
+	// Out is data sent to the remote peer.
+	Out Direction = 'o'
+)
+
+func (d Direction) String() string {
+	switch d {
+	case In:
+		return "in"
+	case Out:
+		return "out"
+	default:
+		return fmt.Sprintf("Direction(%d)", byte(d))
+	}
+}
+
+// Record defines a chunk of data read from or written to a connection.
+type Record struct {
+	Time      time.Time
+	Direction Direction
+	Data      []byte
+}
+
+// Writer writes records to an underlying writer.
+type Writer struct {
+	w io.Writer
+	n int64
+}
+
+// NewWriter returns a Writer, after writing the transcript header to w.
+func NewWriter(w io.Writer) (*Writer, error) {
+	n, err := w.Write(append([]byte(magic), version))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{w: w, n: int64(n)}, nil
+}
+
+// Write writes record r.
+func (w *Writer) Write(r Record) error {
+	if len(r.Data) > MaxRecordSize {
+		return fmt.Errorf("record of %d bytes exceeds maximum size", len(r.Data))
+	}
+
+	buf := make([]byte, recordHeaderSize+len(r.Data))
+	buf[0] = byte(r.Direction)
+	binary.BigEndian.PutUint64(buf[1:], uint64(r.Time.UnixNano()))
+	binary.BigEndian.PutUint32(buf[9:], uint32(len(r.Data)))
+	copy(buf[recordHeaderSize:], r.Data)
+
+	n, err := w.w.Write(buf)
+	w.n += int64(n)
+	return err
+}
+
+// Size returns the number of bytes written.
+func (w *Writer) Size() int64 {
+	return w.n
+}
+
+// Reader reads records from an underlying reader.
+type Reader struct {
+	r *bufio.Reader
+}
+
+// NewReader returns a Reader, after validating the transcript header of r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrInvalid
+	}
+
+	if string(header[:len(magic)]) != magic {
+		return nil, ErrInvalid
+	}
+
+	if header[len(magic)] != version {
+		return nil, fmt.Errorf("unsupported transcript version %d", header[len(magic)])
+	}
+
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next record, or io.EOF at the end of the transcript.
+func (r *Reader) Next() (Record, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r.r, header); err == io.EOF {
+		return Record{}, io.EOF
+	} else if err != nil {
+		return Record{}, io.ErrUnexpectedEOF
+	}
+
+	size := binary.BigEndian.Uint32(header[9:])
+	if size > MaxRecordSize {
+		return Record{}, ErrInvalid
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return Record{}, io.ErrUnexpectedEOF
+	}
+
+	return Record{
+		Direction: Direction(header[0]),
+		Time:      time.Unix(0, int64(binary.BigEndian.Uint64(header[1:]))).UTC(),
+		Data:      data,
+	}, nil
+}
@@ -0,0 +1,247 @@
+/*
+* Honeytrap
+* Copyright (C) 2016-2017 DutchSec (https://dutchsec.com/)
+*
+* This program is free software; you can redistribute it and/or modify it under
+* the terms of the GNU Affero General Public License version 3 as published by the
+* Free Software Foundation.
+*
+* This program is distributed in the hope that it will be useful, but WITHOUT
+* ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+* FOR A PARTICULAR PURPOSE.  See the GNU Affero General Public License for more
+* details.
+*
+* You should have received a copy of the GNU Affero General Public License
+* version 3 along with this program in the file "LICENSE".  If not, see
+* <http://www.gnu.org/licenses/agpl-3.0.txt>.
+*
+* See https://honeytrap.io/ for more details. All requests should be sent to
+* licensing@honeytrap.io
+*
+* The interactive user interfaces in modified source and object code versions
+* of this program must display Appropriate Legal Notices, as required under
+* Section 5 of the GNU Affero General Public License version 3.
+*
+* In accordance with Section 7(b) of the GNU Affero General Public License version 3,
+* these Appropriate Legal Notices must retain the display of the "Powered by
+* Honeytrap" logo and retain the original copyright notice. If the display of the
+* logo is not reasonably feasible for technical reasons, the Appropriate Legal Notices
+* must display the words "Powered by Honeytrap" and retain the original copyright notice.
+ */
+package transcript
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/honeytrap/honeytrap/config"
+)
+
+func TestStoreConn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	s, err := New(WithPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate after every record
+	s.MaxSize = 1
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	conn := s.Conn("b9r5ef2tjkgg00e1uu8g", server)
+
+	go func() {
+		client.Write([]byte("hello"))
+
+		buf := make([]byte, 5)
+		client.Read(buf)
+
+		client.Write([]byte("bye"))
+	}()
+
+	buf := make([]byte, 5)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Write([]byte("world"))
+
+	if _, err := conn.Read(buf[:3]); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "b9r5ef2tjkgg00e1uu8g.2"+ext)); err != nil {
+		t.Errorf("Test failed: expected rotated segment: %s", err)
+	}
+
+	sessions, err := s.Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(sessions, []string{"b9r5ef2tjkgg00e1uu8g"}) {
+		t.Errorf("Test failed: got %+#v, expected %+#v", sessions, []string{"b9r5ef2tjkgg00e1uu8g"})
+	}
+
+	expected := []Record{
+		{Direction: In, Data: []byte("hello")},
+		{Direction: Out, Data: []byte("world")},
+		{Direction: In, Data: []byte("bye")},
+	}
+
+	records := []Record{}
+	if err := s.Records("b9r5ef2tjkgg00e1uu8g", func(r Record) error {
+		if r.Time.IsZero() {
+			t.Errorf("Test failed: record without time")
+		}
+
+		records = append(records, r)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != len(expected) {
+		t.Fatalf("Test failed: got %d records, expected %d", len(records), len(expected))
+	}
+
+	for i := range expected {
+		if records[i].Direction != expected[i].Direction || !bytes.Equal(records[i].Data, expected[i].Data) {
+			t.Errorf("Test failed: got %s %q, expected %s %q", records[i].Direction, records[i].Data, expected[i].Direction, expected[i].Data)
+		}
+	}
+}
+
+func TestStoreInvalidSession(t *testing.T) {
+	s, err := New(WithPath(os.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Records("../etc/passwd", func(Record) error { return nil }); err == nil {
+		t.Errorf("Test failed: expected error for invalid session id")
+	}
+}
+
+func TestReaderInvalid(t *testing.T) {
+	if _, err := NewReader(bytes.NewBufferString("GET / HTTP/1.1")); err != ErrInvalid {
+		t.Errorf("Test failed: got %v, expected %v", err, ErrInvalid)
+	}
+}
+
+func TestStoreQuota(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	s, err := New(WithPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Quota = 64
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	conn := s.Conn("b9r5ef2tjkgg00e1uu8g", server)
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			if _, err := client.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		if _, err := conn.Write(bytes.Repeat([]byte("A"), 32)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn.Close()
+
+	used := s.Used()
+	if used < s.Quota || used > 2*s.Quota {
+		t.Errorf("Test failed: expected recording to stop at the quota, used %d bytes", used)
+	}
+
+	// recounting finds the same usage
+	if err := s.Prune(); err != nil {
+		t.Fatal(err)
+	} else if s.Used() != used {
+		t.Errorf("Test failed: got %d bytes after prune, expected %d", s.Used(), used)
+	}
+
+	other, peer := net.Pipe()
+	defer peer.Close()
+
+	go peer.Read(make([]byte, 5))
+
+	conn = s.Conn("b9r5ef2tjkgg00e1uu90", other)
+	conn.Write([]byte("hello"))
+	conn.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "b9r5ef2tjkgg00e1uu90"+ext)); !os.IsNotExist(err) {
+		t.Errorf("Test failed: expected no transcript over quota")
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	s, err := New(WithPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.MaxAge = config.Delay(time.Hour)
+
+	for _, name := range []string{"old", "new"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name+ext), []byte("transcript"), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "old"+ext), old, old)
+
+	if err := s.Prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, _ := s.Sessions()
+	if !reflect.DeepEqual(sessions, []string{"new"}) {
+		t.Errorf("Test failed: got %+#v, expected %+#v", sessions, []string{"new"})
+	}
+
+	if s.Used() != int64(len("transcript")) {
+		t.Errorf("Test failed: got %d bytes used, expected %d", s.Used(), len("transcript"))
+	}
+}
@@ -31,6 +31,7 @@
 package web
 
 import (
+	"net/http"
 	"os"
 	"path/filepath"
 
@@ -59,6 +60,14 @@ func WithDataDir(dataDir string) func(*web) error {
 	}
 }
 
+// WithHandler adds the handler for the pattern, eg. of an api.
+func WithHandler(pattern string, h http.Handler) func(*web) error {
+	return func(w *web) error {
+		w.handlers[pattern] = h
+		return nil
+	}
+}
+
 func WithConfig(c toml.Primitive) func(*web) error {
 	return func(d *web) error {
 		err := toml.PrimitiveDecode(c, d)
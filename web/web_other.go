@@ -31,65 +31,26 @@
 package web
 
 import (
-	"compress/gzip"
 	"encoding/json"
-	"io"
-	"net"
 	"net/http"
-	"os"
-	"path"
 	"time"
 
 	"github.com/honeytrap/honeytrap/cmd"
 	"github.com/honeytrap/honeytrap/config"
 	"github.com/honeytrap/honeytrap/event"
+	"github.com/honeytrap/honeytrap/metrics"
 	"github.com/honeytrap/honeytrap/pushers/eventbus"
 
 	assetfs "github.com/elazarl/go-bindata-assetfs"
 	"github.com/gorilla/websocket"
 	assets "github.com/honeytrap/honeytrap-web"
 	logging "github.com/op/go-logging"
-	maxminddb "github.com/oschwald/maxminddb-golang"
 )
 
 var log = logging.MustGetLogger("web")
 
 func AcceptAllOrigins(r *http.Request) bool { return true }
 
-func download(url string, dest string) error {
-	client := &http.Client{}
-
-	req, err := http.NewRequest("GET", geoLiteURL, nil)
-	if err != nil {
-		return err
-	}
-
-	var resp *http.Response
-	if resp, err = client.Do(req); err != nil {
-		return err
-	}
-
-	defer resp.Body.Close()
-
-	gzf, err := gzip.NewReader(resp.Body)
-	if err != nil {
-		return err
-	}
-	defer gzf.Close()
-
-	f, err := os.Create(dest)
-	if err != nil {
-		return err
-	}
-
-	defer f.Close()
-
-	_, err = io.Copy(f, gzf)
-	return err
-}
-
-const geoLiteURL = "http://geolite.maxmind.com/download/geoip/database/GeoLite2-City.mmdb.gz"
-
 type web struct {
 	config *config.Config
 
@@ -118,6 +79,9 @@ type web struct {
 	events       *SafeArray
 
 	handleRequest func(message []byte) ([]byte, error)
+
+	// handlers are the additional handlers, by pattern
+	handlers map[string]http.Handler
 }
 
 func New(options ...func(*web) error) (*web, error) {
@@ -140,6 +104,8 @@ func New(options ...func(*web) error) (*web, error) {
 
 		hotCountries: NewSafeArray(),
 		events:       NewLimitedSafeArray(1000),
+
+		handlers: map[string]http.Handler{},
 	}
 
 	for _, optionFn := range options {
@@ -160,7 +126,8 @@ var upgrader = websocket.Upgrader{
 }
 
 func (web *web) SetEventBus(eb *eventbus.EventBus) {
-	eb.Subscribe(web)
+	// the web interface is best effort, never hold up the bus for it
+	eb.Subscribe(web, eventbus.WithName("web"), eventbus.WithOverflow(eventbus.DropNewest))
 }
 
 func (web *web) Start() {
@@ -183,6 +150,12 @@ func (web *web) Start() {
 	})
 
 	handler.HandleFunc("/ws", web.ServeWS)
+	handler.Handle("/metrics", metrics.Handler())
+
+	for pattern, h := range web.handlers {
+		handler.Handle(pattern, h)
+	}
+
 	handler.Handle("/", sh)
 
 	eventCh := make(chan event.Event)
@@ -226,7 +199,7 @@ func (web *web) Start() {
 		}
 	}(eventCh)
 
-	eventCh = resolver(web.dataDir, eventCh)
+	// the country of the source is added by the geoip enricher
 	eventCh = filter(eventCh)
 
 	web.eventCh = eventCh
@@ -295,59 +268,6 @@ func filter(outCh chan event.Event) chan event.Event {
 	return ch
 }
 
-func resolver(dataDir string, outCh chan event.Event) chan event.Event {
-	dbPath := path.Join(dataDir, "GeoLite2-Country.mmdb")
-
-	_, err := os.Stat(dbPath)
-	if os.IsNotExist(err) {
-		err = download(geoLiteURL, dbPath)
-		if err != nil {
-			log.Fatal(err)
-			return outCh
-		}
-	}
-
-	ch := make(chan event.Event)
-	go func() {
-		db, err := maxminddb.Open(dbPath)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		defer db.Close()
-
-		for {
-			evt := <-ch
-
-			v := evt.Get("source-ip")
-			if v == "" {
-				outCh <- evt
-				continue
-			}
-
-			ip := net.ParseIP(v)
-
-			var record struct {
-				Country struct {
-					ISOCode string `maxminddb:"iso_code"`
-				} `maxminddb:"country"`
-			}
-
-			if err = db.Lookup(ip, &record); err != nil {
-				log.Error("Error looking up country for: %s", err.Error())
-
-				outCh <- evt
-				continue
-			}
-
-			evt.Store("source.country.isocode", record.Country.ISOCode)
-			outCh <- evt
-		}
-	}()
-
-	return ch
-}
-
 func (web *web) Send(evt event.Event) {
 	web.eventCh <- evt
 }